@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/scheduler"
+)
+
+// ListJobs returns the background jobs with their schedule and last run
+func ListJobs(c *gin.Context) {
+	jobs, err := scheduler.Default().Jobs(c.Request.Context())
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to list jobs", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// JobRuns returns the last runs of a job, 20 unless the limit query param
+// asks for up to 100
+func JobRuns(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		errorhandler.ReturnError(c, nil, "limit must be between 1 and 100", http.StatusBadRequest)
+		return
+	}
+
+	runs, err := scheduler.Default().Runs(c.Request.Context(), c.Param("name"), limit)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to list job runs", jobStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// PauseJob stops the scheduled runs of a job on every replica
+func PauseJob(c *gin.Context) {
+	setPaused(c, true)
+}
+
+// ResumeJob restarts the scheduled runs of a paused job
+func ResumeJob(c *gin.Context) {
+	setPaused(c, false)
+}
+
+func setPaused(c *gin.Context, paused bool) {
+	name := c.Param("name")
+	if err := scheduler.Default().SetPaused(c.Request.Context(), name, paused); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to update job", jobStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"name": name, "paused": paused})
+}
+
+// RunJob runs a job now, even when it is paused, and returns the run
+func RunJob(c *gin.Context) {
+	run, err := scheduler.Default().RunNow(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to run job", jobStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+func jobStatus(err error) int {
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		return http.StatusNotFound
+	case errors.Is(err, scheduler.ErrJobBusy):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
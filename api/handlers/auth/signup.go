@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/logger"
 	"github.com/umairmaseed/clausia-api/api/handlers/certs"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
 	"github.com/umairmaseed/clausia-api/chaincode"
 	"github.com/umairmaseed/clausia-api/utils"
 
@@ -66,10 +67,16 @@ func (a *Auth) SignUp(c *gin.Context) {
 		return
 	}
 
-	_, err = chaincode.CreateSignerTransaction(cpf, email, form.Name, phone, username)
+	_, err = chaincode.CreateSignerTransaction(c.Request.Context(), chaincode.User{
+		CPF:      cpf,
+		Email:    email,
+		Name:     form.Name,
+		Phone:    phone,
+		UserName: username,
+	})
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
 
@@ -81,7 +88,7 @@ func (a *Auth) SignUp(c *gin.Context) {
 	}
 
 	certName := username + "_cert.pfx"
-	_, err = utils.UploadCertToS3(cert, certName)
+	_, err = utils.UploadCert(c.Request.Context(), cert, certName)
 	if err != nil {
 		logger.Error(err)
 		c.JSON(http.StatusInternalServerError, err.Error())
@@ -41,9 +41,9 @@ func (a *Auth) UpdateEmailOrPhone(c *gin.Context) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
-		errorhandler.ReturnError(c, err, err.Error(), http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, err.Error(), errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -88,14 +88,9 @@ func (a *Auth) UpdateEmailOrPhone(c *gin.Context) {
 		updatesMap["phone"] = form.Phone
 	}
 
-	signerMap := map[string]interface{}{
-		"@assetType": "user",
-		"@key":       signerKey,
-	}
-
-	_, err = chaincode.UpdateSigner(signerMap, updatesMap)
+	_, err = chaincode.UpdateSigner(c.Request.Context(), chaincode.UserRef(signerKey), updatesMap)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to update signer in the blockchain", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to update signer in the blockchain", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
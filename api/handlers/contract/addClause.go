@@ -6,21 +6,23 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
 	"github.com/umairmaseed/clausia-api/db"
 	"github.com/umairmaseed/clausia-api/utils"
 )
 
 type addClauseForm struct {
-	AutoExecutableContract map[string]interface{}   `form:"autoExecutableContract" binding:"required"`
-	Id                     string                   `form:"id" binding:"required"`
-	Description            string                   `form:"description"`
-	Category               string                   `form:"category"`
-	Parameters             map[string]interface{}   `form:"parameters"`
-	Input                  map[string]interface{}   `form:"input"`
-	Dependencies           []map[string]interface{} `form:"dependencies"`
-	ActionType             string                   `form:"actionType" binding:"required"`
+	AutoExecutableContract chaincode.AssetRef     `form:"autoExecutableContract" binding:"required"`
+	Id                     string                 `form:"id" binding:"required"`
+	Description            string                 `form:"description"`
+	Category               string                 `form:"category"`
+	Parameters             map[string]interface{} `form:"parameters"`
+	Input                  map[string]interface{} `form:"input"`
+	Dependencies           []chaincode.AssetRef   `form:"dependencies"`
+	ActionType             string                 `form:"actionType" binding:"required"`
 }
 
 func AddClause(c *gin.Context) {
@@ -30,6 +32,10 @@ func AddClause(c *gin.Context) {
 		return
 	}
 
+	if !policy.Bound(c, form.AutoExecutableContract.Key) {
+		return
+	}
+
 	actionType, err := strconv.ParseFloat(form.ActionType, 64)
 	if err != nil {
 		errorhandler.ReturnError(c, err, "Failed to convert actionType to float64", http.StatusBadRequest)
@@ -42,66 +48,35 @@ func AddClause(c *gin.Context) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find user key", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
-	contractAsset, err := chaincode.SearchAsset(form.AutoExecutableContract)
+	contract, err := chaincode.GetContract(c.Request.Context(), form.AutoExecutableContract.Key)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find contract asset", http.StatusInternalServerError)
-		return
-	}
-
-	results, ok := contractAsset["result"].([]interface{})
-	if !ok || len(results) == 0 {
-		errorhandler.ReturnError(c, fmt.Errorf("no results found in contract asset"), "no results found in contract asset", http.StatusInternalServerError)
-		return
-	}
-
-	firstResult, ok := results[0].(map[string]interface{})
-	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("invalid result format"), "invalid result format", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to find contract asset", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
-	contractOwner, ok := firstResult["owner"].(map[string]interface{})
-	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("could not find owner of th contract"), "could not find owner of th contract", http.StatusInternalServerError)
+	if !clausesChangeable(c, *contract) {
 		return
 	}
 
-	if contractOwner["@key"] != signerKey {
-		errorhandler.ReturnError(c, fmt.Errorf("only the owner of the contract can add the clause"), "only the owner of the contract can add the clause", http.StatusBadRequest)
-		return
-	}
-
-	reqMap := map[string]interface{}{
-		"autoExecutableContract": form.AutoExecutableContract,
-		"id":                     form.Id,
-		"actionType":             actionType,
-	}
-
-	if form.Description != "" {
-		reqMap["description"] = form.Description
-	}
-	if form.Category != "" {
-		reqMap["category"] = form.Category
-	}
-	if form.Parameters != nil {
-		reqMap["parameters"] = form.Parameters
-	}
-	if form.Input != nil {
-		reqMap["input"] = form.Input
-	}
-	if form.Dependencies != nil {
-		reqMap["dependencies"] = form.Dependencies
+	clause := chaincode.Clause{
+		Id:           form.Id,
+		Description:  form.Description,
+		Category:     form.Category,
+		ActionType:   chaincode.ActionType(actionType),
+		Parameters:   form.Parameters,
+		Input:        form.Input,
+		Dependencies: form.Dependencies,
 	}
 
-	updatedContractAsset, err := chaincode.AddClause(reqMap)
+	updatedContractAsset, err := chaincode.AddClause(c.Request.Context(), contract.Ref(), clause)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to add clause to contract", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to add clause to contract", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -113,28 +88,20 @@ func AddClause(c *gin.Context) {
 		Message: "Clause added successfully",
 	})
 
-	participants, ok := firstResult["participants"].([]interface{})
-	if ok {
-		for _, participant := range participants {
-			participantMap, ok := participant.(map[string]interface{})
-			if ok {
-				if userID, ok := participantMap["@key"].(string); ok {
-					notifications = append(notifications, db.Notification{
-						UserID:  userID,
-						Type:    "contract",
-						Message: "A new clause has been added to the contract you are participating in.",
-						Metadata: map[string]string{
-							"contractId": form.Id,
-						},
-					})
-				}
-			}
-		}
+	for _, participant := range contract.Participants {
+		notifications = append(notifications, db.Notification{
+			UserID:  participant.Key,
+			Type:    "contract",
+			Message: "A new clause has been added to the contract you are participating in.",
+			Metadata: map[string]string{
+				"contractId": form.Id,
+			},
+		})
 	}
 
-	_, err = db.NewNotificationService(db.GetDB().Database()).CreateNotification(c.Request.Context(), &notifications)
+	_, err = db.Notifications().CreateNotification(c.Request.Context(), &notifications)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "failed to generate notification", http.StatusInternalServerError)
+		logger.Errorf("failed to generate notification: %v", err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"contract": updatedContractAsset})
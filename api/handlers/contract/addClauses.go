@@ -1,18 +1,17 @@
 package contract
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
-	"github.com/umairmaseed/clausia-api/utils"
 )
 
 type addMultipleClausesForm struct {
-	AutoExecutableContract map[string]interface{}   `form:"autoExecutableContract" binding:"required"`
-	Clauses                []map[string]interface{} `form:"clauses" binding:"required"`
+	AutoExecutableContract chaincode.AssetRef `form:"autoExecutableContract" binding:"required"`
+	Clauses                []chaincode.Clause `form:"clauses" binding:"required"`
 }
 
 func AddMultipleClauses(c *gin.Context) {
@@ -22,55 +21,23 @@ func AddMultipleClauses(c *gin.Context) {
 		return
 	}
 
-	email := c.Request.Header.Get("Email")
-	if email == "" {
-		errorhandler.ReturnError(c, fmt.Errorf("email not found in headers"), "email not found in headers", http.StatusBadRequest)
+	if !policy.Bound(c, form.AutoExecutableContract.Key) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	contract, err := chaincode.GetContract(c.Request.Context(), form.AutoExecutableContract.Key)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find user key", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to find contract asset", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
-	contractAsset, err := chaincode.SearchAsset(form.AutoExecutableContract)
-	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find contract asset", http.StatusInternalServerError)
-		return
-	}
-
-	results, ok := contractAsset["result"].([]interface{})
-	if !ok || len(results) == 0 {
-		errorhandler.ReturnError(c, fmt.Errorf("no results found in contract asset"), "no results found in contract asset", http.StatusInternalServerError)
+	if !clausesChangeable(c, *contract) {
 		return
 	}
 
-	firstResult, ok := results[0].(map[string]interface{})
-	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("invalid result format"), "invalid result format", http.StatusInternalServerError)
-		return
-	}
-
-	contractOwner, ok := firstResult["owner"].(map[string]interface{})
-	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("could not find owner of the contract"), "could not find owner of the contract", http.StatusInternalServerError)
-		return
-	}
-
-	if contractOwner["@key"] != signerKey {
-		errorhandler.ReturnError(c, fmt.Errorf("only the owner of the contract can add clauses"), "only the owner of the contract can add clauses", http.StatusBadRequest)
-		return
-	}
-
-	reqMap := map[string]interface{}{
-		"autoExecutableContract": form.AutoExecutableContract,
-		"clauses":                form.Clauses,
-	}
-
-	updatedContractAsset, err := chaincode.AddClauses(reqMap)
+	updatedContractAsset, err := chaincode.AddClauses(c.Request.Context(), contract.Ref(), form.Clauses)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to add multiple clauses to contract", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to add multiple clauses to contract", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
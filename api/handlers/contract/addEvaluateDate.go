@@ -5,12 +5,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
 )
 
 type addEvaluateDateForm struct {
-	Clause       map[string]interface{} `form:"clause" binding:"required"`
-	EvaluateDate string                 `form:"evaluateDate" binding:"required"`
+	Clause       chaincode.AssetRef `form:"clause" binding:"required"`
+	EvaluateDate string             `form:"evaluateDate" binding:"required"`
 }
 
 func AddEvaluateDate(c *gin.Context) {
@@ -20,14 +22,17 @@ func AddEvaluateDate(c *gin.Context) {
 		return
 	}
 
-	reqMap := map[string]interface{}{
-		"clause":        form.Clause,
-		"evaluatedDate": form.EvaluateDate,
+	if !policy.Bound(c, form.Clause.Key) {
+		return
+	}
+
+	if _, ok := clauseContractInState(c, form.Clause, db.ContractActive); !ok {
+		return
 	}
 
-	updatedClause, err := chaincode.AddEvaluateDate(reqMap)
+	updatedClause, err := chaincode.AddEvaluateDate(c.Request.Context(), form.Clause, form.EvaluateDate)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to add evaluate date to clause", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to add evaluate date to clause", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -6,16 +6,20 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/money"
 )
 
 type addInputsToCheckFine struct {
-	Clause              map[string]interface{} `form:"clause" binding:"required"`
-	ReferenceValue      *float64               `form:"referenceValue"`
-	DailyPercentage     *float64               `form:"dailyPercentage"`
-	Days                *float64               `form:"days"`
-	ReferenceClauseDays bool                   `json:"referenceClauseDays"`
-	ReferenceClauseName string                 `json:"referenceClauseName"`
+	Clause              chaincode.AssetRef `form:"clause" binding:"required"`
+	ReferenceValue      *money.Decimal     `form:"referenceValue"`
+	Currency            string             `form:"currency"`
+	DailyPercentage     *float64           `form:"dailyPercentage"`
+	Days                *float64           `form:"days"`
+	ReferenceClauseDays bool               `json:"referenceClauseDays"`
+	ReferenceClauseName string             `json:"referenceClauseName"`
 }
 
 func AddInputsToCheckFine(c *gin.Context) {
@@ -25,34 +29,53 @@ func AddInputsToCheckFine(c *gin.Context) {
 		return
 	}
 
-	if form.ReferenceValue == nil && form.DailyPercentage == nil && form.Days == nil {
-		errorhandler.ReturnError(c, fmt.Errorf("no input values provided to update"), "No input values provided to update", http.StatusBadRequest)
+	if !policy.Bound(c, form.Clause.Key) {
 		return
 	}
 
-	reqMap := map[string]interface{}{
-		"clause": form.Clause,
+	if _, ok := clauseContractInState(c, form.Clause, db.ContractActive); !ok {
+		return
 	}
 
-	if form.ReferenceValue != nil {
-		reqMap["referenceValue"] = *form.ReferenceValue
-	}
-	if form.DailyPercentage != nil {
-		reqMap["dailyPercentage"] = *form.DailyPercentage
+	clause, err := chaincode.GetClause(c.Request.Context(), form.Clause.Key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find clause asset", errorhandler.ChaincodeStatus(err))
+		return
 	}
-	if form.Days != nil {
-		reqMap["days"] = *form.Days
+
+	if form.ReferenceValue == nil && form.DailyPercentage == nil && form.Days == nil {
+		errorhandler.ReturnError(c, fmt.Errorf("no input values provided to update"), "No input values provided to update", http.StatusBadRequest)
+		return
 	}
-	if form.ReferenceClauseDays {
-		reqMap["referenceClauseDays"] = form.ReferenceClauseDays
+
+	inputs := chaincode.FineInputs{
+		Clause:              form.Clause,
+		DailyPercentage:     form.DailyPercentage,
+		Days:                form.Days,
+		ReferenceClauseDays: form.ReferenceClauseDays,
+		ReferenceClauseName: form.ReferenceClauseName,
 	}
-	if form.ReferenceClauseName != "" {
-		reqMap["referenceClauseName"] = form.ReferenceClauseName
+
+	if form.ReferenceValue != nil {
+		value, err := formAmount(*clause, form.ReferenceValue, form.Currency)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Invalid reference value", http.StatusBadRequest)
+			return
+		}
+		converted, original, rate, err := clauseAmount(c.Request.Context(), *clause, value)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Invalid reference value", http.StatusBadRequest)
+			return
+		}
+		inputs.ReferenceValue = &converted.Amount
+		inputs.Currency = converted.Currency
+		inputs.Original = original
+		inputs.Rate = rate
 	}
 
-	updatedClause, err := chaincode.AddInputsToCheckFine(reqMap)
+	updatedClause, err := chaincode.AddInputsToCheckFine(c.Request.Context(), inputs)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to add inputs to clause", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to add inputs to clause", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -2,26 +2,33 @@ package contract
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"mime/multipart"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/logger"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/money"
+	"github.com/umairmaseed/clausia-api/payments"
 	"github.com/umairmaseed/clausia-api/utils"
 )
 
 type addInputsToMakePaymentType struct {
-	Clause              map[string]interface{} `form:"clause" binding:"required"`
-	Date                string                 `form:"date" binding:"required"`
-	StripeToken         string                 `form:"stripeToken"`
-	PayPalTransactionID string                 `form:"payPalTransactionID"`
-	Payment             float64                `form:"payment" binding:"required"`
-	Receipt             *multipart.FileHeader  `form:"Receipt"`
-	FinalPayment        string                 `form:"finalPayment" binding:"required"`
+	Clause              chaincode.AssetRef    `form:"clause" binding:"required"`
+	Date                string                `form:"date" binding:"required"`
+	StripeToken         string                `form:"stripeToken"`
+	PayPalTransactionID string                `form:"payPalTransactionID"`
+	Payment             *money.Decimal        `form:"payment" binding:"required"`
+	Currency            string                `form:"currency"`
+	Receipt             *multipart.FileHeader `form:"Receipt"`
+	FinalPayment        string                `form:"finalPayment" binding:"required"`
 }
 
 func AddInputsToMakePayment(c *gin.Context) {
@@ -31,21 +38,66 @@ func AddInputsToMakePayment(c *gin.Context) {
 		return
 	}
 
+	if !policy.Bound(c, form.Clause.Key) {
+		return
+	}
+
+	// PayPal transactions are not confirmed with a payment provider, so they
+	// cannot prove a payment until one verifies them
+	if form.PayPalTransactionID != "" {
+		errorhandler.ReturnError(c, errors.New("PayPal transactions cannot be verified, pay by card or with a receipt"), "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	contract, ok := clauseContractInState(c, form.Clause, db.ContractActive)
+	if !ok {
+		return
+	}
+
 	finalPaymentBool, err := strconv.ParseBool(form.FinalPayment)
 	if err != nil {
 		c.JSON(400, gin.H{"error": "Invalid finalPayment value, must be 'true' or 'false'"})
 		return
 	}
 
-	reqMap := map[string]interface{}{
-		"clause":       form.Clause,
-		"payment":      form.Payment,
-		"finalPayment": finalPaymentBool,
-		"date":         form.Date,
+	if finalPaymentBool {
+		if err := requireNoDispute(c.Request.Context(), form.Clause.Key); err != nil {
+			errorhandler.ReturnError(c, err, "Final payment cannot be made", receiptStatus(err))
+			return
+		}
+	}
+
+	clause, err := chaincode.GetClause(c.Request.Context(), form.Clause.Key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find clause asset", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	paid, err := formAmount(*clause, form.Payment, form.Currency)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid payment", http.StatusBadRequest)
+		return
+	}
+
+	converted, original, rate, err := clauseAmount(c.Request.Context(), *clause, paid)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid payment", http.StatusBadRequest)
+		return
+	}
+
+	payment := chaincode.Payment{
+		Clause:       form.Clause,
+		Payment:      converted.Amount,
+		Currency:     converted.Currency,
+		Original:     original,
+		Rate:         rate,
+		FinalPayment: finalPaymentBool,
+		Date:         form.Date,
+		StripeToken:  form.StripeToken,
 	}
 
 	if form.Receipt != nil {
-		if form.PayPalTransactionID == "" && form.StripeToken == "" {
+		if form.StripeToken == "" {
 
 			fbytes, err := utils.GetFileBytes(form.Receipt)
 			if err != nil {
@@ -55,34 +107,124 @@ func AddInputsToMakePayment(c *gin.Context) {
 
 			hash := fmt.Sprintf("%x", sha256.Sum256(fbytes))
 
-			s3Url, err := utils.UploadReceiptToS3(fbytes, hash)
+			receiptURL, err := utils.UploadReceipt(c.Request.Context(), fbytes, hash)
 			if err != nil {
 				logger.Error(err)
-				c.String(http.StatusInternalServerError, "failed to upload file to s3: "+err.Error())
+				c.String(http.StatusInternalServerError, "failed to upload receipt: "+err.Error())
 				c.Abort()
 				return
 			}
 
-			reqMap["receiptUrl"] = s3Url
-			reqMap["receiptHash"] = hash
+			payment.ReceiptURL = receiptURL
+			payment.ReceiptHash = hash
 		} else {
-			errorhandler.ReturnError(c, fmt.Errorf("receipt cannot be provided with Stripe or PayPal payment"), "Invalid input", http.StatusBadRequest)
+			errorhandler.ReturnError(c, errors.New("receipt cannot be provided with a card payment"), "Invalid input", http.StatusBadRequest)
 			return
 		}
 	}
 
 	if form.StripeToken != "" {
-		reqMap["stripeToken"] = form.StripeToken
+		recordCardPayment(c, form.Clause.Key, form.StripeToken, paid)
+		return
 	}
-	if form.PayPalTransactionID != "" {
-		reqMap["payPalTransactionID"] = form.PayPalTransactionID
+
+	// Without a confirmed card payment, only a receipt can prove the payment
+	if payment.ReceiptURL == "" {
+		errorhandler.ReturnError(c, errors.New("a payment needs a confirmed card payment or a receipt"), "Payment not confirmed", http.StatusPaymentRequired)
+		return
+	}
+
+	recordManualPayment(c, *contract, payment)
+}
+
+// recordManualPayment stores the receipt of a payment before recording the
+// payment on the clause. A final payment is held with its receipt until the
+// payee accepts it, so that it cannot close the clause before the payee had
+// a chance to dispute it. Every payment that is not paid by card goes
+// through here, so a final payment cannot skip the hold.
+func recordManualPayment(c *gin.Context, contract chaincode.AutoExecutableContract, payment chaincode.Payment) {
+	ctx := c.Request.Context()
+
+	payerKey, err := utils.SearchAndReturnSignerKey(ctx, c.Request.Header.Get("Email"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
+		return
 	}
 
-	updatedClause, err := chaincode.AddInputsToMakePayment(reqMap)
+	receipt, err := recordReceipt(ctx, contract, payerKey, payment)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to add inputs to clause", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to store receipt", http.StatusInternalServerError)
 		return
 	}
+	if receipt.Held() {
+		c.JSON(http.StatusAccepted, gin.H{"receipt": receipt})
+		return
+	}
+
+	updatedClause, err := chaincode.AddInputsToMakePayment(ctx, payment)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to add inputs to clause", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	if _, err := updateReceipt(ctx, receipt.ID, func(r *db.PaymentReceipt) bool {
+		now := time.Now().UTC()
+		r.RecordedAt = &now
+		return true
+	}); err != nil {
+		logger.Errorf("failed to mark receipt %s as recorded: %v", receipt.ID, err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"clause": updatedClause})
 }
+
+// recordCardPayment records the payment charged by the intent of token on
+// the clause. The token is only accepted for a payment of the clause and
+// amount that the provider confirmed, which the webhook usually recorded
+// already.
+func recordCardPayment(c *gin.Context, clauseKey, token string, amount money.Money) {
+	ctx := c.Request.Context()
+
+	payment, err := db.ClausePayments().FindClausePaymentByIntent(ctx, payments.Default().Name(), token)
+	if errors.Is(err, db.ErrClausePaymentNotFound) {
+		errorhandler.ReturnError(c, errors.New("no payment was charged with the token"), "Payment not confirmed", http.StatusPaymentRequired)
+		return
+	}
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find payment", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case payment.ClauseKey != clauseKey || !chargedAmount(*payment).Equal(amount):
+		errorhandler.ReturnError(c, errors.New("the token was charged for another clause or amount"), "Invalid input", http.StatusBadRequest)
+		return
+	case payment.Status != payments.StatusSucceeded:
+		errorhandler.ReturnError(c, fmt.Errorf("payment is %s", payment.Status), "Payment not confirmed", http.StatusPaymentRequired)
+		return
+	case payment.RecordedAt != nil:
+		errorhandler.ReturnError(c, errors.New("payment was already recorded on the clause"), "Payment already recorded", http.StatusConflict)
+		return
+	}
+
+	payment, err = recordPayment(ctx, payment.ID)
+	if errors.Is(err, errReceiptDisputed) {
+		errorhandler.ReturnError(c, err, "Final payment cannot be made", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to add inputs to clause", errorhandler.ChaincodeStatus(err))
+		return
+	}
+	if payment.RecordedAt == nil {
+		errorhandler.ReturnError(c, errors.New(payment.Error), "Failed to add inputs to clause", http.StatusConflict)
+		return
+	}
+
+	clause, err := chaincode.GetClause(ctx, clauseKey)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get clause", errorhandler.ChaincodeStatus(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"clause": clause})
+}
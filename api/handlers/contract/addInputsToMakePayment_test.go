@@ -0,0 +1,37 @@
+package contract
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestPaymentNeedsProof(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	h.lease(alice, bob)
+
+	payment := func(finalPayment string) url.Values {
+		return url.Values{
+			"clause":       {`{"@assetType":"clause","@key":"clause:rent"}`},
+			"date":         {"2024-02-01"},
+			"payment":      {"500"},
+			"finalPayment": {finalPayment},
+		}
+	}
+
+	// Neither a confirmed card payment nor a receipt proves the payment
+	for _, finalPayment := range []string{"false", "true"} {
+		h.expect(h.serve(AddInputsToMakePayment, http.MethodPost, "/addinputstomakepayment", "bob@example.com", payment(finalPayment), nil), http.StatusPaymentRequired)
+	}
+	if calls := h.calls("addInputsToMakePaymentClause"); calls != 0 {
+		t.Fatalf("expected no payment to be recorded, recorded %d", calls)
+	}
+
+	h.expect(h.serve(AddInputsToMakePayment, http.MethodPost, "/addinputstomakepayment", "bob@example.com", payment("false"), []byte("%PDF-1.4 transfer of 500.00")), http.StatusOK)
+	if calls := h.calls("addInputsToMakePaymentClause"); calls != 1 {
+		t.Fatalf("expected the payment with a receipt to be recorded, recorded %d", calls)
+	}
+}
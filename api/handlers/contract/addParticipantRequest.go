@@ -7,13 +7,16 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/mailer"
 	"github.com/umairmaseed/clausia-api/utils"
 )
 
 type addParticipantsRequestForm struct {
-	AutoExecutableContract map[string]interface{}   `form:"autoExecutableContract" binding:"required"`
-	Participants           []map[string]interface{} `form:"participants" binding:"required"`
+	AutoExecutableContract chaincode.AssetRef   `form:"autoExecutableContract" binding:"required"`
+	Participants           []chaincode.AssetRef `form:"participants" binding:"required"`
 }
 
 func AddParticipantRequest(c *gin.Context) {
@@ -23,32 +26,54 @@ func AddParticipantRequest(c *gin.Context) {
 		return
 	}
 
-	authExecutableCOntractKey, ok := form.AutoExecutableContract["@key"].(string)
-	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("invalid key for auto executable contract"), "Invalid key", http.StatusBadRequest)
+	if !policy.Bound(c, form.AutoExecutableContract.Key) {
 		return
 	}
 
+	email := c.Request.Header.Get("Email")
+	if email == "" {
+		errorhandler.ReturnError(c, fmt.Errorf("email not found in headers"), "email not found in headers", http.StatusBadRequest)
+		return
+	}
+
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	contract, err := chaincode.GetContract(c.Request.Context(), form.AutoExecutableContract.Key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find contract asset", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	var invited []string
 	for _, participant := range form.Participants {
-		ledgerKey, ok := participant["@key"].(string)
-		if !ok {
-			errorhandler.ReturnError(c, fmt.Errorf("invalid key for participant"), "Invalid key", http.StatusBadRequest)
-			return
-		}
+		invited = append(invited, participant.Key)
+	}
+	_, err = updateLifecycle(c.Request.Context(), *contract, func(l *db.ContractLifecycle) error {
+		return invite(l, signerKey, invited)
+	})
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to invite participants", lifecycleStatus(err))
+		return
+	}
 
-		signerAsset, err := chaincode.GetSigner(ledgerKey)
+	for _, participant := range form.Participants {
+		signerAsset, err := chaincode.GetSigner(c.Request.Context(), participant.Key)
 		if err != nil {
-			errorhandler.ReturnError(c, err, "Failed to retrieve signer asset", http.StatusInternalServerError)
+			errorhandler.ReturnError(c, err, "Failed to retrieve signer asset", errorhandler.ChaincodeStatus(err))
 			return
 		}
 
-		email, ok := signerAsset["email"].(string)
-		if !ok || email == "" {
+		email := signerAsset.Email
+		if email == "" {
 			errorhandler.ReturnError(c, fmt.Errorf("signer asset does not contain a valid email"), "Invalid email in signer asset", http.StatusInternalServerError)
 			return
 		}
 
-		token, err := utils.GenerateInviteToken(email, authExecutableCOntractKey, jwtSecret)
+		token, err := utils.GenerateInviteToken(email, form.AutoExecutableContract.Key, jwtSecret)
 		if err != nil {
 			errorhandler.ReturnError(c, err, "Failed to generate invite token", http.StatusInternalServerError)
 			return
@@ -62,9 +87,11 @@ func AddParticipantRequest(c *gin.Context) {
 
 		inviteLink := inviteLinkBase + token
 
-		msg := fmt.Sprintf("Subject: Contract Invitation\n\nPlease click the following link to accept the invitation to join the contract: %s", inviteLink)
-
-		err = utils.SendInviteEmail(email, msg)
+		err = mailer.Default().Send(c.Request.Context(), mailer.Message{
+			To:      []string{email},
+			Subject: "Contract Invitation",
+			Body:    fmt.Sprintf("Please click the following link to accept the invitation to join the contract: %s", inviteLink),
+		})
 		if err != nil {
 			errorhandler.ReturnError(c, err, "Failed to send invite email", http.StatusInternalServerError)
 			return
@@ -5,12 +5,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
 )
 
 type addReferenceDateForm struct {
-	Clause        map[string]interface{} `form:"clause" binding:"required"`
-	ReferenceDate string                 `form:"referenceDate" binding:"required"`
+	Clause        chaincode.AssetRef `form:"clause" binding:"required"`
+	ReferenceDate string             `form:"referenceDate" binding:"required"`
 }
 
 func AddReferenceDate(c *gin.Context) {
@@ -20,14 +22,17 @@ func AddReferenceDate(c *gin.Context) {
 		return
 	}
 
-	reqMap := map[string]interface{}{
-		"clause":        form.Clause,
-		"referenceDate": form.ReferenceDate,
+	if !policy.Bound(c, form.Clause.Key) {
+		return
+	}
+
+	if _, ok := clauseContractInState(c, form.Clause, db.ContractActive); !ok {
+		return
 	}
 
-	updatedClause, err := chaincode.AddReferenceDate(reqMap)
+	updatedClause, err := chaincode.AddReferenceDate(c.Request.Context(), form.Clause, form.ReferenceDate)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to add reference date to clause", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to add reference date to clause", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -7,15 +7,16 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
 	"github.com/umairmaseed/clausia-api/utils"
 )
 
 type Review struct {
-	Rating                 int                    `json:"rating" binding:"required"`
-	Comments               string                 `json:"comments"`
-	Date                   time.Time              `json:"date" binding:"required"`
-	AutoExecutableContract map[string]interface{} `json:"autoExecutableContract" binding:"required"`
+	Rating                 int                `json:"rating" binding:"required"`
+	Comments               string             `json:"comments"`
+	Date                   time.Time          `json:"date" binding:"required"`
+	AutoExecutableContract chaincode.AssetRef `json:"autoExecutableContract" binding:"required"`
 }
 
 func AddReviewToContract(c *gin.Context) {
@@ -25,57 +26,38 @@ func AddReviewToContract(c *gin.Context) {
 		return
 	}
 
+	if !policy.Bound(c, form.AutoExecutableContract.Key) {
+		return
+	}
+
 	email := c.Request.Header.Get("Email")
 	if email == "" {
 		errorhandler.ReturnError(c, fmt.Errorf("email not found in headers"), "email not found in headers", http.StatusBadRequest)
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find user key", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
-	contractAsset, err := chaincode.SearchAsset(form.AutoExecutableContract)
+	contract, err := chaincode.GetContract(c.Request.Context(), form.AutoExecutableContract.Key)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find contract asset", http.StatusInternalServerError)
-		return
-	}
-
-	results, ok := contractAsset["result"].([]interface{})
-	if !ok || len(results) == 0 {
-		errorhandler.ReturnError(c, fmt.Errorf("no results found in contract asset"), "no results found in contract asset", http.StatusInternalServerError)
-		return
-	}
-
-	firstResult, ok := results[0].(map[string]interface{})
-	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("invalid result format"), "invalid result format", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to find contract asset", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
-	reviewReq := make(map[string]interface{})
-
-	reviewReq["user"] = map[string]interface{}{
-		"@assettype": "user",
-		"@key":       signerKey,
-	}
-	reviewReq["rating"] = form.Rating
-	reviewReq["date"] = form.Date
-
-	if form.Comments != "" {
-		reviewReq["comments"] = form.Comments
-	}
-
-	req := map[string]interface{}{
-		"autoExecutableContract": firstResult,
-		"review":                 reviewReq,
+	review := chaincode.Review{
+		User:     chaincode.UserRef(signerKey),
+		Rating:   form.Rating,
+		Comments: form.Comments,
+		Date:     form.Date,
 	}
 
-	updatedContract, err := chaincode.AddReview(req)
+	updatedContract, err := chaincode.AddReview(c.Request.Context(), contract.Ref(), review)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to add review to contract", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to add review to contract", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -0,0 +1,73 @@
+package contract
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+type TemplateReview struct {
+	Rating   int       `json:"rating" binding:"required,min=1,max=5"`
+	Comments string    `json:"comments"`
+	Date     time.Time `json:"date" binding:"required"`
+}
+
+// AddReviewToTemplate rates a public template from 1 to 5 stars. A user has
+// one review per template, replaced when they review it again.
+func AddReviewToTemplate(c *gin.Context) {
+	var form TemplateReview
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind request form: ", http.StatusBadRequest)
+		return
+	}
+
+	template, signerKey, ok := templateOfRequest(c, db.TemplateViewer)
+	if !ok {
+		return
+	}
+	if template.CreatorKey() == signerKey {
+		errorhandler.ReturnError(c, errors.New("creators cannot review their own templates"), "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	review := chaincode.Review{
+		User:     chaincode.UserRef(signerKey),
+		Rating:   form.Rating,
+		Comments: form.Comments,
+		Date:     form.Date,
+	}
+
+	ctx := c.Request.Context()
+	if err := db.TemplateListings().SaveTemplateReview(ctx, template.Key, review); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to add review to template", http.StatusInternalServerError)
+		return
+	}
+
+	templateReviews(c, template.Key)
+}
+
+// TemplateReviews returns the reviews of a template with its average rating
+func TemplateReviews(c *gin.Context) {
+	template, _, ok := templateOfRequest(c, db.TemplateViewer)
+	if !ok {
+		return
+	}
+
+	templateReviews(c, template.Key)
+}
+
+func templateReviews(c *gin.Context, templateKey string) {
+	listings, err := db.TemplateListings().GetTemplateListings(c.Request.Context(), []string{templateKey})
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get template reviews", http.StatusInternalServerError)
+		return
+	}
+
+	listing := listings[templateKey]
+	c.JSON(http.StatusOK, gin.H{"reviews": listing.Reviews, "rating": listing.Rating()})
+}
@@ -5,12 +5,16 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/money"
 )
 
 type addStoredValueToGetCreditForm struct {
-	Clause      map[string]interface{} `form:"clause" binding:"required"`
-	StoredValue *float64               `form:"storedValue" binding:"required"`
+	Clause      chaincode.AssetRef `form:"clause" binding:"required"`
+	StoredValue *money.Decimal     `form:"storedValue" binding:"required"`
+	Currency    string             `form:"currency"`
 }
 
 func AddStoredValueToGetCredit(c *gin.Context) {
@@ -20,17 +24,40 @@ func AddStoredValueToGetCredit(c *gin.Context) {
 		return
 	}
 
-	reqMap := map[string]interface{}{
-		"clause": form.Clause,
+	if !policy.Bound(c, form.Clause.Key) {
+		return
+	}
+
+	if _, ok := clauseContractInState(c, form.Clause, db.ContractActive); !ok {
+		return
 	}
 
-	if form.StoredValue != nil {
-		reqMap["storedValue"] = *form.StoredValue
+	clause, err := chaincode.GetClause(c.Request.Context(), form.Clause.Key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find clause asset", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	value, err := formAmount(*clause, form.StoredValue, form.Currency)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid stored value", http.StatusBadRequest)
+		return
+	}
+	converted, original, rate, err := clauseAmount(c.Request.Context(), *clause, value)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid stored value", http.StatusBadRequest)
+		return
 	}
 
-	updatedClause, err := chaincode.AddStoredValueToGetCredit(reqMap)
+	updatedClause, err := chaincode.AddStoredValueToGetCredit(c.Request.Context(), chaincode.CreditInputs{
+		Clause:      form.Clause,
+		StoredValue: converted.Amount,
+		Currency:    converted.Currency,
+		Original:    original,
+		Rate:        rate,
+	})
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to add inputs to clause", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to add inputs to clause", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -0,0 +1,47 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/money"
+)
+
+// formAmount returns an amount given to a clause in the currency of the
+// form, or in the currency of the clause when the form has none. The amount
+// must be positive, with no more decimal places than its currency has.
+func formAmount(clause chaincode.Clause, amount *money.Decimal, code string) (money.Money, error) {
+	if amount == nil || amount.Sign() <= 0 {
+		return money.Money{}, errors.New("amount must be positive")
+	}
+
+	currency := clause.Currency()
+	if code != "" {
+		var err error
+		if currency, err = money.Currency(code); err != nil {
+			return money.Money{}, err
+		}
+	}
+	if places := money.MinorUnits(currency); amount.Places() > places {
+		return money.Money{}, fmt.Errorf("amount has more than %d decimal places for %s", places, currency)
+	}
+	return money.Money{Amount: *amount, Currency: currency}, nil
+}
+
+// clauseAmount converts an amount into the currency of the clause with the
+// current rate of the default source. The original amount is only returned
+// when it was in another currency, while the rate is always returned so that
+// the inputs of the clause keep the snapshot they were computed with.
+func clauseAmount(ctx context.Context, clause chaincode.Clause, amount money.Money) (money.Money, *money.Money, *money.Rate, error) {
+	converted, rate, err := money.Convert(ctx, money.DefaultRates(), amount, clause.Currency(), time.Now().UTC())
+	if err != nil {
+		return money.Money{}, nil, nil, fmt.Errorf("failed to convert %s: %w", amount, err)
+	}
+	if amount.Currency == converted.Currency {
+		return converted, nil, &rate, nil
+	}
+	return converted, &amount, &rate, nil
+}
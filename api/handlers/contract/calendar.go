@@ -0,0 +1,242 @@
+package contract
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/calendar"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/env"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// UserCalendar returns the dates of the contracts and documents of the
+// caller, sorted by date. The from and to query params, dates or times,
+// limit them to a range, to included.
+func UserCalendar(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	from, err := calendarBound(c.Query("from"), false)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid from date", http.StatusBadRequest)
+		return
+	}
+	to, err := calendarBound(c.Query("to"), true)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid to date", http.StatusBadRequest)
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		errorhandler.ReturnError(c, errors.New("to is before from"), "Invalid date range", http.StatusBadRequest)
+		return
+	}
+
+	userKey, err := utils.SearchAndReturnSignerKey(ctx, c.Request.Header.Get("Email"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	events, err := userEvents(ctx, userKey)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to collect calendar", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": calendar.Between(events, from, to)})
+}
+
+// CreateCalendarFeed gives the caller a new URL of their iCalendar feed,
+// which calendar apps subscribe to. The URL of a previous feed stops
+// working.
+func CreateCalendarFeed(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userKey, err := utils.SearchAndReturnSignerKey(ctx, c.Request.Header.Get("Email"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to generate feed token", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(secret)
+
+	feed := &db.CalendarFeed{UserKey: userKey, TokenHash: feedTokenHash(token)}
+	if err := db.CalendarFeeds().SaveCalendarFeed(ctx, feed); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to store calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	feedURL := publicURL(c) + "/public/calendar/" + token + ".ics"
+	c.JSON(http.StatusOK, gin.H{
+		"feed":   feed,
+		"url":    feedURL,
+		"webcal": "webcal://" + feedURL[strings.Index(feedURL, "://")+3:],
+	})
+}
+
+// DeleteCalendarFeed revokes the iCalendar feed of the caller
+func DeleteCalendarFeed(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userKey, err := utils.SearchAndReturnSignerKey(ctx, c.Request.Header.Get("Email"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	if err := db.CalendarFeeds().DeleteCalendarFeed(ctx, userKey); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to delete calendar feed", calendarFeedStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed deleted"})
+}
+
+// CalendarFeed serves the iCalendar feed of the :token param, with or
+// without its .ics extension. It is public, as calendar apps only have the
+// URL of the feed.
+func CalendarFeed(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+	feed, err := db.CalendarFeeds().FindCalendarFeedByToken(ctx, feedTokenHash(token))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find calendar feed", calendarFeedStatus(err))
+		return
+	}
+
+	events, err := userEvents(ctx, feed.UserKey)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to collect calendar", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := calendar.WriteICS(&buf, "Clausia", calendar.Between(events, time.Time{}, time.Time{}), time.Now()); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to write calendar", http.StatusInternalServerError)
+		return
+	}
+	c.Header("Content-Disposition", "inline; filename=clausia.ics")
+	c.Header("Cache-Control", "private, no-cache")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+// userEvents collects the dates of the contracts a user owns or takes part
+// in, but the cancelled ones, and the signing deadlines of the documents the
+// user owns or has to sign
+func userEvents(ctx context.Context, userKey string) ([]calendar.Event, error) {
+	user := chaincode.UserRef(userKey)
+
+	owned, err := chaincode.SearchContracts(ctx, map[string]interface{}{"owner": user})
+	if err != nil {
+		return nil, err
+	}
+	joined, err := chaincode.SearchContracts(ctx, map[string]interface{}{
+		"participants": map[string]interface{}{"$elemMatch": user},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var events []calendar.Event
+	for _, contract := range append(owned, joined...) {
+		lifecycle, err := loadLifecycle(ctx, contract)
+		if err != nil {
+			return nil, err
+		}
+		if lifecycle.State == db.ContractCancelled {
+			continue
+		}
+
+		var clauses []chaincode.Clause
+		for _, ref := range contract.Clauses {
+			clause, err := chaincode.GetClause(ctx, ref.Key)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, *clause)
+		}
+		events = append(events, calendar.ContractEvents(contract, clauses)...)
+	}
+
+	ownedDocs, err := chaincode.SearchAssetTx(ctx, map[string]interface{}{
+		"@assetType": chaincode.AssetTypeDocument,
+		"owner":      user,
+	})
+	if err != nil {
+		return nil, err
+	}
+	expectedDocs, err := chaincode.GetExpectedUserDoc(ctx, map[string]interface{}{"signer": user})
+	if err != nil {
+		return nil, err
+	}
+	for _, document := range append(ownedDocs, expectedDocs...) {
+		events = append(events, calendar.DocumentEvents(document)...)
+	}
+
+	return events, nil
+}
+
+// calendarBound parses a bound of a date range. A date given as the end of
+// the range includes the whole day.
+func calendarBound(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, allDay, ok := calendar.ParseDate(value)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	if allDay && end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// feedTokenHash returns the hex SHA-256 of a feed token, as stored
+func feedTokenHash(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// publicURL returns the URL of the API as seen by calendar apps, set by the
+// PUBLIC_API_URL env var or taken from the request
+func publicURL(c *gin.Context) string {
+	if base := os.Getenv(env.PUBLIC_API_URL); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.Request.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// calendarFeedStatus returns the HTTP status of an error of the calendar
+// feed store
+func calendarFeedStatus(err error) int {
+	if errors.Is(err, db.ErrCalendarFeedNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
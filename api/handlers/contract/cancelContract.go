@@ -4,14 +4,17 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
 )
 
 type CancelContractForm struct {
-	Clause                map[string]interface{} `form:"clause" binding:"required"`
-	ForceCancellation     bool                   `form:"forceCancellation"`
-	RequestedCancellation bool                   `form:"requestedCancellation"`
+	Clause                chaincode.AssetRef `form:"clause" binding:"required"`
+	ForceCancellation     bool               `form:"forceCancellation"`
+	RequestedCancellation bool               `form:"requestedCancellation"`
 }
 
 func CancelContract(c *gin.Context) {
@@ -22,23 +25,37 @@ func CancelContract(c *gin.Context) {
 		return
 	}
 
-	reqMap := map[string]interface{}{
-		"clause": form.Clause,
+	if !policy.Bound(c, form.Clause.Key) {
+		return
 	}
 
-	if form.ForceCancellation {
-		reqMap["forceCancellation"] = form.ForceCancellation
+	contract, ok := clauseContractInState(c, form.Clause, db.ContractActive)
+	if !ok {
+		return
 	}
 
-	if form.RequestedCancellation {
-		reqMap["requestedCancellation"] = form.RequestedCancellation
+	req := chaincode.CancelRequest{
+		Clause:                form.Clause,
+		ForceCancellation:     form.ForceCancellation,
+		RequestedCancellation: form.RequestedCancellation,
 	}
 
-	updatedClause, err := chaincode.CancelContract(reqMap)
+	updatedClause, err := chaincode.CancelContract(c.Request.Context(), req)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to complete cancel request for contract", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to complete cancel request for contract", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
+	// The cancellation clause is finalized once the contract is cancelled,
+	// and only requested before that
+	if updatedClause.Finalized {
+		_, err := updateLifecycle(c.Request.Context(), *contract, func(l *db.ContractLifecycle) error {
+			return finish(l, db.ContractCancelled)
+		})
+		if err != nil {
+			logger.Errorf("failed to cancel contract %s: %v", contract.Key, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"clause": updatedClause})
 }
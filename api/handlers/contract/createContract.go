@@ -12,11 +12,11 @@ import (
 )
 
 type createContractForm struct {
-	Name          string                   `form:"name" binding:"required"`
-	SignatureDate string                   `form:"signatureDate" binding:"required"`
-	Clauses       []map[string]interface{} `form:"clauses"`
-	Data          map[string]interface{}   `form:"data"`
-	Participants  []map[string]interface{} `form:"participants"`
+	Name          string                 `form:"name" binding:"required"`
+	SignatureDate string                 `form:"signatureDate" binding:"required"`
+	Clauses       []chaincode.Clause     `form:"clauses"`
+	Data          map[string]interface{} `form:"data"`
+	Participants  []chaincode.AssetRef   `form:"participants"`
 }
 
 func CreateContract(c *gin.Context) {
@@ -34,64 +34,86 @@ func CreateContract(c *gin.Context) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
 
-	signerAsset := map[string]interface{}{
-		"@assetType": "user",
-		"@key":       signerKey,
+	owner := chaincode.UserRef(signerKey)
+
+	req := chaincode.AutoExecutableContract{
+		Name:          form.Name,
+		SignatureDate: form.SignatureDate,
+		Owner:         &owner,
+		Clauses:       form.Clauses,
+		Data:          form.Data,
 	}
 
-	req := map[string]interface{}{
-		"name":          form.Name,
-		"signatureDate": form.SignatureDate,
-		"owner":         signerAsset,
+	contract, lifecycle, ok := createContract(c, signerKey, req, form.Participants)
+	if !ok {
+		return
 	}
 
-	if len(form.Clauses) > 0 {
-		req["clauses"] = form.Clauses
+	c.JSON(http.StatusOK, gin.H{"contract": contract, "lifecycle": lifecycle})
+
+}
+
+// createContract creates a contract owned by ownerKey and invites the
+// participants to it, writing the error response on failure
+func createContract(c *gin.Context, ownerKey string, req chaincode.AutoExecutableContract, participants []chaincode.AssetRef) (*chaincode.AutoExecutableContract, *db.ContractLifecycle, bool) {
+	// Participants join the contract when they accept their invitation
+	lifecycle := &db.ContractLifecycle{
+		State:    db.ContractDraft,
+		Invited:  []string{},
+		Accepted: []string{},
+		Declined: []string{},
 	}
-	if len(form.Participants) > 0 {
-		req["participants"] = form.Participants
+	var invited []string
+	for _, participant := range participants {
+		invited = append(invited, participant.Key)
 	}
-	if form.Data != nil {
-		req["data"] = form.Data
+	if err := invite(lifecycle, ownerKey, invited); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to invite participants", lifecycleStatus(err))
+		return nil, nil, false
 	}
 
-	contract, err := chaincode.CreateAutoExecutableContract(req)
+	contract, err := chaincode.CreateAutoExecutableContract(c.Request.Context(), req)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
-		return
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
+		return nil, nil, false
+	}
+
+	lifecycle.ContractKey = contract.Key
+	if err := db.Lifecycles().SaveContractLifecycle(c.Request.Context(), lifecycle); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to store contract lifecycle", http.StatusInternalServerError)
+		return nil, nil, false
 	}
 
 	var notifications []db.Notification
 
 	notifications = append(notifications, db.Notification{
-		UserID:   signerKey,
+		UserID:   ownerKey,
 		Type:     "contract",
 		Message:  "You have created a new contract",
-		Metadata: map[string]string{"contractID": contract["@key"].(string)},
+		Metadata: map[string]string{"contractID": contract.Key},
 	})
 
-	for _, participant := range form.Participants {
+	for _, participantKey := range lifecycle.Invited {
 		notifications = append(notifications, db.Notification{
-			UserID:   participant["@key"].(string),
+			UserID:   participantKey,
 			Type:     "contract",
 			Message:  "You have been invited to sign a contract",
-			Metadata: map[string]string{"contractID": contract["@key"].(string)},
+			Metadata: inviteMetadata(c.Request.Context(), contract.Key, participantKey),
 		})
 	}
 
-	_, err = db.NewNotificationService(db.GetDB().Database()).CreateNotification(c.Request.Context(), &notifications)
+	_, err = db.Notifications().CreateNotification(c.Request.Context(), &notifications)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "failed to generate notification", http.StatusInternalServerError)
+		logger.Errorf("failed to generate notification: %v", err)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"contract": contract})
-
+	return contract, lifecycle, true
 }
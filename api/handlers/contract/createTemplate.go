@@ -12,11 +12,11 @@ import (
 )
 
 type createTemplateForm struct {
-	Id          string                   `form:"id" binding:"required"`
-	Name        string                   `form:"name" binding:"required"`
-	Description string                   `form:"description"`
-	Public      bool                     `form:"public" binding:"required"`
-	Clauses     []map[string]interface{} `form:"clauses"`
+	Id          string                     `form:"id" binding:"required"`
+	Name        string                     `form:"name" binding:"required"`
+	Description string                     `form:"description"`
+	Public      *bool                      `form:"public" binding:"required"`
+	Clauses     []chaincode.TemplateClause `form:"clauses"`
 }
 
 func CreateTemplate(c *gin.Context) {
@@ -34,38 +34,31 @@ func CreateTemplate(c *gin.Context) {
 		return
 	}
 
-	userKey, err := utils.SearchAndReturnSignerKey(email)
+	userKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
 
-	userAsset := map[string]interface{}{
-		"@assetType": "user",
-		"@key":       userKey,
-	}
-
-	req := map[string]interface{}{
-		"name":    form.Name,
-		"creator": userAsset,
-		"public":  form.Public,
-		"id":      form.Id,
-	}
+	creator := chaincode.UserRef(userKey)
 
-	if len(form.Clauses) > 0 {
-		req["clauses"] = form.Clauses
-	}
-	if form.Description != "" {
-		req["description"] = form.Description
+	req := chaincode.Template{
+		Id:          form.Id,
+		Name:        form.Name,
+		Description: form.Description,
+		Public:      *form.Public,
+		Creator:     &creator,
+		Clauses:     form.Clauses,
 	}
 
-	contract, err := chaincode.CreateTemplate(req)
+	contract, err := chaincode.CreateTemplate(c.Request.Context(), req)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
+	recordTemplateChange(c, contract.Key)
 
 	var notifications []db.Notification
 	notifications = append(notifications, db.Notification{
@@ -75,9 +68,9 @@ func CreateTemplate(c *gin.Context) {
 		Metadata: map[string]string{"templateId": form.Id},
 	})
 
-	_, err = db.NewNotificationService(db.GetDB().Database()).CreateNotification(c.Request.Context(), &notifications)
+	_, err = db.Notifications().CreateNotification(c.Request.Context(), &notifications)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "failed to generate notification", http.StatusInternalServerError)
+		logger.Errorf("failed to generate notification: %v", err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"template": contract})
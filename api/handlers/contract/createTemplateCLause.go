@@ -5,21 +5,23 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
 )
 
 type createTemplateClauseForm struct {
-	Id                string                   `form:"id" binding:"required"`
-	Template          map[string]interface{}   `form:"template" binding:"required"`
-	Number            float64                  `form:"number" binding:"required"`
-	Name              string                   `form:"name" binding:"required"`
-	Description       string                   `form:"description"`
-	Category          string                   `form:"category"`
-	ActionType        float64                  `form:"actionType" binding:"required"`
-	Dependencies      []map[string]interface{} `form:"dependencies"`
-	DefaultInputs     map[string]interface{}   `form:"defaultInputs"`
-	DefaultParameters map[string]interface{}   `form:"defaultParameters"`
-	Optional          *bool                    `form:"optional"`
+	Id                string                 `form:"id" binding:"required"`
+	Template          chaincode.AssetRef     `form:"template" binding:"required"`
+	Number            float64                `form:"number" binding:"required"`
+	Name              string                 `form:"name" binding:"required"`
+	Description       string                 `form:"description"`
+	Category          string                 `form:"category"`
+	ActionType        float64                `form:"actionType" binding:"required"`
+	Dependencies      []chaincode.AssetRef   `form:"dependencies"`
+	DefaultInputs     map[string]interface{} `form:"defaultInputs"`
+	DefaultParameters map[string]interface{} `form:"defaultParameters"`
+	Optional          *bool                  `form:"optional"`
 }
 
 func CreateTemplateClause(c *gin.Context) {
@@ -30,39 +32,32 @@ func CreateTemplateClause(c *gin.Context) {
 		return
 	}
 
-	req := map[string]interface{}{
-		"name":       form.Name,
-		"template":   form.Template,
-		"id":         form.Id,
-		"number":     form.Number,
-		"actionType": form.ActionType,
+	req := chaincode.TemplateClause{
+		Id:                form.Id,
+		Template:          &form.Template,
+		Number:            form.Number,
+		Name:              form.Name,
+		Description:       form.Description,
+		Category:          form.Category,
+		ActionType:        chaincode.ActionType(form.ActionType),
+		Dependencies:      form.Dependencies,
+		DefaultInputs:     form.DefaultInputs,
+		DefaultParameters: form.DefaultParameters,
+		Optional:          form.Optional,
 	}
 
-	if len(form.Dependencies) > 0 {
-		req["dependencies"] = form.Dependencies
-	}
-	if form.Description != "" {
-		req["description"] = form.Description
-	}
-	if form.Category != "" {
-		req["category"] = form.Category
-	}
-	if form.DefaultInputs != nil {
-		req["defaultInputs"] = form.DefaultInputs
-	}
-	if form.DefaultParameters != nil {
-		req["defaultParameters"] = form.DefaultParameters
-	}
-	if form.Optional != nil {
-		req["optional"] = *form.Optional
+	if _, _, ok := templateForRole(c, form.Template.Key, db.TemplateEditor); !ok {
+		return
 	}
+	recordTemplateChange(c, form.Template.Key)
 
-	contract, err := chaincode.CreateTemplateClause(req)
+	contract, err := chaincode.CreateTemplateClause(c.Request.Context(), req)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
+	recordTemplateChange(c, form.Template.Key)
 
 	c.JSON(http.StatusOK, gin.H{"templateClause": contract})
 
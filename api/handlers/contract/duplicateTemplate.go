@@ -5,14 +5,15 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
 	"github.com/umairmaseed/clausia-api/chaincode"
-	"github.com/umairmaseed/clausia-api/utils"
+	"github.com/umairmaseed/clausia-api/db"
 )
 
 type DuplicateTemplateForm struct {
-	Id       string                 `form:"id" binding:"required"`
-	Name     string                 `form:"name" binding:"required"`
-	Template map[string]interface{} `form:"Template" binding:"required"`
+	Id       string             `form:"id" binding:"required"`
+	Name     string             `form:"name" binding:"required"`
+	Template chaincode.AssetRef `form:"Template" binding:"required"`
 }
 
 func DuplicateTemplate(c *gin.Context) {
@@ -23,38 +24,19 @@ func DuplicateTemplate(c *gin.Context) {
 		return
 	}
 
-	email := c.Request.Header.Get("Email")
-	if email == "" {
-		logger.Error("Email not found in headers")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Email not found in headers"})
+	_, userKey, ok := templateForRole(c, form.Template.Key, db.TemplateViewer)
+	if !ok {
 		return
 	}
 
-	userKey, err := utils.SearchAndReturnSignerKey(email)
+	contract, err := chaincode.DuplicateTemplate(c.Request.Context(), form.Template, form.Id, form.Name, chaincode.UserRef(userKey))
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	userAsset := map[string]interface{}{
-		"@assetType": "user",
-		"@key":       userKey,
-	}
-
-	req := map[string]interface{}{
-		"name":     form.Name,
-		"creator":  userAsset,
-		"id":       form.Id,
-		"template": form.Template,
-	}
-
-	contract, err := chaincode.DuplicateTemplate(req)
-	if err != nil {
-		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
+	recordTemplateChange(c, contract.Key)
+	countTemplateUse(c, form.Template.Key, db.TemplateDuplicated)
 
 	c.JSON(http.StatusOK, gin.H{"template": contract})
 
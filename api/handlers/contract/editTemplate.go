@@ -1,20 +1,19 @@
 package contract
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
 	"github.com/umairmaseed/clausia-api/chaincode"
-	"github.com/umairmaseed/clausia-api/utils"
+	"github.com/umairmaseed/clausia-api/db"
 )
 
 type EditTemplateForm struct {
-	Template    map[string]interface{} `form:"template" binding:"required"`
-	Name        string                 `form:"name"`
-	Description string                 `form:"description"`
-	Public      *bool                  `form:"public"`
+	Template    chaincode.AssetRef `form:"template" binding:"required"`
+	Name        string             `form:"name"`
+	Description string             `form:"description"`
+	Public      *bool              `form:"public"`
 }
 
 func EditTemplate(c *gin.Context) {
@@ -24,66 +23,27 @@ func EditTemplate(c *gin.Context) {
 		return
 	}
 
-	email := c.Request.Header.Get("Email")
-	if email == "" {
-		errorhandler.ReturnError(c, fmt.Errorf("email not found in headers"), "email not found in headers", http.StatusBadRequest)
-		return
-	}
-
-	userKey, err := utils.SearchAndReturnSignerKey(email)
-	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find user key", http.StatusInternalServerError)
-		return
-	}
-
-	contractAsset, err := chaincode.SearchAsset(form.Template)
-	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find template asset", http.StatusInternalServerError)
-		return
-	}
-
-	results, ok := contractAsset["result"].([]interface{})
-	if !ok || len(results) == 0 {
-		errorhandler.ReturnError(c, fmt.Errorf("no results found in template asset"), "no results found in template asset", http.StatusInternalServerError)
-		return
-	}
-
-	firstResult, ok := results[0].(map[string]interface{})
-	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("invalid result format"), "invalid result format", http.StatusInternalServerError)
-		return
-	}
-
-	contractOwner, ok := firstResult["creator"].(map[string]interface{})
+	template, _, ok := templateForRole(c, form.Template.Key, db.TemplateEditor)
 	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("could not find creator of the template"), "could not find creator of the template", http.StatusInternalServerError)
 		return
 	}
 
-	if contractOwner["@key"] != userKey {
-		errorhandler.ReturnError(c, fmt.Errorf("only the creator of the template can edit"), "only the creator of the template can edit", http.StatusBadRequest)
-		return
-	}
-
-	reqMap := map[string]interface{}{
-		"template": form.Template,
-	}
+	// Templates edited before versions were recorded keep their previous
+	// content as a version
+	recordTemplateChange(c, template.Key)
 
-	if form.Description != "" {
-		reqMap["description"] = form.Description
-	}
-	if form.Name != "" {
-		reqMap["name"] = form.Name
+	update := chaincode.TemplateUpdate{
+		Name:        form.Name,
+		Description: form.Description,
+		Public:      form.Public,
 	}
 
-	if form.Public != nil {
-		reqMap["public"] = *form.Public
-	}
-	updatedContractAsset, err := chaincode.EditTemplate(reqMap)
+	updatedContractAsset, err := chaincode.EditTemplate(c.Request.Context(), template.Ref(), update)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to edit template", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to edit template", errorhandler.ChaincodeStatus(err))
 		return
 	}
+	recordTemplateChange(c, template.Key)
 
 	c.JSON(http.StatusOK, gin.H{"template": updatedContractAsset})
 }
@@ -1,24 +1,26 @@
 package contract
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
 )
 
 type EditTemplateClauseForm struct {
-	TemplateClause    map[string]interface{}   `form:"templateClause" binding:"required"`
-	Name              string                   `form:"name"`
-	Number            *float64                 `form:"number"`
-	Description       string                   `form:"description"`
-	Category          string                   `form:"category"`
-	ActionType        *float64                 `form:"actionType"`
-	Dependencies      []map[string]interface{} `form:"dependencies"`
-	DefaultInputs     map[string]interface{}   `form:"defaultInputs"`
-	DefaultParameters map[string]interface{}   `form:"defaultParameters"`
-	Optional          *bool                    `form:"optional"`
+	TemplateClause    chaincode.AssetRef     `form:"templateClause" binding:"required"`
+	Name              string                 `form:"name"`
+	Number            *float64               `form:"number"`
+	Description       string                 `form:"description"`
+	Category          string                 `form:"category"`
+	ActionType        *float64               `form:"actionType"`
+	Dependencies      []chaincode.AssetRef   `form:"dependencies"`
+	DefaultInputs     map[string]interface{} `form:"defaultInputs"`
+	DefaultParameters map[string]interface{} `form:"defaultParameters"`
+	Optional          *bool                  `form:"optional"`
 }
 
 func EditTemplateClause(c *gin.Context) {
@@ -28,49 +30,43 @@ func EditTemplateClause(c *gin.Context) {
 		return
 	}
 
-	_, err := chaincode.SearchAsset(form.TemplateClause)
+	templateClause, err := chaincode.GetTemplateClause(c.Request.Context(), form.TemplateClause.Key)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find template asset", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to find template asset", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
-	req := map[string]interface{}{
-		"templateClause": form.TemplateClause,
-	}
-
-	if len(form.Dependencies) > 0 {
-		req["dependencies"] = form.Dependencies
+	if templateClause.Template == nil {
+		errorhandler.ReturnError(c, errors.New("template clause has no template"), "Failed to find the template of the clause", http.StatusBadRequest)
+		return
 	}
-	if form.Description != "" {
-		req["description"] = form.Description
+	templateKey := templateClause.Template.Key
+	if _, _, ok := templateForRole(c, templateKey, db.TemplateEditor); !ok {
+		return
 	}
-	if form.Name != "" {
-		req["name"] = form.Name
+	recordTemplateChange(c, templateKey)
+
+	update := chaincode.TemplateClauseUpdate{
+		Name:              form.Name,
+		Number:            form.Number,
+		Description:       form.Description,
+		Category:          form.Category,
+		Dependencies:      form.Dependencies,
+		DefaultInputs:     form.DefaultInputs,
+		DefaultParameters: form.DefaultParameters,
+		Optional:          form.Optional,
 	}
 	if form.ActionType != nil {
-		req["actionType"] = *form.ActionType
-	}
-	if form.Number != nil {
-		req["number"] = *form.Number
-	}
-	if form.Category != "" {
-		req["category"] = form.Category
-	}
-	if form.DefaultInputs != nil {
-		req["defaultInputs"] = form.DefaultInputs
-	}
-	if form.DefaultParameters != nil {
-		req["defaultParameters"] = form.DefaultParameters
-	}
-	if form.Optional != nil {
-		req["optional"] = *form.Optional
+		actionType := chaincode.ActionType(*form.ActionType)
+		update.ActionType = &actionType
 	}
 
-	updatedContractAsset, err := chaincode.EditTemplateClause(req)
+	updatedContractAsset, err := chaincode.EditTemplateClause(c.Request.Context(), templateClause.Ref(), update)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to edit template clause", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to edit template clause", errorhandler.ChaincodeStatus(err))
 		return
 	}
+	recordTemplateChange(c, templateKey)
 
 	c.JSON(http.StatusOK, gin.H{"templateClause": updatedContractAsset})
 }
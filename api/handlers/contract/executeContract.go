@@ -1,27 +1,61 @@
 package contract
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/google/logger"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
 )
 
-func ExecuteContract() {
+// ExecuteContract executes the active contracts with executable clauses,
+// records every attempt, notifies the parties of the outcome and completes or
+// cancels the contracts accordingly. It fails when any of the contracts could
+// not be executed.
+func ExecuteContract(ctx context.Context) error {
 
-	contracts, err := chaincode.GetExecutableContract()
+	contracts, err := chaincode.GetExecutableContract(ctx)
 	if err != nil {
-		logger.Errorf("failed to get executable contracts: %v", err)
-		return
+		return fmt.Errorf("failed to get executable contracts: %w", err)
 	}
 
-	for _, contractMap := range contracts {
-		reqMap := map[string]interface{}{
-			"contract": contractMap,
+	failed := 0
+	for _, contract := range contracts {
+		lifecycle, err := loadLifecycle(ctx, contract)
+		if err != nil {
+			logger.Errorf("failed to get lifecycle of contract %s: %v", contract.Key, err)
+			failed++
+			continue
+		}
+		if lifecycle.State != db.ContractActive {
+			continue
 		}
 
-		_, err := chaincode.ExecuteContract(reqMap)
+		execution, err := runContract(ctx, contract, false)
+		if recordErr := db.ContractExecutions().RecordContractExecution(ctx, execution); recordErr != nil {
+			logger.Errorf("failed to record execution of contract %s: %v", contract.Key, recordErr)
+		}
 		if err != nil {
 			logger.Errorf("failed to execute contract: %v", err)
+			failed++
 			continue
 		}
+
+		state := executionOutcome(ctx, contract, execution)
+		notifyExecution(ctx, contract, execution, state)
+		if state != db.ContractActive {
+			_, err := updateLifecycle(ctx, contract, func(l *db.ContractLifecycle) error {
+				return finish(l, state)
+			})
+			if err != nil {
+				logger.Errorf("failed to update lifecycle of contract %s: %v", contract.Key, err)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to execute %d of %d contracts", failed, len(contracts))
 	}
+	return nil
 }
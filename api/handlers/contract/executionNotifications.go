@@ -0,0 +1,176 @@
+package contract
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+// executionOutcome returns the state of a contract after an execution:
+// cancelled when it finalized a cancellation clause, completed when every
+// clause is finalized, and active otherwise. Cancellation clauses are only
+// finalized once the chaincode cancelled the contract.
+func executionOutcome(ctx context.Context, contract chaincode.AutoExecutableContract, execution *db.ContractExecution) db.ContractState {
+	if !execution.Success {
+		return db.ContractActive
+	}
+	for _, clause := range execution.Clauses {
+		if chaincode.ActionType(clause.ActionType) == chaincode.ActionCancelContract && clause.Finalized {
+			return db.ContractCancelled
+		}
+	}
+	if contractFinished(ctx, contract) {
+		return db.ContractCompleted
+	}
+	return db.ContractActive
+}
+
+// notifyExecution tells the owner and the participants of a contract what
+// its executed clauses produced, and whether the contract is now completed.
+// Clauses that were evaluated without changing their result are left out.
+// The notifications reach connected users through the websocket watcher.
+func notifyExecution(ctx context.Context, contract chaincode.AutoExecutableContract, execution *db.ContractExecution, state db.ContractState) {
+	if !execution.Success || len(execution.Clauses) == 0 {
+		return
+	}
+
+	var messages []db.Notification
+	for _, clause := range execution.Clauses {
+		if !clause.Changed && !clause.Finalized {
+			continue
+		}
+		messages = append(messages, db.Notification{
+			Type:     "contract",
+			Message:  clauseMessage(contract, clause),
+			Metadata: clauseMetadata(contract, clause),
+		})
+	}
+
+	if state == db.ContractCompleted {
+		messages = append(messages, db.Notification{
+			Type:     "contract",
+			Message:  fmt.Sprintf("Contract %s is finished", contract.Name),
+			Metadata: map[string]string{"contractID": contract.Key, "state": string(state)},
+		})
+	}
+
+	var notifications []db.Notification
+	for _, userID := range contractParties(contract) {
+		for _, message := range messages {
+			message.UserID = userID
+			notifications = append(notifications, message)
+		}
+	}
+	if len(notifications) == 0 {
+		return
+	}
+
+	if _, err := db.Notifications().CreateNotification(ctx, &notifications); err != nil {
+		logger.Errorf("failed to generate notification: %v", err)
+	}
+}
+
+// clauseMessage describes the outcome of an executed clause
+func clauseMessage(contract chaincode.AutoExecutableContract, clause db.ClauseExecution) string {
+	switch chaincode.ActionType(clause.ActionType) {
+	case chaincode.ActionCheckDateInterval:
+		return fmt.Sprintf("A payment of contract %s is due", contract.Name)
+	case chaincode.ActionMakePayment:
+		return fmt.Sprintf("A payment was made on contract %s", contract.Name)
+	case chaincode.ActionCheckFine:
+		if fine, ok := clause.Result["fine"]; ok {
+			return fmt.Sprintf("A fine of %s was computed on contract %s", formatValue(fine), contract.Name)
+		}
+		return fmt.Sprintf("A fine was computed on contract %s", contract.Name)
+	case chaincode.ActionGetCredit:
+		if credit, ok := clause.Result["credit"]; ok {
+			return fmt.Sprintf("A credit of %s was applied to contract %s", formatValue(credit), contract.Name)
+		}
+		return fmt.Sprintf("A credit was applied to contract %s", contract.Name)
+	case chaincode.ActionCancelContract:
+		return fmt.Sprintf("Contract %s was cancelled", contract.Name)
+	default:
+		return fmt.Sprintf("A clause of contract %s was executed", contract.Name)
+	}
+}
+
+// clauseMetadata carries the clause and the values it computed
+func clauseMetadata(contract chaincode.AutoExecutableContract, clause db.ClauseExecution) map[string]string {
+	metadata := map[string]string{}
+	for name, value := range clause.Result {
+		metadata[name] = formatValue(value)
+	}
+	metadata["contractID"] = contract.Key
+	metadata["clauseKey"] = clause.Key
+	metadata["clauseID"] = clause.Id
+	metadata["actionType"] = strconv.Itoa(clause.ActionType)
+	return metadata
+}
+
+// contractFinished reports whether every clause of a contract is finalized
+func contractFinished(ctx context.Context, contract chaincode.AutoExecutableContract) bool {
+	if len(contract.Clauses) == 0 {
+		return false
+	}
+	for _, ref := range contract.Clauses {
+		clause, err := chaincode.GetClause(ctx, ref.Key)
+		if err != nil {
+			logger.Errorf("failed to get clause %s: %v", ref.Key, err)
+			return false
+		}
+		if !clause.Finalized {
+			return false
+		}
+	}
+	return true
+}
+
+// contractParties returns the keys of the owner and the participants of a
+// contract, without duplicates
+func contractParties(contract chaincode.AutoExecutableContract) []string {
+	seen := map[string]bool{}
+	var parties []string
+	add := func(key string) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			parties = append(parties, key)
+		}
+	}
+
+	add(contract.OwnerKey())
+	for _, participant := range contract.Participants {
+		add(participant.Key)
+	}
+	return parties
+}
+
+// formatValue formats a value computed by the chaincode for a notification
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		s := ""
+		for i, k := range keys {
+			if i > 0 {
+				s += ", "
+			}
+			s += k + ": " + formatValue(v[k])
+		}
+		return s
+	default:
+		return fmt.Sprint(v)
+	}
+}
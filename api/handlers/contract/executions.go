@@ -0,0 +1,162 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// ContractExecutions returns the last recorded executions of a contract, 20
+// unless the limit query param asks for up to 100
+func ContractExecutions(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		errorhandler.ReturnError(c, nil, "limit must be between 1 and 100", http.StatusBadRequest)
+		return
+	}
+
+	contract, _, ok := contractOfRequest(c)
+	if !ok {
+		return
+	}
+
+	executions, err := db.ContractExecutions().ListContractExecutions(c.Request.Context(), contract.Key, limit)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to list contract executions", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"executions": executions})
+}
+
+// DryRunContract evaluates which clauses of a contract would execute and
+// with what results, without committing the execution
+func DryRunContract(c *gin.Context) {
+	contract, _, ok := contractOfRequest(c)
+	if !ok {
+		return
+	}
+
+	execution, err := runContract(c.Request.Context(), *contract, true)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to evaluate contract execution", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"execution": execution})
+}
+
+// contractOfRequest loads the contract of the :key param for its owner or
+// one of its participants, writing the error response otherwise. The key of
+// the caller is returned with it.
+func contractOfRequest(c *gin.Context) (*chaincode.AutoExecutableContract, string, bool) {
+	email := c.Request.Header.Get("Email")
+	if email == "" {
+		errorhandler.ReturnError(c, fmt.Errorf("email not found in headers"), "email not found in headers", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
+	if err != nil {
+		errorhandler.ReturnError(c, err, err.Error(), errorhandler.ChaincodeStatus(err))
+		return nil, "", false
+	}
+
+	contract, err := chaincode.GetContract(c.Request.Context(), c.Param("key"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get contract", errorhandler.ChaincodeStatus(err))
+		return nil, "", false
+	}
+
+	if contract.OwnerKey() != signerKey && !contract.HasParticipant(signerKey) {
+		errorhandler.ReturnError(c, errors.New("user is not a party of the contract"), "Forbidden", http.StatusForbidden)
+		return nil, "", false
+	}
+	return contract, signerKey, true
+}
+
+// runContract executes a contract, or only evaluates its execution when
+// dryRun is set. The returned execution describes the attempt even when it
+// failed, together with the error.
+func runContract(ctx context.Context, contract chaincode.AutoExecutableContract, dryRun bool) (*db.ContractExecution, error) {
+	execution := &db.ContractExecution{
+		ContractKey: contract.Key,
+		DryRun:      dryRun,
+		StartedAt:   time.Now().UTC(),
+		Clauses:     []db.ClauseExecution{},
+	}
+
+	err := evaluateClauses(ctx, contract, dryRun, execution)
+
+	execution.DurationMs = time.Since(execution.StartedAt).Milliseconds()
+	execution.Success = err == nil
+	if err != nil {
+		execution.Error = err.Error()
+	}
+	return execution, err
+}
+
+// evaluateClauses runs the execution of a contract and fills in the clauses
+// it evaluated, with their inputs and results
+func evaluateClauses(ctx context.Context, contract chaincode.AutoExecutableContract, dryRun bool, execution *db.ContractExecution) error {
+	var evaluated []chaincode.Clause
+	for _, ref := range contract.Clauses {
+		clause, err := chaincode.GetClause(ctx, ref.Key)
+		if err != nil {
+			return fmt.Errorf("failed to get clause %s: %w", ref.Key, err)
+		}
+		if clause.Executable && !clause.Finalized {
+			evaluated = append(evaluated, *clause)
+		}
+	}
+
+	var (
+		executed *chaincode.AutoExecutableContract
+		err      error
+	)
+	if dryRun {
+		executed, err = chaincode.SimulateContractExecution(ctx, contract)
+	} else {
+		executed, err = chaincode.ExecuteContract(ctx, contract)
+	}
+
+	results := map[string]chaincode.Clause{}
+	if executed != nil {
+		for _, clause := range executed.Clauses {
+			results[clause.Key] = clause
+		}
+	}
+
+	for _, clause := range evaluated {
+		after := results[clause.Key]
+		// The chaincode may answer with references only, in which case the
+		// committed clauses are read back from the ledger
+		if after.Result == nil && err == nil && !dryRun {
+			if stored, getErr := chaincode.GetClause(ctx, clause.Key); getErr == nil {
+				after = *stored
+			}
+		}
+
+		execution.Clauses = append(execution.Clauses, db.ClauseExecution{
+			Key:         clause.Key,
+			Id:          clause.Id,
+			Description: clause.Description,
+			ActionType:  int(clause.ActionType),
+			Input:       clause.Input,
+			Result:      after.Result,
+			Finalized:   after.Finalized,
+			Changed:     after.Result != nil && !reflect.DeepEqual(clause.Result, after.Result),
+		})
+	}
+	return err
+}
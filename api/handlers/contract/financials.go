@@ -0,0 +1,102 @@
+package contract
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/financials"
+	"github.com/umairmaseed/clausia-api/money"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// ContractFinancials returns the payments, fines and credits of the
+// contract of the :key param with its outstanding balance, as JSON or, with
+// the format=csv query param, as a CSV timeline. The amounts are converted
+// into the currency query param, the default currency when not given.
+func ContractFinancials(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		errorhandler.ReturnError(c, errors.New("format must be json or csv"), "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	currency := money.DefaultCurrency()
+	if code := c.Query("currency"); code != "" {
+		var err error
+		if currency, err = money.Currency(code); err != nil {
+			errorhandler.ReturnError(c, err, "Invalid currency", http.StatusBadRequest)
+			return
+		}
+	}
+
+	contract, err := chaincode.GetContract(ctx, c.Param("key"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get contract", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	var clauses []financials.ClauseHistory
+	var refunds []financials.Refund
+	for _, ref := range contract.Clauses {
+		clause, err := chaincode.GetClause(ctx, ref.Key)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to get clause", errorhandler.ChaincodeStatus(err))
+			return
+		}
+		versions, err := chaincode.GetClauseHistory(ctx, ref.Key)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to get clause history", errorhandler.ChaincodeStatus(err))
+			return
+		}
+		clauses = append(clauses, financials.ClauseHistory{Clause: *clause, Versions: versions})
+
+		if clause.ActionType != chaincode.ActionMakePayment {
+			continue
+		}
+		payments, err := db.ClausePayments().ListClausePayments(ctx, ref.Key)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to list payments", http.StatusInternalServerError)
+			return
+		}
+		for _, payment := range payments {
+			if payment.Refunded > 0 {
+				refunds = append(refunds, financials.Refund{
+					Time:      payment.UpdatedAt,
+					ClauseKey: payment.ClauseKey,
+					Amount:    money.FromMinor(payment.Refunded, payment.Currency),
+					Reference: payment.IntentID,
+				})
+			}
+		}
+	}
+
+	report, err := financials.Build(ctx, contract.Key, currency, money.DefaultRates(), clauses, refunds)
+	if errors.Is(err, money.ErrNoRate) {
+		errorhandler.ReturnError(c, err, "Failed to convert financials", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to compute financials", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "csv" {
+		var buf bytes.Buffer
+		if err := report.WriteCSV(&buf); err != nil {
+			errorhandler.ReturnError(c, err, "Failed to export financials", http.StatusInternalServerError)
+			return
+		}
+		c.Header("Content-Disposition", utils.AttachmentDisposition("financials-"+contract.Name+".csv"))
+		c.Data(http.StatusOK, "text/csv", buf.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"financials": report})
+}
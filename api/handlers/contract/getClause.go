@@ -1,6 +1,7 @@
 package contract
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -16,23 +17,17 @@ func GetClause(c *gin.Context) {
 		return
 	}
 
-	queryMapClause := map[string]interface{}{
-		"@assetType": "clause",
-		"@key":       clauseKey,
-	}
-
-	clauseAsset, err := chaincode.SearchAssetTx(queryMapClause)
-	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to search for clause", http.StatusInternalServerError)
-		return
-	}
-
 	response := gin.H{}
 
-	if len(clauseAsset) > 0 {
-		response["clause"] = clauseAsset[0]
-	} else {
+	clause, err := chaincode.GetClause(c.Request.Context(), clauseKey)
+	switch {
+	case errors.Is(err, chaincode.ErrNotFound):
 		response["clause"] = map[string]interface{}{}
+	case err != nil:
+		errorhandler.ReturnError(c, err, "Failed to search for clause", errorhandler.ChaincodeStatus(err))
+		return
+	default:
+		response["clause"] = clause
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -1,6 +1,7 @@
 package contract
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -16,23 +17,17 @@ func GetContract(c *gin.Context) {
 		return
 	}
 
-	queryMapContract := map[string]interface{}{
-		"@assetType": "autoExecutableContract",
-		"@key":       contractKey,
-	}
-
-	contractAsset, err := chaincode.SearchAssetTx(queryMapContract)
-	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to search for contract", http.StatusInternalServerError)
-		return
-	}
-
 	response := gin.H{}
 
-	if len(contractAsset) > 0 {
-		response["contract"] = contractAsset[0]
-	} else {
+	contract, err := chaincode.GetContract(c.Request.Context(), contractKey)
+	switch {
+	case errors.Is(err, chaincode.ErrNotFound):
 		response["contract"] = map[string]interface{}{}
+	case err != nil:
+		errorhandler.ReturnError(c, err, "Failed to search for contract", errorhandler.ChaincodeStatus(err))
+		return
+	default:
+		response["contract"] = contract
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -19,27 +19,24 @@ func GetDatesWithCLause(c *gin.Context) {
 	}
 
 	query := map[string]interface{}{
-		"@assetType": "autoExecutableContract",
 		"clauses": map[string]interface{}{
 			"$elemMatch": map[string]interface{}{
-				"@assetType": "clause",
+				"@assetType": chaincode.AssetTypeClause,
 				"@key":       clauseKey,
 			},
 		},
 	}
 
-	result, err := chaincode.SearchAssetTx(query)
+	result, err := chaincode.SearchContracts(c.Request.Context(), query)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to search for contract", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to search for contract", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
 	response := gin.H{}
 
-	fmt.Println("result", result)
-	if len(result) > 0 {
-		contractAsset := result[0]
-		response["dates"] = contractAsset["dates"]
+	if len(result) > 0 && result[0].Dates != nil {
+		response["dates"] = result[0].Dates
 	} else {
 		response["dates"] = map[string]interface{}{}
 	}
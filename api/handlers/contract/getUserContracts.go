@@ -18,39 +18,31 @@ func GetUserContracts(c *gin.Context) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
-		errorhandler.ReturnError(c, err, err.Error(), http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, err.Error(), errorhandler.ChaincodeStatus(err))
 		return
 	}
 
 	queryMapUserContract := map[string]interface{}{
-		"@assetType": "autoExecutableContract",
-		"owner": map[string]interface{}{
-			"@assetType": "user",
-			"@key":       signerKey,
-		},
+		"owner": chaincode.UserRef(signerKey),
 	}
 
-	userContractAsset, err := chaincode.SearchAssetTx(queryMapUserContract)
+	userContractAsset, err := chaincode.SearchContracts(c.Request.Context(), queryMapUserContract)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to search for contracts", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to search for contracts", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
 	queryMapParticipantContract := map[string]interface{}{
-		"@assetType": "autoExecutableContract",
 		"participants": map[string]interface{}{
-			"$elemMatch": map[string]interface{}{
-				"@assetType": "user",
-				"@key":       signerKey,
-			},
+			"$elemMatch": chaincode.UserRef(signerKey),
 		},
 	}
 
-	participantContractsAsset, err := chaincode.SearchAssetTx(queryMapParticipantContract)
+	participantContractsAsset, err := chaincode.SearchContracts(c.Request.Context(), queryMapParticipantContract)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to search for participant contracts", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to search for participant contracts", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
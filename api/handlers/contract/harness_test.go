@@ -0,0 +1,195 @@
+package contract
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/chaincode/fake"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/money"
+	"github.com/umairmaseed/clausia-api/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// harness runs the handlers against an in-process fake chaincode, with
+// lifecycles, receipts and files kept in memory and notifications recorded
+type harness struct {
+	t             *testing.T
+	ledger        *fake.Server
+	lifecycles    *db.MemoryLifecycleStore
+	receipts      *db.MemoryPaymentReceiptStore
+	notifications *recordingNotifier
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	ledger := fake.NewServer()
+	t.Cleanup(ledger.Close)
+
+	chaincode.SetDefaultClient(ledger.Client())
+	t.Cleanup(func() { chaincode.SetDefaultClient(nil) })
+
+	notifications := &recordingNotifier{}
+	db.SetNotifier(notifications)
+	t.Cleanup(func() { db.SetNotifier(nil) })
+
+	storage.SetDefault(storage.NewMemoryStore())
+	t.Cleanup(func() { storage.SetDefault(nil) })
+
+	lifecycles := db.NewMemoryLifecycleStore()
+	db.SetLifecycles(lifecycles)
+	t.Cleanup(func() { db.SetLifecycles(nil) })
+
+	receipts := db.NewMemoryPaymentReceiptStore()
+	db.SetPaymentReceipts(receipts)
+	t.Cleanup(func() { db.SetPaymentReceipts(nil) })
+
+	money.SetDefaultRates(&money.StaticRates{
+		Source: "test",
+		Base:   "BRL",
+		AsOf:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Rates:  map[string]money.Decimal{"BRL": money.MustParseDecimal("1")},
+	})
+	t.Cleanup(func() { money.SetDefaultRates(nil) })
+
+	return &harness{
+		t:             t,
+		ledger:        ledger,
+		lifecycles:    lifecycles,
+		receipts:      receipts,
+		notifications: notifications,
+	}
+}
+
+// user seeds a user asset on the ledger and returns its key
+func (h *harness) user(name, email, cpf string) string {
+	user := h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeUser,
+		"@key":       "user:" + cpf,
+		"cpf":        cpf,
+		"email":      email,
+		"name":       name,
+	})
+	return user["@key"].(string)
+}
+
+// lease seeds a contract of owner with a payment clause, clause:rent, and
+// returns the key of the contract
+func (h *harness) lease(owner string, participants ...string) string {
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:rent",
+		"id":         "rent",
+		"actionType": float64(chaincode.ActionMakePayment),
+	})
+
+	contract := map[string]interface{}{
+		"@assetType": chaincode.AssetTypeContract,
+		"@key":       "autoExecutableContract:lease",
+		"name":       "Lease",
+		"owner":      ref(chaincode.AssetTypeUser, owner),
+		"clauses":    []interface{}{ref(chaincode.AssetTypeClause, "clause:rent")},
+	}
+	var refs []interface{}
+	for _, participant := range participants {
+		refs = append(refs, ref(chaincode.AssetTypeUser, participant))
+	}
+	if len(refs) > 0 {
+		contract["participants"] = refs
+	}
+	return h.ledger.Put(contract)["@key"].(string)
+}
+
+// ref returns an asset reference as stored on the ledger
+func ref(assetType, key string) map[string]interface{} {
+	return map[string]interface{}{"@assetType": assetType, "@key": key}
+}
+
+// lifecycle returns the stored lifecycle of a contract
+func (h *harness) lifecycle(contractKey string) *db.ContractLifecycle {
+	h.t.Helper()
+
+	lifecycle, err := h.lifecycles.GetContractLifecycle(context.Background(), contractKey)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return lifecycle
+}
+
+// calls counts the calls to a transaction of the ledger
+func (h *harness) calls(txName string) int {
+	count := 0
+	for _, call := range h.ledger.Calls() {
+		if call == txName {
+			count++
+		}
+	}
+	return count
+}
+
+// serve runs handler on a multipart request sent by the user with email,
+// carrying fields and, when given, a receipt file
+func (h *harness) serve(handler gin.HandlerFunc, method, target, email string, fields url.Values, receipt []byte, params ...gin.Param) *httptest.ResponseRecorder {
+	h.t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, values := range fields {
+		for _, value := range values {
+			if err := writer.WriteField(name, value); err != nil {
+				h.t.Fatal(err)
+			}
+		}
+	}
+	if receipt != nil {
+		part, err := writer.CreateFormFile("Receipt", "receipt.pdf")
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		part.Write(receipt)
+	}
+	writer.Close()
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(method, target, &body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	c.Request.Header.Set("Email", email)
+	c.Params = params
+
+	handler(c)
+	return rec
+}
+
+// expect fails the test unless rec has the given status
+func (h *harness) expect(rec *httptest.ResponseRecorder, status int) {
+	h.t.Helper()
+
+	if rec.Code != status {
+		h.t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body)
+	}
+}
+
+// recordingNotifier keeps the notifications created by the handlers
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []db.Notification
+}
+
+func (n *recordingNotifier) CreateNotification(ctx context.Context, notif *[]db.Notification) (*mongo.InsertManyResult, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.sent = append(n.sent, *notif...)
+	return &mongo.InsertManyResult{}, nil
+}
@@ -0,0 +1,80 @@
+package contract
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/templates"
+)
+
+type instantiateTemplateForm struct {
+	Name          string                 `form:"name" binding:"required"`
+	SignatureDate string                 `form:"signatureDate" binding:"required"`
+	Participants  []chaincode.AssetRef   `form:"participants"`
+	Data          map[string]interface{} `form:"data"`
+	// Parameters holds the parameter values by template clause id
+	Parameters templates.Values `form:"parameters"`
+	// ExcludedClauses lists the ids of optional template clauses to leave out
+	ExcludedClauses []string `form:"excludedClauses"`
+}
+
+// InstantiateTemplate creates a contract with the clauses of a template, whose
+// parameters are replaced by the given values
+func InstantiateTemplate(c *gin.Context) {
+	var form instantiateTemplateForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind request form", http.StatusBadRequest)
+		return
+	}
+
+	template, signerKey, ok := templateOfRequest(c, db.TemplateViewer)
+	if !ok {
+		return
+	}
+
+	// The contract is created from the recorded version, so that it can be
+	// upgraded when the template changes
+	version, err := recordTemplateVersion(c.Request.Context(), template.Key, "")
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to record template version", templateVersionStatus(err))
+		return
+	}
+
+	parties := []string{signerKey}
+	for _, participant := range form.Participants {
+		parties = append(parties, participant.Key)
+	}
+
+	clauses, err := templates.Instantiate(templates.Clauses(*version), form.Parameters, form.ExcludedClauses, parties)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to instantiate template", http.StatusBadRequest)
+		return
+	}
+
+	data := map[string]interface{}{}
+	for k, v := range form.Data {
+		data[k] = v
+	}
+	data["templateKey"] = template.Key
+	data["templateVersion"] = version.Version
+
+	owner := chaincode.UserRef(signerKey)
+	req := chaincode.AutoExecutableContract{
+		Name:          form.Name,
+		SignatureDate: form.SignatureDate,
+		Owner:         &owner,
+		Clauses:       clauses,
+		Data:          data,
+	}
+
+	contract, lifecycle, ok := createContract(c, signerKey, req, form.Participants)
+	if !ok {
+		return
+	}
+	countTemplateUse(c, template.Key, db.TemplateInstantiated)
+
+	c.JSON(http.StatusOK, gin.H{"contract": contract, "lifecycle": lifecycle})
+}
@@ -0,0 +1,219 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// AcceptInvitation adds the invited user of the token to the participants of
+// the contract. The contract becomes active once every invited user has
+// answered.
+func AcceptInvitation(c *gin.Context) {
+	answerInvitation(c, true)
+}
+
+// DeclineInvitation records that the invited user of the token does not join
+// the contract
+func DeclineInvitation(c *gin.Context) {
+	answerInvitation(c, false)
+}
+
+// ContractLifecycle returns the state of a contract and the answers of the
+// invited users, to its owner, participants and invited users
+func ContractLifecycle(c *gin.Context) {
+	email := c.Request.Header.Get("Email")
+	if email == "" {
+		errorhandler.ReturnError(c, fmt.Errorf("email not found in headers"), "email not found in headers", http.StatusBadRequest)
+		return
+	}
+
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
+	if err != nil {
+		errorhandler.ReturnError(c, err, err.Error(), errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	contract, err := chaincode.GetContract(c.Request.Context(), c.Param("key"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get contract", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	lifecycle, err := loadLifecycle(c.Request.Context(), *contract)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get contract lifecycle", http.StatusInternalServerError)
+		return
+	}
+
+	if contract.OwnerKey() != signerKey && !contract.HasParticipant(signerKey) && !containsKey(lifecycle.Invited, signerKey) {
+		errorhandler.ReturnError(c, errors.New("user is not a party of the contract"), "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lifecycle": lifecycle})
+}
+
+// ActivateContract starts a draft contract of the caller, which then executes
+// and takes inputs without waiting on invited users. Contracts with pending
+// invitations become active once they are answered.
+func ActivateContract(c *gin.Context) {
+	contract, err := chaincode.GetContract(c.Request.Context(), c.Param("key"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get contract", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	lifecycle, err := updateLifecycle(c.Request.Context(), *contract, activate)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to activate contract", lifecycleStatus(err))
+		return
+	}
+
+	var notifications []db.Notification
+	for _, userID := range contractParties(*contract) {
+		notifications = append(notifications, db.Notification{
+			UserID:   userID,
+			Type:     "contract",
+			Message:  fmt.Sprintf("Contract %s is active", contract.Name),
+			Metadata: map[string]string{"contractID": contract.Key, "state": string(lifecycle.State)},
+		})
+	}
+	if _, err := db.Notifications().CreateNotification(c.Request.Context(), &notifications); err != nil {
+		logger.Errorf("failed to generate notification: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"contract": contract, "lifecycle": lifecycle})
+}
+
+// answerInvitation verifies the invite token of the query, which must have
+// been issued to the logged in user, and records the answer
+func answerInvitation(c *gin.Context, accept bool) {
+	ctx := c.Request.Context()
+
+	tokenString := c.Query("token")
+	if tokenString == "" {
+		errorhandler.ReturnError(c, fmt.Errorf("token is required"), "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := utils.VerifyInviteToken(tokenString, jwtSecret)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
+	if !strings.EqualFold(c.Request.Header.Get("Email"), claims.Email) {
+		errorhandler.ReturnError(c, errors.New("the invitation was sent to another user"), "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	participantKey, err := utils.SearchAndReturnSignerKey(ctx, claims.Email)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	contract, err := chaincode.GetContract(ctx, claims.ContractID)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find contract asset", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	// The answer is checked before the ledger is changed, and again when it
+	// is saved
+	lifecycle, err := loadLifecycle(ctx, *contract)
+	if err == nil {
+		err = answer(lifecycle, participantKey, accept)
+	}
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to answer invitation", lifecycleStatus(err))
+		return
+	}
+
+	if accept {
+		participants := []chaincode.AssetRef{chaincode.UserRef(participantKey)}
+		contract, err = chaincode.AddParticipants(ctx, contract.Ref(), participants)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to add participants to contract", errorhandler.ChaincodeStatus(err))
+			return
+		}
+	}
+
+	lifecycle, err = updateLifecycle(ctx, *contract, func(l *db.ContractLifecycle) error {
+		return answer(l, participantKey, accept)
+	})
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to answer invitation", lifecycleStatus(err))
+		return
+	}
+
+	notifyAnswer(c, *contract, lifecycle, claims.Email, accept)
+
+	c.JSON(http.StatusOK, gin.H{"contract": contract, "lifecycle": lifecycle})
+}
+
+// notifyAnswer tells the owner of a contract about the answer of an invited
+// user, and that it is up to them when the contract went back to draft. Every
+// party is told when the contract became active.
+func notifyAnswer(c *gin.Context, contract chaincode.AutoExecutableContract, lifecycle *db.ContractLifecycle, email string, accept bool) {
+	verb := "declined"
+	if accept {
+		verb = "accepted"
+	}
+
+	notifications := []db.Notification{{
+		UserID:   contract.OwnerKey(),
+		Type:     "contract",
+		Message:  fmt.Sprintf("%s %s to join contract %s", email, verb, contract.Name),
+		Metadata: map[string]string{"contractID": contract.Key, "state": string(lifecycle.State)},
+	}}
+
+	if lifecycle.State == db.ContractDraft {
+		notifications[0].Message += ", the contract is back to draft until you invite them again or activate it"
+	}
+
+	if lifecycle.State == db.ContractActive {
+		for _, userID := range contractParties(contract) {
+			notifications = append(notifications, db.Notification{
+				UserID:   userID,
+				Type:     "contract",
+				Message:  fmt.Sprintf("Contract %s is active", contract.Name),
+				Metadata: map[string]string{"contractID": contract.Key, "state": string(lifecycle.State)},
+			})
+		}
+	}
+
+	if _, err := db.Notifications().CreateNotification(c.Request.Context(), &notifications); err != nil {
+		logger.Errorf("failed to generate notification: %v", err)
+	}
+}
+
+// inviteMetadata returns the metadata of the notification inviting a user to
+// a contract, with the token to answer it when one can be issued
+func inviteMetadata(ctx context.Context, contractKey, userKey string) map[string]string {
+	metadata := map[string]string{"contractID": contractKey}
+
+	user, err := chaincode.GetSigner(ctx, userKey)
+	if err != nil {
+		logger.Errorf("failed to get invited user %s: %v", userKey, err)
+		return metadata
+	}
+
+	token, err := utils.GenerateInviteToken(user.Email, contractKey, jwtSecret)
+	if err != nil {
+		logger.Errorf("failed to generate invite token: %v", err)
+		return metadata
+	}
+	metadata["token"] = token
+	return metadata
+}
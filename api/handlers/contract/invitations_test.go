@@ -0,0 +1,64 @@
+package contract
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+func TestDeclineKeepsContractFromActivating(t *testing.T) {
+	t.Setenv("INVITE_EXPiRY_TIME", "24")
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	carol := h.user("Carol", "carol@example.com", "33333333333")
+
+	contractKey := h.lease(alice)
+	if err := h.lifecycles.SaveContractLifecycle(context.Background(), &db.ContractLifecycle{
+		ContractKey: contractKey,
+		State:       db.ContractPendingAcceptance,
+		Invited:     []string{bob, carol},
+		Accepted:    []string{},
+		Declined:    []string{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	token := func(email string) string {
+		token, err := utils.GenerateInviteToken(email, contractKey, jwtSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	h.expect(h.serve(DeclineInvitation, http.MethodPost, "/contracts/invitations/decline?token="+token("bob@example.com"), "bob@example.com", nil, nil), http.StatusOK)
+	h.expect(h.serve(AcceptInvitation, http.MethodPost, "/contracts/invitations/accept?token="+token("carol@example.com"), "carol@example.com", nil, nil), http.StatusOK)
+
+	lifecycle := h.lifecycle(contractKey)
+	if lifecycle.State != db.ContractDraft {
+		t.Fatalf("expected the declined contract to wait for its owner, got %+v", lifecycle)
+	}
+	if err := answer(lifecycle, bob, true); err == nil {
+		t.Fatal("expected the answer of bob to be final")
+	}
+
+	// The owner decides to go on without bob
+	if err := activate(lifecycle); err != nil || lifecycle.State != db.ContractActive {
+		t.Fatalf("expected the owner to activate the contract, got %v, %+v", err, lifecycle)
+	}
+}
+
+func TestAcceptancesActivateContract(t *testing.T) {
+	lifecycle := &db.ContractLifecycle{State: db.ContractPendingAcceptance, Invited: []string{"user:bob", "user:carol"}}
+
+	if err := answer(lifecycle, "user:bob", true); err != nil || lifecycle.State != db.ContractPendingAcceptance {
+		t.Fatalf("expected the contract to wait for carol, got %v, %+v", err, lifecycle)
+	}
+	if err := answer(lifecycle, "user:carol", true); err != nil || lifecycle.State != db.ContractActive {
+		t.Fatalf("expected the contract to be active, got %v, %+v", err, lifecycle)
+	}
+}
@@ -0,0 +1,247 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+// lifecycleRetries bounds the saves retried after a concurrent change
+const lifecycleRetries = 3
+
+// stateError is returned by a transition that the contract state forbids
+type stateError struct {
+	state db.ContractState
+}
+
+func (e *stateError) Error() string {
+	return fmt.Sprintf("contract is %s", e.state)
+}
+
+var (
+	errNotInvited      = errors.New("user has no pending invitation to the contract")
+	errAlreadyAnswered = errors.New("user already answered the invitation")
+	errOwnerInvited    = errors.New("the owner of a contract cannot be invited to it")
+	errClausesAccepted = errors.New("clauses cannot change once an invited user accepted them")
+)
+
+// lifecycleStatus returns the HTTP status of an error of a lifecycle change
+func lifecycleStatus(err error) int {
+	var stateErr *stateError
+	switch {
+	case errors.As(err, &stateErr),
+		errors.Is(err, errAlreadyAnswered),
+		errors.Is(err, db.ErrLifecycleConflict):
+		return http.StatusConflict
+	case errors.Is(err, errNotInvited):
+		return http.StatusForbidden
+	case errors.Is(err, errOwnerInvited):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// loadLifecycle returns the lifecycle of a contract. Contracts created before
+// lifecycles were stored are active, with their current participants.
+func loadLifecycle(ctx context.Context, contract chaincode.AutoExecutableContract) (*db.ContractLifecycle, error) {
+	lifecycle, err := db.Lifecycles().GetContractLifecycle(ctx, contract.Key)
+	if errors.Is(err, db.ErrLifecycleNotFound) {
+		lifecycle = &db.ContractLifecycle{
+			ContractKey: contract.Key,
+			State:       db.ContractActive,
+			Invited:     []string{},
+			Accepted:    []string{},
+			Declined:    []string{},
+		}
+		for _, participant := range contract.Participants {
+			lifecycle.Accepted = append(lifecycle.Accepted, participant.Key)
+		}
+		return lifecycle, nil
+	}
+	return lifecycle, err
+}
+
+// updateLifecycle applies change to the lifecycle of a contract and saves it,
+// applying it again on a fresh copy when it was changed concurrently
+func updateLifecycle(ctx context.Context, contract chaincode.AutoExecutableContract, change func(*db.ContractLifecycle) error) (*db.ContractLifecycle, error) {
+	var err error
+	for attempt := 0; attempt < lifecycleRetries; attempt++ {
+		var lifecycle *db.ContractLifecycle
+		lifecycle, err = loadLifecycle(ctx, contract)
+		if err != nil {
+			return nil, err
+		}
+		if err = change(lifecycle); err != nil {
+			return nil, err
+		}
+
+		err = db.Lifecycles().SaveContractLifecycle(ctx, lifecycle)
+		if err == nil {
+			return lifecycle, nil
+		}
+		if !errors.Is(err, db.ErrLifecycleConflict) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// requireState fails unless the lifecycle is in one of the allowed states
+func requireState(lifecycle *db.ContractLifecycle, allowed ...db.ContractState) error {
+	for _, state := range allowed {
+		if lifecycle.State == state {
+			return nil
+		}
+	}
+	return &stateError{state: lifecycle.State}
+}
+
+// invite adds users to the participants awaited by a draft or pending
+// contract. Users who declined are invited again.
+func invite(lifecycle *db.ContractLifecycle, ownerKey string, userKeys []string) error {
+	if err := requireState(lifecycle, db.ContractDraft, db.ContractPendingAcceptance); err != nil {
+		return err
+	}
+
+	for _, key := range userKeys {
+		switch {
+		case key == ownerKey:
+			return errOwnerInvited
+		case containsKey(lifecycle.Invited, key), containsKey(lifecycle.Accepted, key):
+			continue
+		}
+		lifecycle.Declined = removeKey(lifecycle.Declined, key)
+		lifecycle.Invited = append(lifecycle.Invited, key)
+	}
+
+	if len(lifecycle.Invited) > 0 {
+		lifecycle.State = db.ContractPendingAcceptance
+	}
+	return nil
+}
+
+// answer records the answer of an invited user. The contract becomes active
+// once every invited user has accepted. When one of them declined, it goes
+// back to draft once the others answered, for the owner to invite them again
+// or to activate it without them.
+func answer(lifecycle *db.ContractLifecycle, userKey string, accept bool) error {
+	if !containsKey(lifecycle.Invited, userKey) {
+		if containsKey(lifecycle.Accepted, userKey) || containsKey(lifecycle.Declined, userKey) {
+			return errAlreadyAnswered
+		}
+		return errNotInvited
+	}
+	if err := requireState(lifecycle, db.ContractPendingAcceptance); err != nil {
+		return err
+	}
+
+	lifecycle.Invited = removeKey(lifecycle.Invited, userKey)
+	if accept {
+		lifecycle.Accepted = append(lifecycle.Accepted, userKey)
+	} else {
+		lifecycle.Declined = append(lifecycle.Declined, userKey)
+	}
+
+	if len(lifecycle.Invited) == 0 {
+		if len(lifecycle.Declined) == 0 {
+			lifecycle.State = db.ContractActive
+		} else {
+			lifecycle.State = db.ContractDraft
+		}
+	}
+	return nil
+}
+
+// activate starts a draft contract, which awaits no invited user: one created
+// without participants or one that some invited users declined
+func activate(lifecycle *db.ContractLifecycle) error {
+	if err := requireState(lifecycle, db.ContractDraft); err != nil {
+		return err
+	}
+	lifecycle.State = db.ContractActive
+	return nil
+}
+
+// finish ends an active contract as completed or cancelled
+func finish(lifecycle *db.ContractLifecycle, state db.ContractState) error {
+	if err := requireState(lifecycle, db.ContractActive); err != nil {
+		return err
+	}
+	lifecycle.State = state
+	return nil
+}
+
+// contractInState writes a conflict response unless the contract is in one
+// of the allowed states
+func contractInState(c *gin.Context, contract chaincode.AutoExecutableContract, allowed ...db.ContractState) bool {
+	lifecycle, err := loadLifecycle(c.Request.Context(), contract)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get contract lifecycle", http.StatusInternalServerError)
+		return false
+	}
+	if err := requireState(lifecycle, allowed...); err != nil {
+		errorhandler.ReturnError(c, err, "Contract cannot be changed", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// clausesChangeable writes a conflict response unless the clauses of the
+// contract can change: while it is a draft or awaits its invited users, and
+// none of them accepted it yet
+func clausesChangeable(c *gin.Context, contract chaincode.AutoExecutableContract) bool {
+	lifecycle, err := loadLifecycle(c.Request.Context(), contract)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get contract lifecycle", http.StatusInternalServerError)
+		return false
+	}
+	if err := requireState(lifecycle, db.ContractDraft, db.ContractPendingAcceptance); err != nil {
+		errorhandler.ReturnError(c, err, "Contract cannot be changed", http.StatusConflict)
+		return false
+	}
+	if len(lifecycle.Accepted) > 0 {
+		errorhandler.ReturnError(c, errClausesAccepted, "Contract cannot be changed", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// clauseContractInState loads the contract of a clause and writes the error
+// response unless it is in one of the allowed states
+func clauseContractInState(c *gin.Context, clause chaincode.AssetRef, allowed ...db.ContractState) (*chaincode.AutoExecutableContract, bool) {
+	contract, err := chaincode.GetClauseContract(c.Request.Context(), clause.Key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find the contract of the clause", errorhandler.ChaincodeStatus(err))
+		return nil, false
+	}
+	if !contractInState(c, *contract, allowed...) {
+		return nil, false
+	}
+	return contract, true
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func removeKey(keys []string, key string) []string {
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k != key {
+			out = append(out, k)
+		}
+	}
+	return out
+}
@@ -0,0 +1,563 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/money"
+	"github.com/umairmaseed/clausia-api/payments"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+type paymentIntentForm struct {
+	Clause       chaincode.AssetRef `form:"clause" binding:"required"`
+	Payment      *money.Decimal     `form:"payment" binding:"required"`
+	Currency     string             `form:"currency"`
+	FinalPayment bool               `form:"finalPayment"`
+	Date         string             `form:"date" binding:"required"`
+}
+
+type refundForm struct {
+	// Amount is the amount to refund, in the currency of the payment. The
+	// whole payment is refunded without it.
+	Amount *money.Decimal `form:"amount"`
+}
+
+// CreatePaymentIntent starts the payment of a make payment clause with the
+// payment provider. The payment is recorded on the clause once the provider
+// confirms it through the webhook.
+func CreatePaymentIntent(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var form paymentIntentForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind request form", http.StatusBadRequest)
+		return
+	}
+
+	if !policy.Bound(c, form.Clause.Key) {
+		return
+	}
+
+	email := c.Request.Header.Get("Email")
+	if email == "" {
+		errorhandler.ReturnError(c, fmt.Errorf("email not found in headers"), "email not found in headers", http.StatusBadRequest)
+		return
+	}
+
+	payerKey, err := utils.SearchAndReturnSignerKey(ctx, email)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	contract, ok := clauseContractInState(c, form.Clause, db.ContractActive)
+	if !ok {
+		return
+	}
+
+	clause, err := chaincode.GetClause(ctx, form.Clause.Key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find clause asset", errorhandler.ChaincodeStatus(err))
+		return
+	}
+	if clause.ActionType != chaincode.ActionMakePayment {
+		errorhandler.ReturnError(c, errors.New("the clause does not make payments"), "Invalid clause", http.StatusBadRequest)
+		return
+	}
+	if form.FinalPayment {
+		if err := requireNoDispute(ctx, clause.Key); err != nil {
+			errorhandler.ReturnError(c, err, "Final payment cannot be made", receiptStatus(err))
+			return
+		}
+	}
+
+	// The payer is charged in the currency of the form, and the payment
+	// converted into the currency of the clause once it succeeds
+	charged, err := formAmount(*clause, form.Payment, form.Currency)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid payment", http.StatusBadRequest)
+		return
+	}
+	amount, err := charged.Minor()
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid payment", http.StatusBadRequest)
+		return
+	}
+
+	provider := payments.Default()
+	payment := &db.ClausePayment{
+		Provider:     provider.Name(),
+		ClauseKey:    clause.Key,
+		ContractKey:  contract.Key,
+		PayerKey:     payerKey,
+		Amount:       amount,
+		Currency:     strings.ToLower(charged.Currency),
+		FinalPayment: form.FinalPayment,
+		Date:         form.Date,
+		Status:       payments.StatusPending,
+	}
+	if err := db.ClausePayments().CreateClausePayment(ctx, payment); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to store payment", http.StatusInternalServerError)
+		return
+	}
+
+	intent, err := provider.CreateIntent(ctx, payments.IntentRequest{
+		Amount:   payment.Amount,
+		Currency: payment.Currency,
+		Metadata: map[string]string{
+			"paymentId":   payment.ID,
+			"clauseKey":   payment.ClauseKey,
+			"contractKey": payment.ContractKey,
+		},
+		IdempotencyKey: payment.ID,
+	})
+	if err != nil {
+		payment.Status = payments.StatusFailed
+		payment.Error = err.Error()
+		if err := db.ClausePayments().SaveClausePayment(ctx, payment); err != nil {
+			logger.Errorf("failed to save payment %s: %v", payment.ID, err)
+		}
+		errorhandler.ReturnError(c, err, "Failed to create payment intent", paymentStatus(err))
+		return
+	}
+
+	payment.IntentID = intent.ID
+	if err := db.ClausePayments().SaveClausePayment(ctx, payment); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to store payment", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payment": payment, "clientSecret": intent.ClientSecret})
+}
+
+// ClausePayments lists the payments of the clause of the clauseKey query
+func ClausePayments(c *gin.Context) {
+	list, err := db.ClausePayments().ListClausePayments(c.Request.Context(), c.Query("clauseKey"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to list payments", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payments": list})
+}
+
+// GetClausePayment returns a payment to the parties of its contract. The
+// status of payments in progress is fetched from the provider, which makes up
+// for missed webhooks.
+func GetClausePayment(c *gin.Context) {
+	payment, ok := paymentOfRequest(c, policy.Owner, policy.Participant)
+	if !ok {
+		return
+	}
+
+	if payment.IntentID != "" && (payment.Status == payments.StatusPending || payment.Status == payments.StatusAuthorized) {
+		if provider, err := paymentProvider(*payment); err != nil {
+			logger.Errorf("failed to refresh payment %s: %v", payment.ID, err)
+		} else if intent, err := provider.Intent(c.Request.Context(), payment.IntentID); err != nil {
+			logger.Errorf("failed to fetch payment intent %s: %v", payment.IntentID, err)
+		} else if payment, err = advancePayment(c.Request.Context(), provider, payment.ID, *intent); err != nil {
+			errorhandler.ReturnError(c, err, "Failed to update payment", paymentStatus(err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payment": payment})
+}
+
+// RefundClausePayment returns a succeeded payment, or part of it, to the
+// payer. Only the owner of the contract, who received it, can refund it.
+func RefundClausePayment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var form refundForm
+	if err := c.ShouldBind(&form); err != nil && !errors.Is(err, io.EOF) {
+		errorhandler.ReturnError(c, err, "Failed to bind request form", http.StatusBadRequest)
+		return
+	}
+
+	payment, ok := paymentOfRequest(c, policy.Owner)
+	if !ok {
+		return
+	}
+	if payment.Status != payments.StatusSucceeded {
+		errorhandler.ReturnError(c, fmt.Errorf("payment is %s: %w", payment.Status, payments.ErrInvalidState), "Payment cannot be refunded", http.StatusConflict)
+		return
+	}
+	var amount int64
+	if form.Amount != nil {
+		refund := money.Money{Amount: *form.Amount, Currency: chargedAmount(*payment).Currency}
+		minor, err := refund.Minor()
+		if err != nil || minor <= 0 {
+			errorhandler.ReturnError(c, fmt.Errorf("the refund must be a positive amount of %s", refund.Currency), "Invalid amount", http.StatusBadRequest)
+			return
+		}
+		amount = minor
+	}
+	if amount > payment.Amount {
+		errorhandler.ReturnError(c, errors.New("the refund exceeds the payment"), "Invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	provider, err := paymentProvider(*payment)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Payment cannot be refunded", paymentStatus(err))
+		return
+	}
+
+	intent, err := provider.Refund(ctx, payment.IntentID, amount)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to refund payment", paymentStatus(err))
+		return
+	}
+
+	payment, err = advancePayment(ctx, provider, payment.ID, *intent)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to update payment", paymentStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payment": payment})
+}
+
+// PaymentWebhook receives the signed notifications of the payment provider.
+// Authorized payments are captured, and succeeded ones recorded on their
+// clause. Failures are answered with a 500, so that the provider delivers the
+// event again.
+func PaymentWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to read webhook", http.StatusBadRequest)
+		return
+	}
+
+	provider := payments.Default()
+	event, err := provider.ParseWebhook(payload, c.Request.Header)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid webhook", paymentStatus(err))
+		return
+	}
+	if event.Intent.Status == "" {
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return
+	}
+
+	payment, err := db.ClausePayments().FindClausePaymentByIntent(ctx, provider.Name(), event.Intent.ID)
+	if errors.Is(err, db.ErrClausePaymentNotFound) {
+		// Intents created outside of the API are not followed
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return
+	}
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find payment", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := advancePayment(ctx, provider, payment.ID, event.Intent); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to handle payment event", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// PayMockPayment simulates the payer paying with the mock provider, which
+// then delivers its webhook, to run the payment flow without a gateway. It
+// is only available when PAYMENT_PROVIDER is mock.
+func PayMockPayment(c *gin.Context) {
+	mock, ok := payments.Default().(*payments.MockProvider)
+	if !ok {
+		errorhandler.ReturnError(c, errors.New("the payment provider is not the mock one"), "Not found", http.StatusNotFound)
+		return
+	}
+
+	payment, ok := paymentOfRequest(c, policy.Owner, policy.Participant)
+	if !ok {
+		return
+	}
+
+	intent, err := mock.Pay(payment.IntentID)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to pay", paymentStatus(err))
+		return
+	}
+
+	payment, err = advancePayment(c.Request.Context(), mock, payment.ID, *intent)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to handle payment", paymentStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payment": payment})
+}
+
+// paymentOfRequest loads the payment of the :id param, writing the error
+// response unless the caller has one of the allowed relations to its
+// contract
+func paymentOfRequest(c *gin.Context, allowed ...policy.Relation) (*db.ClausePayment, bool) {
+	payment, err := db.ClausePayments().GetClausePayment(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get payment", paymentStatus(err))
+		return nil, false
+	}
+
+	target := policy.Contract(func(*gin.Context) string { return payment.ContractKey })
+	if _, ok := policy.Authorize(c, target, allowed...); !ok {
+		return nil, false
+	}
+	return payment, true
+}
+
+// paymentProvider returns the provider that charges a payment, which must be
+// the configured one
+func paymentProvider(payment db.ClausePayment) (payments.Provider, error) {
+	provider := payments.Default()
+	if provider.Name() != payment.Provider {
+		return nil, fmt.Errorf("the payment was made with %s, not %s: %w", payment.Provider, provider.Name(), payments.ErrInvalidState)
+	}
+	return provider, nil
+}
+
+// advancePayment moves a payment to the state of its intent at the provider.
+// Authorized intents for the expected amount are captured, and succeeded
+// ones recorded on the clause. Applying the same state again changes nothing,
+// so redelivered events are harmless.
+func advancePayment(ctx context.Context, provider payments.Provider, id string, intent payments.Intent) (*db.ClausePayment, error) {
+	if intent.Status == payments.StatusAuthorized {
+		payment, err := db.ClausePayments().GetClausePayment(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if payment.Status == payments.StatusSucceeded {
+			// Captured by an earlier delivery, which may have failed to
+			// record it
+			return recordPayment(ctx, id)
+		}
+		if payment.Status != payments.StatusPending && payment.Status != payments.StatusAuthorized {
+			return payment, nil
+		}
+
+		if intent.Amount != payment.Amount || !strings.EqualFold(intent.Currency, payment.Currency) {
+			mismatch := fmt.Sprintf("the intent is for %s, expected %s", formatAmount(intent.Amount, intent.Currency), formatAmount(payment.Amount, payment.Currency))
+			payment, _, err := updatePayment(ctx, id, func(p *db.ClausePayment) bool {
+				p.Status = payments.StatusAuthorized
+				p.Error = mismatch
+				return true
+			})
+			return payment, err
+		}
+
+		captured, err := provider.Capture(ctx, payment.IntentID)
+		if errors.Is(err, payments.ErrInvalidState) {
+			// Captured by an earlier delivery
+			captured, err = provider.Intent(ctx, payment.IntentID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		intent = *captured
+	}
+
+	if intent.Status == payments.StatusSucceeded {
+		return recordPayment(ctx, id)
+	}
+
+	payment, changed, err := updatePayment(ctx, id, func(p *db.ClausePayment) bool {
+		if p.Status == intent.Status && p.Refunded == intent.Refunded {
+			return false
+		}
+		if intent.Status == payments.StatusPending && p.Status != payments.StatusPending {
+			return false
+		}
+		p.Status = intent.Status
+		p.Refunded = intent.Refunded
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if changed && (payment.Status == payments.StatusFailed || payment.Status == payments.StatusCanceled || payment.Status == payments.StatusRefunded) {
+		notifyPayment(ctx, *payment, fmt.Sprintf("Payment of %s %s", formatAmount(payment.Amount, payment.Currency), payment.Status))
+	}
+	return payment, nil
+}
+
+// recordPayment records a succeeded payment on its clause, once. The payment
+// is claimed before the ledger is changed, and released when that fails so
+// that a redelivered event records it.
+func recordPayment(ctx context.Context, id string) (*db.ClausePayment, error) {
+	payment, claimed, err := updatePayment(ctx, id, func(p *db.ClausePayment) bool {
+		if p.RecordedAt != nil {
+			return false
+		}
+		now := time.Now().UTC()
+		p.RecordedAt = &now
+		p.Status = payments.StatusSucceeded
+		p.Error = ""
+		return true
+	})
+	if err != nil || !claimed {
+		return payment, err
+	}
+
+	err = recordOnClause(ctx, *payment)
+
+	var stateErr *stateError
+	if err != nil {
+		failure := err.Error()
+		payment, _, releaseErr := updatePayment(ctx, id, func(p *db.ClausePayment) bool {
+			p.RecordedAt = nil
+			p.Error = failure
+			return true
+		})
+		if releaseErr != nil {
+			logger.Errorf("failed to release payment %s: %v", id, releaseErr)
+		}
+
+		// The payment cannot be recorded on a contract that is no longer
+		// active, and has to be refunded
+		if errors.As(err, &stateErr) && payment != nil {
+			notifyPayment(ctx, *payment, fmt.Sprintf("Payment of %s could not be recorded: %s", formatAmount(payment.Amount, payment.Currency), failure))
+			return payment, nil
+		}
+		return nil, err
+	}
+
+	notifyPayment(ctx, *payment, fmt.Sprintf("Payment of %s confirmed", formatAmount(payment.Amount, payment.Currency)))
+	return payment, nil
+}
+
+// recordOnClause adds a confirmed payment to the inputs of its clause, while
+// the contract is active. A final payment waits for the disputes of the
+// receipts of the clause to be settled.
+func recordOnClause(ctx context.Context, payment db.ClausePayment) error {
+	contract, err := chaincode.GetContract(ctx, payment.ContractKey)
+	if err != nil {
+		return err
+	}
+	lifecycle, err := loadLifecycle(ctx, *contract)
+	if err != nil {
+		return err
+	}
+	if err := requireState(lifecycle, db.ContractActive); err != nil {
+		return err
+	}
+	if payment.FinalPayment {
+		if err := requireNoDispute(ctx, payment.ClauseKey); err != nil {
+			return err
+		}
+	}
+
+	clause, err := chaincode.GetClause(ctx, payment.ClauseKey)
+	if err != nil {
+		return err
+	}
+	converted, original, rate, err := clauseAmount(ctx, *clause, chargedAmount(payment))
+	if err != nil {
+		return err
+	}
+
+	_, err = chaincode.AddInputsToMakePayment(ctx, chaincode.Payment{
+		Clause:       clause.Ref(),
+		Payment:      converted.Amount,
+		Currency:     converted.Currency,
+		Original:     original,
+		Rate:         rate,
+		FinalPayment: payment.FinalPayment,
+		Date:         payment.Date,
+		StripeToken:  payment.IntentID,
+	})
+	return err
+}
+
+// updatePayment applies change to a payment and saves it, applying it again
+// on a fresh copy when it was changed concurrently. Nothing is saved when
+// change returns false.
+func updatePayment(ctx context.Context, id string, change func(*db.ClausePayment) bool) (*db.ClausePayment, bool, error) {
+	var err error
+	for attempt := 0; attempt < lifecycleRetries; attempt++ {
+		var payment *db.ClausePayment
+		payment, err = db.ClausePayments().GetClausePayment(ctx, id)
+		if err != nil {
+			return nil, false, err
+		}
+		if !change(payment) {
+			return payment, false, nil
+		}
+
+		err = db.ClausePayments().SaveClausePayment(ctx, payment)
+		if err == nil {
+			return payment, true, nil
+		}
+		if !errors.Is(err, db.ErrClausePaymentConflict) {
+			return nil, false, err
+		}
+	}
+	return nil, false, err
+}
+
+// notifyPayment tells the parties of the contract of a payment about it
+func notifyPayment(ctx context.Context, payment db.ClausePayment, message string) {
+	contract, err := chaincode.GetContract(ctx, payment.ContractKey)
+	if err != nil {
+		logger.Errorf("failed to get contract %s: %v", payment.ContractKey, err)
+		return
+	}
+
+	var notifications []db.Notification
+	for _, userID := range contractParties(*contract) {
+		notifications = append(notifications, db.Notification{
+			UserID:  userID,
+			Type:    "payment",
+			Message: message + " for contract " + contract.Name,
+			Metadata: map[string]string{
+				"paymentID":  payment.ID,
+				"clauseKey":  payment.ClauseKey,
+				"contractID": payment.ContractKey,
+				"status":     string(payment.Status),
+			},
+		})
+	}
+
+	if _, err := db.Notifications().CreateNotification(ctx, &notifications); err != nil {
+		logger.Errorf("failed to generate notification: %v", err)
+	}
+}
+
+// paymentStatus returns the HTTP status of an error of the payment flow
+func paymentStatus(err error) int {
+	switch {
+	case errors.Is(err, db.ErrClausePaymentNotFound), errors.Is(err, payments.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, payments.ErrInvalidState), errors.Is(err, db.ErrClausePaymentConflict):
+		return http.StatusConflict
+	case errors.Is(err, payments.ErrInvalidSignature):
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// chargedAmount returns the amount charged by a payment, which the provider
+// counts in minor units
+func chargedAmount(payment db.ClausePayment) money.Money {
+	return money.FromMinor(payment.Amount, payment.Currency)
+}
+
+func formatAmount(amount int64, currency string) string {
+	return money.FromMinor(amount, currency).String()
+}
@@ -0,0 +1,355 @@
+package contract
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// errReceiptDisputed keeps a final payment from closing a clause while one of
+// its receipts is disputed
+var errReceiptDisputed = errors.New("a receipt of the clause is disputed")
+
+type disputeReceiptForm struct {
+	Comment string `form:"comment" binding:"required"`
+}
+
+type verifyReceiptForm struct {
+	File *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+// ClauseReceipts lists the receipts of the clause of the clauseKey query
+func ClauseReceipts(c *gin.Context) {
+	list, err := db.PaymentReceipts().ListPaymentReceipts(c.Request.Context(), c.Query("clauseKey"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to list receipts", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"receipts": list})
+}
+
+// GetReceipt returns a receipt to the parties of its contract
+func GetReceipt(c *gin.Context) {
+	receipt, ok := receiptOfRequest(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"receipt": receipt})
+}
+
+// DownloadReceipt sends the file of a receipt to the parties of its contract.
+// The file is only sent when it still matches the hash recorded with the
+// payment.
+func DownloadReceipt(c *gin.Context) {
+	receipt, ok := receiptOfRequest(c)
+	if !ok {
+		return
+	}
+
+	file, err := utils.DownloadFile(c.Request.Context(), receipt.ReceiptURL)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to download receipt", http.StatusInternalServerError)
+		return
+	}
+	if hash := fmt.Sprintf("%x", sha256.Sum256(file)); hash != receipt.ReceiptHash {
+		errorhandler.ReturnError(c, fmt.Errorf("stored receipt hashes to %s, recorded %s", hash, receipt.ReceiptHash), "Receipt does not match its hash", http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=receipt-"+receipt.ID)
+	c.Header("X-Receipt-Hash", receipt.ReceiptHash)
+	c.Data(http.StatusOK, http.DetectContentType(file), file)
+}
+
+// VerifyReceipt tells whether an uploaded file is the receipt recorded with a
+// payment
+func VerifyReceipt(c *gin.Context) {
+	var form verifyReceiptForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind request form", http.StatusBadRequest)
+		return
+	}
+
+	receipt, ok := receiptOfRequest(c)
+	if !ok {
+		return
+	}
+
+	file, err := utils.GetFileBytes(form.File)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(file))
+
+	c.JSON(http.StatusOK, gin.H{
+		"receiptHash": receipt.ReceiptHash,
+		"hash":        hash,
+		"matches":     hash == receipt.ReceiptHash,
+	})
+}
+
+// AcceptReceipt lets the payee acknowledge the payment of a receipt, which
+// settles a dispute of it too. The final payment held with the receipt is
+// recorded on the clause first.
+func AcceptReceipt(c *gin.Context) {
+	reviewReceipt(c, db.ReceiptAccepted, "")
+}
+
+// DisputeReceipt lets the payee contest the payment of a receipt. Final
+// payments of the clause are refused until the receipt is accepted.
+func DisputeReceipt(c *gin.Context) {
+	var form disputeReceiptForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind request form", http.StatusBadRequest)
+		return
+	}
+
+	reviewReceipt(c, db.ReceiptDisputed, form.Comment)
+}
+
+// reviewReceipt moves the receipt of the :id param to status, as asked by
+// the owner of its contract that the rule of the route let through, and
+// notifies the payer and the payee
+func reviewReceipt(c *gin.Context, status db.ReceiptStatus, comment string) {
+	ctx := c.Request.Context()
+
+	receipt, ok := receiptOfRequest(c)
+	if !ok {
+		return
+	}
+	if receipt.PayerKey == receipt.PayeeKey {
+		errorhandler.ReturnError(c, errors.New("the payer cannot review their own receipt"), "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// The held payment is claimed with the review before the ledger is
+	// changed, and the review is released when that fails so that the
+	// receipt can be accepted again
+	var reviewErr error
+	var previous db.PaymentReceipt
+	var held bool
+	receipt, err := updateReceipt(ctx, receipt.ID, func(r *db.PaymentReceipt) bool {
+		switch {
+		case r.Status == db.ReceiptAccepted,
+			r.Status == db.ReceiptDisputed && status == db.ReceiptDisputed:
+			reviewErr = fmt.Errorf("receipt is already %s", r.Status)
+			return false
+		}
+		previous = *r
+		now := time.Now().UTC()
+		held = status == db.ReceiptAccepted && r.Held()
+		if held {
+			r.RecordedAt = &now
+		}
+		r.Status = status
+		r.Comment = comment
+		r.ReviewedAt = &now
+		return true
+	})
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to review receipt", receiptStatus(err))
+		return
+	}
+	if reviewErr != nil {
+		errorhandler.ReturnError(c, reviewErr, "Receipt cannot be reviewed", http.StatusConflict)
+		return
+	}
+
+	if held {
+		if err := recordHeldPayment(ctx, *receipt); err != nil {
+			if _, releaseErr := updateReceipt(ctx, receipt.ID, func(r *db.PaymentReceipt) bool {
+				r.Status = previous.Status
+				r.Comment = previous.Comment
+				r.ReviewedAt = previous.ReviewedAt
+				r.RecordedAt = nil
+				return true
+			}); releaseErr != nil {
+				logger.Errorf("failed to release receipt %s: %v", receipt.ID, releaseErr)
+			}
+
+			code := errorhandler.ChaincodeStatus(err)
+			var stateErr *stateError
+			if errors.As(err, &stateErr) {
+				code = http.StatusConflict
+			}
+			errorhandler.ReturnError(c, err, "Failed to add inputs to clause", code)
+			return
+		}
+	}
+
+	message := fmt.Sprintf("Receipt of the payment of %s on %s %s", receipt.Amount(), receipt.Date, receipt.Status)
+	if comment != "" {
+		message += ": " + comment
+	}
+	notifyReceipt(ctx, *receipt, message, receipt.PayerKey, receipt.PayeeKey)
+
+	c.JSON(http.StatusOK, gin.H{"receipt": receipt})
+}
+
+// recordReceipt stores the receipt of a manual payment of a clause, for the
+// owner of the contract to review it, and asks the owner for the review
+func recordReceipt(ctx context.Context, contract chaincode.AutoExecutableContract, payerKey string, payment chaincode.Payment) (*db.PaymentReceipt, error) {
+	receipt := &db.PaymentReceipt{
+		ClauseKey:    payment.Clause.Key,
+		ContractKey:  contract.Key,
+		PayerKey:     payerKey,
+		Payment:      payment.Payment,
+		Currency:     payment.Currency,
+		Original:     payment.Original,
+		Rate:         payment.Rate,
+		Date:         payment.Date,
+		FinalPayment: payment.FinalPayment,
+		ReceiptURL:   payment.ReceiptURL,
+		ReceiptHash:  payment.ReceiptHash,
+		Status:       db.ReceiptPending,
+	}
+	if contract.Owner != nil {
+		receipt.PayeeKey = contract.Owner.Key
+	}
+	if err := db.PaymentReceipts().CreatePaymentReceipt(ctx, receipt); err != nil {
+		return nil, fmt.Errorf("failed to store receipt of clause %s: %w", receipt.ClauseKey, err)
+	}
+
+	if receipt.PayeeKey != "" && receipt.PayeeKey != payerKey {
+		message := fmt.Sprintf("Receipt of the payment of %s on %s awaits your review", receipt.Amount(), receipt.Date)
+		if receipt.Held() {
+			message += ", the final payment is recorded once you accept it"
+		}
+		notifyReceipt(ctx, *receipt, message, receipt.PayeeKey)
+	}
+	return receipt, nil
+}
+
+// recordHeldPayment records the final payment held with a receipt on its
+// clause, while the contract is active
+func recordHeldPayment(ctx context.Context, receipt db.PaymentReceipt) error {
+	contract, err := chaincode.GetContract(ctx, receipt.ContractKey)
+	if err != nil {
+		return err
+	}
+	lifecycle, err := loadLifecycle(ctx, *contract)
+	if err != nil {
+		return err
+	}
+	if err := requireState(lifecycle, db.ContractActive); err != nil {
+		return err
+	}
+
+	_, err = chaincode.AddInputsToMakePayment(ctx, heldPayment(receipt))
+	return err
+}
+
+// heldPayment returns the payment held with a receipt
+func heldPayment(receipt db.PaymentReceipt) chaincode.Payment {
+	return chaincode.Payment{
+		Clause:       chaincode.AssetRef{AssetType: chaincode.AssetTypeClause, Key: receipt.ClauseKey},
+		Payment:      receipt.Payment,
+		Currency:     receipt.Currency,
+		Original:     receipt.Original,
+		Rate:         receipt.Rate,
+		FinalPayment: receipt.FinalPayment,
+		Date:         receipt.Date,
+		ReceiptURL:   receipt.ReceiptURL,
+		ReceiptHash:  receipt.ReceiptHash,
+	}
+}
+
+// requireNoDispute returns errReceiptDisputed while a receipt of the clause is
+// disputed
+func requireNoDispute(ctx context.Context, clauseKey string) error {
+	receipts, err := db.PaymentReceipts().ListPaymentReceipts(ctx, clauseKey)
+	if err != nil {
+		return err
+	}
+	for _, receipt := range receipts {
+		if receipt.Status == db.ReceiptDisputed {
+			return fmt.Errorf("receipt %s: %w", receipt.ID, errReceiptDisputed)
+		}
+	}
+	return nil
+}
+
+// receiptOfRequest loads the receipt of the :id param, which the rule of the
+// route authorized, writing the error response when it cannot be loaded
+func receiptOfRequest(c *gin.Context) (*db.PaymentReceipt, bool) {
+	receipt, err := db.PaymentReceipts().GetPaymentReceipt(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get receipt", receiptStatus(err))
+		return nil, false
+	}
+	return receipt, true
+}
+
+// updateReceipt applies change to a receipt and saves it, applying it again
+// on a fresh copy when it was changed concurrently. Nothing is saved when
+// change returns false.
+func updateReceipt(ctx context.Context, id string, change func(*db.PaymentReceipt) bool) (*db.PaymentReceipt, error) {
+	var err error
+	for attempt := 0; attempt < lifecycleRetries; attempt++ {
+		var receipt *db.PaymentReceipt
+		receipt, err = db.PaymentReceipts().GetPaymentReceipt(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !change(receipt) {
+			return receipt, nil
+		}
+
+		err = db.PaymentReceipts().SavePaymentReceipt(ctx, receipt)
+		if err == nil {
+			return receipt, nil
+		}
+		if !errors.Is(err, db.ErrPaymentReceiptConflict) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// notifyReceipt tells users about a receipt
+func notifyReceipt(ctx context.Context, receipt db.PaymentReceipt, message string, userIDs ...string) {
+	var notifications []db.Notification
+	for _, userID := range userIDs {
+		notifications = append(notifications, db.Notification{
+			UserID:  userID,
+			Type:    "receipt",
+			Message: message,
+			Metadata: map[string]string{
+				"receiptID":  receipt.ID,
+				"clauseKey":  receipt.ClauseKey,
+				"contractID": receipt.ContractKey,
+				"status":     string(receipt.Status),
+			},
+		})
+	}
+
+	if _, err := db.Notifications().CreateNotification(ctx, &notifications); err != nil {
+		logger.Errorf("failed to generate notification: %v", err)
+	}
+}
+
+// receiptStatus returns the HTTP status of an error of the receipt review
+func receiptStatus(err error) int {
+	switch {
+	case errors.Is(err, db.ErrPaymentReceiptNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrPaymentReceiptConflict), errors.Is(err, errReceiptDisputed):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
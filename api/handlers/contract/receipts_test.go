@@ -0,0 +1,82 @@
+package contract
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/money"
+)
+
+func TestHeldReceiptIsRecordedOnce(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	contractKey := h.lease(alice, bob)
+
+	receipt := &db.PaymentReceipt{
+		ClauseKey:    "clause:rent",
+		ContractKey:  contractKey,
+		PayerKey:     bob,
+		PayeeKey:     alice,
+		Payment:      money.MustParseDecimal("500"),
+		Currency:     "BRL",
+		Date:         "2024-02-01",
+		FinalPayment: true,
+		ReceiptHash:  "hash",
+		Status:       db.ReceiptPending,
+	}
+	if err := h.receipts.CreatePaymentReceipt(ctx, receipt); err != nil {
+		t.Fatal(err)
+	}
+	if !receipt.Held() {
+		t.Fatalf("expected the final payment to be held, got %+v", receipt)
+	}
+
+	// Concurrent acceptances record the payment once
+	const accepts = 4
+	codes := make([]int, accepts)
+	var wg sync.WaitGroup
+	for i := 0; i < accepts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := h.serve(AcceptReceipt, http.MethodPost, "/receipts/"+receipt.ID+"/accept", "alice@example.com", nil, nil, gin.Param{Key: "id", Value: receipt.ID})
+			codes[i] = rec.Code
+		}(i)
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			accepted++
+		case http.StatusConflict:
+		default:
+			t.Fatalf("unexpected status %d among %v", code, codes)
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("expected a single acceptance, got %v", codes)
+	}
+
+	// Accepting it again does not record it again
+	h.expect(h.serve(AcceptReceipt, http.MethodPost, "/receipts/"+receipt.ID+"/accept", "alice@example.com", nil, nil, gin.Param{Key: "id", Value: receipt.ID}), http.StatusConflict)
+	if calls := h.calls("addInputsToMakePaymentClause"); calls != 1 {
+		t.Fatalf("expected the held payment to be recorded once, recorded %d", calls)
+	}
+
+	stored, err := h.receipts.GetPaymentReceipt(ctx, receipt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != db.ReceiptAccepted || stored.RecordedAt == nil {
+		t.Fatalf("expected the receipt to be accepted and recorded, got %+v", stored)
+	}
+}
@@ -5,11 +5,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
 )
 
 type RemoveTemplateForm struct {
-	Template map[string]interface{} `form:"template" binding:"required"`
+	Template chaincode.AssetRef `form:"template" binding:"required"`
 }
 
 func RemoveTemplate(c *gin.Context) {
@@ -20,14 +22,14 @@ func RemoveTemplate(c *gin.Context) {
 		return
 	}
 
-	req := map[string]interface{}{
-		"template": form.Template,
+	if _, _, ok := templateForRole(c, form.Template.Key, db.TemplateOwner); !ok {
+		return
 	}
 
-	contract, err := chaincode.RemoveTemplate(req)
+	contract, err := chaincode.RemoveTemplate(c.Request.Context(), form.Template)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
 
@@ -5,12 +5,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
 	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
 )
 
 type RemoveTemplateClauseForm struct {
-	Template       map[string]interface{} `form:"template" binding:"required"`
-	TemplateClause map[string]interface{} `form:"templateClause" binding:"required"`
+	Template       chaincode.AssetRef `form:"template" binding:"required"`
+	TemplateClause chaincode.AssetRef `form:"templateClause" binding:"required"`
 }
 
 func RemoveTemplateClause(c *gin.Context) {
@@ -21,17 +23,18 @@ func RemoveTemplateClause(c *gin.Context) {
 		return
 	}
 
-	req := map[string]interface{}{
-		"template":       form.Template,
-		"templateClause": form.TemplateClause,
+	if _, _, ok := templateForRole(c, form.Template.Key, db.TemplateEditor); !ok {
+		return
 	}
+	recordTemplateChange(c, form.Template.Key)
 
-	contract, err := chaincode.RemoveTemplateClause(req)
+	contract, err := chaincode.RemoveTemplateClause(c.Request.Context(), form.Template, form.TemplateClause)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
+	recordTemplateChange(c, form.Template.Key)
 
 	c.JSON(http.StatusOK, gin.H{"templateClause": contract, "message": "template clause removed successfully"})
 
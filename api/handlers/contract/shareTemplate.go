@@ -6,15 +6,17 @@ import (
 	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
 	"github.com/umairmaseed/clausia-api/chaincode"
 	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/mailer"
 	"github.com/umairmaseed/clausia-api/utils"
 )
 
 type shareTemplateRequestForm struct {
-	Template map[string]interface{}   `form:"template" binding:"required"`
-	Users    []map[string]interface{} `form:"users" binding:"required"`
+	Template chaincode.AssetRef   `form:"template" binding:"required"`
+	Users    []chaincode.AssetRef `form:"users" binding:"required"`
 }
 
 func ShareTemplate(c *gin.Context) {
@@ -24,78 +26,49 @@ func ShareTemplate(c *gin.Context) {
 		return
 	}
 
-	email := c.Request.Header.Get("Email")
-	if email == "" {
-		errorhandler.ReturnError(c, fmt.Errorf("email not found in headers"), "email not found in headers", http.StatusBadRequest)
-		return
-	}
-
-	userKey, err := utils.SearchAndReturnSignerKey(email)
-	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find user key", http.StatusInternalServerError)
-		return
-	}
-
-	contractAsset, err := chaincode.SearchAsset(form.Template)
-	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find template asset", http.StatusInternalServerError)
-		return
-	}
-
-	results, ok := contractAsset["result"].([]interface{})
-	if !ok || len(results) == 0 {
-		errorhandler.ReturnError(c, fmt.Errorf("no results found in template asset"), "no results found in template asset", http.StatusInternalServerError)
-		return
-	}
-
-	firstResult, ok := results[0].(map[string]interface{})
-	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("invalid result format"), "invalid result format", http.StatusInternalServerError)
-		return
-	}
-
-	templateOwner, ok := firstResult["creator"].(map[string]interface{})
-	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("could not find creator of th template"), "could not find creator of th template", http.StatusInternalServerError)
-		return
-	}
-
-	isPublic, ok := firstResult["public"].(bool)
+	template, userKey, ok := templateForRole(c, form.Template.Key, db.TemplateOwner)
 	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("could not find public field of th template"), "could not find public field of th template", http.StatusInternalServerError)
 		return
 	}
 
-	if templateOwner["@key"] != userKey && !isPublic {
-		errorhandler.ReturnError(c, fmt.Errorf("only the creator of the contract can send invite"), "only the owner of the contract can send invite", http.StatusBadRequest)
-		return
-	}
-
-	templateKey, ok := form.Template["@key"].(string)
-	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("invalid key for template"), "Invalid key", http.StatusBadRequest)
-		return
-	}
+	templateKey := template.Key
 
 	for _, user := range form.Users {
-		ledgerKey, ok := user["@key"].(string)
-		if !ok {
-			errorhandler.ReturnError(c, fmt.Errorf("invalid key for user"), "Invalid key", http.StatusBadRequest)
-			return
-		}
+		ledgerKey := user.Key
 
-		signerAsset, err := chaincode.GetSigner(ledgerKey)
+		signerAsset, err := chaincode.GetSigner(c.Request.Context(), ledgerKey)
 		if err != nil {
-			errorhandler.ReturnError(c, err, "Failed to retrieve user asset", http.StatusInternalServerError)
+			errorhandler.ReturnError(c, err, "Failed to retrieve user asset", errorhandler.ChaincodeStatus(err))
 			return
 		}
 
-		email, ok := signerAsset["email"].(string)
-		if !ok || email == "" {
+		email := signerAsset.Email
+		if email == "" {
 			errorhandler.ReturnError(c, fmt.Errorf("user asset does not contain a valid email"), "Invalid email in user asset", http.StatusInternalServerError)
 			return
 		}
 
+		// Shared users keep viewing the template until their access is
+		// revoked, even if it stops being public. Editors and owners keep
+		// their role.
+		role, err := templateRole(c.Request.Context(), *template, ledgerKey)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to get template access", http.StatusInternalServerError)
+			return
+		}
+		if !role.Includes(db.TemplateEditor) {
+			grant := &db.TemplateGrant{
+				TemplateKey: templateKey,
+				UserKey:     ledgerKey,
+				Role:        db.TemplateViewer,
+				GrantedBy:   userKey,
+			}
+			if err := db.TemplateGrants().SaveTemplateGrant(c.Request.Context(), grant); err != nil {
+				errorhandler.ReturnError(c, err, "Failed to grant template access", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		token, err := utils.GenerateInviteToken(email, templateKey, jwtSecret)
 		if err != nil {
 			errorhandler.ReturnError(c, err, "Failed to generate invite token", http.StatusInternalServerError)
@@ -110,9 +83,11 @@ func ShareTemplate(c *gin.Context) {
 
 		inviteLink := inviteLinkBase + token
 
-		msg := fmt.Sprintf("Subject: Template Invitation\n\nYou have been invited to view a template.\nPlease click the following link to view the invitation: %s", inviteLink)
-
-		err = utils.SendInviteEmail(email, msg)
+		err = mailer.Default().Send(c.Request.Context(), mailer.Message{
+			To:      []string{email},
+			Subject: "Template Invitation",
+			Body:    fmt.Sprintf("You have been invited to view a template.\nPlease click the following link to view the invitation: %s", inviteLink),
+		})
 		if err != nil {
 			errorhandler.ReturnError(c, err, "Failed to send invite email", http.StatusInternalServerError)
 			return
@@ -125,9 +100,9 @@ func ShareTemplate(c *gin.Context) {
 			Message:  "An invitation to view a template has been sent to your email",
 			Metadata: map[string]string{"templateId": templateKey}})
 
-		_, err = db.NewNotificationService(db.GetDB().Database()).CreateNotification(c.Request.Context(), &notifications)
+		_, err = db.Notifications().CreateNotification(c.Request.Context(), &notifications)
 		if err != nil {
-			errorhandler.ReturnError(c, err, "failed to generate notification", http.StatusInternalServerError)
+			logger.Errorf("failed to generate notification: %v", err)
 		}
 	}
 
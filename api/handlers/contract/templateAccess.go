@@ -0,0 +1,185 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+type grantTemplateAccessForm struct {
+	User chaincode.AssetRef `form:"user" binding:"required"`
+	Role db.TemplateRole    `form:"role" binding:"required"`
+}
+
+type revokeTemplateAccessForm struct {
+	User chaincode.AssetRef `form:"user" binding:"required"`
+}
+
+// TemplateAccess lists who has access to a template, for its owners. The
+// creator of a template is always one of its owners.
+func TemplateAccess(c *gin.Context) {
+	template, _, ok := templateOfRequest(c, db.TemplateOwner)
+	if !ok {
+		return
+	}
+
+	grants, err := db.TemplateGrants().ListTemplateGrants(c.Request.Context(), template.Key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to list template access", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"creator": template.CreatorKey(), "public": template.Public, "grants": grants})
+}
+
+// GrantTemplateAccess gives a user a role on a template, replacing the role
+// they had
+func GrantTemplateAccess(c *gin.Context) {
+	var form grantTemplateAccessForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind request form", http.StatusBadRequest)
+		return
+	}
+	if !form.Role.Valid() {
+		errorhandler.ReturnError(c, fmt.Errorf("unknown role %s", form.Role), "role must be viewer, editor or owner", http.StatusBadRequest)
+		return
+	}
+
+	template, ownerKey, ok := templateOfRequest(c, db.TemplateOwner)
+	if !ok {
+		return
+	}
+	if form.User.Key == template.CreatorKey() {
+		errorhandler.ReturnError(c, errors.New("the creator of a template is always one of its owners"), "Cannot change the access of the creator", http.StatusBadRequest)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := chaincode.GetSigner(ctx, form.User.Key); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find user", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	grant := &db.TemplateGrant{
+		TemplateKey: template.Key,
+		UserKey:     form.User.Key,
+		Role:        form.Role,
+		GrantedBy:   ownerKey,
+	}
+	if err := db.TemplateGrants().SaveTemplateGrant(ctx, grant); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to grant template access", http.StatusInternalServerError)
+		return
+	}
+
+	notifications := []db.Notification{{
+		UserID:   form.User.Key,
+		Type:     "template",
+		Message:  fmt.Sprintf("You are now %s of template %s", grant.Role, template.Name),
+		Metadata: map[string]string{"templateId": template.Key, "role": string(grant.Role)},
+	}}
+	if _, err := db.Notifications().CreateNotification(ctx, &notifications); err != nil {
+		logger.Errorf("failed to generate notification: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"grant": grant})
+}
+
+// RevokeTemplateAccess removes the access granted to a user on a template
+func RevokeTemplateAccess(c *gin.Context) {
+	var form revokeTemplateAccessForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind request form", http.StatusBadRequest)
+		return
+	}
+
+	template, _, ok := templateOfRequest(c, db.TemplateOwner)
+	if !ok {
+		return
+	}
+	if form.User.Key == template.CreatorKey() {
+		errorhandler.ReturnError(c, errors.New("the creator of a template is always one of its owners"), "Cannot change the access of the creator", http.StatusBadRequest)
+		return
+	}
+
+	err := db.TemplateGrants().RevokeTemplateGrant(c.Request.Context(), template.Key, form.User.Key)
+	if errors.Is(err, db.ErrTemplateGrantNotFound) {
+		errorhandler.ReturnError(c, err, "User has no access to revoke", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to revoke template access", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "template access revoked successfully"})
+}
+
+// templateRole returns the role of a user on a template: owner for its
+// creator, the granted role otherwise, and viewer for a public template.
+// It is empty when the user has no access.
+func templateRole(ctx context.Context, template chaincode.Template, userKey string) (db.TemplateRole, error) {
+	if template.CreatorKey() == userKey {
+		return db.TemplateOwner, nil
+	}
+
+	grant, err := db.TemplateGrants().GetTemplateGrant(ctx, template.Key, userKey)
+	switch {
+	case err == nil:
+		return grant.Role, nil
+	case !errors.Is(err, db.ErrTemplateGrantNotFound):
+		return "", err
+	case template.Public:
+		return db.TemplateViewer, nil
+	default:
+		return "", nil
+	}
+}
+
+// templateOfRequest loads the template of the :key param for a caller with
+// at least the given role on it, writing the error response otherwise. The
+// key of the caller is returned with it.
+func templateOfRequest(c *gin.Context, role db.TemplateRole) (*chaincode.Template, string, bool) {
+	return templateForRole(c, c.Param("key"), role)
+}
+
+// templateForRole loads a template for a caller with at least the given role
+// on it, writing the error response otherwise. The key of the caller is
+// returned with it.
+func templateForRole(c *gin.Context, templateKey string, role db.TemplateRole) (*chaincode.Template, string, bool) {
+	email := c.Request.Header.Get("Email")
+	if email == "" {
+		errorhandler.ReturnError(c, fmt.Errorf("email not found in headers"), "email not found in headers", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	userKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
+		return nil, "", false
+	}
+
+	template, err := chaincode.GetTemplate(c.Request.Context(), templateKey)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find template", errorhandler.ChaincodeStatus(err))
+		return nil, "", false
+	}
+
+	granted, err := templateRole(c.Request.Context(), *template, userKey)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get template access", http.StatusInternalServerError)
+		return nil, "", false
+	}
+	if !granted.Includes(role) {
+		errorhandler.ReturnError(c, fmt.Errorf("the %s role is required on the template", role), "Forbidden", http.StatusForbidden)
+		return nil, "", false
+	}
+	return template, userKey, true
+}
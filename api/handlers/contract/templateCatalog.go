@@ -0,0 +1,135 @@
+package contract
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/templates"
+)
+
+// TemplateCatalog lists the public templates. The q query param searches
+// their name, description and clause categories, tag and category filter
+// them, sort orders them by popularity (the default), rating or name, and
+// page and pageSize paginate them.
+func TemplateCatalog(c *gin.Context) {
+	query := templates.CatalogQuery{
+		Text:     c.Query("q"),
+		Category: c.Query("category"),
+		Sort:     c.DefaultQuery("sort", templates.SortPopular),
+	}
+
+	var err error
+	if query.Tags, err = templates.NormalizeTags(c.QueryArray("tag")); err != nil {
+		errorhandler.ReturnError(c, err, "Invalid tag", http.StatusBadRequest)
+		return
+	}
+	switch query.Sort {
+	case templates.SortPopular, templates.SortRating, templates.SortName:
+	default:
+		errorhandler.ReturnError(c, nil, "sort must be popular, rating or name", http.StatusBadRequest)
+		return
+	}
+	query.Page, err = strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || query.Page <= 0 {
+		errorhandler.ReturnError(c, nil, "page must be a positive number", http.StatusBadRequest)
+		return
+	}
+	query.PageSize, err = strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if err != nil || query.PageSize <= 0 || query.PageSize > 100 {
+		errorhandler.ReturnError(c, nil, "pageSize must be between 1 and 100", http.StatusBadRequest)
+		return
+	}
+
+	ctx := c.Request.Context()
+	public, err := chaincode.SearchTemplates(ctx, map[string]interface{}{"public": true})
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to search templates", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	keys := []interface{}{}
+	templateKeys := []string{}
+	for _, template := range public {
+		keys = append(keys, template.Key)
+		templateKeys = append(templateKeys, template.Key)
+	}
+
+	clauses := map[string][]chaincode.TemplateClause{}
+	if len(keys) > 0 {
+		found, err := chaincode.SearchTemplateClauses(ctx, map[string]interface{}{
+			"template.@key": map[string]interface{}{"$in": keys},
+		})
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to search template clauses", errorhandler.ChaincodeStatus(err))
+			return
+		}
+		for _, clause := range found {
+			if clause.Template != nil {
+				clauses[clause.Template.Key] = append(clauses[clause.Template.Key], clause)
+			}
+		}
+	}
+
+	listings, err := db.TemplateListings().GetTemplateListings(ctx, templateKeys)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get template listings", http.StatusInternalServerError)
+		return
+	}
+
+	var entries []templates.CatalogEntry
+	for _, template := range public {
+		entries = append(entries, templates.NewCatalogEntry(template, clauses[template.Key], listings[template.Key]))
+	}
+	page, total := templates.SearchCatalog(entries, query)
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": page,
+		"total":     total,
+		"page":      query.Page,
+		"pageSize":  query.PageSize,
+	})
+}
+
+type templateTagsForm struct {
+	Tags []string `form:"tags"`
+}
+
+// SetTemplateTags replaces the tags of a template, for its owners
+func SetTemplateTags(c *gin.Context) {
+	var form templateTagsForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind request form", http.StatusBadRequest)
+		return
+	}
+
+	tags, err := templates.NormalizeTags(form.Tags)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Invalid tags", http.StatusBadRequest)
+		return
+	}
+
+	template, _, ok := templateOfRequest(c, db.TemplateOwner)
+	if !ok {
+		return
+	}
+
+	if err := db.TemplateListings().SetTemplateTags(c.Request.Context(), template.Key, tags); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to set template tags", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templateKey": template.Key, "tags": tags})
+}
+
+// countTemplateUse counts a use of a template for its popularity. The use
+// already happened on failure, so it is only logged.
+func countTemplateUse(c *gin.Context, templateKey string, use db.TemplateUse) {
+	if err := db.TemplateListings().CountTemplateUse(c.Request.Context(), templateKey, use); err != nil {
+		logger.Errorf("failed to count use of template %s: %v", templateKey, err)
+	}
+}
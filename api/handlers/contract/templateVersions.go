@@ -0,0 +1,215 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/templates"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// TemplateVersions lists the versions of a template, oldest first
+func TemplateVersions(c *gin.Context) {
+	template, _, ok := templateOfRequest(c, db.TemplateViewer)
+	if !ok {
+		return
+	}
+
+	versions, err := db.TemplateVersions().ListTemplateVersions(c.Request.Context(), template.Key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to list template versions", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// TemplateVersion returns a version of a template, with its clauses
+func TemplateVersion(c *gin.Context) {
+	template, _, ok := templateOfRequest(c, db.TemplateViewer)
+	if !ok {
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "version must be a number", http.StatusBadRequest)
+		return
+	}
+
+	version, err := db.TemplateVersions().GetTemplateVersion(c.Request.Context(), template.Key, number)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get template version", templateVersionStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"version": version})
+}
+
+// DiffTemplateVersions compares two versions of a template clause by clause.
+// The versions are given by the from and to query params, to defaulting to
+// the latest version.
+func DiffTemplateVersions(c *gin.Context) {
+	template, _, ok := templateOfRequest(c, db.TemplateViewer)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	fromNumber, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "from must be a version number", http.StatusBadRequest)
+		return
+	}
+
+	from, err := db.TemplateVersions().GetTemplateVersion(ctx, template.Key, fromNumber)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get template version", templateVersionStatus(err))
+		return
+	}
+
+	var to *db.TemplateVersion
+	if number := c.Query("to"); number != "" {
+		toNumber, err := strconv.Atoi(number)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "to must be a version number", http.StatusBadRequest)
+			return
+		}
+		to, err = db.TemplateVersions().GetTemplateVersion(ctx, template.Key, toNumber)
+	} else {
+		to, err = db.TemplateVersions().LatestTemplateVersion(ctx, template.Key)
+	}
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to get template version", templateVersionStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"diff": templates.DiffVersions(*from, *to)})
+}
+
+// templateVersionStatus returns the HTTP status of an error of the template
+// version store
+func templateVersionStatus(err error) int {
+	switch {
+	case errors.Is(err, db.ErrTemplateVersionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrTemplateVersionExists):
+		return http.StatusConflict
+	default:
+		return errorhandler.ChaincodeStatus(err)
+	}
+}
+
+// templateClauses returns the clauses of a template read from the ledger
+func templateClauses(ctx context.Context, template chaincode.Template) ([]chaincode.TemplateClause, error) {
+	var clauses []chaincode.TemplateClause
+	for _, ref := range template.Clauses {
+		clause, err := chaincode.GetTemplateClause(ctx, ref.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get template clause %s: %w", ref.Key, err)
+		}
+		clauses = append(clauses, *clause)
+	}
+	return clauses, nil
+}
+
+// recordTemplateVersion returns the version of the template as it is on the
+// ledger, recording a new version when it changed since the latest one. It
+// is only called when templates are changed or used, the read endpoints
+// return the recorded versions.
+func recordTemplateVersion(ctx context.Context, templateKey, userKey string) (*db.TemplateVersion, error) {
+	var err error
+	for attempt := 0; attempt < lifecycleRetries; attempt++ {
+		var template *chaincode.Template
+		template, err = chaincode.GetTemplate(ctx, templateKey)
+		if err != nil {
+			return nil, err
+		}
+		var clauses []chaincode.TemplateClause
+		clauses, err = templateClauses(ctx, *template)
+		if err != nil {
+			return nil, err
+		}
+		version := templates.Snapshot(*template, clauses)
+
+		var latest *db.TemplateVersion
+		latest, err = db.TemplateVersions().LatestTemplateVersion(ctx, templateKey)
+		switch {
+		case err == nil && latest.Digest == version.Digest:
+			return latest, nil
+		case err == nil:
+			version.Version = latest.Version + 1
+		case errors.Is(err, db.ErrTemplateVersionNotFound):
+			version.Version = 1
+		default:
+			return nil, err
+		}
+
+		version.CreatedBy = userKey
+		err = db.TemplateVersions().CreateTemplateVersion(ctx, &version)
+		if err == nil {
+			return &version, nil
+		}
+		if !errors.Is(err, db.ErrTemplateVersionExists) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// recordTemplateChange records the version of a template around an edit by
+// the caller. The edit is already committed on failure, so it is only
+// logged.
+func recordTemplateChange(c *gin.Context, templateKey string) {
+	var userKey string
+	if email := c.Request.Header.Get("Email"); email != "" {
+		userKey, _ = utils.SearchAndReturnSignerKey(c.Request.Context(), email)
+	}
+
+	if _, err := recordTemplateVersion(c.Request.Context(), templateKey, userKey); err != nil {
+		logger.Errorf("failed to record version of template %s: %v", templateKey, err)
+	}
+}
+
+// BackfillTemplateVersions records the first version of the templates created
+// before versions were recorded, in the name of their creators. It runs as a
+// job started from the admin API, and skips the templates that have versions.
+func BackfillTemplateVersions(ctx context.Context) error {
+	list, err := chaincode.SearchTemplates(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	var failed []string
+	for _, template := range list {
+		_, err := db.TemplateVersions().LatestTemplateVersion(ctx, template.Key)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, db.ErrTemplateVersionNotFound) {
+			return err
+		}
+
+		var creatorKey string
+		if template.Creator != nil {
+			creatorKey = template.Creator.Key
+		}
+		if _, err := recordTemplateVersion(ctx, template.Key, creatorKey); err != nil {
+			logger.Errorf("failed to record the first version of template %s: %v", template.Key, err)
+			failed = append(failed, template.Key)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to record the first version of %d templates: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
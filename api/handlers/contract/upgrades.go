@@ -0,0 +1,516 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/templates"
+)
+
+var (
+	errNotFromTemplate  = errors.New("contract was not created from a template")
+	errUpgradePending   = errors.New("contract already has a pending upgrade proposal")
+	errSameVersion      = errors.New("contract already uses this template version")
+	errNotAwaited       = errors.New("user is not awaited to answer the upgrade proposal")
+	errUpgradeAnswered  = errors.New("upgrade proposal was already answered")
+	errFinalizedClauses = errors.New("the upgrade changes finalized clauses")
+)
+
+// upgradeStatus returns the HTTP status of an error of an upgrade proposal
+func upgradeStatus(err error) int {
+	var validationErr *templates.ValidationError
+	switch {
+	case errors.Is(err, errNotFromTemplate):
+		return http.StatusBadRequest
+	case errors.Is(err, errNotAwaited):
+		return http.StatusForbidden
+	case errors.Is(err, db.ErrUpgradeProposalNotFound),
+		errors.Is(err, db.ErrTemplateVersionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errUpgradePending),
+		errors.Is(err, errSameVersion),
+		errors.Is(err, errUpgradeAnswered),
+		errors.Is(err, errFinalizedClauses),
+		errors.Is(err, db.ErrUpgradeProposalConflict),
+		errors.As(err, &validationErr):
+		// The parameters kept from the contract do not fit the new version
+		return http.StatusConflict
+	default:
+		return lifecycleStatus(err)
+	}
+}
+
+type proposeUpgradeForm struct {
+	// Version is the template version to upgrade to, the latest by default
+	Version int `form:"version"`
+}
+
+// ProposeUpgrade proposes to the participants of a contract created from a
+// template to move it to another version of the template. The upgrade is
+// applied once every participant accepted it, right away when the contract
+// has none.
+func ProposeUpgrade(c *gin.Context) {
+	var form proposeUpgradeForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind request form", http.StatusBadRequest)
+		return
+	}
+
+	contract, signerKey, ok := contractOfRequest(c)
+	if !ok {
+		return
+	}
+	if contract.OwnerKey() != signerKey {
+		errorhandler.ReturnError(c, errors.New("only the owner of the contract can propose upgrades"), "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !contractInState(c, *contract, db.ContractDraft, db.ContractPendingAcceptance, db.ContractActive) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	proposal, diff, err := proposeUpgrade(ctx, *contract, signerKey, form.Version)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to propose upgrade", upgradeStatus(err))
+		return
+	}
+
+	var notifications []db.Notification
+	for _, participantKey := range proposal.Awaiting {
+		notifications = append(notifications, db.Notification{
+			UserID:   participantKey,
+			Type:     "contract",
+			Message:  fmt.Sprintf("An upgrade of contract %s to version %d of its template was proposed", contract.Name, proposal.ToVersion),
+			Metadata: upgradeMetadata(proposal),
+		})
+	}
+	if len(notifications) > 0 {
+		if _, err := db.Notifications().CreateNotification(ctx, &notifications); err != nil {
+			logger.Errorf("failed to generate notification: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"proposal": proposal, "diff": diff})
+}
+
+// UpgradeProposals lists the upgrade proposals of a contract, newest first
+func UpgradeProposals(c *gin.Context) {
+	contract, _, ok := contractOfRequest(c)
+	if !ok {
+		return
+	}
+
+	proposals, err := db.UpgradeProposals().ListUpgradeProposals(c.Request.Context(), contract.Key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to list upgrade proposals", http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"proposals": proposals})
+}
+
+// AcceptUpgrade records that a participant accepted an upgrade proposal
+func AcceptUpgrade(c *gin.Context) {
+	answerUpgrade(c, true)
+}
+
+// DeclineUpgrade rejects an upgrade proposal on behalf of a participant
+func DeclineUpgrade(c *gin.Context) {
+	answerUpgrade(c, false)
+}
+
+// proposeUpgrade records a proposal to upgrade a contract to a version of
+// its template, applying it when the contract has no participants
+func proposeUpgrade(ctx context.Context, contract chaincode.AutoExecutableContract, ownerKey string, toVersion int) (*db.UpgradeProposal, *templates.Diff, error) {
+	templateKey, fromVersion, err := contractTemplate(ctx, contract)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proposals, err := db.UpgradeProposals().ListUpgradeProposals(ctx, contract.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, p := range proposals {
+		if p.Status == db.UpgradePending || p.Status == db.UpgradeApplying {
+			return nil, nil, errUpgradePending
+		}
+	}
+
+	latest, err := recordTemplateVersion(ctx, templateKey, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if toVersion == 0 {
+		toVersion = latest.Version
+	}
+	if toVersion == fromVersion {
+		return nil, nil, errSameVersion
+	}
+
+	from, err := db.TemplateVersions().GetTemplateVersion(ctx, templateKey, fromVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := db.TemplateVersions().GetTemplateVersion(ctx, templateKey, toVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	diff := templates.DiffVersions(*from, *to)
+
+	proposal := &db.UpgradeProposal{
+		ContractKey: contract.Key,
+		TemplateKey: templateKey,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		ProposedBy:  ownerKey,
+		Status:      db.UpgradePending,
+		Awaiting:    []string{},
+		Accepted:    []string{},
+	}
+	for _, participant := range contract.Participants {
+		if !containsKey(proposal.Awaiting, participant.Key) {
+			proposal.Awaiting = append(proposal.Awaiting, participant.Key)
+		}
+	}
+
+	if err := db.UpgradeProposals().CreateUpgradeProposal(ctx, proposal); err != nil {
+		return nil, nil, err
+	}
+	if len(proposal.Awaiting) == 0 {
+		if err := applyUpgrade(ctx, contract, *from, *to, proposal); err != nil {
+			return nil, nil, err
+		}
+		if err := db.UpgradeProposals().SaveUpgradeProposal(ctx, proposal); err != nil {
+			return nil, nil, err
+		}
+	}
+	return proposal, &diff, nil
+}
+
+// answerUpgrade records the answer of the caller to the upgrade proposal of
+// the :id param, applying the upgrade once every participant accepted it
+func answerUpgrade(c *gin.Context, accept bool) {
+	contract, signerKey, ok := contractOfRequest(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var (
+		proposal *db.UpgradeProposal
+		err      error
+	)
+	for attempt := 0; attempt < lifecycleRetries; attempt++ {
+		proposal, err = answerProposal(ctx, *contract, c.Param("id"), signerKey, accept)
+		if !errors.Is(err, db.ErrUpgradeProposalConflict) {
+			break
+		}
+	}
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to answer upgrade proposal", upgradeStatus(err))
+		return
+	}
+
+	notifyUpgradeAnswer(c, *contract, proposal, c.Request.Header.Get("Email"), accept)
+
+	c.JSON(http.StatusOK, gin.H{"proposal": proposal})
+}
+
+// answerProposal records the answer of a participant on the stored proposal.
+// Accepting a proposal that is still applying resumes its upgrade.
+func answerProposal(ctx context.Context, contract chaincode.AutoExecutableContract, id, userKey string, accept bool) (*db.UpgradeProposal, error) {
+	proposal, err := db.UpgradeProposals().GetUpgradeProposal(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.ContractKey != contract.Key {
+		return nil, db.ErrUpgradeProposalNotFound
+	}
+	if proposal.Status == db.UpgradeApplying && accept {
+		if err := applyProposal(ctx, contract, proposal); err != nil {
+			return nil, err
+		}
+		if err := db.UpgradeProposals().SaveUpgradeProposal(ctx, proposal); err != nil {
+			return nil, err
+		}
+		return proposal, nil
+	}
+	if proposal.Status != db.UpgradePending {
+		return nil, errUpgradeAnswered
+	}
+	if !containsKey(proposal.Awaiting, userKey) {
+		return nil, errNotAwaited
+	}
+
+	proposal.Awaiting = removeKey(proposal.Awaiting, userKey)
+	switch {
+	case !accept:
+		proposal.Status = db.UpgradeRejected
+		proposal.DeclinedBy = userKey
+	case len(proposal.Awaiting) == 0:
+		proposal.Accepted = append(proposal.Accepted, userKey)
+		if err := applyProposal(ctx, contract, proposal); err != nil {
+			return nil, err
+		}
+	default:
+		proposal.Accepted = append(proposal.Accepted, userKey)
+	}
+
+	if err := db.UpgradeProposals().SaveUpgradeProposal(ctx, proposal); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+// applyProposal applies an accepted proposal to a contract that can still be
+// changed
+func applyProposal(ctx context.Context, contract chaincode.AutoExecutableContract, proposal *db.UpgradeProposal) error {
+	lifecycle, err := loadLifecycle(ctx, contract)
+	if err != nil {
+		return err
+	}
+	if err := requireState(lifecycle, db.ContractDraft, db.ContractPendingAcceptance, db.ContractActive); err != nil {
+		return err
+	}
+
+	from, err := db.TemplateVersions().GetTemplateVersion(ctx, proposal.TemplateKey, proposal.FromVersion)
+	if err != nil {
+		return err
+	}
+	to, err := db.TemplateVersions().GetTemplateVersion(ctx, proposal.TemplateKey, proposal.ToVersion)
+	if err != nil {
+		return err
+	}
+	return applyUpgrade(ctx, contract, *from, *to, proposal)
+}
+
+// applyUpgrade replaces the clauses of a contract that differ between two
+// versions of its template, and marks the proposal applied. The new clauses
+// are added before the replaced ones are removed, and the progress is saved
+// with the proposal, so that applying it again finishes an interrupted
+// upgrade.
+func applyUpgrade(ctx context.Context, contract chaincode.AutoExecutableContract, from, to db.TemplateVersion, proposal *db.UpgradeProposal) error {
+	var clauses []chaincode.Clause
+	if proposal.Progress == nil {
+		planned, replaced, err := planUpgrade(ctx, contract, from, to)
+		if err != nil {
+			return err
+		}
+		clauses = planned
+
+		progress := &db.UpgradeProgress{Previous: []string{}, Replaced: []string{}}
+		for _, ref := range contract.Clauses {
+			progress.Previous = append(progress.Previous, ref.Key)
+		}
+		for _, clause := range replaced {
+			progress.Replaced = append(progress.Replaced, clause.Key)
+		}
+		proposal.Status = db.UpgradeApplying
+		proposal.Progress = progress
+		if err := db.UpgradeProposals().SaveUpgradeProposal(ctx, proposal); err != nil {
+			return err
+		}
+	} else if !proposal.Progress.Added && !clausesAddedSince(contract, proposal.Progress.Previous) {
+		// Nothing was changed yet, so the plan is the same
+		planned, _, err := planUpgrade(ctx, contract, from, to)
+		if err != nil {
+			return err
+		}
+		clauses = planned
+	}
+
+	if !proposal.Progress.Added {
+		if len(clauses) > 0 {
+			updated, err := chaincode.AddClauses(ctx, contract.Ref(), clauses)
+			if err != nil {
+				return err
+			}
+			contract = *updated
+		}
+		proposal.Progress.Added = true
+		if err := db.UpgradeProposals().SaveUpgradeProposal(ctx, proposal); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range proposal.Progress.Replaced {
+		if !contractHasClause(contract, key) {
+			continue
+		}
+		updated, err := chaincode.RemoveClause(ctx, contract.Ref(), chaincode.AssetRef{AssetType: chaincode.AssetTypeClause, Key: key})
+		if err != nil {
+			return err
+		}
+		contract = *updated
+	}
+
+	proposal.Status = db.UpgradeApplied
+	return nil
+}
+
+// planUpgrade returns the clauses an upgrade adds to a contract and the ones
+// it replaces. Changed clauses keep the parameters and inputs the contract
+// gave them, as long as the new version still declares them. Optional
+// clauses added by the new version are left out, as are changed clauses that
+// the contract excluded.
+func planUpgrade(ctx context.Context, contract chaincode.AutoExecutableContract, from, to db.TemplateVersion) ([]chaincode.Clause, []chaincode.Clause, error) {
+	existing := map[string]chaincode.Clause{}
+	for _, ref := range contract.Clauses {
+		clause, err := chaincode.GetClause(ctx, ref.Key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get clause %s: %w", ref.Key, err)
+		}
+		existing[clause.Id] = *clause
+	}
+
+	declared := map[string]chaincode.TemplateClause{}
+	for _, clause := range templates.Clauses(to) {
+		declared[clause.Id] = clause
+	}
+
+	var (
+		replaced []chaincode.Clause
+		selected []chaincode.TemplateClause
+		values   = templates.Values{}
+	)
+	for _, change := range templates.DiffVersions(from, to).Clauses {
+		old, inContract := existing[change.Id]
+		switch change.Change {
+		case templates.ClauseRemoved:
+			if inContract {
+				replaced = append(replaced, old)
+			}
+		case templates.ClauseChanged:
+			if !inContract {
+				continue
+			}
+			replaced = append(replaced, old)
+			selected = append(selected, declared[change.Id])
+			kept := map[string]interface{}{}
+			for name, value := range old.Parameters {
+				if _, ok := declared[change.Id].DefaultParameters[name]; ok {
+					kept[name] = value
+				}
+			}
+			values[change.Id] = kept
+		case templates.ClauseAdded:
+			if optional := declared[change.Id].Optional; optional == nil || !*optional {
+				selected = append(selected, declared[change.Id])
+			}
+		}
+	}
+
+	var finalized []string
+	for _, clause := range replaced {
+		if clause.Finalized {
+			finalized = append(finalized, clause.Id)
+		}
+	}
+	if len(finalized) > 0 {
+		return nil, nil, fmt.Errorf("%w: %v", errFinalizedClauses, finalized)
+	}
+
+	clauses, err := templates.Instantiate(selected, values, nil, contractParties(contract))
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range clauses {
+		if old, ok := existing[clauses[i].Id]; ok && old.Input != nil {
+			clauses[i].Input = old.Input
+		}
+	}
+	return clauses, replaced, nil
+}
+
+// clausesAddedSince tells whether a contract has clauses that are not among
+// the previous ones
+func clausesAddedSince(contract chaincode.AutoExecutableContract, previous []string) bool {
+	for _, ref := range contract.Clauses {
+		if !containsKey(previous, ref.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// contractHasClause tells whether a clause is one of a contract
+func contractHasClause(contract chaincode.AutoExecutableContract, clauseKey string) bool {
+	for _, ref := range contract.Clauses {
+		if ref.Key == clauseKey {
+			return true
+		}
+	}
+	return false
+}
+
+// contractTemplate returns the template of a contract and the version it
+// uses: the version of its last applied upgrade, or the one it was created
+// from
+func contractTemplate(ctx context.Context, contract chaincode.AutoExecutableContract) (string, int, error) {
+	templateKey, _ := contract.Data["templateKey"].(string)
+	createdFrom, _ := contract.Data["templateVersion"].(float64)
+	if templateKey == "" || createdFrom == 0 {
+		return "", 0, errNotFromTemplate
+	}
+
+	proposals, err := db.UpgradeProposals().ListUpgradeProposals(ctx, contract.Key)
+	if err != nil {
+		return "", 0, err
+	}
+	for _, p := range proposals {
+		if p.Status == db.UpgradeApplied {
+			return templateKey, p.ToVersion, nil
+		}
+	}
+	return templateKey, int(createdFrom), nil
+}
+
+// notifyUpgradeAnswer tells the owner of a contract about the answer of a
+// participant to an upgrade proposal, and every party once it is applied
+func notifyUpgradeAnswer(c *gin.Context, contract chaincode.AutoExecutableContract, proposal *db.UpgradeProposal, email string, accept bool) {
+	verb := "declined"
+	if accept {
+		verb = "accepted"
+	}
+
+	notifications := []db.Notification{{
+		UserID:   contract.OwnerKey(),
+		Type:     "contract",
+		Message:  fmt.Sprintf("%s %s the upgrade of contract %s", email, verb, contract.Name),
+		Metadata: upgradeMetadata(proposal),
+	}}
+
+	if proposal.Status == db.UpgradeApplied {
+		for _, partyKey := range contractParties(contract) {
+			notifications = append(notifications, db.Notification{
+				UserID:   partyKey,
+				Type:     "contract",
+				Message:  fmt.Sprintf("Contract %s was upgraded to version %d of its template", contract.Name, proposal.ToVersion),
+				Metadata: upgradeMetadata(proposal),
+			})
+		}
+	}
+
+	if _, err := db.Notifications().CreateNotification(c.Request.Context(), &notifications); err != nil {
+		logger.Errorf("failed to generate notification: %v", err)
+	}
+}
+
+func upgradeMetadata(proposal *db.UpgradeProposal) map[string]string {
+	return map[string]string{
+		"contractID":  proposal.ContractKey,
+		"upgradeID":   proposal.ID,
+		"fromVersion": strconv.Itoa(proposal.FromVersion),
+		"toVersion":   strconv.Itoa(proposal.ToVersion),
+		"status":      string(proposal.Status),
+	}
+}
@@ -6,7 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
-	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
 	"github.com/umairmaseed/clausia-api/utils"
 )
 
@@ -33,36 +33,20 @@ func ViewSharedTemplate(c *gin.Context) {
 	UserEmail := claims.Email
 	templateID := claims.ContractID
 
-	template := map[string]interface{}{
-		"@key":       templateID,
-		"@assetType": "template",
-	}
-
 	if UserEmail != email {
 		errorhandler.ReturnError(c, fmt.Errorf("user email does not match token email"), "user email does not match token email", http.StatusBadRequest)
 		return
 	}
 
-	contractAsset, err := chaincode.SearchAsset(template)
-	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to find template asset", http.StatusInternalServerError)
-		return
-	}
-
-	results, ok := contractAsset["result"].([]interface{})
-	if !ok || len(results) == 0 {
-		errorhandler.ReturnError(c, fmt.Errorf("no results found in template asset"), "no results found in template asset", http.StatusInternalServerError)
-		return
-	}
-
-	firstResult, ok := results[0].(map[string]interface{})
+	// The token only proves who the link was sent to, the access may have
+	// been revoked since
+	template, _, ok := templateForRole(c, templateID, db.TemplateViewer)
 	if !ok {
-		errorhandler.ReturnError(c, fmt.Errorf("invalid result format"), "invalid result format", http.StatusInternalServerError)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "Template retrieved successfully",
-		"template": firstResult,
+		"template": template,
 	})
 }
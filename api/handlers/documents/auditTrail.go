@@ -0,0 +1,147 @@
+package documents
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/audit"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/env"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// DocumentHistory returns the audit trail of a document to its owner and
+// required signers
+func DocumentHistory(c *gin.Context) {
+	key, doc, events, ok := documentTrail(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"documentKey": key,
+		"status":      doc.Status,
+		"events":      events,
+	})
+}
+
+// DocumentCertificate exports the audit trail as a certificate of completion
+// stamped with an HMAC of the CERTIFICATE_SIGNING_KEY, in JSON or, with
+// format=pdf, as a plain PDF report. The stamp is not a PDF signature.
+func DocumentCertificate(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "pdf" {
+		errorhandler.ReturnError(c, errors.New("format must be json or pdf"), "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	signingKey := os.Getenv(env.CERTIFICATE_SIGNING_KEY)
+	if signingKey == "" {
+		errorhandler.ReturnError(c, errors.New("missing "+env.CERTIFICATE_SIGNING_KEY+" env var"), "Certificates are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	key, doc, events, ok := documentTrail(c)
+	if !ok {
+		return
+	}
+
+	cert := audit.NewCertificate(key, doc, events, time.Now())
+	if err := cert.Sign([]byte(signingKey)); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to stamp certificate", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "pdf" {
+		c.Header("Content-Disposition", utils.AttachmentDisposition("audit-report-"+doc.Name+".pdf"))
+		c.Data(http.StatusOK, "application/pdf", cert.PDF())
+		return
+	}
+	c.JSON(http.StatusOK, cert)
+}
+
+// documentTrail loads the document of the :key param and its audit events,
+// writing the error response when the caller may not see them
+func documentTrail(c *gin.Context) (string, chaincode.FileAsset, []audit.Event, bool) {
+	ctx := c.Request.Context()
+	key := c.Param("key")
+
+	email := c.Request.Header.Get("Email")
+	if email == "" {
+		logger.Error("Email not found in headers")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email not found in headers"})
+		return "", chaincode.FileAsset{}, nil, false
+	}
+
+	signerKey, err := utils.SearchAndReturnSignerKey(ctx, email)
+	if err != nil {
+		logger.Error(err)
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
+		return "", chaincode.FileAsset{}, nil, false
+	}
+
+	asset, err := chaincode.GetDoc(ctx, key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to retrieve document asset", errorhandler.ChaincodeStatus(err))
+		return "", chaincode.FileAsset{}, nil, false
+	}
+	doc, err := chaincode.FileAssetFromMap(asset)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to read document", http.StatusInternalServerError)
+		return "", chaincode.FileAsset{}, nil, false
+	}
+
+	if !isDocumentParty(doc, signerKey) {
+		errorhandler.ReturnError(c, nil, "Only the owner and the signers of the document can see its history", http.StatusForbidden)
+		return "", chaincode.FileAsset{}, nil, false
+	}
+
+	history, err := chaincode.GetDocHistory(ctx, key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to retrieve document history", errorhandler.ChaincodeStatus(err))
+		return "", chaincode.FileAsset{}, nil, false
+	}
+
+	events, err := audit.Trail(history, signerNames(ctx))
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to read document history", http.StatusInternalServerError)
+		return "", chaincode.FileAsset{}, nil, false
+	}
+
+	return key, doc, events, true
+}
+
+func isDocumentParty(doc chaincode.FileAsset, userKey string) bool {
+	if doc.Owner.Key == userKey {
+		return true
+	}
+	for _, s := range doc.RequiredSignatures {
+		if s.Key == userKey {
+			return true
+		}
+	}
+	return false
+}
+
+// signerNames resolves user names from the ledger, once per user
+func signerNames(ctx context.Context) audit.NameResolver {
+	names := map[string]string{}
+	return func(key string) string {
+		if name, ok := names[key]; ok {
+			return name
+		}
+
+		var name string
+		if user, err := chaincode.GetSigner(ctx, key); err == nil {
+			name = user.Name
+		}
+		names[key] = name
+		return name
+	}
+}
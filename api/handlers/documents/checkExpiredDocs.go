@@ -1,16 +1,22 @@
 package documents
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/google/logger"
 	"github.com/umairmaseed/clausia-api/chaincode"
 )
 
-func CheckExpiredDocs() {
-	expiredDocs, err := chaincode.GetExpiredDocument()
+// CheckExpiredDocs sets the status of pending documents past their timeout
+// to expired
+func CheckExpiredDocs(ctx context.Context) error {
+	expiredDocs, err := chaincode.GetExpiredDocument(ctx)
 	if err != nil {
-		logger.Error(err)
+		return err
 	}
 
+	failed := 0
 	for _, docMap := range expiredDocs {
 		if status, ok := docMap["status"].(float64); ok && status == 0 {
 			key := docMap["@key"].(string)
@@ -22,11 +28,16 @@ func CheckExpiredDocs() {
 				"@assetType": "document",
 				"@key":       key,
 			}
-			_, err = chaincode.UpdateDocument(documentMAp, docMap)
+			_, err = chaincode.UpdateDocument(ctx, documentMAp, docMap)
 			if err != nil {
 				logger.Error(err)
+				failed++
 			}
 		}
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("failed to expire %d documents", failed)
+	}
+	return nil
 }
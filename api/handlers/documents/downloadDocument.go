@@ -3,11 +3,10 @@ package documents
 import (
 	"fmt"
 	"net/http"
-	"os"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
 	"github.com/umairmaseed/clausia-api/utils"
 )
@@ -42,9 +41,9 @@ func DownloadDocument(c *gin.Context) {
 		queryMap["finalDocURL"] = *form.FinalUrl
 	}
 
-	docAsset, err := chaincode.SearchAsset(queryMap)
+	docAsset, err := chaincode.SearchAsset(c.Request.Context(), queryMap)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to search for documents", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to search for documents", errorhandler.ChaincodeStatus(err))
 		return
 	}
 	resultArray, ok := docAsset["result"].([]interface{})
@@ -54,6 +53,12 @@ func DownloadDocument(c *gin.Context) {
 	}
 
 	document := resultArray[0].(map[string]interface{})
+	key, _ := document["@key"].(string)
+	target := policy.Document(func(*gin.Context) string { return key })
+	if _, ok := policy.Authorize(c, target, policy.Owner, policy.Signer); !ok {
+		return
+	}
+
 	name := document["name"].(string)
 	url := ""
 	if form.OriginalUrl != nil {
@@ -62,10 +67,7 @@ func DownloadDocument(c *gin.Context) {
 		url = *form.FinalUrl
 	}
 
-	bucketName := os.Getenv("S3_BUCKET_NAME")
-	s3FilePath := strings.TrimPrefix(url, fmt.Sprintf("s3://%s/", bucketName))
-
-	docBytes, err := utils.DownloadFileFromS3(c.Request.Context(), s3FilePath)
+	docBytes, err := utils.DownloadFile(c.Request.Context(), url)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to download document: "+err.Error())
 		return
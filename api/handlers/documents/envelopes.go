@@ -0,0 +1,414 @@
+package documents
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// envelopeView is an envelope with its documents as found on the ledger in
+// place of their keys
+type envelopeView struct {
+	db.Envelope
+	Documents []map[string]interface{} `json:"documents"`
+}
+
+type envelopeSignForm struct {
+	Password string `form:"password" binding:"required"`
+	// Signature is the go-sign signature position of every document, keyed by
+	// file name. It is ignored for documents with signature fields.
+	Signature        string `form:"signature"`
+	Username         string `form:"username" binding:"required"`
+	Cpf              string `form:"cpf" binding:"required"`
+	RejectSignatures bool   `form:"rejectsignature"`
+}
+
+// ListEnvelopes returns the envelopes owned or to be signed by the user
+func ListEnvelopes(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userKey, ok := requestSignerKey(c)
+	if !ok {
+		return
+	}
+
+	envelopes, err := db.Envelopes().ListEnvelopes(ctx, userKey)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to list envelopes", http.StatusInternalServerError)
+		return
+	}
+
+	// Documents may be signed or expire on their own, so the status of
+	// pending envelopes is refreshed from the ledger
+	for i := range envelopes {
+		if envelopes[i].Status != 0 {
+			continue
+		}
+		if _, err := refreshEnvelope(ctx, &envelopes[i]); err != nil {
+			logger.Errorf("failed to refresh envelope %s: %v", envelopes[i].ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"envelopes": envelopes})
+}
+
+// GetEnvelope returns an envelope with its documents
+func GetEnvelope(c *gin.Context) {
+	view, _, ok := envelopeOfRequest(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// SignEnvelope signs, or rejects, every document of an envelope at once. All
+// documents are checked before the first one is signed.
+func SignEnvelope(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var form envelopeSignForm
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind form data", http.StatusBadRequest)
+		return
+	}
+
+	view, userKey, ok := envelopeOfRequest(c)
+	if !ok {
+		return
+	}
+
+	sign := signForm{
+		Password:         form.Password,
+		Signature:        form.Signature,
+		Username:         form.Username,
+		Cpf:              form.Cpf,
+		RejectSignatures: form.RejectSignatures,
+	}
+	if _, err := signerOf(ctx, userKey, sign); err != nil {
+		respondSignError(c, err)
+		return
+	}
+
+	for _, doc := range view.Documents {
+		if _, err := checkSignable(doc, userKey); err != nil {
+			name, _ := doc["name"].(string)
+			respondSignError(c, envelopeDocumentError(name, err))
+			return
+		}
+	}
+
+	for i, doc := range view.Documents {
+		docKey, _ := doc["@key"].(string)
+		name, _ := doc["name"].(string)
+
+		sign.DocKey = docKey
+		_, _, err := signDocument(ctx, userKey, sign)
+		if err != nil {
+			// The documents signed so far stay signed, signing the envelope
+			// again resumes from the failed one
+			logger.Errorf("envelope %s: signed %d of %d documents", view.ID, i, len(view.Documents))
+			respondSignError(c, envelopeDocumentError(name, err))
+			return
+		}
+	}
+
+	previous := view.Status
+	view, err := loadEnvelope(ctx, &view.Envelope)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to retrieve envelope documents", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	if previous != view.Status && view.Status != 0 {
+		notification := []db.Notification{
+			{
+				UserID:  view.Owner,
+				Type:    "envelope",
+				Message: fmt.Sprintf("Envelope %s is %s", view.Name, envelopeStatusName(view.Status)),
+				Metadata: map[string]string{
+					"envelope": view.ID,
+				},
+			},
+		}
+		if _, err := db.Notifications().CreateNotification(ctx, &notification); err != nil {
+			logger.Errorf("failed to generate notification: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// CancelEnvelope cancels the pending documents of an envelope. Only its
+// owner may cancel it.
+func CancelEnvelope(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	view, userKey, ok := envelopeOfRequest(c)
+	if !ok {
+		return
+	}
+
+	if view.Owner != userKey {
+		errorhandler.ReturnError(c, nil, "User not authorized to cancel the envelope", http.StatusForbidden)
+		return
+	}
+	if view.Status != 0 {
+		errorhandler.ReturnError(c, nil, "Envelope is already "+envelopeStatusName(view.Status), http.StatusConflict)
+		return
+	}
+
+	for _, doc := range view.Documents {
+		if status, _ := doc["status"].(float64); status != 0 {
+			continue
+		}
+
+		docKey, _ := doc["@key"].(string)
+		documentMap := map[string]interface{}{
+			"@assetType": "document",
+			"@key":       docKey,
+		}
+		if _, err := chaincode.CancelDocument(ctx, documentMap, float64(1)); err != nil {
+			errorhandler.ReturnError(c, err, "Failed to cancel envelope document", errorhandler.ChaincodeStatus(err))
+			return
+		}
+	}
+
+	view, err := loadEnvelope(ctx, &view.Envelope)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to retrieve envelope documents", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	var notification []db.Notification
+	for _, signer := range view.Signers {
+		notification = append(notification, db.Notification{
+			UserID:  signer,
+			Type:    "envelope",
+			Message: "Envelope " + view.Name + " was cancelled by its owner",
+			Metadata: map[string]string{
+				"envelope": view.ID,
+			},
+		})
+	}
+	if len(notification) > 0 {
+		if _, err := db.Notifications().CreateNotification(ctx, &notification); err != nil {
+			logger.Errorf("failed to generate notification: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// DownloadEnvelope sends a zip with the latest version of every document of
+// an envelope, signed when it has been signed at least once
+func DownloadEnvelope(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	view, _, ok := envelopeOfRequest(c)
+	if !ok {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	names := map[string]int{}
+
+	for _, doc := range view.Documents {
+		docURL, _ := doc["finalDocURL"].(string)
+		if docURL == "" {
+			docURL, _ = doc["originalDocURL"].(string)
+		}
+
+		docBytes, err := utils.DownloadFile(ctx, docURL)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to download document", http.StatusInternalServerError)
+			return
+		}
+
+		name, _ := doc["name"].(string)
+		w, err := archive.Create(uniqueName(names, name))
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to create envelope archive", http.StatusInternalServerError)
+			return
+		}
+		w.Write(docBytes)
+	}
+
+	if err := archive.Close(); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to create envelope archive", http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Content-Disposition", utils.AttachmentDisposition(view.Name+".zip"))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// requestSignerKey returns the ledger key of the logged in user, writing the
+// error response when it cannot be found
+func requestSignerKey(c *gin.Context) (string, bool) {
+	email := c.Request.Header.Get("Email")
+	if email == "" {
+		logger.Error("Email not found in headers")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email not found in headers"})
+		return "", false
+	}
+
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
+	if err != nil {
+		logger.Error(err)
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
+		return "", false
+	}
+	return signerKey, true
+}
+
+// envelopeOfRequest loads the envelope of the :id param for its owner or one
+// of its signers, writing the error response otherwise
+func envelopeOfRequest(c *gin.Context) (*envelopeView, string, bool) {
+	ctx := c.Request.Context()
+
+	userKey, ok := requestSignerKey(c)
+	if !ok {
+		return nil, "", false
+	}
+
+	envelope, err := db.Envelopes().GetEnvelope(ctx, c.Param("id"))
+	if errors.Is(err, db.ErrEnvelopeNotFound) {
+		errorhandler.ReturnError(c, err, "Failed to retrieve envelope", http.StatusNotFound)
+		return nil, "", false
+	}
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to retrieve envelope", http.StatusInternalServerError)
+		return nil, "", false
+	}
+
+	if !isEnvelopeParty(envelope, userKey) {
+		errorhandler.ReturnError(c, nil, "Only the owner and the signers of the envelope can access it", http.StatusForbidden)
+		return nil, "", false
+	}
+
+	view, err := loadEnvelope(ctx, envelope)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to retrieve envelope documents", errorhandler.ChaincodeStatus(err))
+		return nil, "", false
+	}
+	return view, userKey, true
+}
+
+// loadEnvelope fetches the documents of an envelope and saves its status when
+// they changed it
+func loadEnvelope(ctx context.Context, envelope *db.Envelope) (*envelopeView, error) {
+	docs, err := refreshEnvelope(ctx, envelope)
+	if err != nil {
+		return nil, err
+	}
+	return &envelopeView{Envelope: *envelope, Documents: docs}, nil
+}
+
+func refreshEnvelope(ctx context.Context, envelope *db.Envelope) ([]map[string]interface{}, error) {
+	docs := make([]map[string]interface{}, 0, len(envelope.Documents))
+	for _, key := range envelope.Documents {
+		doc, err := chaincode.GetDoc(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	status := envelopeStatus(docs)
+	if status != envelope.Status {
+		if err := db.Envelopes().UpdateEnvelopeStatus(ctx, envelope.ID, status); err != nil {
+			return nil, err
+		}
+		envelope.Status = status
+	}
+	return docs, nil
+}
+
+// envelopeStatus derives the status of an envelope from its documents, with
+// the same values as the status of a document. It is signed only when every
+// document is signed.
+func envelopeStatus(docs []map[string]interface{}) int {
+	done, rejected := 0, 0
+	for _, doc := range docs {
+		status, _ := doc["status"].(float64)
+		switch status {
+		case 1, 2:
+			return int(status)
+		case 3:
+			done++
+		case 4:
+			done++
+			rejected++
+		}
+	}
+
+	switch {
+	case done < len(docs):
+		return 0
+	case rejected > 0:
+		return 4
+	default:
+		return 3
+	}
+}
+
+func envelopeStatusName(status int) string {
+	switch status {
+	case 1:
+		return "cancelled"
+	case 2:
+		return "expired"
+	case 3:
+		return "signed"
+	case 4:
+		return "finalized with rejections"
+	default:
+		return "pending"
+	}
+}
+
+func isEnvelopeParty(envelope *db.Envelope, userKey string) bool {
+	if envelope.Owner == userKey {
+		return true
+	}
+	for _, signer := range envelope.Signers {
+		if signer == userKey {
+			return true
+		}
+	}
+	return false
+}
+
+// envelopeDocumentError names the document a signing error is about
+func envelopeDocumentError(name string, err error) error {
+	var signErr *signError
+	if errors.As(err, &signErr) {
+		return &signError{signErr.status, "Document " + name + ": " + signErr.text, signErr.err}
+	}
+	return err
+}
+
+// uniqueName returns name, or name with a counter when it was already used
+func uniqueName(used map[string]int, name string) string {
+	used[name]++
+	if used[name] == 1 {
+		return name
+	}
+
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), used[name], ext)
+}
@@ -1,7 +1,6 @@
 package documents
 
 import (
-	"log"
 	"net/http"
 	"strconv"
 
@@ -32,10 +31,10 @@ func ExpectedUserSignatures(c *gin.Context) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
 
@@ -57,9 +56,10 @@ func ExpectedUserSignatures(c *gin.Context) {
 		reqMap["status"] = statusFloat
 	}
 
-	documents, err := chaincode.GetExpectedUserDoc(reqMap)
+	documents, err := chaincode.GetExpectedUserDoc(c.Request.Context(), reqMap)
 	if err != nil {
-		log.Fatalf("Error getting expected user documents: %v", err)
+		errorhandler.ReturnError(c, err, "Failed to get expected user documents", errorhandler.ChaincodeStatus(err))
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
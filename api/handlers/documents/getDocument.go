@@ -4,8 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -26,23 +24,30 @@ func GetDoc(c *gin.Context) {
 		return
 	}
 
-	asset, err := chaincode.GetDoc(key)
+	asset, err := chaincode.GetDoc(c.Request.Context(), key)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to retrieve document asset", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to retrieve document asset", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
-	history, err := chaincode.GetDocHistory(key)
+	history, err := chaincode.GetDocHistory(c.Request.Context(), key)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to retrieve document history", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to retrieve document history", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
 	filteredHistory := filterSuccessfulSigners(history)
 
+	doc, err := chaincode.FileAssetFromMap(asset)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to read document signing steps", http.StatusInternalServerError)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"document":        asset,
 		"filteredHistory": filteredHistory,
+		"signingStep":     currentSigningStep(doc),
 	})
 
 }
@@ -58,23 +63,11 @@ func filterSuccessfulSigners(history []chaincode.DocumentHistoryRecord) []Docume
 			continue
 		}
 
-		secondsStr := extractValue(entry.Timestamp, "seconds:")
-		nanosStr := extractValue(entry.Timestamp, "nanos:")
-
-		// Convert extracted values to integers
-		seconds, err := strconv.ParseInt(secondsStr, 10, 64)
-		if err != nil {
-			fmt.Println("Error parsing seconds:", err)
-		}
-
-		nanos, err := strconv.ParseInt(nanosStr, 10, 64)
+		t, err := entry.Time()
 		if err != nil {
-			fmt.Println("Error parsing nanos:", err)
+			continue
 		}
 
-		// Create a time object using Unix time
-		t := time.Unix(seconds, nanos)
-
 		for _, signer := range doc.SuccessfulSignatures {
 			signerKey := signer.Key
 			if !previousSigners[signerKey] {
@@ -90,18 +83,3 @@ func filterSuccessfulSigners(history []chaincode.DocumentHistoryRecord) []Docume
 
 	return filteredHistory
 }
-
-func extractValue(input, prefix string) string {
-	startIndex := strings.Index(input, prefix)
-	if startIndex == -1 {
-		return ""
-	}
-	startIndex += len(prefix)
-	endIndex := strings.Index(input[startIndex:], " ")
-	if endIndex == -1 {
-		endIndex = len(input)
-	} else {
-		endIndex += startIndex
-	}
-	return input[startIndex:endIndex]
-}
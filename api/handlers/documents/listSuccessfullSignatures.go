@@ -18,9 +18,9 @@ func ListSuccessfulSignatures(c *gin.Context) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
-		errorhandler.ReturnError(c, err, err.Error(), http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, err.Error(), errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -34,9 +34,9 @@ func ListSuccessfulSignatures(c *gin.Context) {
 		},
 	}
 
-	docAsset, err := chaincode.SearchAssetTx(queryMap)
+	docAsset, err := chaincode.SearchAssetTx(c.Request.Context(), queryMap)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to search for documents", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to search for documents", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
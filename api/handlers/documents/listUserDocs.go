@@ -29,9 +29,9 @@ func ListUserDocs(c *gin.Context) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
-		errorhandler.ReturnError(c, err, err.Error(), http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, err.Error(), errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -52,9 +52,9 @@ func ListUserDocs(c *gin.Context) {
 		queryMap["status"] = statusFloat
 	}
 
-	docAsset, err := chaincode.SearchAssetTx(queryMap)
+	docAsset, err := chaincode.SearchAssetTx(c.Request.Context(), queryMap)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to search for documents", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to search for documents", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -1,7 +1,6 @@
 package documents
 
 import (
-	"log"
 	"net/http"
 	"strconv"
 
@@ -32,10 +31,10 @@ func PendingSignatures(c *gin.Context) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
 
@@ -57,9 +56,10 @@ func PendingSignatures(c *gin.Context) {
 		reqMap["status"] = statusFloat
 	}
 
-	documents, err := chaincode.GetExpectedUserDoc(reqMap)
+	documents, err := chaincode.GetExpectedUserDoc(c.Request.Context(), reqMap)
 	if err != nil {
-		log.Fatalf("Error getting expected user documents: %v", err)
+		errorhandler.ReturnError(c, err, "Failed to get expected user documents", errorhandler.ChaincodeStatus(err))
+		return
 	}
 
 	filteredDocuments := filterDocuments(documents, signerKey)
@@ -80,6 +80,12 @@ func filterDocuments(documents []map[string]interface{}, signerKey string) []map
 			continue
 		}
 
+		// Documents signed in steps are pending only once the signer's step is reached
+		asset, err := chaincode.FileAssetFromMap(doc)
+		if err == nil && !asset.IsTurnOf(signerKey) {
+			continue
+		}
+
 		filtered = append(filtered, doc)
 	}
 
@@ -0,0 +1,104 @@
+package documents
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// maxPublicUpload bounds the size of the files visitors may compare
+const maxPublicUpload = 20 << 20
+
+type publicSigner struct {
+	Key      string    `json:"key"`
+	Name     string    `json:"name,omitempty"`
+	SignedAt time.Time `json:"signedAt"`
+	TxID     string    `json:"txId"`
+}
+
+type publicComparison struct {
+	SHA256 string `json:"sha256"`
+	// Matches is "final" or "original" when the uploaded file is the signed
+	// or the original file of the document, and "none" otherwise
+	Matches string `json:"matches"`
+}
+
+// PublicVerifyDocument lets anyone holding the key printed in a signed PDF's
+// QR code check the document's signers and status. A PDF uploaded as file is
+// compared with the hashes registered on the ledger.
+func PublicVerifyDocument(c *gin.Context) {
+	key := publicDocumentKey(c.Param("key"))
+	if key == "" {
+		errorhandler.ReturnError(c, fmt.Errorf("missing key"), "Key is required", http.StatusBadRequest)
+		return
+	}
+
+	var comparison *publicComparison
+	if c.Request.Method == http.MethodPost {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPublicUpload)
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			errorhandler.ReturnError(c, err, "File is required", http.StatusBadRequest)
+			return
+		}
+		fbytes, err := utils.GetFileBytes(file)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to read file", http.StatusBadRequest)
+			return
+		}
+		comparison = &publicComparison{SHA256: fmt.Sprintf("%x", sha256.Sum256(fbytes))}
+	}
+
+	asset, err := chaincode.GetDoc(c.Request.Context(), key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to retrieve document", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	history, err := chaincode.GetDocHistory(c.Request.Context(), key)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to retrieve document history", errorhandler.ChaincodeStatus(err))
+		return
+	}
+
+	signers := []publicSigner{}
+	for _, entry := range filterSuccessfulSigners(history) {
+		signer := publicSigner{Key: entry.Signer, SignedAt: entry.Timestamp, TxID: entry.TxID}
+		if user, err := chaincode.GetSigner(c.Request.Context(), entry.Signer); err == nil {
+			signer.Name = user.Name
+		}
+		signers = append(signers, signer)
+	}
+
+	if comparison != nil {
+		comparison.Matches = compareWithLedger(asset, comparison.SHA256).Matches
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":          key,
+		"name":         asset["name"],
+		"status":       asset["status"],
+		"originalHash": asset["originalHash"],
+		"finalHash":    asset["finalHash"],
+		"signers":      signers,
+		"comparison":   comparison,
+	})
+}
+
+// publicDocumentKey accepts a full document key, or the id after the colon
+// that go-sign prints in the QR code
+func publicDocumentKey(key string) string {
+	key = strings.TrimSpace(key)
+	if key == "" || strings.Contains(key, ":") {
+		return key
+	}
+	return chaincode.AssetTypeDocument + ":" + key
+}
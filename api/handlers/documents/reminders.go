@@ -0,0 +1,214 @@
+package documents
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/mailer"
+)
+
+// defaultReminders is when the signers of documents uploaded without a
+// reminder schedule are reminded, before the document timeout
+var defaultReminders = []time.Duration{72 * time.Hour, 24 * time.Hour}
+
+// SendReminders reminds the signers of pending documents to sign them,
+// following the reminder schedule of each document. Only the signers whose
+// turn it is are reminded, and the owner is warned of the missing signatures
+// along with the last reminder.
+func SendReminders(ctx context.Context) error {
+	docs, err := chaincode.GetPendingDocuments(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	users := userCache(ctx)
+	failed := 0
+	for _, asset := range docs {
+		if err := remindSigners(ctx, asset, now, users); err != nil {
+			logger.Errorf("failed to send reminders of document %v: %v", asset["@key"], err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to send reminders of %d documents", failed)
+	}
+	return nil
+}
+
+func remindSigners(ctx context.Context, asset map[string]interface{}, now time.Time, users func(string) *chaincode.User) error {
+	key, _ := asset["@key"].(string)
+	doc, err := chaincode.FileAssetFromMap(asset)
+	if err != nil {
+		return err
+	}
+
+	deadline, err := time.Parse(time.RFC3339, doc.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %q: %w", doc.Timeout, err)
+	}
+	if !now.Before(deadline) {
+		return nil
+	}
+
+	state, err := db.Reminders().GetReminderState(ctx, key)
+	if err != nil {
+		return err
+	}
+	schedule := state.Before
+	if len(schedule) == 0 {
+		schedule = defaultReminders
+	}
+
+	// Reminders missed while the scheduler was not running are recorded
+	// without being sent, only the most urgent one is sent
+	due := dueReminders(schedule, deadline, now)
+	sent := false
+	for _, before := range due {
+		marked, err := db.Reminders().MarkReminderSent(ctx, key, reminderID(before))
+		if err != nil {
+			return err
+		}
+		sent = sent || marked
+	}
+	if !sent {
+		return nil
+	}
+	escalate := due[len(due)-1] == schedule[len(schedule)-1]
+
+	pending := doc.PendingSigners()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	date := deadline.UTC().Format("2006-01-02 15:04 MST")
+	var notification []db.Notification
+	var names []string
+	for _, signer := range pending {
+		notification = append(notification, db.Notification{
+			UserID:   signer.Key,
+			Type:     "reminder",
+			Message:  "Document " + doc.Name + " is waiting for your signature until " + date,
+			Metadata: map[string]string{"document": key},
+		})
+
+		user := users(signer.Key)
+		if user == nil {
+			names = append(names, signer.Key)
+			continue
+		}
+		names = append(names, user.Name)
+		sendEmail(ctx, user, mailer.Message{
+			Subject: "Reminder: " + doc.Name + " is waiting for your signature",
+			Body:    "The document " + doc.Name + " is waiting for your signature until " + date + ".",
+		})
+	}
+
+	if escalate {
+		message := "Document " + doc.Name + " expires on " + date + " and is still missing the signatures of " + strings.Join(names, ", ")
+		notification = append(notification, db.Notification{
+			UserID:   doc.Owner.Key,
+			Type:     "reminder",
+			Message:  message,
+			Metadata: map[string]string{"document": key},
+		})
+		if owner := users(doc.Owner.Key); owner != nil {
+			sendEmail(ctx, owner, mailer.Message{
+				Subject: "Signatures missing on " + doc.Name,
+				Body:    message + ".",
+			})
+		}
+	}
+
+	_, err = db.Notifications().CreateNotification(ctx, &notification)
+	return err
+}
+
+// dueReminders returns the reminders of schedule due at now, the most urgent
+// last
+func dueReminders(schedule []time.Duration, deadline, now time.Time) []time.Duration {
+	var due []time.Duration
+	for _, before := range schedule {
+		if !now.Before(deadline.Add(-before)) {
+			due = append(due, before)
+		}
+	}
+	return due
+}
+
+func reminderID(before time.Duration) string {
+	return "before:" + before.String()
+}
+
+func sendEmail(ctx context.Context, user *chaincode.User, msg mailer.Message) {
+	if user.Email == "" {
+		return
+	}
+	msg.To = []string{user.Email}
+	if err := mailer.Default().Send(ctx, msg); err != nil {
+		logger.Errorf("failed to email %s: %v", user.Key, err)
+	}
+}
+
+// userCache resolves users from the ledger, once per user
+func userCache(ctx context.Context) func(string) *chaincode.User {
+	users := map[string]*chaincode.User{}
+	return func(key string) *chaincode.User {
+		if user, ok := users[key]; ok {
+			return user
+		}
+
+		user, err := chaincode.GetSigner(ctx, key)
+		if err != nil {
+			logger.Errorf("failed to get user %s: %v", key, err)
+		}
+		users[key] = user
+		return user
+	}
+}
+
+// parseReminderSchedule parses a comma separated list of durations before the
+// timeout, such as "3d,1d" or "72h,12h30m", sorted from the earliest reminder
+func parseReminderSchedule(raw string) ([]time.Duration, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var schedule []time.Duration
+	seen := map[time.Duration]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+
+		var before time.Duration
+		var err error
+		if days := strings.TrimSuffix(part, "d"); days != part {
+			var n int
+			n, err = strconv.Atoi(days)
+			before = time.Duration(n) * 24 * time.Hour
+		} else {
+			before, err = time.ParseDuration(part)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid reminders format: %q is not a duration", part)
+		}
+		if before <= 0 {
+			return nil, fmt.Errorf("invalid reminders format: %q must be positive", part)
+		}
+		if seen[before] {
+			return nil, fmt.Errorf("invalid reminders format: %q appears twice", part)
+		}
+		seen[before] = true
+		schedule = append(schedule, before)
+	}
+
+	sort.Slice(schedule, func(i, j int) bool { return schedule[i] > schedule[j] })
+	return schedule, nil
+}
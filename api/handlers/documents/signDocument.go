@@ -2,8 +2,10 @@ package documents
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -12,19 +14,23 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
 	"github.com/umairmaseed/clausia-api/db"
 	"github.com/umairmaseed/clausia-api/utils"
 )
 
 type signForm struct {
-	DocKey           string `form:"dockey" binding:"required"`
-	Password         string `form:"password" binding:"required"`
-	Signature        string `form:"signature" binding:"required"`
-	Username         string `form"username" binding:"required"`
-	Cpf              string `form"cpf" binding:"required"`
-	RejectSignatures bool   `form"rejectsignature" binding:"required"`
+	DocKey   string `form:"dockey" binding:"required"`
+	Password string `form:"password" binding:"required"`
+	// Signature is the go-sign signature position, ignored for documents
+	// with signature fields
+	Signature        string `form:"signature"`
+	Username         string `form:"username" binding:"required"`
+	Cpf              string `form:"cpf" binding:"required"`
+	RejectSignatures bool   `form:"rejectsignature"`
 }
 
 type signResponse struct {
@@ -36,94 +42,172 @@ type signResponse struct {
 	LastSignature string `json:"lastSignature"`
 	Key           string `json:"key"`
 	Error         string `json:"error"`
+
+	// SigningStep is the step expected to sign next, nil once every signer
+	// has acted
+	SigningStep *signingStepStatus `json:"signingStep,omitempty"`
 }
 
 func SignDocument(c *gin.Context) {
 
 	var form signForm
-	var retrieveOriginalDocURL bool = true
 
 	if err := c.ShouldBind(&form); err != nil {
 		errorhandler.ReturnError(c, err, "Failed to bind form data", http.StatusBadRequest)
 		return
 	}
-	var rejectedSign bool = form.RejectSignatures
 
-	// Retrieving document from blockchain
-	asset, err := chaincode.GetDoc(form.DocKey)
+	if !policy.Bound(c, form.DocKey) {
+		return
+	}
+
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), c.Request.Header.Get("Email"))
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to retrieve document asset", http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
 		return
 	}
 
-	originalDocURL, _ := asset["originalDocURL"].(string)
-	fileName, _ := asset["name"].(string)
-	status := asset["status"].(float64)
-	originalHash := asset["originalHash"].(string)
-	requiredSignatures, _ := asset["requiredSignatures"].([]interface{})
-	successfulSignatures, _ := asset["successfulSignatures"].([]interface{})
-	rejectedSignatures := asset["rejectedSignatures"].([]interface{})
-	ownerMap, _ := asset["owner"].(map[string]interface{})
-	ownerKey, _ := ownerMap["@key"].(string)
-	owner := chaincode.Signer{Key: ownerKey}
-	username := form.Username
-	timeout := asset["timeout"].(string)
+	response, _, err := signDocument(c.Request.Context(), signerKey, form)
+	if err != nil {
+		respondSignError(c, err)
+		return
+	}
 
-	finalDocURL, ok := asset["finalDocURL"].(string)
-	if ok {
-		retrieveOriginalDocURL = false
+	c.JSON(http.StatusOK, response)
+}
+
+// signError is a failure of signDocument, with the status and text it is
+// reported with
+type signError struct {
+	status int
+	text   string
+	err    error
+}
+
+func (e *signError) Error() string {
+	if e.err != nil {
+		return e.text + ": " + e.err.Error()
 	}
+	return e.text
+}
 
-	// Checking status before signing the doc
-	if status == 1 {
-		errorhandler.ReturnError(c, nil, "Document is not available for signatures", http.StatusInternalServerError)
-		return
-	} else if status == 2 {
-		errorhandler.ReturnError(c, nil, "Document is expired to be signed", http.StatusInternalServerError)
-		return
-	} else if status == 3 || status == 4 {
-		errorhandler.ReturnError(c, nil, "Document is already finalized for signatures", http.StatusInternalServerError)
+func (e *signError) Unwrap() error {
+	return e.err
+}
+
+func respondSignError(c *gin.Context, err error) {
+	var signErr *signError
+	if errors.As(err, &signErr) {
+		errorhandler.ReturnError(c, signErr.err, signErr.text, signErr.status)
 		return
 	}
+	errorhandler.ReturnError(c, err, "Failed to sign document", http.StatusInternalServerError)
+}
 
-	// Retrieving signer key and signer asset from blockchain
-	signerKey, err := chaincode.GetSignerKey(form.Cpf)
+// signerOf returns the user asset of signerKey, the caller, with a signError
+// unless the CPF and username of the form are theirs
+func signerOf(ctx context.Context, signerKey string, form signForm) (*chaincode.User, error) {
+	signer, err := chaincode.GetSigner(ctx, signerKey)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to retrieve signer key", http.StatusInternalServerError)
-		return
+		return nil, &signError{errorhandler.ChaincodeStatus(err), "Failed to retrieve signer asset", err}
+	}
+	if signer.CPF != form.Cpf || signer.UserName != form.Username {
+		return nil, &signError{http.StatusForbidden, "Signer does not match the logged in user", nil}
 	}
-	ledgerKey := signerKey["@key"].(string)
+	return signer, nil
+}
 
-	signer, err := chaincode.GetSigner(ledgerKey)
+// checkSignable returns a signError unless the document is pending and it is
+// the turn of signerKey to sign it
+func checkSignable(asset map[string]interface{}, signerKey string) (chaincode.FileAsset, error) {
+	doc, err := chaincode.FileAssetFromMap(asset)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to retrieve signer asset", http.StatusInternalServerError)
-		return
+		return doc, &signError{http.StatusInternalServerError, "Failed to read document signing steps", err}
+	}
+
+	// Checking status before signing the doc
+	switch doc.Status {
+	case 1:
+		return doc, &signError{http.StatusInternalServerError, "Document is not available for signatures", nil}
+	case 2:
+		return doc, &signError{http.StatusInternalServerError, "Document is expired to be signed", nil}
+	case 3, 4:
+		return doc, &signError{http.StatusInternalServerError, "Document is already finalized for signatures", nil}
 	}
 
 	// Checking Signer eligible to sign the document
 	signerAllowed := false
-	for _, reqSigner := range requiredSignatures {
-		reqSignerMap, _ := reqSigner.(map[string]interface{})
-		if reqSignerMap["@key"] == ledgerKey {
+	for _, reqSigner := range doc.RequiredSignatures {
+		if reqSigner.Key == signerKey {
 			signerAllowed = true
 			break
 		}
 	}
-
 	if !signerAllowed {
-		errorhandler.ReturnError(c, err, "Signer not allowed to sign the document", http.StatusForbidden)
-		return
+		return doc, &signError{http.StatusForbidden, "Signer not allowed to sign the document", nil}
 	}
 
 	//Check if signer already signed the document
-	for _, sig := range successfulSignatures {
-		signerMap, _ := sig.(map[string]interface{})
-		key, _ := signerMap["@key"].(string)
-		if key == ledgerKey {
-			errorhandler.ReturnError(c, err, "Document already signed by the signer", http.StatusForbidden)
-			return
+	for _, sig := range doc.SuccessfulSignatures {
+		if sig.Key == signerKey {
+			return doc, &signError{http.StatusForbidden, "Document already signed by the signer", nil}
 		}
 	}
+
+	// Checking it is the signer's turn when the document is signed in steps
+	if !doc.IsTurnOf(signerKey) {
+		return doc, &signError{http.StatusForbidden, waitingForStepMessage(doc), nil}
+	}
+
+	return doc, nil
+}
+
+// signDocument signs, or rejects, the document form.DocKey on behalf of the
+// signer with key signerKey, whose CPF and username the form must hold. It
+// returns the response of SignDocument and the
+// document as saved on the ledger.
+func signDocument(ctx context.Context, signerKey string, form signForm) (interface{}, chaincode.FileAsset, error) {
+	var retrieveOriginalDocURL bool = true
+	var rejectedSign bool = form.RejectSignatures
+
+	// Retrieving document from blockchain
+	asset, err := chaincode.GetDoc(ctx, form.DocKey)
+	if err != nil {
+		return nil, chaincode.FileAsset{}, &signError{errorhandler.ChaincodeStatus(err), "Failed to retrieve document asset", err}
+	}
+
+	originalDocURL, _ := asset["originalDocURL"].(string)
+	fileName, _ := asset["name"].(string)
+	originalHash, _ := asset["originalHash"].(string)
+	requiredSignatures, _ := asset["requiredSignatures"].([]interface{})
+	successfulSignatures, _ := asset["successfulSignatures"].([]interface{})
+	rejectedSignatures, _ := asset["rejectedSignatures"].([]interface{})
+	ownerMap, _ := asset["owner"].(map[string]interface{})
+	ownerKey, _ := ownerMap["@key"].(string)
+	owner := chaincode.Signer{Key: ownerKey}
+	timeout, _ := asset["timeout"].(string)
+	finalHash, _ := asset["finalHash"].(string)
+
+	finalDocURL, ok := asset["finalDocURL"].(string)
+	if ok {
+		retrieveOriginalDocURL = false
+	}
+
+	// Retrieving the signer asset of the caller from blockchain
+	signer, err := signerOf(ctx, signerKey, form)
+	if err != nil {
+		return nil, chaincode.FileAsset{}, err
+	}
+	ledgerKey := signer.Key
+	username := signer.UserName
+
+	doc, err := checkSignable(asset, ledgerKey)
+	if err != nil {
+		return nil, chaincode.FileAsset{}, err
+	}
+
+	var status int
+
 	// if Signer reject to sign the document
 	if rejectedSign {
 
@@ -138,69 +222,69 @@ func SignDocument(c *gin.Context) {
 			status = 0
 		}
 
-		rejectedDoc, err := chaincode.UploadDocumentTransaction(chaincode.FileAsset{
+		updated := chaincode.FileAsset{
 			OriginalHash:         originalHash,
-			Status:               int(status),
+			Status:               status,
 			RequiredSignatures:   requiredSigners,
 			OriginalDocURL:       originalDocURL,
 			Name:                 fileName,
 			RejectedSignatures:   rejectedSigners,
 			SuccessfulSignatures: successfulSigners,
-			FinalHash:            asset["finalHash"].(string),
+			FinalHash:            finalHash,
 			FinalDocURL:          finalDocURL,
 			Owner:                owner,
 			Timeout:              timeout,
-		})
+			SigningSteps:         doc.SigningSteps,
+			SignatureFields:      doc.SignatureFields,
+		}
+		rejectedDoc, err := chaincode.UploadDocumentTransaction(ctx, updated)
 		if err != nil {
-			errorhandler.ReturnError(c, err, "failed to save document to ledger:", http.StatusInternalServerError)
-			c.Abort()
-			return
+			return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "failed to save document to ledger:", err}
 		}
 
 		notification := []db.Notification{
 			{
 				UserID:  ownerKey,
 				Type:    "document",
-				Message: "Document rejected by " + signer["name"].(string),
+				Message: "Document rejected by " + signer.Name,
 				Metadata: map[string]string{
 					"document": fileName,
 					"status":   "rejected",
 				},
 			},
 		}
+		notification = append(notification, nextStepNotifications(doc, updated, fileName)...)
 
-		_, err = db.NewNotificationService(db.GetDB().Database()).CreateNotification(c.Request.Context(), &notification)
+		_, err = db.Notifications().CreateNotification(ctx, &notification)
 		if err != nil {
-			errorhandler.ReturnError(c, err, "failed to generate notification", http.StatusInternalServerError)
+			logger.Errorf("failed to generate notification: %v", err)
 		}
 
-		c.JSON(http.StatusOK, rejectedDoc)
-		return
+		return rejectedDoc, updated, nil
 	}
 
-	bucketName := os.Getenv("S3_BUCKET_NAME")
-
-	// Validate which docurl should be used to retrieve the doc from s3
-	var s3FilePath string
+	// Validate which docurl should be used to retrieve the doc
+	docURL := finalDocURL
 	if retrieveOriginalDocURL {
-		s3FilePath = strings.TrimPrefix(originalDocURL, fmt.Sprintf("s3://%s/", bucketName))
-	} else {
-		s3FilePath = strings.TrimPrefix(finalDocURL, fmt.Sprintf("s3://%s/", bucketName))
+		docURL = originalDocURL
 	}
 
-	//  Retrieve document from s3
-	docBytes, err := utils.DownloadFileFromS3(c.Request.Context(), s3FilePath)
+	signature, err := signatureParams(doc, ledgerKey, fileName, form.Signature)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to download document: "+err.Error())
-		return
+		return nil, chaincode.FileAsset{}, &signError{http.StatusBadRequest, "Invalid signature position", err}
+	}
+
+	//  Retrieve document from storage
+	docBytes, err := utils.DownloadFile(ctx, docURL)
+	if err != nil {
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "Failed to download document", err}
 	}
 
-	//Retrive certificate from from s3
+	//Retrive certificate from storage
 	certKey := fmt.Sprintf("certificates/%s_cert.pfx", username)
-	certBytes, err := utils.DownloadFileFromS3(c.Request.Context(), certKey)
+	certBytes, err := utils.DownloadFile(ctx, certKey)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to download certificate: "+err.Error())
-		return
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "Failed to download certificate", err}
 	}
 	url := fmt.Sprintf("%s/api/signdocs", os.Getenv("GO_SIGN_API"))
 	client := http.DefaultClient
@@ -210,21 +294,20 @@ func SignDocument(c *gin.Context) {
 
 	bodyWriter.WriteField("fileName", fileName)
 	bodyWriter.WriteField("password", form.Password)
-	bodyWriter.WriteField("signature", form.Signature)
+	bodyWriter.WriteField("signature", signature)
 	bodyWriter.WriteField("clientBaseUrl", os.Getenv("CLIENT_BASE_URL"))
-	bodyWriter.WriteField("ledgerKey", ledgerKey)
+	// go-sign prints this key in the QR code, so it must identify the document
+	bodyWriter.WriteField("ledgerKey", form.DocKey)
 
 	fileWriter, err := bodyWriter.CreateFormFile("file", fileName)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to create form file for document", http.StatusInternalServerError)
-		return
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "Failed to create form file for document", err}
 	}
 	fileWriter.Write(docBytes)
 
 	certWriter, err := bodyWriter.CreateFormFile("certificate", fmt.Sprintf("%s_cert.pfx", username))
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to create form file for certificate", http.StatusInternalServerError)
-		return
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "Failed to create form file for certificate", err}
 	}
 	certWriter.Write(certBytes)
 
@@ -232,45 +315,46 @@ func SignDocument(c *gin.Context) {
 	bodyWriter.Close()
 
 	// Signing the document and reading the response
-	response, err := client.Post(url, contentType, bodyBuf)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bodyBuf)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Could not sign document due to error", http.StatusInternalServerError)
-		return
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "Could not sign document due to error", err}
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "Could not sign document due to error", err}
 	}
 	defer response.Body.Close()
 
 	resBody, err := io.ReadAll(response.Body)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Unable to read response from signing service", http.StatusInternalServerError)
-		return
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "Unable to read response from signing service", err}
 	}
 
-	fmt.Println("Response from signing service:", string(resBody))
-
 	var res signResponse
 	if err := json.Unmarshal(resBody, &res); err != nil {
-		errorhandler.ReturnError(c, err, "Could not parse response from signing service:", http.StatusInternalServerError)
-		return
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "Could not parse response from signing service:", err}
 	}
 
 	if res.Error != "" {
-		errorhandler.ReturnError(c, err, res.Error, http.StatusInternalServerError)
-		return
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, res.Error, nil}
 	}
 
-	// Organizing the finalDocurl and saving it in the s3
+	// Organizing the finalDocurl and saving it in storage
 	var finalHashName string
 	signedDocHash := fmt.Sprintf("%x", sha256.Sum256(res.File))
 
 	parts := strings.Split(fileName, "-")
 	if len(parts) > 1 {
 		finalHashName = signedDocHash + "-" + parts[1]
+	} else {
+		finalHashName = signedDocHash + "-" + fileName
 	}
 
-	signedDocUrl, err := utils.UploadSignedDocToS3(res.File, finalHashName)
+	signedDocUrl, err := utils.UploadSignedDocument(ctx, res.File, finalHashName)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "Failed to upload document to S3:", http.StatusInternalServerError)
-		return
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "Failed to upload signed document", err}
 	}
 
 	//Organizing updateSignature, rejectedSignatures and requiredSignatures
@@ -298,9 +382,9 @@ func SignDocument(c *gin.Context) {
 	}
 
 	// Updating doc asset state
-	_, err = chaincode.UploadDocumentTransaction(chaincode.FileAsset{
+	updated := chaincode.FileAsset{
 		OriginalHash:         originalHash,
-		Status:               int(status),
+		Status:               status,
 		RequiredSignatures:   requiredSigners,
 		OriginalDocURL:       originalDocURL,
 		Name:                 fileName,
@@ -310,31 +394,35 @@ func SignDocument(c *gin.Context) {
 		FinalDocURL:          signedDocUrl,
 		Owner:                owner,
 		Timeout:              timeout,
-	})
+		SigningSteps:         doc.SigningSteps,
+		SignatureFields:      doc.SignatureFields,
+	}
+	_, err = chaincode.UploadDocumentTransaction(ctx, updated)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "failed to save document to ledger:", http.StatusInternalServerError)
-		c.Abort()
-		return
+		return nil, chaincode.FileAsset{}, &signError{http.StatusInternalServerError, "failed to save document to ledger:", err}
 	}
 
 	notification := []db.Notification{
 		{
 			UserID:  ownerKey,
 			Type:    "document",
-			Message: "Document succeffuly signed by " + signer["name"].(string),
+			Message: "Document succeffuly signed by " + signer.Name,
 			Metadata: map[string]string{
 				"document": fileName,
 				"status":   "accepted",
 			},
 		},
 	}
+	notification = append(notification, nextStepNotifications(doc, updated, fileName)...)
 
-	_, err = db.NewNotificationService(db.GetDB().Database()).CreateNotification(c.Request.Context(), &notification)
+	_, err = db.Notifications().CreateNotification(ctx, &notification)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "failed to generate notification", http.StatusInternalServerError)
+		logger.Errorf("failed to generate notification: %v", err)
 	}
 
-	c.JSON(http.StatusOK, res)
+	res.SigningStep = currentSigningStep(updated)
+
+	return res, updated, nil
 }
 
 func convertToSigners(signatures []interface{}) []chaincode.Signer {
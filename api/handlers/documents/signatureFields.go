@@ -0,0 +1,94 @@
+package documents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+// signatureParam mirrors go-sign's pdfsign.SignatureParam
+type signatureParam struct {
+	Final bool `json:"final"`
+	Rect  struct {
+		X    float64 `json:"x"`
+		Y    float64 `json:"y"`
+		Page int     `json:"page"`
+	} `json:"rect"`
+}
+
+// signatureParams returns the signature position sent to go-sign. Documents
+// with signature fields are stamped at the signer's field, whatever position
+// the client requested. The signature after which every required signer
+// signed or rejected the document is final.
+func signatureParams(doc chaincode.FileAsset, signerKey, fileName, requested string) (string, error) {
+	if len(doc.SignatureFields) == 0 {
+		if requested == "" {
+			return "", fmt.Errorf("signature position is required")
+		}
+		return requested, nil
+	}
+
+	field, ok := doc.SignatureFieldOf(signerKey)
+	if !ok {
+		return "", fmt.Errorf("no signature field defined for signer %s", signerKey)
+	}
+
+	var param signatureParam
+	param.Final = len(doc.SuccessfulSignatures)+len(doc.RejectedSignatures)+1 == len(doc.RequiredSignatures)
+	param.Rect.X = field.X
+	param.Rect.Y = field.Y
+	param.Rect.Page = field.Page
+
+	raw, err := json.Marshal(map[string]signatureParam{fileName: param})
+	return string(raw), err
+}
+
+func parseSignatureFields(raw string) ([]chaincode.SignatureField, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var fields []chaincode.SignatureField
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return nil, fmt.Errorf("invalid signatureFields format: %w", err)
+	}
+	return fields, nil
+}
+
+// validateSignatureFields checks that every required signer has exactly one
+// field on a page of the document, and that no other signer has one
+func validateSignatureFields(fields []chaincode.SignatureField, required []chaincode.Signer) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	isRequired := make(map[string]bool)
+	for _, signer := range required {
+		isRequired[signer.Key] = true
+	}
+
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		key := field.Signer.Key
+		if !isRequired[key] {
+			return fmt.Errorf("signature field for %s, who is not a required signer", key)
+		}
+		if seen[key] {
+			return fmt.Errorf("signer %s has more than one signature field", key)
+		}
+		if field.Page < 1 || field.X < 0 || field.Y < 0 {
+			return fmt.Errorf("invalid signature field for %s: page must be at least 1 and coordinates cannot be negative", key)
+		}
+		seen[key] = true
+	}
+
+	for _, signer := range required {
+		if !seen[signer.Key] {
+			return fmt.Errorf("required signer %s has no signature field", signer.Key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package documents
+
+import (
+	"fmt"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+type signingStepStatus struct {
+	Step           int                `json:"step"`
+	Steps          int                `json:"steps"`
+	Role           string             `json:"role,omitempty"`
+	PendingSigners []chaincode.Signer `json:"pendingSigners"`
+}
+
+// currentSigningStep describes the step expected to sign the document next,
+// numbered from 1. It returns nil once every signer has acted.
+func currentSigningStep(doc chaincode.FileAsset) *signingStepStatus {
+	current := doc.CurrentStep()
+	if current < 0 {
+		return nil
+	}
+
+	steps := doc.Steps()
+	return &signingStepStatus{
+		Step:           current + 1,
+		Steps:          len(steps),
+		Role:           steps[current].Role,
+		PendingSigners: doc.PendingSigners(),
+	}
+}
+
+func waitingForStepMessage(doc chaincode.FileAsset) string {
+	step := currentSigningStep(doc)
+	if step == nil {
+		return "Document has no pending signing step"
+	}
+	if step.Role != "" {
+		return fmt.Sprintf("Signer must wait for signing step %d of %d (%s)", step.Step, step.Steps, step.Role)
+	}
+	return fmt.Sprintf("Signer must wait for signing step %d of %d", step.Step, step.Steps)
+}
+
+// nextStepNotifications asks the signers of the next step to sign once the
+// previous step is complete
+func nextStepNotifications(before, after chaincode.FileAsset, fileName string) []db.Notification {
+	current := after.CurrentStep()
+	if current < 0 || current == before.CurrentStep() {
+		return nil
+	}
+
+	var notifications []db.Notification
+	for _, signer := range after.PendingSigners() {
+		notifications = append(notifications, db.Notification{
+			UserID:  signer.Key,
+			Type:    "document",
+			Message: "It is your turn to sign " + fileName,
+			Metadata: map[string]string{
+				"document": fileName,
+				"status":   "pending",
+			},
+		})
+	}
+	return notifications
+}
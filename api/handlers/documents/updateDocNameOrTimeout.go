@@ -7,9 +7,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/logger"
 	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/chaincode"
 	"github.com/umairmaseed/clausia-api/db"
-	"github.com/umairmaseed/clausia-api/utils"
 )
 
 type updateDoc struct {
@@ -26,21 +26,13 @@ func UpdateDocNameOrTimeout(c *gin.Context) {
 		return
 	}
 
-	email := c.Request.Header.Get("Email")
-	if email == "" {
-		errorhandler.ReturnError(c, fmt.Errorf("email not found in headers"), "email not found in headers", http.StatusBadRequest)
+	if !policy.Bound(c, form.DocKey) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	doc, err := chaincode.GetDoc(c.Request.Context(), form.DocKey)
 	if err != nil {
-		errorhandler.ReturnError(c, err, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	doc, err := chaincode.GetDoc(form.DocKey)
-	if err != nil {
-		errorhandler.ReturnError(c, err, err.Error(), http.StatusInternalServerError)
+		errorhandler.ReturnError(c, err, err.Error(), errorhandler.ChaincodeStatus(err))
 		return
 	}
 
@@ -56,11 +48,6 @@ func UpdateDocNameOrTimeout(c *gin.Context) {
 		return
 	}
 
-	if ownerKey != signerKey {
-		errorhandler.ReturnError(c, fmt.Errorf("user not authorized to changed the status of the document"), "user not authorized to changed the status of the document", http.StatusBadRequest)
-		return
-	}
-
 	if doc == nil {
 		errorhandler.ReturnError(c, nil, "No document found", http.StatusNotFound)
 		return
@@ -84,10 +71,10 @@ func UpdateDocNameOrTimeout(c *gin.Context) {
 		"@key":       form.DocKey,
 	}
 
-	updateDoc, err := chaincode.UpdateDocument(documentMAp, updatesMap)
+	updateDoc, err := chaincode.UpdateDocument(c.Request.Context(), documentMAp, updatesMap)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
 
@@ -102,9 +89,9 @@ func UpdateDocNameOrTimeout(c *gin.Context) {
 		},
 	}
 
-	_, err = db.NewNotificationService(db.GetDB().Database()).CreateNotification(c.Request.Context(), &notification)
+	_, err = db.Notifications().CreateNotification(c.Request.Context(), &notification)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "failed to generate notification", http.StatusInternalServerError)
+		logger.Errorf("failed to generate notification: %v", err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -2,6 +2,7 @@ package documents
 
 import (
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"mime/multipart"
 	"net/http"
@@ -19,6 +20,20 @@ type uploadDocumentForm struct {
 	Files              []*multipart.FileHeader `form:"files" binding:"required"`
 	RequiredSignatures string                  `form:"requiredSignatures" binding:"required"`
 	Timeout            string                  `form:"timeout" binding:"required"`
+	// SigningSteps is a JSON array of steps signed one after the other, e.g.
+	// [{"role":"counterparty","signers":[{"@key":"user:1"}]},{"role":"witness","signers":[...]}].
+	// Without it every required signer may sign in any order.
+	SigningSteps string `form:"signingSteps"`
+	// SignatureFields is a JSON array with the position of the signature of
+	// each required signer, e.g. [{"signer":{"@key":"user:1"},"page":1,"x":100,"y":120}].
+	// Without it signers choose the position when signing.
+	SignatureFields string `form:"signatureFields"`
+	// EnvelopeName names the envelope created when several files are
+	// uploaded, the name of the first file by default
+	EnvelopeName string `form:"envelopeName"`
+	// Reminders is when signers are reminded to sign, before the timeout,
+	// e.g. "3d,1d". Without it the default reminders are sent.
+	Reminders string `form:"reminders"`
 }
 
 func UploadDocument(c *gin.Context) {
@@ -27,6 +42,7 @@ func UploadDocument(c *gin.Context) {
 	if err := c.Bind(&form); err != nil {
 		logger.Error(err)
 		c.String(http.StatusBadRequest, err.Error())
+		return
 	}
 
 	timeout := form.Timeout
@@ -38,10 +54,10 @@ func UploadDocument(c *gin.Context) {
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
 	if err != nil {
 		logger.Error(err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(errorhandler.ChaincodeStatus(err), err.Error())
 		return
 	}
 
@@ -49,9 +65,43 @@ func UploadDocument(c *gin.Context) {
 		Key: signerKey,
 	}
 
-	fileHashes := make([]string, len(form.Files))
+	requiredSignatures, _ := parseRequiredSignatures(form.RequiredSignatures)
+	if err := validateRequiredSignatures(requiredSignatures); err != nil {
+		logger.Error(err)
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	signingSteps, err := parseSigningSteps(form.SigningSteps)
+	if err == nil {
+		err = validateSigningSteps(signingSteps, requiredSignatures)
+	}
+	if err != nil {
+		logger.Error(err)
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	signatureFields, err := parseSignatureFields(form.SignatureFields)
+	if err == nil {
+		err = validateSignatureFields(signatureFields, requiredSignatures)
+	}
+	if err != nil {
+		logger.Error(err)
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reminders, err := parseReminderSchedule(form.Reminders)
+	if err != nil {
+		logger.Error(err)
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fileHashes := make([]string, 0, len(form.Files))
+	documents := make([]map[string]interface{}, 0, len(form.Files))
 
-	var response interface{}
 	for _, f := range form.Files {
 
 		fbytes, err := utils.GetFileBytes(f)
@@ -61,32 +111,26 @@ func UploadDocument(c *gin.Context) {
 			c.Abort()
 			return
 		}
-		requiredSignatures, _ := parseRequiredSignatures(form.RequiredSignatures)
-		if err := validateRequiredSignatures(requiredSignatures); err != nil {
-			logger.Error(err)
-			c.String(http.StatusBadRequest, err.Error())
-			c.Abort()
-			return
-		}
-
 		hash := fmt.Sprintf("%x", sha256.Sum256(fbytes))
 		filename := f.Filename
-		s3Url, err := utils.UploadFileToS3(fbytes, filename)
+		docURL, err := utils.UploadFile(c.Request.Context(), fbytes, filename)
 		if err != nil {
 			logger.Error(err)
-			c.String(http.StatusInternalServerError, "failed to upload file to s3: "+err.Error())
+			c.String(http.StatusInternalServerError, "failed to upload file: "+err.Error())
 			c.Abort()
 			return
 		}
 
-		processAsset, err := chaincode.UploadDocumentTransaction(chaincode.FileAsset{
+		processAsset, err := chaincode.UploadDocumentTransaction(c.Request.Context(), chaincode.FileAsset{
 			OriginalHash:       hash,
 			Status:             0,
 			RequiredSignatures: requiredSignatures,
-			OriginalDocURL:     s3Url,
+			OriginalDocURL:     docURL,
 			Name:               filename,
 			Owner:              ownerMap,
 			Timeout:            timeout,
+			SigningSteps:       signingSteps,
+			SignatureFields:    signatureFields,
 		})
 		if err != nil {
 			logger.Error(err)
@@ -95,9 +139,41 @@ func UploadDocument(c *gin.Context) {
 			return
 		}
 
+		if len(reminders) > 0 {
+			key, _ := processAsset["@key"].(string)
+			if err := db.Reminders().SetReminderSchedule(c.Request.Context(), key, reminders); err != nil {
+				logger.Errorf("failed to save reminders of document %s: %v", key, err)
+			}
+		}
+
 		fileHashes = append(fileHashes, hash)
+		documents = append(documents, processAsset)
+	}
 
-		response = processAsset
+	// Several files are signed together as an envelope
+	var envelope *db.Envelope
+	if len(documents) > 1 {
+		envelope = &db.Envelope{
+			Name:    form.EnvelopeName,
+			Owner:   signerKey,
+			Timeout: timeout,
+		}
+		if envelope.Name == "" {
+			envelope.Name = form.Files[0].Filename
+		}
+		for _, signer := range requiredSignatures {
+			envelope.Signers = append(envelope.Signers, signer.Key)
+		}
+		for _, doc := range documents {
+			key, _ := doc["@key"].(string)
+			envelope.Documents = append(envelope.Documents, key)
+		}
+
+		if err := db.Envelopes().CreateEnvelope(c.Request.Context(), envelope); err != nil {
+			logger.Error(err)
+			c.String(http.StatusInternalServerError, "failed to save envelope: "+err.Error())
+			return
+		}
 	}
 
 	notification := []db.Notification{
@@ -106,22 +182,40 @@ func UploadDocument(c *gin.Context) {
 			Type:    "document",
 			Message: "Document uploaded successfully",
 		},
-		{
-			UserID:  form.RequiredSignatures,
+	}
+
+	// Only the signers of the first step are asked to sign for now, the
+	// others are notified when their turn comes
+	firstStep := chaincode.FileAsset{RequiredSignatures: requiredSignatures, SigningSteps: signingSteps}
+	for _, signer := range firstStep.PendingSigners() {
+		if envelope != nil {
+			notification = append(notification, db.Notification{
+				UserID:   signer.Key,
+				Type:     "envelope",
+				Message:  "You have been requested by " + signerKey + " to sign the envelope " + envelope.Name,
+				Metadata: map[string]string{"envelope": envelope.ID},
+			})
+			continue
+		}
+		notification = append(notification, db.Notification{
+			UserID:  signer.Key,
 			Type:    "document",
-			Message: "You have been request by" + signerKey + " to sign a document",
-		},
+			Message: "You have been requested by " + signerKey + " to sign a document",
+		})
 	}
 
-	_, err = db.NewNotificationService(db.GetDB().Database()).CreateNotification(c.Request.Context(), &notification)
+	_, err = db.Notifications().CreateNotification(c.Request.Context(), &notification)
 	if err != nil {
-		errorhandler.ReturnError(c, err, "failed to generate notification", http.StatusInternalServerError)
+		logger.Errorf("failed to generate notification: %v", err)
 	}
 
 	c.Set("fileHashes", fileHashes)
 
-	c.JSON(http.StatusCreated, response)
-
+	if envelope != nil {
+		c.JSON(http.StatusCreated, envelopeView{Envelope: *envelope, Documents: documents})
+		return
+	}
+	c.JSON(http.StatusCreated, documents[0])
 }
 
 func parseRequiredSignatures(signatures string) ([]chaincode.Signer, error) {
@@ -137,6 +231,54 @@ func parseRequiredSignatures(signatures string) ([]chaincode.Signer, error) {
 	return requiredSignatures, nil
 }
 
+func parseSigningSteps(raw string) ([]chaincode.SigningStep, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var steps []chaincode.SigningStep
+	if err := json.Unmarshal([]byte(raw), &steps); err != nil {
+		return nil, fmt.Errorf("invalid signingSteps format: %w", err)
+	}
+	return steps, nil
+}
+
+// validateSigningSteps checks that every required signer belongs to exactly
+// one step, and that the steps name no other signer
+func validateSigningSteps(steps []chaincode.SigningStep, required []chaincode.Signer) error {
+	if len(steps) == 0 {
+		return nil
+	}
+
+	stepOf := make(map[string]int)
+	for i, step := range steps {
+		if len(step.Signers) == 0 {
+			return fmt.Errorf("signing step %d has no signers", i+1)
+		}
+		for _, signer := range step.Signers {
+			if signer.Key == "" {
+				return fmt.Errorf("signing step %d: signer key cannot be empty", i+1)
+			}
+			if prev, ok := stepOf[signer.Key]; ok {
+				return fmt.Errorf("signer %s appears in signing steps %d and %d", signer.Key, prev+1, i+1)
+			}
+			stepOf[signer.Key] = i
+		}
+	}
+
+	for _, signer := range required {
+		if _, ok := stepOf[signer.Key]; !ok {
+			return fmt.Errorf("required signer %s is not part of any signing step", signer.Key)
+		}
+		delete(stepOf, signer.Key)
+	}
+	for key := range stepOf {
+		return fmt.Errorf("signer %s is not a required signer", key)
+	}
+
+	return nil
+}
+
 func validateRequiredSignatures(signatures []chaincode.Signer) error {
 	if len(signatures) == 0 {
 		return fmt.Errorf("requiredSignatures cannot be empty")
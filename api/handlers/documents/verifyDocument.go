@@ -0,0 +1,146 @@
+package documents
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/api/policy"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/env"
+	"github.com/umairmaseed/clausia-api/pdfverify"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+type verifyDocumentForm struct {
+	File *multipart.FileHeader `form:"file"`
+	Key  string                `form:"key"`
+}
+
+// ledgerCheck compares the verified file with the hashes registered on the ledger
+type ledgerCheck struct {
+	DocumentKey  string `json:"documentKey,omitempty"`
+	OriginalHash string `json:"originalHash,omitempty"`
+	FinalHash    string `json:"finalHash,omitempty"`
+	// Matches is "final" or "original" when the file is the signed or the
+	// original file registered on the ledger, and "none" otherwise
+	Matches string `json:"matches"`
+}
+
+// VerifyDocument reports on the signatures of an uploaded PDF, or of the
+// latest file of the document with the given key
+func VerifyDocument(c *gin.Context) {
+	var form verifyDocumentForm
+
+	if err := c.ShouldBind(&form); err != nil {
+		errorhandler.ReturnError(c, err, "Failed to bind form data", http.StatusBadRequest)
+		return
+	}
+
+	if (form.File == nil) == (form.Key == "") {
+		errorhandler.ReturnError(c, fmt.Errorf("either file or key must be provided, but not both"), "Invalid input: provide either file or key", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		pdf []byte
+		doc map[string]interface{}
+		err error
+	)
+	if form.File != nil {
+		pdf, err = utils.GetFileBytes(form.File)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to read file", http.StatusBadRequest)
+			return
+		}
+	} else {
+		// Anyone may verify a file they hold, but only the parties of a
+		// document may have it fetched by key
+		target := policy.Document(func(*gin.Context) string { return form.Key })
+		if _, ok := policy.Authorize(c, target, policy.Owner, policy.Signer); !ok {
+			return
+		}
+
+		doc, err = chaincode.GetDoc(c.Request.Context(), form.Key)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to retrieve document asset", errorhandler.ChaincodeStatus(err))
+			return
+		}
+
+		url, ok := doc["finalDocURL"].(string)
+		if !ok || url == "" {
+			url, _ = doc["originalDocURL"].(string)
+		}
+		pdf, err = utils.DownloadFile(c.Request.Context(), url)
+		if err != nil {
+			errorhandler.ReturnError(c, err, "Failed to download document", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	report, err := pdfverify.Verify(pdf, pdfverify.Options{Roots: trustedRoots()})
+	if err != nil && !errors.Is(err, pdfverify.ErrNoSignatures) {
+		errorhandler.ReturnError(c, err, "Failed to verify document", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if doc == nil {
+		doc, err = chaincode.GetDocByHash(c.Request.Context(), report.SHA256)
+		if err != nil && !errors.Is(err, chaincode.ErrNotFound) {
+			errorhandler.ReturnError(c, err, "Failed to search for the document", errorhandler.ChaincodeStatus(err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"report": report,
+		"ledger": compareWithLedger(doc, report.SHA256),
+	})
+}
+
+func compareWithLedger(doc map[string]interface{}, hash string) ledgerCheck {
+	check := ledgerCheck{Matches: "none"}
+	if doc == nil {
+		return check
+	}
+
+	check.DocumentKey, _ = doc["@key"].(string)
+	check.OriginalHash, _ = doc["originalHash"].(string)
+	check.FinalHash, _ = doc["finalHash"].(string)
+
+	switch hash {
+	case check.FinalHash:
+		check.Matches = "final"
+	case check.OriginalHash:
+		check.Matches = "original"
+	}
+	return check
+}
+
+// trustedRoots returns the root certificates from the PEM bundle named by the
+// PDF_TRUSTED_ROOTS env var, or nil to use the system pool
+func trustedRoots() *x509.CertPool {
+	path := os.Getenv(env.PDF_TRUSTED_ROOTS)
+	if path == "" {
+		return nil
+	}
+
+	bundle, err := os.ReadFile(path)
+	if err != nil {
+		logger.Errorf("failed to read %s: %v", env.PDF_TRUSTED_ROOTS, err)
+		return nil
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(bundle) {
+		logger.Errorf("no certificates found in %s", path)
+		return nil
+	}
+	return roots
+}
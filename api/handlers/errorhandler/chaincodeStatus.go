@@ -0,0 +1,27 @@
+package errorhandler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+// ChaincodeStatus returns the HTTP status matching an error returned by the
+// chaincode package, so a missing asset is not reported like an unreachable peer
+func ChaincodeStatus(err error) int {
+	switch {
+	case errors.Is(err, chaincode.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, chaincode.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, chaincode.ErrBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, chaincode.ErrEndorsement):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, chaincode.ErrTransport):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
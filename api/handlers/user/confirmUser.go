@@ -1,6 +1,7 @@
 package user
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -29,11 +30,11 @@ func ConfirmUser(c *gin.Context) {
 	var err error
 
 	if form.Email != "" {
-		userId, err = findUserByEmail(form.Email)
+		userId, err = findUserByEmail(c.Request.Context(), form.Email)
 	} else if form.UserName != "" {
-		userId, err = findUserByUserName(form.UserName)
+		userId, err = findUserByUserName(c.Request.Context(), form.UserName)
 	} else if form.Id != "" {
-		userId, err = findUserByID(form.Id)
+		userId, err = findUserByID(c.Request.Context(), form.Id)
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No parameter was passed"})
 		return
@@ -51,30 +52,30 @@ func ConfirmUser(c *gin.Context) {
 	})
 }
 
-func findUserByEmail(email string) (string, error) {
-	key, err := utils.SearchAndReturnSignerKey(email)
+func findUserByEmail(ctx context.Context, email string) (string, error) {
+	key, err := utils.SearchAndReturnSignerKey(ctx, email)
 	if err != nil {
 		return "", err
 	}
 	return key, nil
 }
 
-func findUserByUserName(userName string) (string, error) {
+func findUserByUserName(ctx context.Context, userName string) (string, error) {
 	auth := auth.NewAuth()
 	_, email, err := auth.CheckIfUserExistsAndGetEmail(userName)
 	if err != nil {
 		return "", err
 	}
 
-	key, nerr := utils.SearchAndReturnSignerKey(email)
+	key, nerr := utils.SearchAndReturnSignerKey(ctx, email)
 	if nerr != nil {
 		return "", err
 	}
 	return key, nil
 }
 
-func findUserByID(id string) (string, error) {
-	_, err := chaincode.GetSigner(id)
+func findUserByID(ctx context.Context, id string) (string, error) {
+	_, err := chaincode.GetSigner(ctx, id)
 	if err != nil {
 		return "", err
 	}
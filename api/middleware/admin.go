@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/env"
+)
+
+// RequireAdmin lets through only the users whose email is listed in the
+// comma separated ADMIN_EMAILS env var. It must run after the authentication
+// middleware, which sets the Email header.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsAdmin(c.Request.Header.Get("Email")) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// IsAdmin tells whether email is listed in ADMIN_EMAILS
+func IsAdmin(email string) bool {
+	if email == "" {
+		return false
+	}
+	for _, admin := range strings.Split(os.Getenv(env.ADMIN_EMAILS), ",") {
+		if strings.EqualFold(strings.TrimSpace(admin), email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(60, time.Minute, 2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("10.0.0.1"); !ok {
+			t.Fatalf("expected request %d to be allowed", i+1)
+		}
+	}
+	ok, wait := l.Allow("10.0.0.1")
+	if ok || wait != time.Second {
+		t.Fatalf("expected the burst to be exhausted for a second, got %v, %v", ok, wait)
+	}
+	if ok, _ := l.Allow("10.0.0.2"); !ok {
+		t.Fatal("expected other clients not to be limited")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("10.0.0.1"); !ok {
+		t.Fatal("expected a token to be refilled after a second")
+	}
+
+	now = now.Add(time.Hour)
+	l.Allow("10.0.0.3")
+	if _, ok := l.buckets["10.0.0.1"]; ok {
+		t.Fatal("expected idle clients to be pruned")
+	}
+}
@@ -0,0 +1,308 @@
+// Package policy authorizes requests on contracts and documents from the
+// relations of the caller to them. Routes declare the relations they allow
+// with Require, and handlers can check them with Authorize.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/umairmaseed/clausia-api/api/handlers/errorhandler"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// Relation is how a user relates to a contract or a document
+type Relation string
+
+// Relations of a user to an asset. The owner of a document may also be one
+// of its signers, so a user can hold more than one relation.
+const (
+	Owner       Relation = "owner"
+	Participant Relation = "participant"
+	Signer      Relation = "signer"
+	None        Relation = "none"
+)
+
+// Context keys holding the relations of the caller and the key of the asset
+// once a rule let the request through
+const (
+	relationsKey = "policy.relations"
+	assetKeyKey  = "policy.key"
+)
+
+// AssetKey reads the key of the asset a request acts on, or an empty string
+// when the request does not name one
+type AssetKey func(c *gin.Context) string
+
+// Param reads the asset key from a path param
+func Param(name string) AssetKey {
+	return func(c *gin.Context) string {
+		return c.Param(name)
+	}
+}
+
+// Query reads the asset key from a query param
+func Query(name string) AssetKey {
+	return func(c *gin.Context) string {
+		return c.Query(name)
+	}
+}
+
+// Body reads the asset key from a field of the JSON or form body, holding
+// either the key or an asset reference. The body is left for the handler to
+// bind, which then checks the key it bound with Bound.
+func Body(field string) AssetKey {
+	return func(c *gin.Context) string {
+		if c.ContentType() != binding.MIMEJSON {
+			return refKey(c.PostForm(field))
+		}
+
+		if c.Request.Body == nil {
+			return ""
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return ""
+		}
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return ""
+		}
+		switch value := fields[field].(type) {
+		case string:
+			return value
+		case map[string]interface{}:
+			key, _ := value["@key"].(string)
+			return key
+		}
+		return ""
+	}
+}
+
+// refKey returns the key of a form value, which holds either the key or the
+// JSON of an asset reference
+func refKey(value string) string {
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		return value
+	}
+
+	var ref chaincode.AssetRef
+	if err := json.Unmarshal([]byte(value), &ref); err != nil {
+		return ""
+	}
+	return ref.Key
+}
+
+// Target is an asset a request acts on, with the way its key is read from the
+// request and the relations of a user to it are resolved
+type Target struct {
+	asset     string
+	key       AssetKey
+	relations func(ctx context.Context, key, userKey string) ([]Relation, error)
+}
+
+// Contract targets the contract whose key is read by key. Its owner and
+// participants relate to it.
+func Contract(key AssetKey) Target {
+	return Target{asset: "contract", key: key, relations: contractRelations}
+}
+
+// Clause targets the contract holding the clause whose key is read by key
+func Clause(key AssetKey) Target {
+	return Target{asset: "clause", key: key, relations: clauseRelations}
+}
+
+// Receipt targets the contract of the payment receipt whose ID is read by
+// key. The parties of the contract relate to it.
+func Receipt(key AssetKey) Target {
+	return Target{asset: "receipt", key: key, relations: receiptRelations}
+}
+
+// Document targets the document whose key is read by key. Its owner and
+// required signers relate to it.
+func Document(key AssetKey) Target {
+	return Target{asset: "document", key: key, relations: documentRelations}
+}
+
+// Relations returns the relations of a user to the asset with the given key,
+// which hold None alone when the user is not related to it
+func (t Target) Relations(ctx context.Context, key, userKey string) ([]Relation, error) {
+	relations, err := t.relations(ctx, key, userKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(relations) == 0 {
+		return []Relation{None}, nil
+	}
+	return relations, nil
+}
+
+func contractRelations(ctx context.Context, key, userKey string) ([]Relation, error) {
+	contract, err := chaincode.GetContract(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return relationsToContract(*contract, userKey), nil
+}
+
+func clauseRelations(ctx context.Context, key, userKey string) ([]Relation, error) {
+	contract, err := chaincode.GetClauseContract(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return relationsToContract(*contract, userKey), nil
+}
+
+func receiptRelations(ctx context.Context, id, userKey string) ([]Relation, error) {
+	receipt, err := db.PaymentReceipts().GetPaymentReceipt(ctx, id)
+	if errors.Is(err, db.ErrPaymentReceiptNotFound) {
+		return nil, fmt.Errorf("receipt %s: %w", id, chaincode.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return contractRelations(ctx, receipt.ContractKey, userKey)
+}
+
+func relationsToContract(contract chaincode.AutoExecutableContract, userKey string) []Relation {
+	var relations []Relation
+	if contract.OwnerKey() == userKey {
+		relations = append(relations, Owner)
+	}
+	if contract.HasParticipant(userKey) {
+		relations = append(relations, Participant)
+	}
+	return relations
+}
+
+func documentRelations(ctx context.Context, key, userKey string) ([]Relation, error) {
+	asset, err := chaincode.GetDoc(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := chaincode.FileAssetFromMap(asset)
+	if err != nil {
+		return nil, err
+	}
+
+	var relations []Relation
+	if doc.Owner.Key == userKey {
+		relations = append(relations, Owner)
+	}
+	for _, signer := range doc.RequiredSignatures {
+		if signer.Key == userKey {
+			relations = append(relations, Signer)
+			break
+		}
+	}
+	return relations, nil
+}
+
+// Require is the middleware letting through the callers holding one of the
+// allowed relations to the target. Others get a 403, and requests not naming
+// the target a 400. It must run after the authentication middleware, which
+// sets the Email header.
+func Require(target Target, allowed ...Relation) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, relations, ok := authorize(c, target, allowed...)
+		if !ok {
+			c.Abort()
+			return
+		}
+		c.Set(relationsKey, relations)
+		c.Set(assetKeyKey, key)
+		c.Next()
+	}
+}
+
+// Authorize resolves the relations of the caller to the target and checks
+// that one of them is allowed, writing the error response otherwise
+func Authorize(c *gin.Context, target Target, allowed ...Relation) ([]Relation, bool) {
+	_, relations, ok := authorize(c, target, allowed...)
+	return relations, ok
+}
+
+func authorize(c *gin.Context, target Target, allowed ...Relation) (string, []Relation, bool) {
+	key := target.key(c)
+	if key == "" {
+		errorhandler.ReturnError(c, fmt.Errorf("the request does not name the %s", target.asset), target.asset+" key is required", http.StatusBadRequest)
+		return "", nil, false
+	}
+
+	email := c.Request.Header.Get("Email")
+	if email == "" {
+		errorhandler.ReturnError(c, errors.New("email not found in headers"), "email not found in headers", http.StatusBadRequest)
+		return "", nil, false
+	}
+
+	userKey, err := utils.SearchAndReturnSignerKey(c.Request.Context(), email)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find user key", errorhandler.ChaincodeStatus(err))
+		return "", nil, false
+	}
+
+	relations, err := target.Relations(c.Request.Context(), key, userKey)
+	if err != nil {
+		errorhandler.ReturnError(c, err, "Failed to find "+target.asset+" asset", errorhandler.ChaincodeStatus(err))
+		return "", nil, false
+	}
+
+	if !Allows(relations, allowed...) {
+		errorhandler.ReturnError(c, forbidden(target.asset, allowed), "Forbidden", http.StatusForbidden)
+		return "", nil, false
+	}
+	return key, relations, true
+}
+
+// Allows tells whether one of the relations is allowed
+func Allows(relations []Relation, allowed ...Relation) bool {
+	for _, relation := range relations {
+		for _, a := range allowed {
+			if relation == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RelationsOf returns the relations of the caller stored by Require, nil
+// when the route has no rule
+func RelationsOf(c *gin.Context) []Relation {
+	relations, _ := c.Get(relationsKey)
+	r, _ := relations.([]Relation)
+	return r
+}
+
+// Bound checks that the key a handler bound from the request is the one
+// Require authorized, writing a 400 otherwise. The JSON binding matches
+// fields regardless of case, so a body can name a second asset that the
+// rule did not read.
+func Bound(c *gin.Context, key string) bool {
+	authorized, ok := c.Get(assetKeyKey)
+	if !ok || authorized == key {
+		return true
+	}
+	errorhandler.ReturnError(c, fmt.Errorf("the request names %s besides the authorized %s", key, authorized), "Conflicting asset keys", http.StatusBadRequest)
+	return false
+}
+
+func forbidden(asset string, allowed []Relation) error {
+	names := make([]string, len(allowed))
+	for i, relation := range allowed {
+		names[i] = string(relation)
+	}
+	return fmt.Errorf("the %s relation is required on the %s", strings.Join(names, " or "), asset)
+}
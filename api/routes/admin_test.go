@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/scheduler"
+)
+
+func TestAdminJobs(t *testing.T) {
+	h := newHarness(t)
+	t.Setenv("ADMIN_EMAILS", "ops@example.com, Root@Example.com")
+
+	db.SetJobs(db.NewMemoryJobStore())
+	t.Cleanup(func() { db.SetJobs(nil) })
+
+	jobs := scheduler.New("test")
+	scheduler.SetDefault(jobs)
+	t.Cleanup(func() { scheduler.SetDefault(nil) })
+
+	jobs.Register(scheduler.Job{
+		Name:     "expire-documents",
+		Schedule: scheduler.Every(time.Hour),
+		Run:      func(ctx context.Context) error { return errors.New("ledger unavailable") },
+	})
+
+	h.expect(h.do(http.MethodGet, "/admin/jobs", "alice@example.com", nil), http.StatusForbidden, nil)
+
+	var list struct {
+		Jobs []scheduler.JobStatus `json:"jobs"`
+	}
+	h.expect(h.do(http.MethodGet, "/admin/jobs", "root@example.com", nil), http.StatusOK, &list)
+	if len(list.Jobs) != 1 || list.Jobs[0].Schedule != "@every 1h0m0s" || list.Jobs[0].LastRun != nil {
+		t.Fatalf("unexpected jobs %+v", list.Jobs)
+	}
+
+	h.expect(h.do(http.MethodPost, "/admin/jobs/expire-documents/pause", "ops@example.com", nil), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, "/admin/jobs/unknown/pause", "ops@example.com", nil), http.StatusNotFound, nil)
+
+	var run db.JobRun
+	h.expect(h.do(http.MethodPost, "/admin/jobs/expire-documents/run", "ops@example.com", nil), http.StatusOK, &run)
+	if run.Error != "ledger unavailable" || run.Trigger != scheduler.TriggerManual {
+		t.Fatalf("unexpected run %+v", run)
+	}
+
+	h.expect(h.do(http.MethodGet, "/admin/jobs", "ops@example.com", nil), http.StatusOK, &list)
+	if !list.Jobs[0].Paused || list.Jobs[0].LastRun == nil || list.Jobs[0].LastRun.ID != run.ID {
+		t.Fatalf("expected the job to be paused with its last run, got %+v", list.Jobs[0])
+	}
+
+	h.expect(h.do(http.MethodPost, "/admin/jobs/expire-documents/resume", "ops@example.com", nil), http.StatusOK, nil)
+
+	var runs struct {
+		Runs []db.JobRun `json:"runs"`
+	}
+	h.expect(h.do(http.MethodGet, "/admin/jobs/expire-documents/runs?limit=5", "ops@example.com", nil), http.StatusOK, &runs)
+	if len(runs.Runs) != 1 {
+		t.Fatalf("expected one run, got %v", runs.Runs)
+	}
+	h.expect(h.do(http.MethodGet, "/admin/jobs/expire-documents/runs?limit=0", "ops@example.com", nil), http.StatusBadRequest, nil)
+}
@@ -0,0 +1,143 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/calendar"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+func TestUserCalendar(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	h.user("Carol", "carol@example.com", "33333333333")
+
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:interval",
+		"id":         "interval",
+		"actionType": float64(chaincode.ActionCheckDateInterval),
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:rent",
+		"id":         "rent",
+		"actionType": float64(chaincode.ActionMakePayment),
+		"parameters": map[string]interface{}{"dueDate": "2024-02-05"},
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":    chaincode.AssetTypeContract,
+		"@key":          "autoExecutableContract:lease",
+		"name":          "Lease",
+		"signatureDate": "2024-01-01T10:00:00Z",
+		"owner":         ref(chaincode.AssetTypeUser, alice),
+		"participants":  []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"clauses": []interface{}{
+			ref(chaincode.AssetTypeClause, "clause:interval"),
+			ref(chaincode.AssetTypeClause, "clause:rent"),
+		},
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":    chaincode.AssetTypeContract,
+		"@key":          "autoExecutableContract:cancelled",
+		"name":          "Cancelled",
+		"signatureDate": "2024-01-15T10:00:00Z",
+		"owner":         ref(chaincode.AssetTypeUser, alice),
+	})
+	lifecycle := &db.ContractLifecycle{ContractKey: "autoExecutableContract:cancelled", State: db.ContractCancelled}
+	if err := h.lifecycles.SaveContractLifecycle(context.Background(), lifecycle); err != nil {
+		t.Fatal(err)
+	}
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":         chaincode.AssetTypeDocument,
+		"@key":               "document:lease",
+		"name":               "lease.pdf",
+		"status":             0.0,
+		"timeout":            "2024-03-15T18:00:00Z",
+		"owner":              ref(chaincode.AssetTypeUser, alice),
+		"requiredSignatures": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+	})
+
+	form := url.Values{
+		"clause":        {`{"@assetType":"clause","@key":"clause:interval"}`},
+		"referenceDate": {"2024-03-01"},
+	}
+	h.expect(h.do(http.MethodPost, "/addreferencedate", "bob@example.com", form), http.StatusOK, nil)
+
+	var got struct {
+		Events []calendar.Event `json:"events"`
+	}
+	h.expect(h.do(http.MethodGet, "/calendar", "bob@example.com", nil), http.StatusOK, &got)
+	expected := []calendar.EventType{calendar.EventSignature, calendar.EventPaymentDue, calendar.EventReferenceDate, calendar.EventDocumentTimeout}
+	if len(got.Events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), got.Events)
+	}
+	for i, eventType := range expected {
+		if got.Events[i].Type != eventType {
+			t.Errorf("event %d: expected %s, got %+v", i, eventType, got.Events[i])
+		}
+	}
+
+	// The end of a range given as a date includes the whole day
+	got.Events = nil
+	h.expect(h.do(http.MethodGet, "/calendar?from=2024-02-01&to=2024-03-01", "bob@example.com", nil), http.StatusOK, &got)
+	if len(got.Events) != 2 || got.Events[0].ClauseKey != "clause:rent" || got.Events[1].ClauseKey != "clause:interval" {
+		t.Fatalf("unexpected events in range %+v", got.Events)
+	}
+	h.expect(h.do(http.MethodGet, "/calendar?from=yesterday", "bob@example.com", nil), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodGet, "/calendar?from=2024-03-01&to=2024-02-01", "bob@example.com", nil), http.StatusBadRequest, nil)
+
+	// The cancelled contract of the owner is left out
+	got.Events = nil
+	h.expect(h.do(http.MethodGet, "/calendar", "alice@example.com", nil), http.StatusOK, &got)
+	for _, event := range got.Events {
+		if event.ContractKey == "autoExecutableContract:cancelled" {
+			t.Fatalf("expected no events of the cancelled contract, got %+v", event)
+		}
+	}
+	got.Events = nil
+	h.expect(h.do(http.MethodGet, "/calendar", "carol@example.com", nil), http.StatusOK, &got)
+	if len(got.Events) != 0 {
+		t.Fatalf("expected no events, got %+v", got.Events)
+	}
+
+	var feed struct {
+		URL    string `json:"url"`
+		Webcal string `json:"webcal"`
+	}
+	h.expect(h.do(http.MethodPost, "/calendar/feed", "bob@example.com", nil), http.StatusOK, &feed)
+	path := strings.TrimPrefix(feed.URL, "http://example.com")
+	if !strings.HasPrefix(path, "/public/calendar/") || !strings.HasSuffix(path, ".ics") || feed.Webcal != "webcal://example.com"+path {
+		t.Fatalf("unexpected feed %+v", feed)
+	}
+
+	// The feed is read without the Cognito token
+	rec := h.do(http.MethodGet, path, "", nil)
+	h.expect(rec, http.StatusOK, nil)
+	ics := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") || !strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n") || strings.Count(ics, "BEGIN:VEVENT") != len(expected) {
+		t.Fatalf("unexpected feed %v\n%s", rec.Header(), ics)
+	}
+	if !strings.Contains(ics, "DTSTART;VALUE=DATE:20240205\r\n") || !strings.Contains(ics, "UID:documentTimeout-document:lease@clausia\r\n") {
+		t.Fatalf("expected the dates in the feed, got\n%s", ics)
+	}
+	h.expect(h.do(http.MethodGet, strings.TrimSuffix(path, ".ics"), "", nil), http.StatusOK, nil)
+	h.expect(h.do(http.MethodGet, "/public/calendar/unknown.ics", "", nil), http.StatusNotFound, nil)
+
+	// A new feed revokes the previous one
+	h.expect(h.do(http.MethodPost, "/calendar/feed", "bob@example.com", nil), http.StatusOK, &feed)
+	h.expect(h.do(http.MethodGet, path, "", nil), http.StatusNotFound, nil)
+	path = strings.TrimPrefix(feed.URL, "http://example.com")
+	h.expect(h.do(http.MethodGet, path, "", nil), http.StatusOK, nil)
+
+	h.expect(h.do(http.MethodDelete, "/calendar/feed", "bob@example.com", nil), http.StatusOK, nil)
+	h.expect(h.do(http.MethodGet, path, "", nil), http.StatusNotFound, nil)
+	h.expect(h.do(http.MethodDelete, "/calendar/feed", "bob@example.com", nil), http.StatusNotFound, nil)
+}
@@ -0,0 +1,283 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/api/handlers/contract"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+func TestContractFlow(t *testing.T) {
+	h := newHarness(t)
+	t.Setenv("INVITE_EXPiRY_TIME", "24")
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	var created struct {
+		Contract  chaincode.AutoExecutableContract `json:"contract"`
+		Lifecycle db.ContractLifecycle             `json:"lifecycle"`
+	}
+	h.expect(h.do(http.MethodPost, "/createcontract", "alice@example.com", map[string]interface{}{
+		"name":          "Lease",
+		"signatureDate": "2024-01-01T00:00:00Z",
+		"participants":  []interface{}{ref(chaincode.AssetTypeUser, bob)},
+	}), http.StatusOK, &created)
+
+	contractKey := created.Contract.Key
+	if contractKey == "" || created.Contract.OwnerKey() != alice || created.Contract.HasParticipant(bob) {
+		t.Fatalf("unexpected contract %+v", created.Contract)
+	}
+	if created.Lifecycle.State != db.ContractPendingAcceptance || len(created.Lifecycle.Invited) != 1 {
+		t.Fatalf("expected bob to be invited, got %+v", created.Lifecycle)
+	}
+	token := h.notifications.metadata(bob, "token")
+	if token == "" {
+		t.Fatalf("expected bob to be notified of the invitation, got %s", h.notifications)
+	}
+
+	addClause := map[string]interface{}{
+		"autoExecutableContract": ref(chaincode.AssetTypeContract, contractKey),
+		"id":                     "payment",
+		"description":            "Monthly rent",
+		"actionType":             "1",
+	}
+	h.expect(h.do(http.MethodPost, "/addclause", "bob@example.com", addClause), http.StatusForbidden, nil)
+
+	var updated struct {
+		Contract chaincode.AutoExecutableContract `json:"contract"`
+	}
+	h.expect(h.do(http.MethodPost, "/addclause", "alice@example.com", addClause), http.StatusOK, &updated)
+	if len(updated.Contract.Clauses) != 1 {
+		t.Fatalf("expected one clause, got %+v", updated.Contract.Clauses)
+	}
+	clauseKey := updated.Contract.Clauses[0].Key
+
+	h.expect(h.do(http.MethodPost, "/addreferencedate", "alice@example.com", map[string]interface{}{
+		"clause":        ref(chaincode.AssetTypeClause, clauseKey),
+		"referenceDate": "2024-02-01T00:00:00Z",
+	}), http.StatusConflict, nil)
+
+	fineClause := map[string]interface{}{
+		"autoExecutableContract": ref(chaincode.AssetTypeContract, contractKey),
+		"id":                     "fine",
+		"actionType":             "2",
+	}
+	h.expect(h.do(http.MethodPost, "/addclause", "alice@example.com", fineClause), http.StatusOK, &updated)
+	fineKey := updated.Contract.Clauses[1].Key
+
+	var removed struct {
+		Contract chaincode.AutoExecutableContract `json:"contract"`
+	}
+	h.expect(h.do(http.MethodPost, "/removeclause", "alice@example.com", map[string]interface{}{
+		"autoExecutableContract": ref(chaincode.AssetTypeContract, contractKey),
+		"clause":                 fineKey,
+	}), http.StatusOK, &removed)
+	if len(removed.Contract.Clauses) != 1 || removed.Contract.Clauses[0].Key != clauseKey {
+		t.Fatalf("expected the fine clause to be removed, got %+v", removed.Contract.Clauses)
+	}
+	if _, ok := h.ledger.Get(fineKey); ok {
+		t.Fatal("expected the clause asset to be deleted")
+	}
+
+	h.expect(h.do(http.MethodPost, "/contracts/invitations/accept?token="+token, "alice@example.com", nil), http.StatusForbidden, nil)
+
+	var accepted struct {
+		Contract  chaincode.AutoExecutableContract `json:"contract"`
+		Lifecycle db.ContractLifecycle             `json:"lifecycle"`
+	}
+	h.expect(h.do(http.MethodPost, "/contracts/invitations/accept?token="+token, "bob@example.com", nil), http.StatusOK, &accepted)
+	if !accepted.Contract.HasParticipant(bob) || accepted.Lifecycle.State != db.ContractActive {
+		t.Fatalf("expected bob to join the active contract, got %+v %+v", accepted.Contract, accepted.Lifecycle)
+	}
+	h.expect(h.do(http.MethodPost, "/contracts/invitations/accept?token="+token, "bob@example.com", nil), http.StatusConflict, nil)
+
+	var userContracts struct {
+		Created     []chaincode.AutoExecutableContract `json:"userCreatedContracts"`
+		Participant []chaincode.AutoExecutableContract `json:"participantContract"`
+	}
+	h.expect(h.do(http.MethodGet, "/getusercontracts", "alice@example.com", nil), http.StatusOK, &userContracts)
+	if len(userContracts.Created) != 1 || len(userContracts.Participant) != 0 {
+		t.Fatalf("unexpected contracts for alice %+v", userContracts)
+	}
+	h.expect(h.do(http.MethodGet, "/getusercontracts", "bob@example.com", nil), http.StatusOK, &userContracts)
+	if len(userContracts.Created) != 0 || len(userContracts.Participant) != 1 {
+		t.Fatalf("unexpected contracts for bob %+v", userContracts)
+	}
+
+	h.expect(h.do(http.MethodPost, "/addclause", "alice@example.com", addClause), http.StatusConflict, nil)
+
+	var gotClause struct {
+		Clause chaincode.Clause `json:"clause"`
+	}
+	h.expect(h.do(http.MethodGet, "/getclause?clauseKey="+clauseKey, "bob@example.com", nil), http.StatusOK, &gotClause)
+	if gotClause.Clause.Id != "payment" || gotClause.Clause.ActionType != 1 {
+		t.Fatalf("unexpected clause %+v", gotClause.Clause)
+	}
+
+	var gotContract struct {
+		Contract chaincode.AutoExecutableContract `json:"contract"`
+	}
+	h.expect(h.do(http.MethodGet, "/getcontract?contractKey="+contractKey, "bob@example.com", nil), http.StatusOK, &gotContract)
+	if gotContract.Contract.Name != "Lease" {
+		t.Fatalf("unexpected contract %+v", gotContract.Contract)
+	}
+
+	h.expect(h.do(http.MethodGet, "/getdateswithclause?clauseKey="+clauseKey, "bob@example.com", nil), http.StatusOK, nil)
+
+	var clauseResp struct {
+		Clause chaincode.Clause `json:"clause"`
+	}
+	h.expect(h.do(http.MethodPost, "/addreferencedate", "alice@example.com", map[string]interface{}{
+		"clause":        ref(chaincode.AssetTypeClause, clauseKey),
+		"referenceDate": "2024-02-01T00:00:00Z",
+	}), http.StatusOK, &clauseResp)
+	if clauseResp.Clause.Input["referenceDate"] != "2024-02-01T00:00:00Z" {
+		t.Fatalf("expected reference date in the clause input, got %+v", clauseResp.Clause)
+	}
+
+	h.expect(h.do(http.MethodPost, "/addreviewtocontract", "bob@example.com", map[string]interface{}{
+		"rating":                 5,
+		"comments":               "Smooth",
+		"date":                   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		"autoExecutableContract": ref(chaincode.AssetTypeContract, contractKey),
+	}), http.StatusOK, &updated)
+	if len(updated.Contract.Reviews) != 1 || updated.Contract.Reviews[0].User.Key != bob {
+		t.Fatalf("expected bob's review, got %+v", updated.Contract.Reviews)
+	}
+
+	contract.ExecuteContract(context.Background())
+	if h.asset(clauseKey)["finalized"] != true {
+		t.Fatalf("expected the clause to be executed, got %v", h.asset(clauseKey))
+	}
+
+	var lifecycle struct {
+		Lifecycle db.ContractLifecycle `json:"lifecycle"`
+	}
+	h.expect(h.do(http.MethodGet, "/contracts/"+contractKey+"/lifecycle", "bob@example.com", nil), http.StatusOK, &lifecycle)
+	if lifecycle.Lifecycle.State != db.ContractCompleted {
+		t.Fatalf("expected the contract to be completed, got %+v", lifecycle.Lifecycle)
+	}
+	h.expect(h.do(http.MethodPost, "/removeclause", "alice@example.com", map[string]interface{}{
+		"autoExecutableContract": ref(chaincode.AssetTypeContract, contractKey),
+		"clause":                 clauseKey,
+	}), http.StatusConflict, nil)
+}
+
+func TestDeclineInvitation(t *testing.T) {
+	h := newHarness(t)
+	t.Setenv("INVITE_EXPiRY_TIME", "24")
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	carol := h.user("Carol", "carol@example.com", "33333333333")
+
+	var created struct {
+		Contract chaincode.AutoExecutableContract `json:"contract"`
+	}
+	h.expect(h.do(http.MethodPost, "/createcontract", "alice@example.com", map[string]interface{}{
+		"name":          "Lease",
+		"signatureDate": "2024-01-01T00:00:00Z",
+		"participants":  []interface{}{ref(chaincode.AssetTypeUser, bob), ref(chaincode.AssetTypeUser, carol)},
+	}), http.StatusOK, &created)
+
+	var answered struct {
+		Lifecycle db.ContractLifecycle `json:"lifecycle"`
+	}
+	h.expect(h.do(http.MethodPost, "/contracts/invitations/decline?token="+h.notifications.metadata(bob, "token"), "bob@example.com", nil), http.StatusOK, &answered)
+	if answered.Lifecycle.State != db.ContractPendingAcceptance {
+		t.Fatalf("expected the contract to wait for carol, got %+v", answered.Lifecycle)
+	}
+	h.expect(h.do(http.MethodPost, "/contracts/invitations/accept?token="+h.notifications.metadata(bob, "token"), "bob@example.com", nil), http.StatusConflict, nil)
+
+	// The acceptance of carol does not activate the contract that bob
+	// declined, the owner decides
+	h.expect(h.do(http.MethodPost, "/contracts/invitations/accept?token="+h.notifications.metadata(carol, "token"), "carol@example.com", nil), http.StatusOK, &answered)
+	if answered.Lifecycle.State != db.ContractDraft || len(answered.Lifecycle.Declined) != 1 || len(answered.Lifecycle.Accepted) != 1 {
+		t.Fatalf("expected the contract to go back to draft, got %+v", answered.Lifecycle)
+	}
+	if participants, _ := h.asset(created.Contract.Key)["participants"].([]interface{}); len(participants) != 1 {
+		t.Fatalf("expected carol alone on the contract, got %v", h.asset(created.Contract.Key))
+	}
+	if h.notifications.metadata(alice, "state") != string(db.ContractDraft) {
+		t.Fatalf("expected the owner to be told the contract is back to draft, got %s", h.notifications)
+	}
+
+	// The clauses carol accepted cannot change anymore
+	contractRef := ref(chaincode.AssetTypeContract, created.Contract.Key)
+	rec := h.do(http.MethodPost, "/addclause", "alice@example.com", map[string]interface{}{
+		"autoExecutableContract": contractRef,
+		"id":                     "payment",
+		"actionType":             "1",
+	})
+	h.expect(rec, http.StatusConflict, nil)
+	if !strings.Contains(rec.Body.String(), "accepted") {
+		t.Fatalf("expected the acceptance to block the clause change, got %s", rec.Body)
+	}
+	h.expect(h.do(http.MethodPost, "/addclauses", "alice@example.com", map[string]interface{}{"autoExecutableContract": contractRef, "clauses": []interface{}{map[string]interface{}{"id": "fine", "actionType": 2}}}), http.StatusConflict, nil)
+	h.expect(h.do(http.MethodPost, "/removeclause", "alice@example.com", map[string]interface{}{"autoExecutableContract": contractRef, "clause": "clause:missing"}), http.StatusConflict, nil)
+
+	h.expect(h.do(http.MethodPost, "/contracts/invitations/accept?token=invalid", "bob@example.com", nil), http.StatusUnauthorized, nil)
+	h.expect(h.do(http.MethodGet, "/contracts/"+created.Contract.Key+"/lifecycle", "bob@example.com", nil), http.StatusForbidden, nil)
+
+	// The owner goes on without the users who declined
+	h.expect(h.do(http.MethodPost, "/contracts/"+created.Contract.Key+"/activate", "alice@example.com", nil), http.StatusOK, &answered)
+	if answered.Lifecycle.State != db.ContractActive {
+		t.Fatalf("expected the contract to be active, got %+v", answered.Lifecycle)
+	}
+}
+
+func TestActivateContract(t *testing.T) {
+	h := newHarness(t)
+	t.Setenv("INVITE_EXPiRY_TIME", "24")
+
+	h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	var created struct {
+		Contract  chaincode.AutoExecutableContract `json:"contract"`
+		Lifecycle db.ContractLifecycle             `json:"lifecycle"`
+	}
+	h.expect(h.do(http.MethodPost, "/createcontract", "alice@example.com", map[string]interface{}{
+		"name":          "Loan",
+		"signatureDate": "2024-01-01T00:00:00Z",
+		"clauses":       []interface{}{map[string]interface{}{"id": "interval", "actionType": 0}},
+	}), http.StatusOK, &created)
+	if created.Lifecycle.State != db.ContractDraft {
+		t.Fatalf("expected a draft contract, got %+v", created.Lifecycle)
+	}
+	contractPath := "/contracts/" + created.Contract.Key
+	clause := map[string]interface{}{
+		"clause":        ref(chaincode.AssetTypeClause, created.Contract.Clauses[0].Key),
+		"referenceDate": "2024-03-01",
+	}
+	h.expect(h.do(http.MethodPost, "/addreferencedate", "alice@example.com", clause), http.StatusConflict, nil)
+
+	h.expect(h.do(http.MethodPost, contractPath+"/activate", "bob@example.com", nil), http.StatusForbidden, nil)
+
+	var activated struct {
+		Lifecycle db.ContractLifecycle `json:"lifecycle"`
+	}
+	h.expect(h.do(http.MethodPost, contractPath+"/activate", "alice@example.com", nil), http.StatusOK, &activated)
+	if activated.Lifecycle.State != db.ContractActive {
+		t.Fatalf("expected the contract to be active, got %+v", activated.Lifecycle)
+	}
+	h.expect(h.do(http.MethodPost, "/addreferencedate", "alice@example.com", clause), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, contractPath+"/activate", "alice@example.com", nil), http.StatusConflict, nil)
+
+	// Contracts awaiting answers become active once they are answered
+	var pending struct {
+		Contract chaincode.AutoExecutableContract `json:"contract"`
+	}
+	h.expect(h.do(http.MethodPost, "/createcontract", "alice@example.com", map[string]interface{}{
+		"name":          "Lease",
+		"signatureDate": "2024-01-01T00:00:00Z",
+		"participants":  []interface{}{ref(chaincode.AssetTypeUser, bob)},
+	}), http.StatusOK, &pending)
+	h.expect(h.do(http.MethodPost, "/contracts/"+pending.Contract.Key+"/activate", "alice@example.com", nil), http.StatusConflict, nil)
+}
@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+func TestMultiCurrencyInputs(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:rent",
+		"actionType": float64(chaincode.ActionMakePayment),
+		"parameters": map[string]interface{}{"amount": 1000.0, "currency": "BRL"},
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:fine",
+		"actionType": float64(chaincode.ActionCheckFine),
+		"parameters": map[string]interface{}{"currency": "EUR"},
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:credit",
+		"actionType": float64(chaincode.ActionGetCredit),
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":   chaincode.AssetTypeContract,
+		"@key":         "autoExecutableContract:lease",
+		"name":         "Lease",
+		"owner":        ref(chaincode.AssetTypeUser, alice),
+		"participants": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"clauses": []interface{}{
+			ref(chaincode.AssetTypeClause, "clause:rent"),
+			ref(chaincode.AssetTypeClause, "clause:fine"),
+			ref(chaincode.AssetTypeClause, "clause:credit"),
+		},
+	})
+
+	pay := func(amount, currency string) multipartForm {
+		return multipartForm{
+			fields: url.Values{
+				"clause":       {`{"@assetType":"clause","@key":"clause:rent"}`},
+				"date":         {"2024-02-01"},
+				"payment":      {amount},
+				"currency":     {currency},
+				"finalPayment": {"false"},
+			},
+			files: []formFile{{field: "Receipt", name: "receipt.pdf", data: []byte("transfer of " + amount + " " + currency)}},
+		}
+	}
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", pay("100", "XYZ")), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", pay("100", "GBP")), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", pay("-100", "USD")), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", pay("100.001", "USD")), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", pay("1e-999999", "USD")), http.StatusBadRequest, nil)
+
+	// A payment in dollars is recorded in reais, with the rate it was
+	// converted with
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", pay("100.10", "usd")), http.StatusOK, nil)
+	input, _ := h.asset("clause:rent")["input"].(map[string]interface{})
+	original, _ := input["original"].(map[string]interface{})
+	rate, _ := input["rate"].(map[string]interface{})
+	if input["payment"] != 500.5 || input["currency"] != "BRL" || original["amount"] != 100.1 || original["currency"] != "USD" {
+		t.Fatalf("expected the payment converted into BRL, got %v", input)
+	}
+	if rate["from"] != "USD" || rate["to"] != "BRL" || rate["value"] != 5.0 || rate["source"] != "test" || rate["asOf"] != "2024-01-02T00:00:00Z" {
+		t.Fatalf("expected the rate snapshot on the clause, got %v", rate)
+	}
+
+	fine := map[string]interface{}{
+		"clause":          ref(chaincode.AssetTypeClause, "clause:fine"),
+		"referenceValue":  "1000",
+		"dailyPercentage": 1.5,
+	}
+	h.expect(h.do(http.MethodPost, "/addinputstocheckfine", "bob@example.com", fine), http.StatusOK, nil)
+	input, _ = h.asset("clause:fine")["input"].(map[string]interface{})
+	if input["referenceValue"] != 1000.0 || input["currency"] != "EUR" || input["original"] != nil || input["dailyPercentage"] != 1.5 {
+		t.Fatalf("expected the reference value in the currency of the clause, got %v", input)
+	}
+	fine["currency"] = "BRL"
+	h.expect(h.do(http.MethodPost, "/addinputstocheckfine", "bob@example.com", fine), http.StatusOK, nil)
+	input, _ = h.asset("clause:fine")["input"].(map[string]interface{})
+	if input["referenceValue"] != 180.0 || input["currency"] != "EUR" {
+		t.Fatalf("expected the reference value converted into EUR, got %v", input)
+	}
+
+	// Clauses without a currency are in the default one
+	credit := map[string]interface{}{
+		"clause":      ref(chaincode.AssetTypeClause, "clause:credit"),
+		"storedValue": 20,
+		"currency":    "EUR",
+	}
+	h.expect(h.do(http.MethodPost, "/addstoredvaluetogetcredit", "bob@example.com", credit), http.StatusOK, nil)
+	input, _ = h.asset("clause:credit")["input"].(map[string]interface{})
+	if input["storedValue"] != 111.11 || input["currency"] != "BRL" {
+		t.Fatalf("expected the stored value converted into BRL, got %v", input)
+	}
+	delete(credit, "storedValue")
+	h.expect(h.do(http.MethodPost, "/addstoredvaluetogetcredit", "bob@example.com", credit), http.StatusBadRequest, nil)
+
+	// Card payments are charged in the currency of the payer, and recorded
+	// in the currency of the clause
+	var created struct {
+		Payment db.ClausePayment `json:"payment"`
+	}
+	intent := map[string]interface{}{
+		"clause":   ref(chaincode.AssetTypeClause, "clause:rent"),
+		"payment":  "10.5",
+		"currency": "USD",
+		"date":     "2024-02-02",
+	}
+	h.expect(h.do(http.MethodPost, "/payments/intents", "bob@example.com", intent), http.StatusOK, &created)
+	if created.Payment.Amount != 1050 || created.Payment.Currency != "usd" {
+		t.Fatalf("unexpected payment %+v", created.Payment)
+	}
+	intent["payment"] = "10.555"
+	h.expect(h.do(http.MethodPost, "/payments/intents", "bob@example.com", intent), http.StatusBadRequest, nil)
+
+	h.expect(h.do(http.MethodPost, "/payments/"+created.Payment.ID+"/mock/pay", "bob@example.com", nil), http.StatusOK, nil)
+	input, _ = h.asset("clause:rent")["input"].(map[string]interface{})
+	if input["payment"] != 52.5 || input["currency"] != "BRL" || input["stripeToken"] != created.Payment.IntentID {
+		t.Fatalf("expected the card payment converted into BRL, got %v", input)
+	}
+}
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+func TestDocumentFlow(t *testing.T) {
+	h := newHarness(t)
+
+	if err := h.blobs.Put(context.Background(), "documents/lease.pdf", strings.NewReader("%PDF-1.7")); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	doc := h.ledger.Put(map[string]interface{}{
+		"@assetType":           chaincode.AssetTypeDocument,
+		"originalHash":         "abc123",
+		"name":                 "lease.pdf",
+		"originalDocURL":       "blob://documents/lease.pdf",
+		"status":               0,
+		"owner":                ref(chaincode.AssetTypeUser, alice),
+		"requiredSignatures":   []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"successfulSignatures": []interface{}{},
+		"rejectedSignatures":   []interface{}{},
+		"timeout":              "2099-01-01T00:00:00Z",
+	})
+	docKey := doc["@key"].(string)
+
+	var list struct {
+		Documents []map[string]interface{} `json:"documents"`
+	}
+	h.expect(h.do(http.MethodGet, "/listdocuments", "alice@example.com", nil), http.StatusOK, &list)
+	if len(list.Documents) != 1 || list.Documents[0]["@key"] != docKey {
+		t.Fatalf("expected alice to own the document, got %v", list.Documents)
+	}
+
+	h.expect(h.do(http.MethodGet, "/listdocuments", "bob@example.com", nil), http.StatusOK, &list)
+	if len(list.Documents) != 0 {
+		t.Fatalf("expected bob to own no document, got %v", list.Documents)
+	}
+
+	h.expect(h.do(http.MethodGet, "/pendingsignatures", "bob@example.com", nil), http.StatusOK, &list)
+	if len(list.Documents) != 1 {
+		t.Fatalf("expected one pending signature for bob, got %v", list.Documents)
+	}
+
+	h.expect(h.do(http.MethodGet, "/expectedsignatures", "bob@example.com", nil), http.StatusOK, &list)
+	if len(list.Documents) != 1 {
+		t.Fatalf("expected one expected signature for bob, got %v", list.Documents)
+	}
+
+	rename := url.Values{"dockey": {docKey}, "name": {"lease-v2.pdf"}}
+	h.expect(h.do(http.MethodPost, "/updatedocnameortimeout", "bob@example.com", rename), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/updatedocnameortimeout", "alice@example.com", rename), http.StatusOK, nil)
+	if name := h.asset(docKey)["name"]; name != "lease-v2.pdf" {
+		t.Fatalf("expected document to be renamed, got %v", name)
+	}
+	if len(h.notifications.forUser(alice)) != 1 {
+		t.Fatalf("expected alice to be notified of the update, got %s", h.notifications)
+	}
+
+	var got struct {
+		Document map[string]interface{} `json:"document"`
+	}
+	h.expect(h.do(http.MethodGet, "/getdocument?key="+docKey, "bob@example.com", nil), http.StatusOK, &got)
+	if got.Document["name"] != "lease-v2.pdf" {
+		t.Fatalf("unexpected document %v", got.Document)
+	}
+
+	download := h.do(http.MethodPost, "/downloaddocument", "bob@example.com", url.Values{"originalurl": {"blob://documents/lease.pdf"}})
+	h.expect(download, http.StatusOK, nil)
+	if body := download.Body.String(); body != "%PDF-1.7" {
+		t.Fatalf("unexpected download %q", body)
+	}
+
+	h.expect(h.do(http.MethodGet, "/getdocument?key=document:missing", "bob@example.com", nil), http.StatusNotFound, nil)
+
+	cancel := map[string]interface{}{"@key": docKey}
+	h.expect(h.do(http.MethodPost, "/canceldocument", "bob@example.com", cancel), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/canceldocument", "alice@example.com", cancel), http.StatusOK, nil)
+	if status := h.asset(docKey)["status"]; status != float64(1) {
+		t.Fatalf("expected document to be cancelled, got status %v", status)
+	}
+
+	h.expect(h.do(http.MethodGet, "/listdocuments?status=1", "alice@example.com", nil), http.StatusOK, &list)
+	if len(list.Documents) != 1 {
+		t.Fatalf("expected one cancelled document, got %v", list.Documents)
+	}
+	h.expect(h.do(http.MethodGet, "/listdocuments?status=0", "alice@example.com", nil), http.StatusOK, &list)
+	if len(list.Documents) != 0 {
+		t.Fatalf("expected no pending document, got %v", list.Documents)
+	}
+}
+
+func TestLedgerErrorsAreMapped(t *testing.T) {
+	h := newHarness(t)
+	h.user("Alice", "alice@example.com", "11111111111")
+
+	h.expect(h.do(http.MethodGet, "/listdocuments", "", nil), http.StatusUnauthorized, nil)
+	h.expect(h.do(http.MethodGet, "/listdocuments", "nobody@example.com", nil), http.StatusNotFound, nil)
+
+	h.ledger.FailNext("searchAssetQuery", http.StatusServiceUnavailable)
+	h.expect(h.do(http.MethodGet, "/listdocuments", "alice@example.com", nil), http.StatusBadGateway, nil)
+
+	h.ledger.FailNext("searchAssetQuery", http.StatusInternalServerError)
+	h.expect(h.do(http.MethodGet, "/listdocuments", "alice@example.com", nil), http.StatusUnprocessableEntity, nil)
+}
@@ -0,0 +1,159 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestEnvelopes(t *testing.T) {
+	h := newHarness(t)
+	h.signingService("bob", "carol")
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	carol := h.user("Carol", "carol@example.com", "33333333333")
+	h.user("Eve", "eve@example.com", "55555555555")
+
+	upload := multipartForm{
+		fields: url.Values{
+			"requiredSignatures": {bob + "," + carol},
+			"timeout":            {"2099-01-01T00:00:00Z"},
+			"envelopeName":       {"Lease; 2024"},
+		},
+		files: []formFile{
+			{field: "files", name: "lease.pdf", data: []byte("%PDF-1.7 lease")},
+			{field: "files", name: "annex.pdf", data: []byte("%PDF-1.7 annex")},
+		},
+	}
+
+	var envelope struct {
+		ID        string                   `json:"id"`
+		Name      string                   `json:"name"`
+		Status    int                      `json:"status"`
+		Documents []map[string]interface{} `json:"documents"`
+	}
+	h.expect(h.do(http.MethodPost, "/uploaddocument", "alice@example.com", upload), http.StatusCreated, &envelope)
+	if envelope.ID == "" || envelope.Name != "Lease; 2024" || len(envelope.Documents) != 2 {
+		t.Fatalf("expected an envelope with both documents, got %+v", envelope)
+	}
+	if got := h.notifications.forUser(bob); len(got) != 1 {
+		t.Fatalf("expected bob to be asked once to sign the envelope, got %v", got)
+	}
+
+	var list struct {
+		Envelopes []map[string]interface{} `json:"envelopes"`
+	}
+	h.expect(h.do(http.MethodGet, "/envelopes", "carol@example.com", nil), http.StatusOK, &list)
+	if len(list.Envelopes) != 1 {
+		t.Fatalf("expected carol to see the envelope, got %v", list.Envelopes)
+	}
+	h.expect(h.do(http.MethodGet, "/envelopes/"+envelope.ID, "eve@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodGet, "/envelopes/unknown", "alice@example.com", nil), http.StatusNotFound, nil)
+
+	sign := func(username, cpf string) url.Values {
+		return url.Values{
+			"password":  {"secret"},
+			"signature": {"signature"},
+			"username":  {username},
+			"cpf":       {cpf},
+		}
+	}
+
+	h.expect(h.do(http.MethodPost, "/envelopes/"+envelope.ID+"/sign", "bob@example.com", sign("carol", "33333333333")), http.StatusForbidden, nil)
+
+	h.expect(h.do(http.MethodPost, "/envelopes/"+envelope.ID+"/sign", "bob@example.com", sign("bob", "22222222222")), http.StatusOK, &envelope)
+	if envelope.Status != 0 {
+		t.Fatalf("expected the envelope to wait for carol, got status %d", envelope.Status)
+	}
+	for _, doc := range envelope.Documents {
+		if signed := doc["successfulSignatures"].([]interface{}); len(signed) != 1 {
+			t.Fatalf("expected bob to sign %s, got %v", doc["name"], signed)
+		}
+	}
+
+	h.expect(h.do(http.MethodPost, "/envelopes/"+envelope.ID+"/sign", "bob@example.com", sign("bob", "22222222222")), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/envelopes/"+envelope.ID+"/cancel", "carol@example.com", nil), http.StatusForbidden, nil)
+
+	h.expect(h.do(http.MethodPost, "/envelopes/"+envelope.ID+"/sign", "carol@example.com", sign("carol", "33333333333")), http.StatusOK, &envelope)
+	if envelope.Status != 3 {
+		t.Fatalf("expected the envelope to be signed, got status %d", envelope.Status)
+	}
+	if got := h.notifications.forUser(alice); len(got) == 0 || got[len(got)-1] != "Envelope Lease; 2024 is signed" {
+		t.Fatalf("expected alice to be told the envelope is signed, got %v", got)
+	}
+	h.expect(h.do(http.MethodPost, "/envelopes/"+envelope.ID+"/cancel", "alice@example.com", nil), http.StatusConflict, nil)
+
+	rec := h.do(http.MethodGet, "/envelopes/"+envelope.ID+"/download", "alice@example.com", nil)
+	h.expect(rec, http.StatusOK, nil)
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="Lease; 2024.zip"` {
+		t.Fatalf("unexpected Content-Disposition %s", got)
+	}
+	if len(archive.File) != 2 {
+		t.Fatalf("expected both documents in the archive, got %d", len(archive.File))
+	}
+	f, _ := archive.File[0].Open()
+	data, _ := io.ReadAll(f)
+	if want := "%PDF-1.7 lease\nsigned by " + envelope.Documents[0]["@key"].(string) + "\nsigned by " + envelope.Documents[0]["@key"].(string); string(data) != want {
+		t.Fatalf("expected the signed lease, got %q", data)
+	}
+}
+
+func TestCancelEnvelope(t *testing.T) {
+	h := newHarness(t)
+
+	h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	upload := multipartForm{
+		fields: url.Values{
+			"requiredSignatures": {bob},
+			"timeout":            {"2099-01-01T00:00:00Z"},
+		},
+		files: []formFile{
+			{field: "files", name: "lease.pdf", data: []byte("%PDF-1.7 lease")},
+			{field: "files", name: "lease.pdf", data: []byte("%PDF-1.7 lease v2")},
+		},
+	}
+
+	var envelope struct {
+		ID        string                   `json:"id"`
+		Name      string                   `json:"name"`
+		Status    int                      `json:"status"`
+		Documents []map[string]interface{} `json:"documents"`
+	}
+	h.expect(h.do(http.MethodPost, "/uploaddocument", "alice@example.com", upload), http.StatusCreated, &envelope)
+	if envelope.Name != "lease.pdf" {
+		t.Fatalf("expected the envelope to be named after its first file, got %q", envelope.Name)
+	}
+
+	h.expect(h.do(http.MethodPost, "/envelopes/"+envelope.ID+"/cancel", "alice@example.com", nil), http.StatusOK, &envelope)
+	if envelope.Status != 1 {
+		t.Fatalf("expected the envelope to be cancelled, got status %d", envelope.Status)
+	}
+	for _, doc := range envelope.Documents {
+		if doc["status"] != float64(1) {
+			t.Fatalf("expected %s to be cancelled, got %v", doc["@key"], doc["status"])
+		}
+	}
+	if got := h.notifications.forUser(bob); len(got) != 2 || got[1] != "Envelope lease.pdf was cancelled by its owner" {
+		t.Fatalf("expected bob to be told of the cancellation, got %v", got)
+	}
+
+	rec := h.do(http.MethodGet, "/envelopes/"+envelope.ID+"/download", "bob@example.com", nil)
+	h.expect(rec, http.StatusOK, nil)
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.File[0].Name != "lease.pdf" || archive.File[1].Name != "lease (2).pdf" {
+		t.Fatalf("expected distinct names in the archive, got %s and %s", archive.File[0].Name, archive.File[1].Name)
+	}
+}
@@ -0,0 +1,229 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/api/handlers/contract"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/chaincode/fake"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+func TestContractExecutions(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	h.user("Carol", "carol@example.com", "33333333333")
+
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":  chaincode.AssetTypeClause,
+		"@key":        "clause:rent",
+		"id":          "rent",
+		"description": "Monthly rent",
+		"actionType":  1,
+		"input":       map[string]interface{}{"payment": 1000},
+		"executable":  true,
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:fine",
+		"id":         "fine",
+		"actionType": 2,
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":   chaincode.AssetTypeContract,
+		"@key":         "autoExecutableContract:lease",
+		"name":         "Lease",
+		"owner":        ref(chaincode.AssetTypeUser, alice),
+		"participants": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"clauses": []interface{}{
+			ref(chaincode.AssetTypeClause, "clause:rent"),
+			ref(chaincode.AssetTypeClause, "clause:fine"),
+		},
+	})
+
+	const path = "/contracts/autoExecutableContract:lease"
+
+	var dryRun struct {
+		Execution db.ContractExecution `json:"execution"`
+	}
+	h.expect(h.do(http.MethodPost, path+"/dryrun", "bob@example.com", nil), http.StatusOK, &dryRun)
+	if !dryRun.Execution.DryRun || !dryRun.Execution.Success || len(dryRun.Execution.Clauses) != 1 {
+		t.Fatalf("unexpected dry run %+v", dryRun.Execution)
+	}
+	if clause := dryRun.Execution.Clauses[0]; clause.Key != "clause:rent" || clause.Result["executed"] != true || clause.Input["payment"] != 1000.0 {
+		t.Fatalf("unexpected dry run of the rent clause %+v", clause)
+	}
+	if h.asset("clause:rent")["finalized"] == true {
+		t.Fatal("expected the dry run not to execute the clause")
+	}
+	if recorded, _ := h.executions.ListContractExecutions(context.Background(), "autoExecutableContract:lease", 10); len(recorded) != 0 {
+		t.Fatalf("expected the dry run not to be recorded, got %+v", recorded)
+	}
+
+	h.expect(h.do(http.MethodPost, path+"/dryrun", "carol@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodGet, path+"/executions", "carol@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/contracts/autoExecutableContract:missing/dryrun", "alice@example.com", nil), http.StatusNotFound, nil)
+
+	if err := contract.ExecuteContract(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if h.asset("clause:rent")["finalized"] != true {
+		t.Fatal("expected the rent clause to be executed")
+	}
+
+	var listed struct {
+		Executions []db.ContractExecution `json:"executions"`
+	}
+	h.expect(h.do(http.MethodGet, path+"/executions", "alice@example.com", nil), http.StatusOK, &listed)
+	if len(listed.Executions) != 1 {
+		t.Fatalf("expected one recorded execution, got %+v", listed.Executions)
+	}
+	execution := listed.Executions[0]
+	if execution.DryRun || !execution.Success || len(execution.Clauses) != 1 || execution.Clauses[0].Result["executed"] != true {
+		t.Fatalf("unexpected execution %+v", execution)
+	}
+
+	h.expect(h.do(http.MethodGet, path+"/executions?limit=0", "alice@example.com", nil), http.StatusBadRequest, nil)
+}
+
+func TestExecutionNotifications(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:fine",
+		"id":         "fine",
+		"actionType": int(chaincode.ActionCheckFine),
+		"input":      map[string]interface{}{"days": 3},
+		"executable": true,
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":   chaincode.AssetTypeContract,
+		"@key":         "autoExecutableContract:lease",
+		"name":         "Lease",
+		"owner":        ref(chaincode.AssetTypeUser, alice),
+		"participants": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"clauses":      []interface{}{ref(chaincode.AssetTypeClause, "clause:fine")},
+	})
+
+	if err := contract.ExecuteContract(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []string{alice, bob} {
+		messages := h.notifications.forUser(user)
+		if len(messages) != 2 || messages[0] != "A fine was computed on contract Lease" || messages[1] != "Contract Lease is finished" {
+			t.Fatalf("unexpected notifications for %s: %v", user, messages)
+		}
+	}
+
+	h.notifications.mu.Lock()
+	metadata := h.notifications.sent[0].Metadata
+	h.notifications.mu.Unlock()
+	if metadata["clauseKey"] != "clause:fine" || metadata["contractID"] != "autoExecutableContract:lease" || metadata["input"] != "days: 3" {
+		t.Fatalf("unexpected notification metadata %v", metadata)
+	}
+}
+
+func TestEvaluatedCancellationKeepsContractActive(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:cancel",
+		"id":         "cancel",
+		"actionType": int(chaincode.ActionCancelContract),
+		"executable": true,
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeContract,
+		"@key":       "autoExecutableContract:lease",
+		"name":       "Lease",
+		"owner":      ref(chaincode.AssetTypeUser, alice),
+		"clauses":    []interface{}{ref(chaincode.AssetTypeClause, "clause:cancel")},
+	})
+
+	// The chaincode evaluates the clause but its conditions are not met
+	h.ledger.Handle("executeAutoExecutableContract", func(s *fake.Store, args map[string]interface{}) (interface{}, error) {
+		contract, err := s.Resolve(args, "contract")
+		if err != nil {
+			return nil, err
+		}
+		clause, _ := s.Get("clause:cancel")
+		contract["clauses"] = []interface{}{clause}
+		return contract, nil
+	})
+
+	if err := contract.ExecuteContract(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	lifecycle, err := h.lifecycles.GetContractLifecycle(context.Background(), "autoExecutableContract:lease")
+	if err == nil && lifecycle.State != db.ContractActive {
+		t.Fatalf("expected the contract to stay active, got %s", lifecycle.State)
+	}
+}
+
+func TestUnchangedClausesAreNotNotified(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:fine",
+		"id":         "fine",
+		"actionType": int(chaincode.ActionCheckFine),
+		"executable": true,
+		"result":     map[string]interface{}{"fine": 10.0},
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:interval",
+		"id":         "interval",
+		"actionType": int(chaincode.ActionCheckDateInterval),
+		"executable": true,
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeContract,
+		"@key":       "autoExecutableContract:lease",
+		"name":       "Lease",
+		"owner":      ref(chaincode.AssetTypeUser, alice),
+		"clauses": []interface{}{
+			ref(chaincode.AssetTypeClause, "clause:fine"),
+			ref(chaincode.AssetTypeClause, "clause:interval"),
+		},
+	})
+
+	// The fine is evaluated again to the same result, and the interval gets
+	// its first result, without finalizing either clause
+	h.ledger.Handle("executeAutoExecutableContract", func(s *fake.Store, args map[string]interface{}) (interface{}, error) {
+		contract, err := s.Resolve(args, "contract")
+		if err != nil {
+			return nil, err
+		}
+		fine, _ := s.Get("clause:fine")
+		interval, _ := s.Get("clause:interval")
+		interval["result"] = map[string]interface{}{"due": true}
+		contract["clauses"] = []interface{}{fine, s.Put(interval)}
+		return contract, nil
+	})
+
+	if err := contract.ExecuteContract(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := h.notifications.forUser(alice)
+	if len(messages) != 1 || messages[0] != "A payment of contract Lease is due" {
+		t.Fatalf("unexpected notifications %v", messages)
+	}
+}
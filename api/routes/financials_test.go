@@ -0,0 +1,125 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/financials"
+)
+
+func TestContractFinancials(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	h.user("Carol", "carol@example.com", "33333333333")
+
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:rent",
+		"id":         "rent",
+		"actionType": float64(chaincode.ActionMakePayment),
+		"parameters": map[string]interface{}{"amount": 1000.0},
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:fine",
+		"id":         "fine",
+		"actionType": float64(chaincode.ActionCheckFine),
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":   chaincode.AssetTypeContract,
+		"@key":         "autoExecutableContract:lease",
+		"name":         "Lease",
+		"owner":        ref(chaincode.AssetTypeUser, alice),
+		"participants": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"clauses": []interface{}{
+			ref(chaincode.AssetTypeClause, "clause:rent"),
+			ref(chaincode.AssetTypeClause, "clause:fine"),
+		},
+	})
+
+	pay := func(amount, finalPayment, receipt string) string {
+		t.Helper()
+		form := multipartForm{
+			fields: url.Values{
+				"clause":       {`{"@assetType":"clause","@key":"clause:rent"}`},
+				"date":         {"2024-02-01"},
+				"payment":      {amount},
+				"finalPayment": {finalPayment},
+			},
+			files: []formFile{{field: "Receipt", name: "receipt.pdf", data: []byte(receipt)}},
+		}
+		h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", form), http.StatusOK, nil)
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(receipt)))
+	}
+	first := pay("300", "false", "transfer of 300")
+
+	// The execution computes a fine
+	fine := h.asset("clause:fine")
+	fine["result"] = map[string]interface{}{"fine": 25.5}
+	h.ledger.Put(fine)
+
+	second := pay("500.25", "false", "transfer of 500.25")
+
+	var got struct {
+		Financials financials.Report `json:"financials"`
+	}
+	h.expect(h.do(http.MethodGet, "/contracts/autoExecutableContract:lease/financials", "bob@example.com", nil), http.StatusOK, &got)
+	report := got.Financials
+	if report.Currency != "BRL" || report.Scheduled.String() != "1000" || report.TotalPaid.String() != "800.25" || report.TotalFines.String() != "25.5" || report.Outstanding.String() != "225.25" {
+		t.Fatalf("unexpected totals %+v", report)
+	}
+	if len(report.Timeline) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", report.Timeline)
+	}
+	for i, e := range []struct {
+		entryType financials.EntryType
+		reference string
+		balance   string
+	}{
+		{financials.EntryPayment, first, "700"},
+		{financials.EntryFine, "", "725.5"},
+		{financials.EntryPayment, second, "225.25"},
+	} {
+		entry := report.Timeline[i]
+		if entry.Type != e.entryType || entry.Reference != e.reference || entry.Balance.String() != e.balance {
+			t.Errorf("entry %d: expected %+v, got %+v", i, e, entry)
+		}
+	}
+
+	// Converted into a reporting currency
+	got.Financials = financials.Report{}
+	h.expect(h.do(http.MethodGet, "/contracts/autoExecutableContract:lease/financials?currency=usd", "bob@example.com", nil), http.StatusOK, &got)
+	report = got.Financials
+	if report.Currency != "USD" || report.Scheduled.String() != "200" || report.TotalPaid.String() != "160.05" || report.TotalFines.String() != "5.1" || report.Outstanding.String() != "45.05" {
+		t.Fatalf("unexpected totals in USD %+v", report)
+	}
+	if rate := report.Timeline[0].Rate; rate.From != "BRL" || rate.To != "USD" || rate.Value.String() != "0.2" || rate.Source != "test" {
+		t.Fatalf("unexpected rate %+v", rate)
+	}
+	h.expect(h.do(http.MethodGet, "/contracts/autoExecutableContract:lease/financials?currency=XYZ", "bob@example.com", nil), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodGet, "/contracts/autoExecutableContract:lease/financials?currency=GBP", "bob@example.com", nil), http.StatusBadRequest, nil)
+
+	rec := h.do(http.MethodGet, "/contracts/autoExecutableContract:lease/financials?format=csv", "alice@example.com", nil)
+	h.expect(rec, http.StatusOK, nil)
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") || rec.Header().Get("Content-Disposition") != "attachment; filename=financials-Lease.csv" {
+		t.Fatalf("unexpected headers %v", rec.Header())
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[3][2] != "payment" || rows[3][5] != "500.25" || rows[3][6] != "225.25" || rows[3][7] != "BRL" {
+		t.Fatalf("unexpected CSV %v", rows)
+	}
+
+	h.expect(h.do(http.MethodGet, "/contracts/autoExecutableContract:lease/financials?format=xml", "alice@example.com", nil), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodGet, "/contracts/autoExecutableContract:lease/financials", "carol@example.com", nil), http.StatusForbidden, nil)
+}
@@ -0,0 +1,431 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umairmaseed/clausia-api/api/handlers/auth"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/chaincode/fake"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/mailer"
+	"github.com/umairmaseed/clausia-api/money"
+	"github.com/umairmaseed/clausia-api/payments"
+	"github.com/umairmaseed/clausia-api/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// testUserHeader carries the email of the caller in tests, in place of the
+// Cognito id token
+const testUserHeader = "X-Test-User"
+
+// harness runs the API routes against an in-process fake chaincode, with
+// notifications and emails recorded and files, envelopes, reminders,
+// contract executions, lifecycles and template versions, upgrade proposals,
+// listings, grants, clause payments, receipts and calendar feeds stored in
+// memory. Payments are charged with the mock provider, and amounts converted
+// with static rates of one BRL to 0.2 USD and 0.18 EUR.
+type harness struct {
+	t             *testing.T
+	engine        *gin.Engine
+	ledger        *fake.Server
+	notifications *recordingNotifier
+	blobs         *storage.MemoryStore
+	envelopes     *db.MemoryEnvelopeStore
+	reminders     *db.MemoryReminderStore
+	executions    *db.MemoryContractExecutionStore
+	lifecycles    *db.MemoryLifecycleStore
+	versions      *db.MemoryTemplateVersionStore
+	upgrades      *db.MemoryUpgradeProposalStore
+	listings      *db.MemoryTemplateListingStore
+	grants        *db.MemoryTemplateGrantStore
+	payments      *db.MemoryClausePaymentStore
+	provider      *payments.MockProvider
+	receipts      *db.MemoryPaymentReceiptStore
+	calendarFeeds *db.MemoryCalendarFeedStore
+	rates         *money.StaticRates
+	emails        *recordingMailer
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	ledger := fake.NewServer()
+	t.Cleanup(ledger.Close)
+
+	chaincode.SetDefaultClient(ledger.Client())
+	t.Cleanup(func() { chaincode.SetDefaultClient(nil) })
+
+	notifications := &recordingNotifier{}
+	db.SetNotifier(notifications)
+	t.Cleanup(func() { db.SetNotifier(nil) })
+
+	blobs := storage.NewMemoryStore()
+	storage.SetDefault(blobs)
+	t.Cleanup(func() { storage.SetDefault(nil) })
+
+	envelopes := db.NewMemoryEnvelopeStore()
+	db.SetEnvelopes(envelopes)
+	t.Cleanup(func() { db.SetEnvelopes(nil) })
+
+	reminders := db.NewMemoryReminderStore()
+	db.SetReminders(reminders)
+	t.Cleanup(func() { db.SetReminders(nil) })
+
+	executions := db.NewMemoryContractExecutionStore()
+	db.SetContractExecutions(executions)
+	t.Cleanup(func() { db.SetContractExecutions(nil) })
+
+	lifecycles := db.NewMemoryLifecycleStore()
+	db.SetLifecycles(lifecycles)
+	t.Cleanup(func() { db.SetLifecycles(nil) })
+
+	versions := db.NewMemoryTemplateVersionStore()
+	db.SetTemplateVersions(versions)
+	t.Cleanup(func() { db.SetTemplateVersions(nil) })
+
+	upgrades := db.NewMemoryUpgradeProposalStore()
+	db.SetUpgradeProposals(upgrades)
+	t.Cleanup(func() { db.SetUpgradeProposals(nil) })
+
+	listings := db.NewMemoryTemplateListingStore()
+	db.SetTemplateListings(listings)
+	t.Cleanup(func() { db.SetTemplateListings(nil) })
+
+	grants := db.NewMemoryTemplateGrantStore()
+	db.SetTemplateGrants(grants)
+	t.Cleanup(func() { db.SetTemplateGrants(nil) })
+
+	clausePayments := db.NewMemoryClausePaymentStore()
+	db.SetClausePayments(clausePayments)
+	t.Cleanup(func() { db.SetClausePayments(nil) })
+
+	receipts := db.NewMemoryPaymentReceiptStore()
+	db.SetPaymentReceipts(receipts)
+	t.Cleanup(func() { db.SetPaymentReceipts(nil) })
+
+	calendarFeeds := db.NewMemoryCalendarFeedStore()
+	db.SetCalendarFeeds(calendarFeeds)
+	t.Cleanup(func() { db.SetCalendarFeeds(nil) })
+
+	provider := payments.NewMockProvider("whsec_test")
+	payments.SetDefault(provider)
+	t.Cleanup(func() { payments.SetDefault(nil) })
+
+	rates := &money.StaticRates{
+		Source: "test",
+		Base:   "BRL",
+		AsOf:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Rates: map[string]money.Decimal{
+			"BRL": money.MustParseDecimal("1"),
+			"USD": money.MustParseDecimal("0.2"),
+			"EUR": money.MustParseDecimal("0.18"),
+		},
+	}
+	money.SetDefaultRates(rates)
+	t.Cleanup(func() { money.SetDefaultRates(nil) })
+
+	emails := &recordingMailer{}
+	mailer.SetDefault(emails)
+	t.Cleanup(func() { mailer.SetDefault(nil) })
+
+	engine := gin.New()
+	addRoutes(engine, nil, auth.Auth{}, testAuthMiddleware)
+
+	return &harness{
+		t:             t,
+		engine:        engine,
+		ledger:        ledger,
+		notifications: notifications,
+		blobs:         blobs,
+		envelopes:     envelopes,
+		reminders:     reminders,
+		executions:    executions,
+		lifecycles:    lifecycles,
+		versions:      versions,
+		upgrades:      upgrades,
+		listings:      listings,
+		grants:        grants,
+		payments:      clausePayments,
+		provider:      provider,
+		receipts:      receipts,
+		calendarFeeds: calendarFeeds,
+		rates:         rates,
+		emails:        emails,
+	}
+}
+
+// testAuthMiddleware authenticates the caller named by testUserHeader and
+// sets the same headers as the Cognito middleware
+func testAuthMiddleware(c *gin.Context) {
+	email := c.Request.Header.Get(testUserHeader)
+	if email == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "missing test user")
+		return
+	}
+
+	c.Request.Header.Del("email")
+	c.Request.Header.Add("email", email)
+	c.Next()
+}
+
+// user seeds a user asset on the ledger and returns its key
+func (h *harness) user(name, email, cpf string) string {
+	user := h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeUser,
+		"@key":       "user:" + cpf,
+		"cpf":        cpf,
+		"email":      email,
+		"name":       name,
+		"userName":   strings.ToLower(name),
+		"phone":      "+5500000000000",
+	})
+	return user["@key"].(string)
+}
+
+// multipartForm is sent by do as multipart/form-data
+type multipartForm struct {
+	fields url.Values
+	files  []formFile
+}
+
+type formFile struct {
+	field, name string
+	data        []byte
+}
+
+// do sends a request as the given user. url.Values bodies are form encoded,
+// multipartForm bodies are sent as multipart/form-data and other bodies are
+// sent as JSON.
+func (h *harness) do(method, path, email string, body interface{}) *httptest.ResponseRecorder {
+	h.t.Helper()
+
+	var (
+		reader      io.Reader
+		contentType string
+	)
+	switch b := body.(type) {
+	case nil:
+	case url.Values:
+		reader = strings.NewReader(b.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	case multipartForm:
+		buf := &bytes.Buffer{}
+		w := multipart.NewWriter(buf)
+		for field, values := range b.fields {
+			for _, value := range values {
+				w.WriteField(field, value)
+			}
+		}
+		for _, f := range b.files {
+			fw, err := w.CreateFormFile(f.field, f.name)
+			if err != nil {
+				h.t.Fatal(err)
+			}
+			fw.Write(f.data)
+		}
+		if err := w.Close(); err != nil {
+			h.t.Fatal(err)
+		}
+		reader = buf
+		contentType = w.FormDataContentType()
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+		contentType = "application/json"
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if email != "" {
+		req.Header.Set(testUserHeader, email)
+	}
+
+	rec := httptest.NewRecorder()
+	h.engine.ServeHTTP(rec, req)
+	return rec
+}
+
+// expect fails the test unless rec has the given status, and decodes the
+// response body into out when it is not nil
+func (h *harness) expect(rec *httptest.ResponseRecorder, status int, out interface{}) {
+	h.t.Helper()
+
+	if rec.Code != status {
+		h.t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			h.t.Fatalf("failed to decode response %s: %v", rec.Body.String(), err)
+		}
+	}
+}
+
+// signingService is a stand-in for the go-sign API, which returns the
+// document with the signer's ledger key appended
+type signingService struct {
+	mu       sync.Mutex
+	requests []url.Values
+}
+
+// last returns the form fields of the last signing request
+func (s *signingService) last() url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.requests) == 0 {
+		return url.Values{}
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+// lastSignature returns the signature position of the last signing request
+func (s *signingService) lastSignature() string {
+	return s.last().Get("signature")
+}
+
+// signingService starts a signing service and stores a certificate for each
+// of the given usernames
+func (h *harness) signingService(usernames ...string) *signingService {
+	h.t.Helper()
+
+	service := &signingService{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		service.mu.Lock()
+		service.requests = append(service.requests, r.MultipartForm.Value)
+		service.mu.Unlock()
+
+		data, _ := io.ReadAll(file)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name": r.FormValue("fileName"),
+			"file": append(data, []byte("\nsigned by "+r.FormValue("ledgerKey"))...),
+		})
+	}))
+	h.t.Cleanup(server.Close)
+	h.t.Setenv("GO_SIGN_API", server.URL)
+
+	for _, username := range usernames {
+		cert := strings.NewReader("cert of " + username)
+		if err := h.blobs.Put(context.Background(), "certificates/"+username+"_cert.pfx", cert); err != nil {
+			h.t.Fatal(err)
+		}
+	}
+	return service
+}
+
+// asset returns the ledger asset with the given key
+func (h *harness) asset(key string) map[string]interface{} {
+	h.t.Helper()
+
+	asset, ok := h.ledger.Get(key)
+	if !ok {
+		h.t.Fatalf("asset %s not found on the ledger", key)
+	}
+	return asset
+}
+
+func ref(assetType, key string) map[string]interface{} {
+	return map[string]interface{}{"@assetType": assetType, "@key": key}
+}
+
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []db.Notification
+}
+
+func (n *recordingNotifier) CreateNotification(ctx context.Context, notif *[]db.Notification) (*mongo.InsertManyResult, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.sent = append(n.sent, *notif...)
+	return &mongo.InsertManyResult{}, nil
+}
+
+// forUser returns the messages sent to userID
+func (n *recordingNotifier) forUser(userID string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var messages []string
+	for _, notification := range n.sent {
+		if notification.UserID == userID {
+			messages = append(messages, notification.Message)
+		}
+	}
+	return messages
+}
+
+// metadata returns the last value of a metadata field of the notifications
+// sent to userID
+func (n *recordingNotifier) metadata(userID, field string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	value := ""
+	for _, notification := range n.sent {
+		if notification.UserID == userID && notification.Metadata[field] != "" {
+			value = notification.Metadata[field]
+		}
+	}
+	return value
+}
+
+func (n *recordingNotifier) String() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return fmt.Sprintf("%+v", n.sent)
+}
+
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// to returns the subjects of the emails sent to address
+func (m *recordingMailer) to(address string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var subjects []string
+	for _, msg := range m.sent {
+		for _, to := range msg.To {
+			if to == address {
+				subjects = append(subjects, msg.Subject)
+			}
+		}
+	}
+	return subjects
+}
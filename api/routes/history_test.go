@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/audit"
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+func TestDocumentHistory(t *testing.T) {
+	t.Setenv("CERTIFICATE_SIGNING_KEY", "test-secret")
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	h.user("Carol", "carol@example.com", "33333333333")
+
+	doc := h.ledger.Put(map[string]interface{}{
+		"@assetType":           chaincode.AssetTypeDocument,
+		"originalHash":         "abc123",
+		"name":                 "lease.pdf",
+		"status":               0,
+		"owner":                ref(chaincode.AssetTypeUser, alice),
+		"requiredSignatures":   []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"successfulSignatures": []interface{}{},
+		"rejectedSignatures":   []interface{}{},
+		"timeout":              "2099-01-01T00:00:00Z",
+	})
+	docKey := doc["@key"].(string)
+
+	h.expect(h.do(http.MethodPost, "/updatedocnameortimeout", "alice@example.com", url.Values{"dockey": {docKey}, "name": {"lease \"v2\""}}), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, "/canceldocument", "alice@example.com", map[string]interface{}{"@key": docKey}), http.StatusOK, nil)
+
+	var history struct {
+		Events []audit.Event `json:"events"`
+	}
+	h.expect(h.do(http.MethodGet, "/documents/"+docKey+"/history", "bob@example.com", nil), http.StatusOK, &history)
+
+	types := []string{}
+	for _, event := range history.Events {
+		if event.TxID == "" {
+			t.Errorf("expected every event to carry its transaction, got %+v", event)
+		}
+		types = append(types, event.Type)
+	}
+	want := []string{audit.EventUploaded, audit.EventRenamed, audit.EventCancelled}
+	if len(types) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("expected events %v, got %v", want, types)
+		}
+	}
+	if history.Events[2].Message != "Cancelled by Alice" {
+		t.Fatalf("unexpected message %q", history.Events[2].Message)
+	}
+
+	h.expect(h.do(http.MethodGet, "/documents/"+docKey+"/history", "carol@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodGet, "/documents/document:missing/history", "alice@example.com", nil), http.StatusNotFound, nil)
+
+	var cert audit.Certificate
+	h.expect(h.do(http.MethodGet, "/documents/"+docKey+"/certificate", "alice@example.com", nil), http.StatusOK, &cert)
+	if cert.DocumentKey != docKey || len(cert.Events) != 3 || cert.Signature == nil {
+		t.Fatalf("unexpected certificate %+v", cert)
+	}
+	if err := cert.Verify([]byte("test-secret")); err != nil {
+		t.Fatalf("expected the certificate to be signed with the configured key, got %v", err)
+	}
+
+	rec := h.do(http.MethodGet, "/documents/"+docKey+"/certificate?format=pdf", "alice@example.com", nil)
+	h.expect(rec, http.StatusOK, nil)
+	if rec.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(rec.Body.Bytes(), []byte("%PDF")) {
+		t.Fatalf("expected a PDF certificate, got %s", rec.Header().Get("Content-Type"))
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="audit-report-lease \"v2\".pdf"` {
+		t.Fatalf("expected the name to be encoded, got %s", got)
+	}
+
+	h.expect(h.do(http.MethodGet, "/documents/"+docKey+"/certificate?format=xml", "alice@example.com", nil), http.StatusBadRequest, nil)
+}
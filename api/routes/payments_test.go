@@ -0,0 +1,200 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/chaincode/fake"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/payments"
+)
+
+func TestPaymentFlow(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	h.user("Carol", "carol@example.com", "33333333333")
+
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:rent",
+		"id":         "rent",
+		"actionType": float64(chaincode.ActionMakePayment),
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:fine",
+		"id":         "fine",
+		"actionType": float64(chaincode.ActionCheckFine),
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":   chaincode.AssetTypeContract,
+		"@key":         "autoExecutableContract:lease",
+		"name":         "Lease",
+		"owner":        ref(chaincode.AssetTypeUser, alice),
+		"participants": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"clauses": []interface{}{
+			ref(chaincode.AssetTypeClause, "clause:rent"),
+			ref(chaincode.AssetTypeClause, "clause:fine"),
+		},
+	})
+
+	intentForm := func(clauseKey string) map[string]interface{} {
+		return map[string]interface{}{
+			"clause":       ref(chaincode.AssetTypeClause, clauseKey),
+			"payment":      1000.5,
+			"finalPayment": true,
+			"date":         "2024-02-01",
+		}
+	}
+	type paymentResponse struct {
+		Payment      db.ClausePayment `json:"payment"`
+		ClientSecret string           `json:"clientSecret"`
+	}
+
+	h.expect(h.do(http.MethodPost, "/payments/intents", "carol@example.com", intentForm("clause:rent")), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/payments/intents", "bob@example.com", intentForm("clause:fine")), http.StatusBadRequest, nil)
+
+	var created paymentResponse
+	h.expect(h.do(http.MethodPost, "/payments/intents", "bob@example.com", intentForm("clause:rent")), http.StatusOK, &created)
+	payment := created.Payment
+	if payment.Status != payments.StatusPending || payment.Amount != 100050 || payment.Currency != "brl" || payment.PayerKey != bob || payment.IntentID == "" || created.ClientSecret == "" {
+		t.Fatalf("unexpected payment %+v, client secret %q", payment, created.ClientSecret)
+	}
+
+	// A card token is only accepted once the provider confirmed the charge
+	makePayment := map[string]interface{}{
+		"clause":       ref(chaincode.AssetTypeClause, "clause:rent"),
+		"date":         "2024-02-01",
+		"payment":      1000.5,
+		"finalPayment": "true",
+		"stripeToken":  payment.IntentID,
+	}
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", makePayment), http.StatusPaymentRequired, nil)
+
+	if _, err := h.provider.Pay(payment.IntentID); err != nil {
+		t.Fatal(err)
+	}
+	payload, header, err := h.provider.Webhook(payment.IntentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged := header.Clone()
+	forged.Set(payments.SignatureHeader, payments.Sign(payload, "another secret", time.Now()))
+	h.expect(h.webhook(payload, forged), http.StatusBadRequest, nil)
+	if stored, _ := h.payments.GetClausePayment(context.Background(), payment.ID); stored.Status != payments.StatusPending {
+		t.Fatalf("expected a forged webhook to be ignored, got %+v", stored)
+	}
+
+	h.expect(h.webhook(payload, header), http.StatusOK, nil)
+
+	var got paymentResponse
+	h.expect(h.do(http.MethodGet, "/payments/"+payment.ID, "alice@example.com", nil), http.StatusOK, &got)
+	if got.Payment.Status != payments.StatusSucceeded || got.Payment.RecordedAt == nil {
+		t.Fatalf("expected the payment to be captured and recorded, got %+v", got.Payment)
+	}
+	input, _ := h.asset("clause:rent")["input"].(map[string]interface{})
+	if input["payment"] != 1000.5 || input["finalPayment"] != true || input["stripeToken"] != payment.IntentID {
+		t.Fatalf("expected the payment on the clause, got %v", input)
+	}
+	if h.notifications.metadata(alice, "paymentID") != payment.ID || h.notifications.metadata(bob, "paymentID") != payment.ID {
+		t.Fatalf("expected the parties to be notified of the payment, got %s", h.notifications)
+	}
+
+	// Redeliveries do not record the payment again
+	records := h.history("clause:rent")
+	h.expect(h.webhook(payload, header), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", makePayment), http.StatusConflict, nil)
+	if n := h.history("clause:rent"); n != records {
+		t.Fatalf("expected the payment to be recorded once, got %d records", n)
+	}
+
+	makePayment["stripeToken"] = "pi_unknown"
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", makePayment), http.StatusPaymentRequired, nil)
+
+	// PayPal transactions are not verified by a provider
+	delete(makePayment, "stripeToken")
+	makePayment["payPalTransactionID"] = "PAYID-1"
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", makePayment), http.StatusBadRequest, nil)
+
+	var list struct {
+		Payments []db.ClausePayment `json:"payments"`
+	}
+	h.expect(h.do(http.MethodGet, "/payments?clauseKey=clause:rent", "bob@example.com", nil), http.StatusOK, &list)
+	if len(list.Payments) != 1 || list.Payments[0].ID != payment.ID {
+		t.Fatalf("unexpected payments %+v", list.Payments)
+	}
+	h.expect(h.do(http.MethodGet, "/payments?clauseKey=clause:rent", "carol@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodGet, "/payments/"+payment.ID, "carol@example.com", nil), http.StatusForbidden, nil)
+
+	// Only the owner, who received the payment, refunds it
+	refund := map[string]interface{}{"amount": 100}
+	h.expect(h.do(http.MethodPost, "/payments/"+payment.ID+"/refund", "bob@example.com", refund), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/payments/"+payment.ID+"/refund", "alice@example.com", map[string]interface{}{"amount": 2000}), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodPost, "/payments/"+payment.ID+"/refund", "alice@example.com", refund), http.StatusOK, &got)
+	if got.Payment.Status != payments.StatusRefunded || got.Payment.Refunded != 10000 {
+		t.Fatalf("expected the payment to be partly refunded, got %+v", got.Payment)
+	}
+	h.expect(h.do(http.MethodPost, "/payments/"+payment.ID+"/refund", "alice@example.com", refund), http.StatusConflict, nil)
+
+	// Declined payments are not recorded
+	h.expect(h.do(http.MethodPost, "/payments/intents", "bob@example.com", intentForm("clause:rent")), http.StatusOK, &created)
+	if _, err := h.provider.Decline(created.Payment.IntentID); err != nil {
+		t.Fatal(err)
+	}
+	payload, header, err = h.provider.Webhook(created.Payment.IntentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.expect(h.webhook(payload, header), http.StatusOK, nil)
+	got = paymentResponse{}
+	h.expect(h.do(http.MethodGet, "/payments/"+created.Payment.ID, "bob@example.com", nil), http.StatusOK, &got)
+	if got.Payment.Status != payments.StatusFailed || got.Payment.RecordedAt != nil {
+		t.Fatalf("expected the payment to fail, got %+v", got.Payment)
+	}
+
+	// The mock provider pays without a gateway. A payment confirmed once the
+	// contract is cancelled is kept for a refund, not recorded.
+	h.expect(h.do(http.MethodPost, "/payments/intents", "bob@example.com", intentForm("clause:rent")), http.StatusOK, &created)
+	h.expect(h.do(http.MethodPost, "/payments/"+created.Payment.ID+"/mock/pay", "carol@example.com", nil), http.StatusForbidden, nil)
+
+	lifecycle := &db.ContractLifecycle{ContractKey: "autoExecutableContract:lease", State: db.ContractCancelled}
+	if err := h.lifecycles.SaveContractLifecycle(context.Background(), lifecycle); err != nil {
+		t.Fatal(err)
+	}
+	got = paymentResponse{}
+	h.expect(h.do(http.MethodPost, "/payments/"+created.Payment.ID+"/mock/pay", "bob@example.com", nil), http.StatusOK, &got)
+	if got.Payment.Status != payments.StatusSucceeded || got.Payment.RecordedAt != nil || got.Payment.Error != "contract is cancelled" {
+		t.Fatalf("expected the payment not to be recorded on a cancelled contract, got %+v", got.Payment)
+	}
+	h.expect(h.do(http.MethodPost, "/payments/intents", "bob@example.com", intentForm("clause:rent")), http.StatusConflict, nil)
+}
+
+// webhook delivers a notification of the payment provider
+func (h *harness) webhook(payload []byte, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewReader(payload))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	h.engine.ServeHTTP(rec, req)
+	return rec
+}
+
+// history returns the number of changes of a ledger asset
+func (h *harness) history(key string) int {
+	var n int
+	h.ledger.Do(func(st *fake.Store) {
+		n = len(st.History(key))
+	})
+	return n
+}
@@ -0,0 +1,278 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+// TestRoutePolicies checks the authorization of every route acting on a
+// contract, a document, an envelope, a template, a payment or a receipt:
+// callers without an allowed relation get a 403, from the rule of the route
+// before the handler runs or from the check of the handler
+func TestRoutePolicies(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	h.user("Carol", "carol@example.com", "33333333333")
+
+	clauseKey := "clause:policy"
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       clauseKey,
+		"id":         "payment",
+		"actionType": float64(chaincode.ActionMakePayment),
+	})
+	contractKey := "autoExecutableContract:policy"
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":   chaincode.AssetTypeContract,
+		"@key":         contractKey,
+		"name":         "Lease",
+		"owner":        ref(chaincode.AssetTypeUser, alice),
+		"participants": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"clauses":      []interface{}{ref(chaincode.AssetTypeClause, clauseKey)},
+	})
+	docKey := "document:policy"
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":         chaincode.AssetTypeDocument,
+		"@key":               docKey,
+		"name":               "lease.pdf",
+		"originalDocURL":     "documents/lease.pdf",
+		"owner":              ref(chaincode.AssetTypeUser, alice),
+		"requiredSignatures": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+	})
+
+	contractRef := ref(chaincode.AssetTypeContract, contractKey)
+	clauseRef := ref(chaincode.AssetTypeClause, clauseKey)
+	contractPath := "/contracts/" + contractKey
+	receipt := &db.PaymentReceipt{ID: "receipt-policy", ClauseKey: clauseKey, ContractKey: contractKey, PayerKey: bob, PayeeKey: alice}
+	if err := h.receipts.CreatePaymentReceipt(context.Background(), receipt); err != nil {
+		t.Fatal(err)
+	}
+	receiptPath := "/receipts/" + receipt.ID
+
+	routes := []struct {
+		method, path string
+		body         interface{}
+		// denied are the related users the rule rejects, besides carol
+		denied []string
+	}{
+		{http.MethodPost, "/signdocument", url.Values{"dockey": {docKey}}, []string{"alice@example.com"}},
+		{http.MethodPost, "/canceldocument", map[string]interface{}{"@key": docKey}, []string{"bob@example.com"}},
+		{http.MethodPost, "/updatedocnameortimeout", url.Values{"dockey": {docKey}}, []string{"bob@example.com"}},
+		{http.MethodGet, "/getdocument?key=" + docKey, nil, nil},
+		{http.MethodGet, "/documents/" + docKey + "/history", nil, nil},
+		{http.MethodGet, "/documents/" + docKey + "/certificate", nil, nil},
+		{http.MethodGet, "/getcontract?contractKey=" + contractKey, nil, nil},
+		{http.MethodGet, "/getclause?clauseKey=" + clauseKey, nil, nil},
+		{http.MethodGet, "/getdateswithclause?clauseKey=" + clauseKey, nil, nil},
+		{http.MethodPost, "/addclause", map[string]interface{}{"autoExecutableContract": contractRef}, []string{"bob@example.com"}},
+		{http.MethodPost, "/removeclause", map[string]interface{}{"autoExecutableContract": contractRef, "clause": clauseKey}, []string{"bob@example.com"}},
+		{http.MethodPost, "/addclauses", map[string]interface{}{"autoExecutableContract": contractRef}, []string{"bob@example.com"}},
+		{http.MethodPost, "/addparticipantrequest", map[string]interface{}{"autoExecutableContract": contractRef}, []string{"bob@example.com"}},
+		{http.MethodPost, "/addreferencedate", map[string]interface{}{"clause": clauseRef}, nil},
+		{http.MethodPost, "/addevaluatedate", map[string]interface{}{"clause": clauseRef}, nil},
+		{http.MethodPost, "/addinputstocheckfine", map[string]interface{}{"clause": clauseRef}, nil},
+		{http.MethodPost, "/addstoredvaluetogetcredit", map[string]interface{}{"clause": clauseRef}, nil},
+		{http.MethodPost, "/addinputstomakepayment", multipartForm{fields: url.Values{"clause": {`{"@assetType":"clause","@key":"` + clauseKey + `"}`}}}, nil},
+		{http.MethodPost, "/cancelcontract", url.Values{"clause": {clauseKey}}, nil},
+		{http.MethodPost, "/addreviewtocontract", map[string]interface{}{"autoExecutableContract": contractRef}, nil},
+		{http.MethodGet, contractPath + "/executions", nil, nil},
+		{http.MethodPost, contractPath + "/dryrun", nil, nil},
+		{http.MethodGet, contractPath + "/upgrades", nil, nil},
+		{http.MethodPost, contractPath + "/upgrades", map[string]interface{}{}, []string{"bob@example.com"}},
+		{http.MethodPost, contractPath + "/upgrades/missing/accept", nil, nil},
+		{http.MethodPost, contractPath + "/upgrades/missing/decline", nil, nil},
+		{http.MethodGet, contractPath + "/financials", nil, nil},
+		{http.MethodPost, contractPath + "/activate", nil, []string{"bob@example.com"}},
+		{http.MethodGet, receiptPath, nil, nil},
+		{http.MethodGet, receiptPath + "/file", nil, nil},
+		{http.MethodPost, receiptPath + "/verify", multipartForm{files: []formFile{{"file", "receipt.pdf", []byte("%PDF")}}}, nil},
+		{http.MethodPost, receiptPath + "/accept", nil, []string{"bob@example.com"}},
+		{http.MethodPost, receiptPath + "/dispute", map[string]interface{}{"comment": "unpaid"}, []string{"bob@example.com"}},
+	}
+
+	for _, route := range routes {
+		for _, email := range append([]string{"carol@example.com"}, route.denied...) {
+			rec := h.do(route.method, route.path, email, route.body)
+			if rec.Code != http.StatusForbidden || !strings.HasPrefix(rec.Body.String(), "Forbidden: ") {
+				t.Errorf("%s %s as %s: expected 403, got %d: %s", route.method, route.path, email, rec.Code, rec.Body)
+			}
+		}
+
+		// Related users get past the rule, to the handler
+		for _, email := range []string{"alice@example.com", "bob@example.com"} {
+			if containsKey(route.denied, email) {
+				continue
+			}
+			rec := h.do(route.method, route.path, email, route.body)
+			if strings.HasPrefix(rec.Body.String(), "Forbidden: the ") {
+				t.Errorf("%s %s as %s: expected the rule to allow the caller, got %d: %s", route.method, route.path, email, rec.Code, rec.Body)
+			}
+		}
+	}
+
+	// Routes without a rule have their handlers check the caller, as they
+	// act on assets found through the request or on templates, whose access
+	// is granted apart
+	templateKey := "template:policy"
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeTemplate,
+		"@key":       templateKey,
+		"name":       "Lease",
+		"creator":    ref(chaincode.AssetTypeUser, alice),
+	})
+	templateClauseKey := "templateClause:policy"
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeTemplateClause,
+		"@key":       templateClauseKey,
+		"template":   ref(chaincode.AssetTypeTemplate, templateKey),
+		"name":       "Rent",
+	})
+	ctx := context.Background()
+	envelope := &db.Envelope{ID: "envelope-policy", Owner: alice, Signers: []string{bob}, Documents: []string{docKey}}
+	if err := h.envelopes.CreateEnvelope(ctx, envelope); err != nil {
+		t.Fatal(err)
+	}
+	payment := &db.ClausePayment{ID: "payment-policy", ClauseKey: clauseKey, ContractKey: contractKey, PayerKey: bob}
+	if err := h.payments.CreateClausePayment(ctx, payment); err != nil {
+		t.Fatal(err)
+	}
+
+	templateRef := ref(chaincode.AssetTypeTemplate, templateKey)
+	templatePath := "/templates/" + templateKey
+	handlerChecked := []struct {
+		method, path string
+		body         interface{}
+		// check is the handler check the route relies on
+		check string
+	}{
+		{http.MethodPost, "/downloaddocument", url.Values{"originalurl": {"documents/lease.pdf"}}, "document parties, found by URL"},
+		{http.MethodPost, "/verifydocument", multipartForm{fields: url.Values{"key": {docKey}}}, "document parties, when fetched by key"},
+		{http.MethodGet, "/envelopes/" + envelope.ID, nil, "envelopeOfRequest"},
+		{http.MethodPost, "/envelopes/" + envelope.ID + "/sign", url.Values{"cpf": {"33333333333"}, "username": {"carol"}, "password": {"secret"}}, "envelopeOfRequest"},
+		{http.MethodPost, "/envelopes/" + envelope.ID + "/cancel", nil, "envelopeOfRequest, then owner"},
+		{http.MethodGet, "/envelopes/" + envelope.ID + "/download", nil, "envelopeOfRequest"},
+		{http.MethodGet, contractPath + "/lifecycle", nil, "contract parties and invited users"},
+		{http.MethodPost, "/edittemplate", map[string]interface{}{"template": templateRef}, "templateForRole editor"},
+		{http.MethodPost, "/createtemplateclause", map[string]interface{}{"template": templateRef, "id": "fine", "number": 2, "name": "Fine", "actionType": 2}, "templateForRole editor"},
+		{http.MethodPost, "/edittemplateclause", map[string]interface{}{"templateClause": ref(chaincode.AssetTypeTemplateClause, templateClauseKey)}, "templateForRole editor"},
+		{http.MethodPost, "/duplicatetemplate", map[string]interface{}{"Template": templateRef, "id": "copy", "name": "Copy"}, "templateForRole viewer"},
+		{http.MethodPost, "/removetemplate", map[string]interface{}{"template": templateRef}, "templateForRole owner"},
+		{http.MethodPost, "/removetemplateclause", map[string]interface{}{"template": templateRef, "templateClause": ref(chaincode.AssetTypeTemplateClause, templateClauseKey)}, "templateForRole editor"},
+		{http.MethodPost, "/sharetemplate", map[string]interface{}{"template": templateRef, "users": []interface{}{ref(chaincode.AssetTypeUser, bob)}}, "templateForRole owner"},
+		{http.MethodPost, templatePath + "/tags", map[string]interface{}{"tags": []string{"lease"}}, "templateOfRequest owner"},
+		{http.MethodGet, templatePath + "/access", nil, "templateOfRequest owner"},
+		{http.MethodPost, templatePath + "/access", map[string]interface{}{"user": ref(chaincode.AssetTypeUser, bob), "role": "viewer"}, "templateOfRequest owner"},
+		{http.MethodPost, templatePath + "/access/revoke", map[string]interface{}{"user": ref(chaincode.AssetTypeUser, bob)}, "templateOfRequest owner"},
+		{http.MethodGet, templatePath + "/reviews", nil, "templateOfRequest viewer"},
+		{http.MethodPost, templatePath + "/reviews", map[string]interface{}{"rating": 5, "date": "2024-01-01T00:00:00Z"}, "templateOfRequest viewer"},
+		{http.MethodPost, templatePath + "/instantiate", map[string]interface{}{"name": "Lease", "signatureDate": "2024-01-01"}, "templateOfRequest viewer"},
+		{http.MethodGet, templatePath + "/versions", nil, "templateOfRequest viewer"},
+		{http.MethodGet, templatePath + "/versions/1", nil, "templateOfRequest viewer"},
+		{http.MethodGet, templatePath + "/diff?from=1&to=2", nil, "templateOfRequest viewer"},
+		{http.MethodGet, "/payments/" + payment.ID, nil, "paymentOfRequest contract parties"},
+		{http.MethodPost, "/payments/" + payment.ID + "/refund", nil, "paymentOfRequest contract owner"},
+		{http.MethodPost, "/payments/" + payment.ID + "/mock/pay", nil, "paymentOfRequest contract parties"},
+	}
+	for _, route := range handlerChecked {
+		rec := h.do(route.method, route.path, "carol@example.com", route.body)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s (%s): expected 403 for an unrelated user, got %d: %s", route.method, route.path, route.check, rec.Code, rec.Body)
+		}
+	}
+
+	// Routes naming no asset only return those of the caller
+	for _, path := range []string{"/listdocuments", "/expectedsignatures", "/pendingsignatures", "/listsuccessfulsignatures", "/getusercontracts", "/envelopes", "/calendar", "/templates/catalog"} {
+		rec := h.do(http.MethodGet, path, "carol@example.com", nil)
+		for _, key := range []string{contractKey, clauseKey, docKey, envelope.ID, templateKey} {
+			if strings.Contains(rec.Body.String(), key) {
+				t.Errorf("GET %s: expected no asset of others, got %d: %s", path, rec.Code, rec.Body)
+			}
+		}
+	}
+
+	h.expect(h.do(http.MethodGet, "/getcontract", "alice@example.com", nil), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodPost, "/addclause", "alice@example.com", map[string]interface{}{}), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodGet, "/getcontract?contractKey=autoExecutableContract:missing", "alice@example.com", nil), http.StatusNotFound, nil)
+	h.expect(h.do(http.MethodGet, "/getclause?clauseKey=clause:missing", "alice@example.com", nil), http.StatusNotFound, nil)
+	h.expect(h.do(http.MethodGet, "/getdocument?key="+docKey, "dave@example.com", nil), http.StatusNotFound, nil)
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// TestConflictingBodyKeys checks that a JSON body cannot name an asset the
+// rule authorized and, under a key differing in case that the binding also
+// matches, another one the handler would act on
+func TestConflictingBodyKeys(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	carol := h.user("Carol", "carol@example.com", "33333333333")
+
+	for _, asset := range []struct{ key, owner string }{{"victim", alice}, {"mine", carol}} {
+		h.ledger.Put(map[string]interface{}{
+			"@assetType": chaincode.AssetTypeClause,
+			"@key":       "clause:" + asset.key,
+			"id":         asset.key,
+			"actionType": float64(chaincode.ActionCheckDateInterval),
+		})
+		h.ledger.Put(map[string]interface{}{
+			"@assetType": chaincode.AssetTypeContract,
+			"@key":       "autoExecutableContract:" + asset.key,
+			"name":       asset.key,
+			"owner":      ref(chaincode.AssetTypeUser, asset.owner),
+			"clauses":    []interface{}{ref(chaincode.AssetTypeClause, "clause:"+asset.key)},
+		})
+	}
+
+	// Clauses are only changed in drafts, and inputs only added to active
+	// contracts
+	lifecycle := &db.ContractLifecycle{ContractKey: "autoExecutableContract:victim", State: db.ContractDraft}
+	if err := h.lifecycles.SaveContractLifecycle(context.Background(), lifecycle); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := []struct{ path, body string }{
+		{"/removeclause", `{"autoExecutableContract":{"@key":"autoExecutableContract:mine"},"AutoExecutableContract":{"@key":"autoExecutableContract:victim"},"clause":"clause:victim"}`},
+		{"/removeclause", `{"autoExecutableContract":{"@key":"autoExecutableContract:mine","@KEY":"autoExecutableContract:victim"},"clause":"clause:victim"}`},
+		{"/addclause", `{"autoExecutableContract":{"@key":"autoExecutableContract:mine"},"AutoExecutableContract":{"@key":"autoExecutableContract:victim"},"id":"x","actionType":"0"}`},
+		{"/addparticipantrequest", `{"autoExecutableContract":{"@key":"autoExecutableContract:mine"},"AutoExecutableContract":{"@key":"autoExecutableContract:victim"},"participants":[]}`},
+	}
+	for _, b := range bodies {
+		rec := h.do(http.MethodPost, b.path, "carol@example.com", json.RawMessage(b.body))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: expected 400, got %d: %s", b.path, b.body, rec.Code, rec.Body)
+		}
+	}
+
+	lifecycle.State = db.ContractActive
+	if err := h.lifecycles.SaveContractLifecycle(context.Background(), lifecycle); err != nil {
+		t.Fatal(err)
+	}
+	body := json.RawMessage(`{"clause":{"@key":"clause:mine"},"Clause":{"@key":"clause:victim"},"referenceDate":"2024-03-01"}`)
+	h.expect(h.do(http.MethodPost, "/addreferencedate", "carol@example.com", body), http.StatusBadRequest, nil)
+
+	contract := h.asset("autoExecutableContract:victim")
+	if clauses, _ := contract["clauses"].([]interface{}); len(clauses) != 1 {
+		t.Fatalf("expected the clause of the victim to be kept, got %v", contract["clauses"])
+	}
+	clause := h.asset("clause:victim")
+	if input, _ := clause["input"].(map[string]interface{}); input["referenceDate"] != nil {
+		t.Fatalf("expected no reference date on the clause of the victim, got %v", input)
+	}
+}
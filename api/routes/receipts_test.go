@@ -0,0 +1,282 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/chaincode/fake"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+func TestReceiptReview(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	h.user("Carol", "carol@example.com", "33333333333")
+
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:rent",
+		"id":         "rent",
+		"actionType": float64(chaincode.ActionMakePayment),
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":   chaincode.AssetTypeContract,
+		"@key":         "autoExecutableContract:lease",
+		"name":         "Lease",
+		"owner":        ref(chaincode.AssetTypeUser, alice),
+		"participants": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"clauses":      []interface{}{ref(chaincode.AssetTypeClause, "clause:rent")},
+	})
+
+	receiptFile := []byte("%PDF-1.4 transfer of 500.00")
+	receiptHash := fmt.Sprintf("%x", sha256.Sum256(receiptFile))
+	manualPayment := func(finalPayment string, receipt []byte) multipartForm {
+		form := multipartForm{fields: url.Values{
+			"clause":       {`{"@assetType":"clause","@key":"clause:rent"}`},
+			"date":         {"2024-02-01"},
+			"payment":      {"500"},
+			"finalPayment": {finalPayment},
+		}}
+		if receipt != nil {
+			form.files = []formFile{{field: "Receipt", name: "receipt.pdf", data: receipt}}
+		}
+		return form
+	}
+
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", manualPayment("false", receiptFile)), http.StatusOK, nil)
+
+	var list struct {
+		Receipts []db.PaymentReceipt `json:"receipts"`
+	}
+	h.expect(h.do(http.MethodGet, "/receipts?clauseKey=clause:rent", "bob@example.com", nil), http.StatusOK, &list)
+	if len(list.Receipts) != 1 {
+		t.Fatalf("expected one receipt, got %+v", list.Receipts)
+	}
+	receipt := list.Receipts[0]
+	if receipt.Status != db.ReceiptPending || receipt.PayerKey != bob || receipt.PayeeKey != alice || receipt.ReceiptHash != receiptHash || receipt.Amount().String() != "500.00 BRL" {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	if h.notifications.metadata(alice, "receiptID") != receipt.ID {
+		t.Fatalf("expected the payee to be asked to review the receipt, got %s", h.notifications)
+	}
+	h.expect(h.do(http.MethodGet, "/receipts?clauseKey=clause:rent", "carol@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodGet, "/receipts/"+receipt.ID, "carol@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodGet, "/receipts/missing", "alice@example.com", nil), http.StatusNotFound, nil)
+
+	rec := h.do(http.MethodGet, "/receipts/"+receipt.ID+"/file", "alice@example.com", nil)
+	h.expect(rec, http.StatusOK, nil)
+	if rec.Body.String() != string(receiptFile) || rec.Header().Get("X-Receipt-Hash") != receiptHash {
+		t.Fatalf("unexpected receipt download %q, headers %v", rec.Body.String(), rec.Header())
+	}
+
+	// A stored file that no longer matches the recorded hash is not served
+	if err := h.blobs.Put(ctx, "receipts/"+receiptHash, strings.NewReader("forged")); err != nil {
+		t.Fatal(err)
+	}
+	h.expect(h.do(http.MethodGet, "/receipts/"+receipt.ID+"/file", "alice@example.com", nil), http.StatusInternalServerError, nil)
+
+	var verified struct {
+		Hash    string `json:"hash"`
+		Matches bool   `json:"matches"`
+	}
+	verify := func(file []byte) {
+		t.Helper()
+		form := multipartForm{files: []formFile{{field: "file", name: "receipt.pdf", data: file}}}
+		h.expect(h.do(http.MethodPost, "/receipts/"+receipt.ID+"/verify", "alice@example.com", form), http.StatusOK, &verified)
+	}
+	verify(receiptFile)
+	if !verified.Matches || verified.Hash != receiptHash {
+		t.Fatalf("expected the receipt to match, got %+v", verified)
+	}
+	verify([]byte("forged"))
+	if verified.Matches {
+		t.Fatalf("expected another file not to match, got %+v", verified)
+	}
+
+	// A final card payment started before the dispute waits for it to be
+	// settled
+	var intent struct {
+		Payment db.ClausePayment `json:"payment"`
+	}
+	h.expect(h.do(http.MethodPost, "/payments/intents", "bob@example.com", map[string]interface{}{
+		"clause":       ref(chaincode.AssetTypeClause, "clause:rent"),
+		"payment":      100,
+		"finalPayment": true,
+		"date":         "2024-03-01",
+	}), http.StatusOK, &intent)
+
+	// Only the payee reviews the receipt, and a dispute needs a comment
+	dispute := map[string]interface{}{"comment": "The transfer never reached my account"}
+	h.expect(h.do(http.MethodPost, "/receipts/"+receipt.ID+"/dispute", "bob@example.com", dispute), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/receipts/"+receipt.ID+"/accept", "carol@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/receipts/"+receipt.ID+"/dispute", "alice@example.com", map[string]interface{}{}), http.StatusBadRequest, nil)
+
+	var reviewed struct {
+		Receipt db.PaymentReceipt `json:"receipt"`
+	}
+	h.expect(h.do(http.MethodPost, "/receipts/"+receipt.ID+"/dispute", "alice@example.com", dispute), http.StatusOK, &reviewed)
+	if reviewed.Receipt.Status != db.ReceiptDisputed || reviewed.Receipt.Comment != dispute["comment"] || reviewed.Receipt.ReviewedAt == nil {
+		t.Fatalf("expected the receipt to be disputed, got %+v", reviewed.Receipt)
+	}
+	for _, user := range []string{alice, bob} {
+		if h.notifications.metadata(user, "status") != string(db.ReceiptDisputed) {
+			t.Fatalf("expected %s to be notified of the dispute, got %s", user, h.notifications)
+		}
+	}
+	h.expect(h.do(http.MethodPost, "/receipts/"+receipt.ID+"/dispute", "alice@example.com", dispute), http.StatusConflict, nil)
+
+	// The dispute blocks final payments, not partial ones
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", manualPayment("true", nil)), http.StatusConflict, nil)
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", manualPayment("false", []byte("%PDF-1.4 transfer of 100.00"))), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, "/payments/intents", "bob@example.com", map[string]interface{}{
+		"clause":       ref(chaincode.AssetTypeClause, "clause:rent"),
+		"payment":      100,
+		"finalPayment": true,
+		"date":         "2024-03-01",
+	}), http.StatusConflict, nil)
+
+	if _, err := h.provider.Pay(intent.Payment.IntentID); err != nil {
+		t.Fatal(err)
+	}
+	payload, header, err := h.provider.Webhook(intent.Payment.IntentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.expect(h.webhook(payload, header), http.StatusInternalServerError, nil)
+	if stored, _ := h.payments.GetClausePayment(ctx, intent.Payment.ID); stored.RecordedAt != nil || !strings.Contains(stored.Error, "disputed") {
+		t.Fatalf("expected the final payment to wait for the dispute, got %+v", stored)
+	}
+
+	// Accepting the receipt settles the dispute
+	reviewed.Receipt = db.PaymentReceipt{}
+	h.expect(h.do(http.MethodPost, "/receipts/"+receipt.ID+"/accept", "alice@example.com", nil), http.StatusOK, &reviewed)
+	if reviewed.Receipt.Status != db.ReceiptAccepted || reviewed.Receipt.Comment != "" {
+		t.Fatalf("expected the receipt to be accepted, got %+v", reviewed.Receipt)
+	}
+	if h.notifications.metadata(bob, "status") != string(db.ReceiptAccepted) {
+		t.Fatalf("expected the payer to be notified of the acceptance, got %s", h.notifications)
+	}
+	h.expect(h.do(http.MethodPost, "/receipts/"+receipt.ID+"/dispute", "alice@example.com", dispute), http.StatusConflict, nil)
+
+	h.expect(h.webhook(payload, header), http.StatusOK, nil)
+	if stored, _ := h.payments.GetClausePayment(ctx, intent.Payment.ID); stored.RecordedAt == nil {
+		t.Fatalf("expected the final payment to be recorded, got %+v", stored)
+	}
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", manualPayment("true", []byte("%PDF-1.4 transfer of 400.00"))), http.StatusAccepted, nil)
+}
+
+func TestFinalPaymentWaitsForItsReceipt(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeClause,
+		"@key":       "clause:rent",
+		"id":         "rent",
+		"actionType": float64(chaincode.ActionMakePayment),
+	})
+	h.ledger.Put(map[string]interface{}{
+		"@assetType":   chaincode.AssetTypeContract,
+		"@key":         "autoExecutableContract:lease",
+		"name":         "Lease",
+		"owner":        ref(chaincode.AssetTypeUser, alice),
+		"participants": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"clauses":      []interface{}{ref(chaincode.AssetTypeClause, "clause:rent")},
+	})
+
+	finalPayment := multipartForm{
+		fields: url.Values{
+			"clause":       {`{"@assetType":"clause","@key":"clause:rent"}`},
+			"date":         {"2024-02-01"},
+			"payment":      {"500"},
+			"finalPayment": {"true"},
+		},
+		files: []formFile{{field: "Receipt", name: "receipt.pdf", data: []byte("%PDF-1.4 transfer of 500.00")}},
+	}
+	paid := func() bool {
+		clause, _ := h.ledger.Get("clause:rent")
+		input, _ := clause["input"].(map[string]interface{})
+		return input["finalPayment"] == true
+	}
+
+	// A final payment without a receipt is not recorded
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", multipartForm{fields: finalPayment.fields}), http.StatusPaymentRequired, nil)
+	if paid() {
+		t.Fatal("expected the payment not to be recorded without a receipt")
+	}
+
+	// Nothing is recorded when the receipt cannot be stored
+	db.SetPaymentReceipts(nil)
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", finalPayment), http.StatusInternalServerError, nil)
+	db.SetPaymentReceipts(h.receipts)
+	if paid() {
+		t.Fatal("expected the payment not to be recorded without its receipt")
+	}
+
+	var held struct {
+		Receipt db.PaymentReceipt `json:"receipt"`
+	}
+	h.expect(h.do(http.MethodPost, "/addinputstomakepayment", "bob@example.com", finalPayment), http.StatusAccepted, &held)
+	if !held.Receipt.Held() || paid() {
+		t.Fatalf("expected the final payment to be held, got %+v", held.Receipt)
+	}
+
+	// A dispute keeps the payment held, and the acceptance records it
+	dispute := map[string]interface{}{"comment": "The transfer never reached my account"}
+	h.expect(h.do(http.MethodPost, "/receipts/"+held.Receipt.ID+"/dispute", "alice@example.com", dispute), http.StatusOK, nil)
+	if paid() {
+		t.Fatal("expected the disputed payment not to be recorded")
+	}
+
+	// Nothing is recorded on a contract that is no longer active
+	lifecycle := &db.ContractLifecycle{ContractKey: "autoExecutableContract:lease", State: db.ContractCancelled}
+	if err := h.lifecycles.SaveContractLifecycle(context.Background(), lifecycle); err != nil {
+		t.Fatal(err)
+	}
+	h.expect(h.do(http.MethodPost, "/receipts/"+held.Receipt.ID+"/accept", "alice@example.com", nil), http.StatusConflict, nil)
+	if paid() {
+		t.Fatal("expected the payment not to be recorded on a cancelled contract")
+	}
+	lifecycle.State = db.ContractActive
+	if err := h.lifecycles.SaveContractLifecycle(context.Background(), lifecycle); err != nil {
+		t.Fatal(err)
+	}
+
+	// The acceptance is released when the ledger fails, so that it can be
+	// accepted again
+	h.ledger.FailNext("addInputsToMakePaymentClause", http.StatusInternalServerError)
+	h.expect(h.do(http.MethodPost, "/receipts/"+held.Receipt.ID+"/accept", "alice@example.com", nil), http.StatusUnprocessableEntity, nil)
+	if stored, _ := h.receipts.GetPaymentReceipt(context.Background(), held.Receipt.ID); stored.Status != db.ReceiptDisputed || !stored.Held() || paid() {
+		t.Fatalf("expected the receipt to be released, got %+v", stored)
+	}
+
+	var reviewed struct {
+		Receipt db.PaymentReceipt `json:"receipt"`
+	}
+	h.expect(h.do(http.MethodPost, "/receipts/"+held.Receipt.ID+"/accept", "alice@example.com", nil), http.StatusOK, &reviewed)
+	if reviewed.Receipt.Status != db.ReceiptAccepted || reviewed.Receipt.RecordedAt == nil || !paid() {
+		t.Fatalf("expected the accepted payment to be recorded, got %+v", reviewed.Receipt)
+	}
+
+	// Accepting it again does not record the payment twice
+	calls := 0
+	h.ledger.Handle("addInputsToMakePaymentClause", func(*fake.Store, map[string]interface{}) (interface{}, error) {
+		calls++
+		return nil, nil
+	})
+	h.expect(h.do(http.MethodPost, "/receipts/"+held.Receipt.ID+"/accept", "alice@example.com", nil), http.StatusConflict, nil)
+	if calls != 0 {
+		t.Fatalf("expected the payment to be recorded once, recorded %d more times", calls)
+	}
+}
@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/api/handlers/documents"
+)
+
+func TestSendReminders(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	carol := h.user("Carol", "carol@example.com", "33333333333")
+
+	upload := func(name string, timeout time.Time, reminders string) string {
+		form := multipartForm{
+			fields: url.Values{
+				"requiredSignatures": {bob + "," + carol},
+				"timeout":            {timeout.UTC().Format(time.RFC3339)},
+				"reminders":          {reminders},
+			},
+			files: []formFile{{field: "files", name: name, data: []byte("%PDF-1.7 " + name)}},
+		}
+		var doc map[string]interface{}
+		h.expect(h.do(http.MethodPost, "/uploaddocument", "alice@example.com", form), http.StatusCreated, &doc)
+		return doc["@key"].(string)
+	}
+
+	h.expect(h.do(http.MethodPost, "/uploaddocument", "alice@example.com", multipartForm{
+		fields: url.Values{
+			"requiredSignatures": {bob},
+			"timeout":            {"2099-01-01T00:00:00Z"},
+			"reminders":          {"1d,soon"},
+		},
+		files: []formFile{{field: "files", name: "lease.pdf", data: []byte("%PDF-1.7")}},
+	}), http.StatusBadRequest, nil)
+
+	// Within the first reminder of the default schedule, 3 days before
+	lease := upload("lease.pdf", time.Now().Add(48*time.Hour), "")
+	// Past every reminder of its own schedule
+	annex := upload("annex.pdf", time.Now().Add(90*time.Minute), "4h,2h")
+	// Before any reminder
+	upload("later.pdf", time.Now().Add(30*24*time.Hour), "")
+
+	sign := url.Values{
+		"dockey":    {annex},
+		"password":  {"secret"},
+		"signature": {"signature"},
+		"username":  {"carol"},
+		"cpf":       {"33333333333"},
+	}
+	h.signingService("carol")
+	h.expect(h.do(http.MethodPost, "/signdocument", "carol@example.com", sign), http.StatusOK, nil)
+
+	documents.SendReminders(context.Background())
+
+	if got := h.emails.to("bob@example.com"); len(got) != 2 {
+		t.Fatalf("expected bob to be reminded of both documents, got %v", got)
+	}
+	if got := h.emails.to("carol@example.com"); len(got) != 1 || got[0] != "Reminder: lease.pdf is waiting for your signature" {
+		t.Fatalf("expected carol to be reminded only of the lease, got %v", got)
+	}
+	if got := h.emails.to("alice@example.com"); len(got) != 1 || got[0] != "Signatures missing on annex.pdf" {
+		t.Fatalf("expected alice to be warned about the annex only, got %v", got)
+	}
+	notified := h.notifications.forUser(alice)
+	if last := notified[len(notified)-1]; !strings.HasPrefix(last, "Document annex.pdf expires on") {
+		t.Fatalf("unexpected escalation %q", last)
+	}
+
+	state, _ := h.reminders.GetReminderState(context.Background(), annex)
+	if len(state.Sent) != 2 {
+		t.Fatalf("expected both reminders of the annex to be recorded, got %v", state.Sent)
+	}
+	if state, _ := h.reminders.GetReminderState(context.Background(), lease); len(state.Sent) != 1 {
+		t.Fatalf("expected one reminder of the lease to be recorded, got %v", state.Sent)
+	}
+
+	documents.SendReminders(context.Background())
+	if got := h.emails.to("bob@example.com"); len(got) != 2 {
+		t.Fatalf("expected reminders to be sent once, got %v", got)
+	}
+}
@@ -2,26 +2,52 @@ package routes
 
 import (
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/umairmaseed/clausia-api/api/handlers/admin"
 	"github.com/umairmaseed/clausia-api/api/handlers/auth"
 	"github.com/umairmaseed/clausia-api/api/handlers/contract"
 	"github.com/umairmaseed/clausia-api/api/handlers/documents"
 	"github.com/umairmaseed/clausia-api/api/handlers/notification"
 	"github.com/umairmaseed/clausia-api/api/handlers/user"
+	"github.com/umairmaseed/clausia-api/api/middleware"
+	"github.com/umairmaseed/clausia-api/api/policy"
 	"github.com/umairmaseed/clausia-api/api/routes/docs"
+	"github.com/umairmaseed/clausia-api/env"
 	"github.com/umairmaseed/clausia-api/websocket"
 
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
+// Targets and relations shared by the authorization rules of the routes.
+// Routes without a rule have their handlers check the caller: the lifecycle
+// of a contract is also shown to its invited users, templates have their own
+// roles, and envelopes, payments and documents found by URL are only tied to
+// their asset once loaded. Receipts are tied to the contract of their payment. Listing routes and the calendar only
+// return the assets of the caller.
+var (
+	contractOfPath  = policy.Contract(policy.Param("key"))
+	contractOfBody  = policy.Contract(policy.Body("autoExecutableContract"))
+	clauseOfBody    = policy.Clause(policy.Body("clause"))
+	receiptOfPath   = policy.Receipt(policy.Param("id"))
+	contractParties = []policy.Relation{policy.Owner, policy.Participant}
+	documentParties = []policy.Relation{policy.Owner, policy.Signer}
+)
+
 // Register routes and handlers used by engine
 func AddRoutesToEngine(r *gin.Engine, wsServer *websocket.WebSocketServer) {
-
 	a := auth.NewAuth()
+	addRoutes(r, wsServer, a, a.AuthMiddleware())
+}
 
+// addRoutes registers every route, with authMiddleware guarding the private
+// ones. Tests replace the Cognito middleware through it.
+func addRoutes(r *gin.Engine, wsServer *websocket.WebSocketServer, a auth.Auth, authMiddleware gin.HandlerFunc) {
 	r.POST("/login", a.SignIn)
 	r.POST("/signup", a.SignUp)
 	r.POST("/otp", a.VerifyAccount)
@@ -41,37 +67,55 @@ func AddRoutesToEngine(r *gin.Engine, wsServer *websocket.WebSocketServer) {
 		})
 	})
 
-	r.Use(a.AuthMiddleware())
+	// Public verification of the QR code printed on signed documents
+	public := r.Group("/public", publicRateLimiter().Middleware())
+	public.GET("/verify/:key", documents.PublicVerifyDocument)
+	public.POST("/verify/:key", documents.PublicVerifyDocument)
+	// iCalendar feeds, read by calendar apps with the token of their URL
+	public.GET("/calendar/:token", contract.CalendarFeed)
+
+	// Signed notifications of the payment provider
+	r.POST("/payments/webhook", contract.PaymentWebhook)
+
+	r.Use(authMiddleware)
 	r.POST("/checkpw", a.CheckPw)
 
 	r.POST("/uploaddocument", documents.UploadDocument)
-	r.POST("/signdocument", documents.SignDocument)
-	r.POST("/canceldocument", documents.CancelDocument)
-	r.POST("/updatedocnameortimeout", documents.UpdateDocNameOrTimeout)
+	r.POST("/signdocument", policy.Require(policy.Document(policy.Body("dockey")), policy.Signer), documents.SignDocument)
+	r.POST("/canceldocument", policy.Require(policy.Document(policy.Body("@key")), policy.Owner), documents.CancelDocument)
+	r.POST("/updatedocnameortimeout", policy.Require(policy.Document(policy.Body("dockey")), policy.Owner), documents.UpdateDocNameOrTimeout)
 	r.POST("/updateemailorphone", a.UpdateEmailOrPhone)
 	r.POST("/confirmnewemail", a.ConfirmNewEmail)
 	r.GET("/listdocuments", documents.ListUserDocs)
 	r.POST("/downloaddocument", documents.DownloadDocument)
 	r.GET("/expectedsignatures", documents.ExpectedUserSignatures)
-	r.GET("/getdocument", documents.GetDoc)
+	r.GET("/getdocument", policy.Require(policy.Document(policy.Query("key")), documentParties...), documents.GetDoc)
 	r.GET("/listsuccessfulsignatures", documents.ListSuccessfulSignatures)
 	r.GET("/pendingsignatures", documents.PendingSignatures)
+	r.POST("/verifydocument", documents.VerifyDocument)
+	r.GET("/documents/:key/history", policy.Require(policy.Document(policy.Param("key")), documentParties...), documents.DocumentHistory)
+	r.GET("/documents/:key/certificate", policy.Require(policy.Document(policy.Param("key")), documentParties...), documents.DocumentCertificate)
+	r.GET("/envelopes", documents.ListEnvelopes)
+	r.GET("/envelopes/:id", documents.GetEnvelope)
+	r.POST("/envelopes/:id/sign", documents.SignEnvelope)
+	r.POST("/envelopes/:id/cancel", documents.CancelEnvelope)
+	r.GET("/envelopes/:id/download", documents.DownloadEnvelope)
 
 	r.POST("/createcontract", contract.CreateContract)
 	r.GET("/getusercontracts", contract.GetUserContracts)
-	r.GET("/getcontract", contract.GetContract)
-	r.GET("/getclause", contract.GetClause)
-	r.POST("/addclause", contract.AddClause)
-	r.POST("/removeclause", contract.RemoveClause)
-	r.POST("/addclauses", contract.AddMultipleClauses)
+	r.GET("/getcontract", policy.Require(policy.Contract(policy.Query("contractKey")), contractParties...), contract.GetContract)
+	r.GET("/getclause", policy.Require(policy.Clause(policy.Query("clauseKey")), contractParties...), contract.GetClause)
+	r.POST("/addclause", policy.Require(contractOfBody, policy.Owner), contract.AddClause)
+	r.POST("/removeclause", policy.Require(contractOfBody, policy.Owner), contract.RemoveClause)
+	r.POST("/addclauses", policy.Require(contractOfBody, policy.Owner), contract.AddMultipleClauses)
 	r.POST("/addparticipants", contract.AddParticipants)
-	r.POST("/addreferencedate", contract.AddReferenceDate)
-	r.POST("/addevaluatedate", contract.AddEvaluateDate)
-	r.POST("/addinputstocheckfine", contract.AddInputsToCheckFine)
-	r.POST("/addstoredvaluetogetcredit", contract.AddStoredValueToGetCredit)
-	r.POST("/addreviewtocontract", contract.AddReviewToContract)
-	r.POST("/addinputstomakepayment", contract.AddInputsToMakePayment)
-	r.POST("/cancelcontract", contract.CancelContract)
+	r.POST("/addreferencedate", policy.Require(clauseOfBody, contractParties...), contract.AddReferenceDate)
+	r.POST("/addevaluatedate", policy.Require(clauseOfBody, contractParties...), contract.AddEvaluateDate)
+	r.POST("/addinputstocheckfine", policy.Require(clauseOfBody, contractParties...), contract.AddInputsToCheckFine)
+	r.POST("/addstoredvaluetogetcredit", policy.Require(clauseOfBody, contractParties...), contract.AddStoredValueToGetCredit)
+	r.POST("/addreviewtocontract", policy.Require(contractOfBody, contractParties...), contract.AddReviewToContract)
+	r.POST("/addinputstomakepayment", policy.Require(clauseOfBody, contractParties...), contract.AddInputsToMakePayment)
+	r.POST("/cancelcontract", policy.Require(clauseOfBody, contractParties...), contract.CancelContract)
 	r.POST("/createtemplate", contract.CreateTemplate)
 	r.POST("/createtemplateclause", contract.CreateTemplateClause)
 	r.POST("/edittemplate", contract.EditTemplate)
@@ -79,10 +123,46 @@ func AddRoutesToEngine(r *gin.Engine, wsServer *websocket.WebSocketServer) {
 	r.POST("/duplicatetemplate", contract.DuplicateTemplate)
 	r.POST("/removetemplate", contract.RemoveTemplate)
 	r.POST("/removetemplateclause", contract.RemoveTemplateClause)
-	r.POST("/addparticipantrequest", contract.AddParticipantRequest)
+	r.POST("/addparticipantrequest", policy.Require(contractOfBody, policy.Owner), contract.AddParticipantRequest)
 	r.POST("/sharetemplate", contract.ShareTemplate)
 	r.POST("/viewsharedtemplate", contract.ViewSharedTemplate)
-	r.GET("/getdateswithclause", contract.GetDatesWithCLause)
+	r.GET("/getdateswithclause", policy.Require(policy.Clause(policy.Query("clauseKey")), contractParties...), contract.GetDatesWithCLause)
+	r.GET("/contracts/:key/executions", policy.Require(contractOfPath, contractParties...), contract.ContractExecutions)
+	r.POST("/contracts/:key/dryrun", policy.Require(contractOfPath, contractParties...), contract.DryRunContract)
+	r.GET("/contracts/:key/lifecycle", contract.ContractLifecycle)
+	r.POST("/contracts/:key/activate", policy.Require(contractOfPath, policy.Owner), contract.ActivateContract)
+	r.POST("/contracts/invitations/accept", contract.AcceptInvitation)
+	r.POST("/contracts/invitations/decline", contract.DeclineInvitation)
+	r.GET("/templates/catalog", contract.TemplateCatalog)
+	r.POST("/templates/:key/tags", contract.SetTemplateTags)
+	r.GET("/templates/:key/access", contract.TemplateAccess)
+	r.POST("/templates/:key/access", contract.GrantTemplateAccess)
+	r.POST("/templates/:key/access/revoke", contract.RevokeTemplateAccess)
+	r.GET("/templates/:key/reviews", contract.TemplateReviews)
+	r.POST("/templates/:key/reviews", contract.AddReviewToTemplate)
+	r.POST("/templates/:key/instantiate", contract.InstantiateTemplate)
+	r.GET("/templates/:key/versions", contract.TemplateVersions)
+	r.GET("/templates/:key/versions/:version", contract.TemplateVersion)
+	r.GET("/templates/:key/diff", contract.DiffTemplateVersions)
+	r.GET("/contracts/:key/upgrades", policy.Require(contractOfPath, contractParties...), contract.UpgradeProposals)
+	r.POST("/contracts/:key/upgrades", policy.Require(contractOfPath, policy.Owner), contract.ProposeUpgrade)
+	r.POST("/contracts/:key/upgrades/:id/accept", policy.Require(contractOfPath, contractParties...), contract.AcceptUpgrade)
+	r.POST("/contracts/:key/upgrades/:id/decline", policy.Require(contractOfPath, contractParties...), contract.DeclineUpgrade)
+	r.GET("/contracts/:key/financials", policy.Require(contractOfPath, contractParties...), contract.ContractFinancials)
+	r.POST("/payments/intents", policy.Require(clauseOfBody, contractParties...), contract.CreatePaymentIntent)
+	r.GET("/payments", policy.Require(policy.Clause(policy.Query("clauseKey")), contractParties...), contract.ClausePayments)
+	r.GET("/payments/:id", contract.GetClausePayment)
+	r.POST("/payments/:id/refund", contract.RefundClausePayment)
+	r.POST("/payments/:id/mock/pay", contract.PayMockPayment)
+	r.GET("/receipts", policy.Require(policy.Clause(policy.Query("clauseKey")), contractParties...), contract.ClauseReceipts)
+	r.GET("/receipts/:id", policy.Require(receiptOfPath, contractParties...), contract.GetReceipt)
+	r.GET("/receipts/:id/file", policy.Require(receiptOfPath, contractParties...), contract.DownloadReceipt)
+	r.POST("/receipts/:id/verify", policy.Require(receiptOfPath, contractParties...), contract.VerifyReceipt)
+	r.POST("/receipts/:id/accept", policy.Require(receiptOfPath, policy.Owner), contract.AcceptReceipt)
+	r.POST("/receipts/:id/dispute", policy.Require(receiptOfPath, policy.Owner), contract.DisputeReceipt)
+	r.GET("/calendar", contract.UserCalendar)
+	r.POST("/calendar/feed", contract.CreateCalendarFeed)
+	r.DELETE("/calendar/feed", contract.DeleteCalendarFeed)
 
 	r.GET("/getnotifications", notification.GetNotifications)
 	r.POST("/deletenotification", notification.DeleteNotification)
@@ -93,6 +173,13 @@ func AddRoutesToEngine(r *gin.Engine, wsServer *websocket.WebSocketServer) {
 	r.GET("/user/info", user.GetUserInfo)
 	r.GET("/confirmuser", user.ConfirmUser)
 
+	jobs := r.Group("/admin/jobs", middleware.RequireAdmin())
+	jobs.GET("", admin.ListJobs)
+	jobs.GET("/:name/runs", admin.JobRuns)
+	jobs.POST("/:name/pause", admin.PauseJob)
+	jobs.POST("/:name/resume", admin.ResumeJob)
+	jobs.POST("/:name/run", admin.RunJob)
+
 	// serve swagger files
 	docs.SwaggerInfo.BasePath = "/api"
 	r.StaticFile("/swagger.yaml", "./api/routes/docs/swagger.yaml")
@@ -106,3 +193,13 @@ func AddRoutesToEngine(r *gin.Engine, wsServer *websocket.WebSocketServer) {
 		http.HandlerFunc(websocket.WebSocketHandler(wsServer)).ServeHTTP(c.Writer, c.Request)
 	})
 }
+
+// publicRateLimiter allows PUBLIC_VERIFY_RATE requests per minute to each
+// client of the public routes, 30 by default
+func publicRateLimiter() *middleware.RateLimiter {
+	perMinute := 30
+	if rate, err := strconv.Atoi(os.Getenv(env.PUBLIC_VERIFY_RATE)); err == nil && rate > 0 {
+		perMinute = rate
+	}
+	return middleware.NewRateLimiter(perMinute, time.Minute, perMinute)
+}
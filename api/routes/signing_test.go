@@ -0,0 +1,219 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+func TestSigningSteps(t *testing.T) {
+	h := newHarness(t)
+	h.signingService("bob", "carol", "dave")
+
+	h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	carol := h.user("Carol", "carol@example.com", "33333333333")
+	dave := h.user("Dave", "dave@example.com", "44444444444")
+
+	steps, _ := json.Marshal([]chaincode.SigningStep{
+		{Role: "counterparty", Signers: []chaincode.Signer{{Key: bob}}},
+		{Role: "witness", Signers: []chaincode.Signer{{Key: carol}, {Key: dave}}},
+	})
+	upload := func(signingSteps string) multipartForm {
+		return multipartForm{
+			fields: url.Values{
+				"requiredSignatures": {bob + "," + carol + "," + dave},
+				"timeout":            {"2099-01-01T00:00:00Z"},
+				"signingSteps":       {signingSteps},
+			},
+			files: []formFile{{field: "files", name: "lease.pdf", data: []byte("%PDF-1.7")}},
+		}
+	}
+
+	incomplete := `[{"signers":[{"@key":"` + bob + `"}]}]`
+	h.expect(h.do(http.MethodPost, "/uploaddocument", "alice@example.com", upload(incomplete)), http.StatusBadRequest, nil)
+
+	var doc map[string]interface{}
+	h.expect(h.do(http.MethodPost, "/uploaddocument", "alice@example.com", upload(string(steps))), http.StatusCreated, &doc)
+	docKey := doc["@key"].(string)
+
+	if len(h.notifications.forUser(bob)) != 1 || len(h.notifications.forUser(carol)) != 0 {
+		t.Fatalf("expected only bob to be asked to sign, got %s", h.notifications)
+	}
+
+	var pending struct {
+		Documents []map[string]interface{} `json:"documents"`
+	}
+	h.expect(h.do(http.MethodGet, "/pendingsignatures", "carol@example.com", nil), http.StatusOK, &pending)
+	if len(pending.Documents) != 0 {
+		t.Fatalf("expected no pending signature for carol before bob signs, got %v", pending.Documents)
+	}
+	h.expect(h.do(http.MethodGet, "/pendingsignatures", "bob@example.com", nil), http.StatusOK, &pending)
+	if len(pending.Documents) != 1 {
+		t.Fatalf("expected one pending signature for bob, got %v", pending.Documents)
+	}
+
+	sign := func(username, cpf string) url.Values {
+		return url.Values{
+			"dockey":    {docKey},
+			"password":  {"secret"},
+			"signature": {"signature"},
+			"username":  {username},
+			"cpf":       {cpf},
+		}
+	}
+
+	rec := h.do(http.MethodPost, "/signdocument", "carol@example.com", sign("carol", "33333333333"))
+	h.expect(rec, http.StatusForbidden, nil)
+	if body := rec.Body.String(); body != "Signer must wait for signing step 1 of 2 (counterparty)" {
+		t.Fatalf("unexpected error %q", body)
+	}
+
+	var signed struct {
+		SigningStep struct {
+			Step           int                `json:"step"`
+			Role           string             `json:"role"`
+			PendingSigners []chaincode.Signer `json:"pendingSigners"`
+		} `json:"signingStep"`
+	}
+	h.expect(h.do(http.MethodPost, "/signdocument", "bob@example.com", sign("bob", "22222222222")), http.StatusOK, &signed)
+	if signed.SigningStep.Step != 2 || signed.SigningStep.Role != "witness" || len(signed.SigningStep.PendingSigners) != 2 {
+		t.Fatalf("expected the witness step to be next, got %+v", signed.SigningStep)
+	}
+	if len(h.notifications.forUser(carol)) != 1 || len(h.notifications.forUser(dave)) != 1 {
+		t.Fatalf("expected the witnesses to be asked to sign, got %s", h.notifications)
+	}
+	if steps := h.asset(docKey)["signingSteps"].([]interface{}); len(steps) != 2 {
+		t.Fatalf("expected the signing steps to be kept, got %v", steps)
+	}
+
+	h.expect(h.do(http.MethodGet, "/pendingsignatures", "carol@example.com", nil), http.StatusOK, &pending)
+	if len(pending.Documents) != 1 {
+		t.Fatalf("expected one pending signature for carol, got %v", pending.Documents)
+	}
+
+	// Signers sign as themselves, not as the CPF or username they send
+	for _, form := range []url.Values{sign("bob", "22222222222"), sign("carol", "22222222222"), sign("bob", "33333333333")} {
+		rec := h.do(http.MethodPost, "/signdocument", "dave@example.com", form)
+		h.expect(rec, http.StatusForbidden, nil)
+		if body := rec.Body.String(); body != "Signer does not match the logged in user" {
+			t.Fatalf("unexpected error %q", body)
+		}
+	}
+
+	h.expect(h.do(http.MethodPost, "/signdocument", "carol@example.com", sign("carol", "33333333333")), http.StatusOK, &signed)
+	if signed.SigningStep.Step != 2 || len(signed.SigningStep.PendingSigners) != 1 || signed.SigningStep.PendingSigners[0].Key != dave {
+		t.Fatalf("expected dave to be the last pending signer, got %+v", signed.SigningStep)
+	}
+
+	rejection := sign("dave", "44444444444")
+	rejection.Set("rejectsignature", "true")
+	h.expect(h.do(http.MethodPost, "/signdocument", "dave@example.com", rejection), http.StatusOK, nil)
+	if status := h.asset(docKey)["status"]; status != float64(4) {
+		t.Fatalf("expected the document to be finalized with rejections, got status %v", status)
+	}
+
+	var got struct {
+		SigningStep *struct{} `json:"signingStep"`
+	}
+	h.expect(h.do(http.MethodGet, "/getdocument?key="+docKey, "alice@example.com", nil), http.StatusOK, &got)
+	if got.SigningStep != nil {
+		t.Fatalf("expected no pending signing step, got %+v", got.SigningStep)
+	}
+}
+
+func TestSignatureFields(t *testing.T) {
+	h := newHarness(t)
+	signing := h.signingService("bob", "carol")
+
+	h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	carol := h.user("Carol", "carol@example.com", "33333333333")
+	dave := h.user("Dave", "dave@example.com", "44444444444")
+
+	upload := func(fields []chaincode.SignatureField) multipartForm {
+		raw, _ := json.Marshal(fields)
+		return multipartForm{
+			fields: url.Values{
+				"requiredSignatures": {bob + "," + carol + "," + dave},
+				"timeout":            {"2099-01-01T00:00:00Z"},
+				"signatureFields":    {string(raw)},
+			},
+			files: []formFile{{field: "files", name: "nda.pdf", data: []byte("%PDF-1.7")}},
+		}
+	}
+
+	bobField := chaincode.SignatureField{Signer: chaincode.Signer{Key: bob}, Page: 2, X: 100, Y: 150}
+	carolField := chaincode.SignatureField{Signer: chaincode.Signer{Key: carol}, Page: 2, X: 300, Y: 150}
+	daveField := chaincode.SignatureField{Signer: chaincode.Signer{Key: dave}, Page: 3, X: 100, Y: 150}
+	stranger := chaincode.SignatureField{Signer: chaincode.Signer{Key: "user:stranger"}, Page: 1}
+
+	for name, fields := range map[string][]chaincode.SignatureField{
+		"missing signer":  {bobField, daveField},
+		"unknown signer":  {bobField, carolField, daveField, stranger},
+		"duplicate field": {bobField, bobField, carolField, daveField},
+		"invalid page":    {bobField, daveField, {Signer: carolField.Signer, Page: 0}},
+	} {
+		rec := h.do(http.MethodPost, "/uploaddocument", "alice@example.com", upload(fields))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+
+	var doc map[string]interface{}
+	h.expect(h.do(http.MethodPost, "/uploaddocument", "alice@example.com", upload([]chaincode.SignatureField{bobField, carolField, daveField})), http.StatusCreated, &doc)
+	docKey := doc["@key"].(string)
+
+	// A rejection counts towards the final signature
+	h.expect(h.do(http.MethodPost, "/signdocument", "dave@example.com", url.Values{
+		"dockey":          {docKey},
+		"password":        {"secret"},
+		"username":        {"dave"},
+		"cpf":             {"44444444444"},
+		"rejectsignature": {"true"},
+	}), http.StatusOK, nil)
+
+	sign := url.Values{
+		"dockey":    {docKey},
+		"password":  {"secret"},
+		"signature": {`{"nda.pdf":{"rect":{"x":0,"y":0,"page":1},"final":true}}`},
+		"username":  {"bob"},
+		"cpf":       {"22222222222"},
+	}
+	h.expect(h.do(http.MethodPost, "/signdocument", "bob@example.com", sign), http.StatusOK, nil)
+	if got := signing.lastSignature(); got != `{"nda.pdf":{"final":false,"rect":{"x":100,"y":150,"page":2}}}` {
+		t.Fatalf("expected bob's field to be used, got %s", got)
+	}
+
+	sign.Del("signature")
+	sign.Set("username", "carol")
+	sign.Set("cpf", "33333333333")
+	h.expect(h.do(http.MethodPost, "/signdocument", "carol@example.com", sign), http.StatusOK, nil)
+	if got := signing.lastSignature(); got != `{"nda.pdf":{"final":true,"rect":{"x":300,"y":150,"page":2}}}` {
+		t.Fatalf("expected carol's field to be used for the final signature, got %s", got)
+	}
+}
+
+func TestSignatureIsRequiredWithoutFields(t *testing.T) {
+	h := newHarness(t)
+	h.signingService("bob")
+
+	h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	var doc map[string]interface{}
+	h.expect(h.do(http.MethodPost, "/uploaddocument", "alice@example.com", multipartForm{
+		fields: url.Values{"requiredSignatures": {bob}, "timeout": {"2099-01-01T00:00:00Z"}},
+		files:  []formFile{{field: "files", name: "nda.pdf", data: []byte("%PDF-1.7")}},
+	}), http.StatusCreated, &doc)
+
+	h.expect(h.do(http.MethodPost, "/signdocument", "bob@example.com", url.Values{
+		"dockey":   {doc["@key"].(string)},
+		"password": {"secret"},
+		"username": {"bob"},
+		"cpf":      {"22222222222"},
+	}), http.StatusBadRequest, nil)
+}
@@ -0,0 +1,529 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/api/handlers/contract"
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/templates"
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+func TestTemplateFlow(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	var created struct {
+		Template chaincode.Template `json:"template"`
+	}
+	h.expect(h.do(http.MethodPost, "/createtemplate", "alice@example.com", map[string]interface{}{
+		"id":          "lease",
+		"name":        "Lease",
+		"description": "Residential lease",
+		"public":      true,
+	}), http.StatusOK, &created)
+
+	templateKey := created.Template.Key
+	if templateKey == "" || created.Template.CreatorKey() != alice || !created.Template.Public {
+		t.Fatalf("unexpected template %+v", created.Template)
+	}
+
+	var clause struct {
+		TemplateClause chaincode.TemplateClause `json:"templateClause"`
+	}
+	h.expect(h.do(http.MethodPost, "/createtemplateclause", "alice@example.com", map[string]interface{}{
+		"id":                "rent",
+		"template":          ref(chaincode.AssetTypeTemplate, templateKey),
+		"number":            1,
+		"name":              "Rent",
+		"actionType":        1,
+		"defaultParameters": map[string]interface{}{"amount": 1000},
+	}), http.StatusOK, &clause)
+	clauseKey := clause.TemplateClause.Key
+	if clauseKey == "" || clause.TemplateClause.DefaultParameters["amount"] != float64(1000) {
+		t.Fatalf("unexpected template clause %+v", clause.TemplateClause)
+	}
+	if clauses := h.asset(templateKey)["clauses"].([]interface{}); len(clauses) != 1 {
+		t.Fatalf("expected the clause to be linked to the template, got %v", clauses)
+	}
+
+	edit := map[string]interface{}{
+		"template": ref(chaincode.AssetTypeTemplate, templateKey),
+		"name":     "Lease v2",
+	}
+	h.expect(h.do(http.MethodPost, "/edittemplate", "bob@example.com", edit), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/edittemplate", "alice@example.com", edit), http.StatusOK, nil)
+	if name := h.asset(templateKey)["name"]; name != "Lease v2" {
+		t.Fatalf("expected template to be renamed, got %v", name)
+	}
+
+	h.expect(h.do(http.MethodPost, "/edittemplateclause", "alice@example.com", map[string]interface{}{
+		"templateClause": ref(chaincode.AssetTypeTemplateClause, clauseKey),
+		"name":           "Monthly rent",
+	}), http.StatusOK, nil)
+	if name := h.asset(clauseKey)["name"]; name != "Monthly rent" {
+		t.Fatalf("expected template clause to be renamed, got %v", name)
+	}
+
+	var duplicated struct {
+		Template chaincode.Template `json:"template"`
+	}
+	h.expect(h.do(http.MethodPost, "/duplicatetemplate", "bob@example.com", map[string]interface{}{
+		"id":       "lease-copy",
+		"name":     "Bob's lease",
+		"template": ref(chaincode.AssetTypeTemplate, templateKey),
+	}), http.StatusOK, &duplicated)
+	if duplicated.Template.Key == templateKey || duplicated.Template.CreatorKey() != bob {
+		t.Fatalf("unexpected duplicate %+v", duplicated.Template)
+	}
+
+	h.expect(h.do(http.MethodPost, "/removetemplateclause", "alice@example.com", map[string]interface{}{
+		"template":       ref(chaincode.AssetTypeTemplate, templateKey),
+		"templateClause": ref(chaincode.AssetTypeTemplateClause, clauseKey),
+	}), http.StatusOK, nil)
+	if clauses, _ := h.asset(templateKey)["clauses"].([]interface{}); len(clauses) != 0 {
+		t.Fatalf("expected the clause to be removed, got %v", clauses)
+	}
+
+	h.expect(h.do(http.MethodPost, "/removetemplate", "alice@example.com", map[string]interface{}{
+		"template": ref(chaincode.AssetTypeTemplate, templateKey),
+	}), http.StatusOK, nil)
+	if _, ok := h.ledger.Get(templateKey); ok {
+		t.Fatal("expected the template to be removed")
+	}
+}
+
+func TestInstantiateTemplate(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	h.user("Carol", "carol@example.com", "33333333333")
+
+	var created struct {
+		Template chaincode.Template `json:"template"`
+	}
+	h.expect(h.do(http.MethodPost, "/createtemplate", "alice@example.com", map[string]interface{}{
+		"id":     "lease",
+		"name":   "Lease",
+		"public": false,
+	}), http.StatusOK, &created)
+	templateKey := created.Template.Key
+
+	for _, clause := range []map[string]interface{}{
+		{"id": "fine", "number": 2, "name": "Late fine", "actionType": 2, "optional": true,
+			"defaultParameters": map[string]interface{}{"dailyPercentage": 1}},
+		{"id": "rent", "number": 1, "name": "Rent", "actionType": 1,
+			"defaultParameters": map[string]interface{}{"amount": 1000, "dueDate": "2024-01-05", "payer": ref(chaincode.AssetTypeUser, alice)},
+			"defaultInputs":     map[string]interface{}{"payment": 0}},
+	} {
+		clause["template"] = ref(chaincode.AssetTypeTemplate, templateKey)
+		h.expect(h.do(http.MethodPost, "/createtemplateclause", "alice@example.com", clause), http.StatusOK, nil)
+	}
+
+	path := "/templates/" + templateKey + "/instantiate"
+	form := map[string]interface{}{
+		"name":          "Bob's lease",
+		"signatureDate": "2024-01-01T00:00:00Z",
+		"participants":  []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"parameters": map[string]interface{}{
+			"rent": map[string]interface{}{"amount": 1200, "dueDate": "2024-02-05", "payer": ref(chaincode.AssetTypeUser, bob)},
+			"fine": map[string]interface{}{"dailyPercentage": 2},
+		},
+	}
+
+	h.expect(h.do(http.MethodPost, path, "bob@example.com", form), http.StatusForbidden, nil)
+
+	var instantiated struct {
+		Contract chaincode.AutoExecutableContract `json:"contract"`
+	}
+	h.expect(h.do(http.MethodPost, path, "alice@example.com", form), http.StatusOK, &instantiated)
+	if instantiated.Contract.Data["templateKey"] != templateKey || len(instantiated.Contract.Clauses) != 2 {
+		t.Fatalf("unexpected contract %+v", instantiated.Contract)
+	}
+	rent := h.asset(instantiated.Contract.Clauses[0].Key)
+	params := rent["parameters"].(map[string]interface{})
+	if rent["id"] != "rent" || params["amount"] != 1200.0 || params["dueDate"] != "2024-02-05" || rent["input"] == nil {
+		t.Fatalf("unexpected rent clause %v", rent)
+	}
+	if h.notifications.metadata(bob, "contractID") != instantiated.Contract.Key {
+		t.Fatalf("expected bob to be invited, got %s", h.notifications)
+	}
+
+	form["excludedClauses"] = []string{"fine"}
+	form["parameters"] = map[string]interface{}{
+		"rent": map[string]interface{}{"amount": "a lot", "dueDate": "soon", "payer": ref(chaincode.AssetTypeUser, "user:33333333333"), "deposit": 1},
+	}
+	rec := h.do(http.MethodPost, path, "alice@example.com", form)
+	h.expect(rec, http.StatusBadRequest, nil)
+	for _, problem := range []string{
+		"parameter amount of clause rent must be a number",
+		"parameter dueDate of clause rent must be a date",
+		"parameter payer of clause rent must reference a party of the contract",
+		"clause rent has no parameter deposit",
+	} {
+		if !strings.Contains(rec.Body.String(), problem) {
+			t.Errorf("expected %q in %s", problem, rec.Body.String())
+		}
+	}
+
+	// Dependencies cannot be carried over to the clauses of the contract
+	h.expect(h.do(http.MethodPost, "/createtemplateclause", "alice@example.com", map[string]interface{}{
+		"template":     ref(chaincode.AssetTypeTemplate, templateKey),
+		"id":           "deposit",
+		"number":       3,
+		"name":         "Deposit",
+		"actionType":   1,
+		"dependencies": []interface{}{ref(chaincode.AssetTypeTemplateClause, "templateClause:rent")},
+	}), http.StatusOK, nil)
+	delete(form, "excludedClauses")
+	form["parameters"] = map[string]interface{}{}
+	rec = h.do(http.MethodPost, path, "alice@example.com", form)
+	h.expect(rec, http.StatusBadRequest, nil)
+	if !strings.Contains(rec.Body.String(), "clause deposit declares dependencies") {
+		t.Fatalf("expected the dependencies to be rejected, got %s", rec.Body)
+	}
+}
+
+func TestTemplateVersionBackfill(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	h.user("Bob", "bob@example.com", "22222222222")
+
+	// A template created before versions were recorded
+	templateKey := "template:legacy"
+	h.ledger.Put(map[string]interface{}{
+		"@assetType": chaincode.AssetTypeTemplate,
+		"@key":       templateKey,
+		"name":       "Lease",
+		"public":     true,
+		"creator":    ref(chaincode.AssetTypeUser, alice),
+	})
+
+	// Reading its versions records none
+	var versions struct {
+		Versions []db.TemplateVersion `json:"versions"`
+	}
+	h.expect(h.do(http.MethodGet, "/templates/"+templateKey+"/versions", "bob@example.com", nil), http.StatusOK, &versions)
+	if len(versions.Versions) != 0 {
+		t.Fatalf("expected no version before the backfill, got %+v", versions.Versions)
+	}
+	h.expect(h.do(http.MethodGet, "/templates/"+templateKey+"/diff?from=1", "bob@example.com", nil), http.StatusNotFound, nil)
+	if _, err := h.versions.LatestTemplateVersion(ctx, templateKey); !errors.Is(err, db.ErrTemplateVersionNotFound) {
+		t.Fatalf("expected the read endpoints not to record versions, got %v", err)
+	}
+
+	// The backfill records its first version, once
+	for i := 0; i < 2; i++ {
+		if err := contract.BackfillTemplateVersions(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.expect(h.do(http.MethodGet, "/templates/"+templateKey+"/versions", "bob@example.com", nil), http.StatusOK, &versions)
+	if len(versions.Versions) != 1 || versions.Versions[0].Version != 1 || versions.Versions[0].CreatedBy != alice {
+		t.Fatalf("expected the first version in the name of the creator, got %+v", versions.Versions)
+	}
+}
+
+func TestTemplateVersionsAndUpgrades(t *testing.T) {
+	t.Setenv("INVITE_EXPiRY_TIME", "24")
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+	h.user("Carol", "carol@example.com", "33333333333")
+
+	var created struct {
+		Template chaincode.Template `json:"template"`
+	}
+	h.expect(h.do(http.MethodPost, "/createtemplate", "alice@example.com", map[string]interface{}{
+		"id":     "lease",
+		"name":   "Lease",
+		"public": true,
+	}), http.StatusOK, &created)
+	templateKey := created.Template.Key
+
+	var clause struct {
+		TemplateClause chaincode.TemplateClause `json:"templateClause"`
+	}
+	h.expect(h.do(http.MethodPost, "/createtemplateclause", "alice@example.com", map[string]interface{}{
+		"id":                "rent",
+		"template":          ref(chaincode.AssetTypeTemplate, templateKey),
+		"number":            1,
+		"name":              "Rent",
+		"actionType":        1,
+		"defaultParameters": map[string]interface{}{"amount": 1000, "dueDate": "2024-01-05"},
+	}), http.StatusOK, &clause)
+
+	var versions struct {
+		Versions []db.TemplateVersion `json:"versions"`
+	}
+	h.expect(h.do(http.MethodGet, "/templates/"+templateKey+"/versions", "bob@example.com", nil), http.StatusOK, &versions)
+	if len(versions.Versions) != 2 || len(versions.Versions[0].Clauses) != 0 || versions.Versions[1].Clauses[0].Id != "rent" {
+		t.Fatalf("expected a version per change, got %+v", versions.Versions)
+	}
+
+	var instantiated struct {
+		Contract chaincode.AutoExecutableContract `json:"contract"`
+	}
+	h.expect(h.do(http.MethodPost, "/templates/"+templateKey+"/instantiate", "alice@example.com", map[string]interface{}{
+		"name":          "Bob's lease",
+		"signatureDate": "2024-01-01T00:00:00Z",
+		"participants":  []interface{}{ref(chaincode.AssetTypeUser, bob)},
+		"parameters":    map[string]interface{}{"rent": map[string]interface{}{"amount": 1200}},
+	}), http.StatusOK, &instantiated)
+	contractKey := instantiated.Contract.Key
+	if instantiated.Contract.Data["templateVersion"] != 2.0 {
+		t.Fatalf("expected the template version on the contract, got %v", instantiated.Contract.Data)
+	}
+	h.expect(h.do(http.MethodPost, "/contracts/invitations/accept?token="+h.notifications.metadata(bob, "token"), "bob@example.com", nil), http.StatusOK, nil)
+
+	h.expect(h.do(http.MethodPost, "/edittemplateclause", "alice@example.com", map[string]interface{}{
+		"templateClause":    ref(chaincode.AssetTypeTemplateClause, clause.TemplateClause.Key),
+		"defaultParameters": map[string]interface{}{"amount": 1500, "dueDate": "2024-01-05", "lateFee": 10},
+	}), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, "/createtemplateclause", "alice@example.com", map[string]interface{}{
+		"id":                "deposit",
+		"template":          ref(chaincode.AssetTypeTemplate, templateKey),
+		"number":            2,
+		"name":              "Deposit",
+		"actionType":        3,
+		"defaultParameters": map[string]interface{}{"amount": 500},
+	}), http.StatusOK, nil)
+
+	var diff struct {
+		Diff templates.Diff `json:"diff"`
+	}
+	h.expect(h.do(http.MethodGet, "/templates/"+templateKey+"/diff?from=2", "bob@example.com", nil), http.StatusOK, &diff)
+	if diff.Diff.To != 4 || len(diff.Diff.Clauses) != 2 ||
+		diff.Diff.Clauses[0].Change != templates.ClauseChanged || len(diff.Diff.Clauses[0].Fields) != 2 ||
+		diff.Diff.Clauses[1].Id != "deposit" || diff.Diff.Clauses[1].Change != templates.ClauseAdded {
+		t.Fatalf("unexpected diff %+v", diff.Diff)
+	}
+	h.expect(h.do(http.MethodGet, "/templates/"+templateKey+"/diff?from=9", "bob@example.com", nil), http.StatusNotFound, nil)
+
+	upgrades := "/contracts/" + contractKey + "/upgrades"
+	h.expect(h.do(http.MethodPost, upgrades, "bob@example.com", map[string]interface{}{}), http.StatusForbidden, nil)
+
+	var proposed struct {
+		Proposal db.UpgradeProposal `json:"proposal"`
+	}
+	h.expect(h.do(http.MethodPost, upgrades, "alice@example.com", map[string]interface{}{}), http.StatusOK, &proposed)
+	proposal := proposed.Proposal
+	if proposal.FromVersion != 2 || proposal.ToVersion != 4 || proposal.Status != db.UpgradePending {
+		t.Fatalf("unexpected proposal %+v", proposal)
+	}
+	if h.notifications.metadata(bob, "upgradeID") != proposal.ID {
+		t.Fatalf("expected bob to be asked about the upgrade, got %s", h.notifications)
+	}
+	h.expect(h.do(http.MethodPost, upgrades, "alice@example.com", map[string]interface{}{}), http.StatusConflict, nil)
+
+	accept := upgrades + "/" + proposal.ID + "/accept"
+	h.expect(h.do(http.MethodPost, accept, "carol@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, accept, "alice@example.com", nil), http.StatusForbidden, nil)
+
+	// An upgrade interrupted after the new clauses were added is finished by
+	// accepting it again
+	h.ledger.FailNext("removeClause", http.StatusInternalServerError)
+	h.expect(h.do(http.MethodPost, accept, "bob@example.com", nil), http.StatusInternalServerError, nil)
+	var listed struct {
+		Proposals []db.UpgradeProposal `json:"proposals"`
+	}
+	h.expect(h.do(http.MethodGet, upgrades, "bob@example.com", nil), http.StatusOK, &listed)
+	if len(listed.Proposals) != 1 || listed.Proposals[0].Status != db.UpgradeApplying || !listed.Proposals[0].Progress.Added {
+		t.Fatalf("expected the upgrade to be applying, got %+v", listed.Proposals)
+	}
+	h.expect(h.do(http.MethodPost, upgrades, "alice@example.com", map[string]interface{}{}), http.StatusConflict, nil)
+	h.expect(h.do(http.MethodPost, accept, "bob@example.com", nil), http.StatusOK, &proposed)
+	if proposed.Proposal.Status != db.UpgradeApplied {
+		t.Fatalf("expected the upgrade to be applied, got %+v", proposed.Proposal)
+	}
+	h.expect(h.do(http.MethodPost, accept, "bob@example.com", nil), http.StatusConflict, nil)
+
+	clauses := map[string]map[string]interface{}{}
+	if refs := h.asset(contractKey)["clauses"].([]interface{}); len(refs) != 2 {
+		t.Fatalf("expected the replaced clauses to be removed, got %v", refs)
+	}
+	for _, c := range h.asset(contractKey)["clauses"].([]interface{}) {
+		clause := h.asset(c.(map[string]interface{})["@key"].(string))
+		clauses[clause["id"].(string)] = clause["parameters"].(map[string]interface{})
+	}
+	if rent := clauses["rent"]; rent["amount"] != 1200.0 || rent["lateFee"] != 10.0 {
+		t.Fatalf("expected the rent to keep its amount and get the late fee, got %v", rent)
+	}
+	if deposit := clauses["deposit"]; deposit["amount"] != 500.0 {
+		t.Fatalf("expected the deposit clause to be added, got %v", clauses)
+	}
+	if h.notifications.metadata(alice, "status") != string(db.UpgradeApplied) {
+		t.Fatalf("expected alice to be told about the upgrade, got %s", h.notifications)
+	}
+
+	h.expect(h.do(http.MethodPost, upgrades, "alice@example.com", map[string]interface{}{}), http.StatusConflict, nil)
+}
+
+func TestTemplateCatalog(t *testing.T) {
+	h := newHarness(t)
+
+	h.user("Alice", "alice@example.com", "11111111111")
+	h.user("Bob", "bob@example.com", "22222222222")
+
+	create := func(email, id, name string, public bool) string {
+		var created struct {
+			Template chaincode.Template `json:"template"`
+		}
+		h.expect(h.do(http.MethodPost, "/createtemplate", email, map[string]interface{}{
+			"id": id, "name": name, "description": name + " agreement", "public": public,
+		}), http.StatusOK, &created)
+		return created.Template.Key
+	}
+	lease := create("alice@example.com", "lease", "Lease", true)
+	create("alice@example.com", "secret", "Secret", false)
+	loan := create("bob@example.com", "loan", "Loan", true)
+
+	h.expect(h.do(http.MethodPost, "/createtemplateclause", "alice@example.com", map[string]interface{}{
+		"id": "rent", "template": ref(chaincode.AssetTypeTemplate, lease), "number": 1, "name": "Rent",
+		"category": "payment", "actionType": 1,
+	}), http.StatusOK, nil)
+
+	h.expect(h.do(http.MethodPost, "/templates/"+lease+"/tags", "bob@example.com", map[string]interface{}{"tags": []string{"housing"}}), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/templates/"+lease+"/tags", "alice@example.com", map[string]interface{}{"tags": []string{" Housing", "rent"}}), http.StatusOK, nil)
+
+	h.expect(h.do(http.MethodPost, "/duplicatetemplate", "bob@example.com", map[string]interface{}{
+		"id": "lease-copy", "name": "Bob's lease", "template": ref(chaincode.AssetTypeTemplate, lease),
+	}), http.StatusOK, nil)
+
+	reviews := "/templates/" + lease + "/reviews"
+	h.expect(h.do(http.MethodPost, reviews, "alice@example.com", map[string]interface{}{"rating": 5, "date": "2024-01-01T00:00:00Z"}), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, reviews, "bob@example.com", map[string]interface{}{"rating": 6, "date": "2024-01-01T00:00:00Z"}), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodPost, reviews, "bob@example.com", map[string]interface{}{"rating": 4, "date": "2024-01-01T00:00:00Z"}), http.StatusOK, nil)
+
+	var rated struct {
+		Reviews []chaincode.Review `json:"reviews"`
+		Rating  float64            `json:"rating"`
+	}
+	h.expect(h.do(http.MethodPost, reviews, "bob@example.com", map[string]interface{}{"rating": 2, "comments": "Too short", "date": "2024-01-02T00:00:00Z"}), http.StatusOK, &rated)
+	if len(rated.Reviews) != 1 || rated.Rating != 2 || rated.Reviews[0].Comments != "Too short" {
+		t.Fatalf("expected the review to be replaced, got %+v", rated)
+	}
+
+	var catalog struct {
+		Templates []templates.CatalogEntry `json:"templates"`
+		Total     int                      `json:"total"`
+	}
+	h.expect(h.do(http.MethodGet, "/templates/catalog", "bob@example.com", nil), http.StatusOK, &catalog)
+	if catalog.Total != 3 || catalog.Templates[0].Template.Key != lease || catalog.Templates[0].Popularity != 1 {
+		t.Fatalf("expected the public templates, most popular first, got %+v", catalog)
+	}
+
+	h.expect(h.do(http.MethodGet, "/templates/catalog?q=payment", "bob@example.com", nil), http.StatusOK, &catalog)
+	if catalog.Total != 1 || catalog.Templates[0].Template.Key != lease || catalog.Templates[0].Rating != 2 {
+		t.Fatalf("expected to find the lease by its clause category, got %+v", catalog)
+	}
+
+	h.expect(h.do(http.MethodGet, "/templates/catalog?tag=housing&tag=RENT", "bob@example.com", nil), http.StatusOK, &catalog)
+	if catalog.Total != 1 || catalog.Templates[0].Template.Key != lease {
+		t.Fatalf("expected to find the lease by its tags, got %+v", catalog)
+	}
+
+	h.expect(h.do(http.MethodGet, "/templates/catalog?sort=name&page=2&pageSize=2", "bob@example.com", nil), http.StatusOK, &catalog)
+	if catalog.Total != 3 || len(catalog.Templates) != 1 || catalog.Templates[0].Template.Key != loan {
+		t.Fatalf("expected the last template by name on the second page, got %+v", catalog)
+	}
+
+	h.expect(h.do(http.MethodGet, "/templates/catalog?sort=newest", "bob@example.com", nil), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodGet, "/templates/catalog?pageSize=500", "bob@example.com", nil), http.StatusBadRequest, nil)
+}
+
+func TestTemplateAccess(t *testing.T) {
+	t.Setenv("INVITE_EXPiRY_TIME", "24")
+	h := newHarness(t)
+
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	var created struct {
+		Template chaincode.Template `json:"template"`
+	}
+	h.expect(h.do(http.MethodPost, "/createtemplate", "alice@example.com", map[string]interface{}{
+		"id": "lease", "name": "Lease", "public": false,
+	}), http.StatusOK, &created)
+	templateKey := created.Template.Key
+	template := ref(chaincode.AssetTypeTemplate, templateKey)
+	access := "/templates/" + templateKey + "/access"
+	grant := func(role string) {
+		h.expect(h.do(http.MethodPost, access, "alice@example.com", map[string]interface{}{
+			"user": ref(chaincode.AssetTypeUser, bob), "role": role,
+		}), http.StatusOK, nil)
+	}
+	edit := map[string]interface{}{"template": template, "name": "Lease v2"}
+	clause := map[string]interface{}{"id": "rent", "template": template, "number": 1, "name": "Rent", "actionType": 1}
+	duplicate := map[string]interface{}{"id": "lease-copy", "name": "Bob's lease", "template": template}
+
+	token, err := utils.GenerateInviteToken("bob@example.com", templateKey, []byte(os.Getenv("JWT_SECRET")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewShared := "/viewsharedtemplate?token=" + token
+
+	h.expect(h.do(http.MethodGet, "/templates/"+templateKey+"/versions", "bob@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/duplicatetemplate", "bob@example.com", duplicate), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, viewShared, "bob@example.com", nil), http.StatusForbidden, nil)
+
+	h.expect(h.do(http.MethodPost, access, "alice@example.com", map[string]interface{}{
+		"user": ref(chaincode.AssetTypeUser, bob), "role": "admin",
+	}), http.StatusBadRequest, nil)
+	grant("viewer")
+	if h.notifications.metadata(bob, "role") != "viewer" {
+		t.Fatalf("expected bob to be told about his access, got %s", h.notifications)
+	}
+	h.expect(h.do(http.MethodGet, "/templates/"+templateKey+"/versions", "bob@example.com", nil), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, viewShared, "bob@example.com", nil), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, "/duplicatetemplate", "bob@example.com", duplicate), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, "/edittemplate", "bob@example.com", edit), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/createtemplateclause", "bob@example.com", clause), http.StatusForbidden, nil)
+
+	grant("editor")
+	h.expect(h.do(http.MethodPost, "/edittemplate", "bob@example.com", edit), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, "/createtemplateclause", "bob@example.com", clause), http.StatusOK, nil)
+	h.expect(h.do(http.MethodGet, access, "bob@example.com", nil), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, "/removetemplate", "bob@example.com", map[string]interface{}{"template": template}), http.StatusForbidden, nil)
+
+	var listed struct {
+		Creator string             `json:"creator"`
+		Grants  []db.TemplateGrant `json:"grants"`
+	}
+	h.expect(h.do(http.MethodGet, access, "alice@example.com", nil), http.StatusOK, &listed)
+	if listed.Creator != alice || len(listed.Grants) != 1 || listed.Grants[0].UserKey != bob || listed.Grants[0].Role != db.TemplateEditor {
+		t.Fatalf("unexpected access %+v", listed)
+	}
+
+	revoke := access + "/revoke"
+	h.expect(h.do(http.MethodPost, revoke, "alice@example.com", map[string]interface{}{"user": ref(chaincode.AssetTypeUser, alice)}), http.StatusBadRequest, nil)
+	h.expect(h.do(http.MethodPost, revoke, "alice@example.com", map[string]interface{}{"user": ref(chaincode.AssetTypeUser, bob)}), http.StatusOK, nil)
+	h.expect(h.do(http.MethodPost, revoke, "alice@example.com", map[string]interface{}{"user": ref(chaincode.AssetTypeUser, bob)}), http.StatusNotFound, nil)
+	h.expect(h.do(http.MethodPost, "/edittemplate", "bob@example.com", edit), http.StatusForbidden, nil)
+	h.expect(h.do(http.MethodPost, viewShared, "bob@example.com", nil), http.StatusForbidden, nil)
+
+	// Sharing the template emails an invitation
+	t.Setenv("INVITE_LINK", "https://example.com/templates/shared?token=")
+	h.expect(h.do(http.MethodPost, "/sharetemplate", "alice@example.com", map[string]interface{}{
+		"template": template, "users": []interface{}{ref(chaincode.AssetTypeUser, bob)},
+	}), http.StatusOK, nil)
+	if got := h.emails.to("bob@example.com"); len(got) != 1 || got[0] != "Template Invitation" {
+		t.Fatalf("expected bob to be emailed an invitation, got %v", got)
+	}
+	h.expect(h.do(http.MethodPost, viewShared, "bob@example.com", nil), http.StatusOK, nil)
+
+	grant("owner")
+	h.expect(h.do(http.MethodPost, "/removetemplate", "bob@example.com", map[string]interface{}{"template": template}), http.StatusOK, nil)
+}
@@ -0,0 +1,166 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/storage"
+)
+
+func TestVerifyDocument(t *testing.T) {
+	h := newHarness(t)
+	alice := h.user("Alice", "alice@example.com", "11111111111")
+
+	signed, err := os.ReadFile("../../pdfverify/testdata/signed.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	finalHash := fmt.Sprintf("%x", sha256.Sum256(signed))
+	if err := h.blobs.Put(context.Background(), "sign-documents/signed.pdf", bytes.NewReader(signed)); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := h.ledger.Put(map[string]interface{}{
+		"@assetType":   chaincode.AssetTypeDocument,
+		"originalHash": "0000",
+		"finalHash":    finalHash,
+		"finalDocURL":  "blob://sign-documents/signed.pdf",
+		"name":         "signed.pdf",
+		"status":       3,
+		"owner":        ref(chaincode.AssetTypeUser, alice),
+	})
+	docKey := doc["@key"].(string)
+
+	type verifyResponse struct {
+		Report struct {
+			Valid      bool `json:"valid"`
+			Signatures []struct {
+				SignatureValid bool `json:"signatureValid"`
+				Signer         struct {
+					Subject string `json:"subject"`
+				} `json:"signer"`
+			} `json:"signatures"`
+		} `json:"report"`
+		Ledger struct {
+			DocumentKey string `json:"documentKey"`
+			Matches     string `json:"matches"`
+		} `json:"ledger"`
+	}
+
+	var byKey verifyResponse
+	h.expect(h.do(http.MethodPost, "/verifydocument", "alice@example.com", url.Values{"key": {docKey}}), http.StatusOK, &byKey)
+	if !byKey.Report.Valid || len(byKey.Report.Signatures) != 1 || byKey.Report.Signatures[0].Signer.Subject == "" {
+		t.Fatalf("unexpected report %+v", byKey.Report)
+	}
+	if byKey.Ledger.DocumentKey != docKey || byKey.Ledger.Matches != "final" {
+		t.Fatalf("expected the signed file to match the ledger, got %+v", byKey.Ledger)
+	}
+
+	var byFile verifyResponse
+	h.expect(h.do(http.MethodPost, "/verifydocument", "alice@example.com", multipartForm{
+		files: []formFile{{field: "file", name: "signed.pdf", data: signed}},
+	}), http.StatusOK, &byFile)
+	if byFile.Ledger.DocumentKey != docKey || byFile.Ledger.Matches != "final" {
+		t.Fatalf("expected the uploaded file to be found by hash, got %+v", byFile.Ledger)
+	}
+
+	var unknown verifyResponse
+	tampered := append(append([]byte{}, signed...), []byte("\n%%EOF\n")...)
+	h.expect(h.do(http.MethodPost, "/verifydocument", "alice@example.com", multipartForm{
+		files: []formFile{{field: "file", name: "tampered.pdf", data: tampered}},
+	}), http.StatusOK, &unknown)
+	if unknown.Ledger.Matches != "none" || unknown.Ledger.DocumentKey != "" {
+		t.Fatalf("expected a modified file not to match the ledger, got %+v", unknown.Ledger)
+	}
+
+	h.expect(h.do(http.MethodPost, "/verifydocument", "alice@example.com", url.Values{}), http.StatusBadRequest, nil)
+}
+
+func TestPublicVerify(t *testing.T) {
+	t.Setenv("PUBLIC_VERIFY_RATE", "6")
+	h := newHarness(t)
+	signing := h.signingService("bob")
+
+	h.user("Alice", "alice@example.com", "11111111111")
+	bob := h.user("Bob", "bob@example.com", "22222222222")
+
+	var doc map[string]interface{}
+	h.expect(h.do(http.MethodPost, "/uploaddocument", "alice@example.com", multipartForm{
+		fields: url.Values{"requiredSignatures": {bob}, "timeout": {"2099-01-01T00:00:00Z"}},
+		files:  []formFile{{field: "files", name: "nda.pdf", data: []byte("%PDF-1.7")}},
+	}), http.StatusCreated, &doc)
+	docKey := doc["@key"].(string)
+
+	h.expect(h.do(http.MethodPost, "/signdocument", "bob@example.com", url.Values{
+		"dockey":    {docKey},
+		"password":  {"secret"},
+		"signature": {"{}"},
+		"username":  {"bob"},
+		"cpf":       {"22222222222"},
+	}), http.StatusOK, nil)
+	if got := signing.last().Get("ledgerKey"); got != docKey {
+		t.Fatalf("expected go-sign to receive the document key for the QR code, got %q", got)
+	}
+
+	// The QR code holds the id after the colon of the key
+	id := docKey[len("document:"):]
+
+	var verified struct {
+		Name      string `json:"name"`
+		Status    int    `json:"status"`
+		FinalHash string `json:"finalHash"`
+		Signers   []struct {
+			Key  string `json:"key"`
+			Name string `json:"name"`
+		} `json:"signers"`
+		Comparison *struct {
+			Matches string `json:"matches"`
+		} `json:"comparison"`
+	}
+	h.expect(h.do(http.MethodGet, "/public/verify/"+id, "", nil), http.StatusOK, &verified)
+	if verified.Name != "nda.pdf" || verified.Status != 3 || verified.FinalHash == "" || verified.Comparison != nil {
+		t.Fatalf("unexpected verification %+v", verified)
+	}
+	if len(verified.Signers) != 1 || verified.Signers[0].Key != bob || verified.Signers[0].Name != "Bob" {
+		t.Fatalf("expected bob to be listed as signer, got %+v", verified.Signers)
+	}
+
+	signedURL := h.asset(docKey)["finalDocURL"].(string)
+	signedKey := signedURL[len("blob://"):]
+	signed, err := storage.ReadAll(context.Background(), h.blobs, signedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.expect(h.do(http.MethodPost, "/public/verify/"+docKey, "", multipartForm{
+		files: []formFile{{field: "file", name: "nda.pdf", data: signed}},
+	}), http.StatusOK, &verified)
+	if verified.Comparison == nil || verified.Comparison.Matches != "final" {
+		t.Fatalf("expected the signed file to match, got %+v", verified.Comparison)
+	}
+
+	h.expect(h.do(http.MethodPost, "/public/verify/"+docKey, "", multipartForm{
+		files: []formFile{{field: "file", name: "forged.pdf", data: []byte("%PDF-1.7 forged")}},
+	}), http.StatusOK, &verified)
+	if verified.Comparison.Matches != "none" {
+		t.Fatalf("expected a forged file not to match, got %+v", verified.Comparison)
+	}
+
+	h.expect(h.do(http.MethodGet, "/public/verify/missing", "", nil), http.StatusNotFound, nil)
+
+	// Six requests per minute are allowed, and four have been made
+	h.expect(h.do(http.MethodGet, "/public/verify/"+id, "", nil), http.StatusOK, nil)
+	h.expect(h.do(http.MethodGet, "/public/verify/"+id, "", nil), http.StatusOK, nil)
+	rec := h.do(http.MethodGet, "/public/verify/"+id, "", nil)
+	h.expect(rec, http.StatusTooManyRequests, nil)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+}
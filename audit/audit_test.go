@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+func record(t *testing.T, txID string, seconds int64, doc map[string]interface{}) chaincode.DocumentHistoryRecord {
+	t.Helper()
+
+	value, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chaincode.DocumentHistoryRecord{
+		TxID:      txID,
+		Timestamp: fmt.Sprintf("seconds:%d nanos:0", seconds),
+		Value:     value,
+	}
+}
+
+func document(status int, name, timeout string, signed, rejected []string) map[string]interface{} {
+	refs := func(keys []string) []interface{} {
+		out := []interface{}{}
+		for _, k := range keys {
+			out = append(out, map[string]interface{}{"@key": k})
+		}
+		return out
+	}
+	return map[string]interface{}{
+		"name":                 name,
+		"status":               status,
+		"timeout":              timeout,
+		"originalHash":         "abc",
+		"owner":                map[string]interface{}{"@key": "user:alice"},
+		"requiredSignatures":   refs([]string{"user:bob", "user:carol"}),
+		"successfulSignatures": refs(signed),
+		"rejectedSignatures":   refs(rejected),
+	}
+}
+
+func TestTrail(t *testing.T) {
+	history := []chaincode.DocumentHistoryRecord{
+		// Newest first, as the ledger may return them
+		record(t, "tx5", 500, document(4, "lease-v2.pdf", "2099-02-01", []string{"user:bob"}, []string{"user:carol"})),
+		record(t, "tx4", 400, document(0, "lease-v2.pdf", "2099-02-01", []string{"user:bob"}, nil)),
+		record(t, "tx3", 300, document(0, "lease-v2.pdf", "2099-02-01", nil, nil)),
+		record(t, "tx2", 200, document(0, "lease-v2.pdf", "2099-01-01", nil, nil)),
+		record(t, "tx1", 100, document(0, "lease.pdf", "2099-01-01", nil, nil)),
+	}
+	names := func(key string) string {
+		return map[string]string{"user:alice": "Alice", "user:bob": "Bob"}[key]
+	}
+
+	events, err := Trail(history, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ eventType, txID, message string }{
+		{EventUploaded, "tx1", `Uploaded "lease.pdf"`},
+		{EventRenamed, "tx2", `Renamed from "lease.pdf" to "lease-v2.pdf"`},
+		{EventTimeoutChanged, "tx3", "Signing deadline changed from 2099-01-01 to 2099-02-01"},
+		{EventSigned, "tx4", "Signed by Bob"},
+		{EventRejected, "tx5", "Rejected by user:carol"},
+		{EventFinalizedWithRejection, "tx5", "Finalized with rejections"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, w := range want {
+		got := events[i]
+		if got.Type != w.eventType || got.TxID != w.txID || got.Message != w.message {
+			t.Errorf("event %d: expected %+v, got %+v", i, w, got)
+		}
+	}
+	if events[0].Actor != "user:alice" || events[0].ActorName != "Alice" {
+		t.Errorf("expected the upload to be attributed to alice, got %+v", events[0])
+	}
+	if !events[0].Timestamp.Equal(time.Unix(100, 0)) {
+		t.Errorf("unexpected timestamp %v", events[0].Timestamp)
+	}
+}
+
+func TestTrailStatusChanges(t *testing.T) {
+	for status, eventType := range map[int]string{1: EventCancelled, 2: EventExpired, 3: EventCompleted} {
+		events, err := Trail([]chaincode.DocumentHistoryRecord{
+			record(t, "tx1", 100, document(0, "a.pdf", "2099-01-01", nil, nil)),
+			record(t, "tx2", 200, document(status, "a.pdf", "2099-01-01", nil, nil)),
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[1].Type != eventType {
+			t.Errorf("status %d: expected a %s event, got %+v", status, eventType, events)
+		}
+	}
+}
+
+func TestCertificateSignature(t *testing.T) {
+	doc := chaincode.FileAsset{Name: "lease.pdf", OriginalHash: "abc", FinalHash: "def", Status: 3}
+	events := []Event{{Type: EventSigned, TxID: "tx1", Message: "Signed by Bob"}}
+	cert := NewCertificate("document:1", doc, events, time.Unix(1000, 0))
+
+	key := []byte("secret")
+	if err := cert.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Verify(key); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	// The signature survives a JSON round trip
+	raw, _ := json.Marshal(cert)
+	var decoded Certificate
+	json.Unmarshal(raw, &decoded)
+	if err := decoded.Verify(key); err != nil {
+		t.Fatalf("expected the decoded certificate to verify, got %v", err)
+	}
+
+	decoded.Events[0].Message = "Signed by Mallory"
+	if err := decoded.Verify(key); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected a tampered certificate to be rejected, got %v", err)
+	}
+	if err := cert.Verify([]byte("other")); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected another key to be rejected, got %v", err)
+	}
+}
+
+func TestCertificatePDF(t *testing.T) {
+	var events []Event
+	for i := 0; i < 40; i++ {
+		events = append(events, Event{TxID: "tx" + strconv.Itoa(i), Message: "Signed by Zoë (legal)"})
+	}
+	cert := NewCertificate("document:1", chaincode.FileAsset{Name: "lease.pdf"}, events, time.Unix(1000, 0))
+	cert.Sign([]byte("secret"))
+
+	pdf := cert.PDF()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("expected a complete PDF")
+	}
+	if !bytes.Contains(pdf, []byte(`Signed by Zo\353 \(legal\)`)) {
+		t.Fatal("expected escaped Latin-1 text")
+	}
+	if !bytes.Contains(pdf, []byte("/Count 2")) {
+		t.Fatal("expected the trail to span two pages")
+	}
+
+	// startxref must point at the cross reference table
+	i := bytes.LastIndex(pdf, []byte("startxref\n"))
+	var offset int
+	fmt.Sscanf(string(pdf[i+len("startxref\n"):]), "%d", &offset)
+	if !bytes.HasPrefix(pdf[offset:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", offset)
+	}
+}
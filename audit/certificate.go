@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+// SignatureAlgorithm is the algorithm of certificate stamps
+const SignatureAlgorithm = "HMAC-SHA256"
+
+// ErrInvalidSignature is returned by Verify for tampered certificates
+var ErrInvalidSignature = errors.New("invalid certificate signature")
+
+// Certificate of completion of a document, listing its audit trail. It is a
+// report stamped with an HMAC of the API, not a digital signature: only the
+// holder of the key it was signed with can verify it.
+type Certificate struct {
+	DocumentKey  string    `json:"documentKey"`
+	DocumentName string    `json:"documentName"`
+	Status       int       `json:"status"`
+	OriginalHash string    `json:"originalHash"`
+	FinalHash    string    `json:"finalHash,omitempty"`
+	Signers      []string  `json:"signers"`
+	Events       []Event   `json:"events"`
+	IssuedAt     time.Time `json:"issuedAt"`
+
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+// Signature is the HMAC stamp that authenticates a certificate issued by this
+// API
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"value"`
+}
+
+// NewCertificate returns the unsigned certificate of a document
+func NewCertificate(key string, doc chaincode.FileAsset, events []Event, issuedAt time.Time) *Certificate {
+	signers := make([]string, 0, len(doc.RequiredSignatures))
+	for _, s := range doc.RequiredSignatures {
+		signers = append(signers, s.Key)
+	}
+
+	return &Certificate{
+		DocumentKey:  key,
+		DocumentName: doc.Name,
+		Status:       doc.Status,
+		OriginalHash: doc.OriginalHash,
+		FinalHash:    doc.FinalHash,
+		Signers:      signers,
+		Events:       events,
+		IssuedAt:     issuedAt.UTC(),
+	}
+}
+
+// Sign sets the signature of the certificate, computed over its JSON encoding
+// without the signature
+func (c *Certificate) Sign(key []byte) error {
+	mac, err := c.mac(key)
+	if err != nil {
+		return err
+	}
+
+	c.Signature = &Signature{Algorithm: SignatureAlgorithm, Value: hex.EncodeToString(mac)}
+	return nil
+}
+
+// Verify checks that the certificate was signed with key and not modified since
+func (c *Certificate) Verify(key []byte) error {
+	if c.Signature == nil || c.Signature.Algorithm != SignatureAlgorithm {
+		return ErrInvalidSignature
+	}
+
+	got, err := hex.DecodeString(c.Signature.Value)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	want, err := c.mac(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(got, want) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (c *Certificate) mac(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errors.New("missing certificate signing key")
+	}
+
+	unsigned := *c
+	unsigned.Signature = nil
+	payload, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hmac.New(sha256.New, key)
+	h.Write(payload)
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	pageWidth    = 595 // A4 in points
+	pageHeight   = 842
+	margin       = 50
+	lineHeight   = 14
+	fontSize     = 10
+	maxLineChars = 95
+	linesPerPage = (pageHeight - 2*margin) / lineHeight
+)
+
+// PDF renders the certificate as a plain PDF report, which carries no PDF
+// signature. The HMAC stamp printed at the end covers the JSON encoding of
+// the certificate, and is verified by the API that issued it.
+func (c *Certificate) PDF() []byte {
+	lines := []string{
+		"Audit report: certificate of completion",
+		"",
+		"Document: " + c.DocumentName,
+		"Key: " + c.DocumentKey,
+		"Original SHA-256: " + c.OriginalHash,
+	}
+	if c.FinalHash != "" {
+		lines = append(lines, "Signed SHA-256: "+c.FinalHash)
+	}
+	lines = append(lines,
+		"Signers: "+strings.Join(c.Signers, ", "),
+		"Issued at: "+c.IssuedAt.Format(time.RFC3339),
+		"",
+		"Audit trail",
+		"",
+	)
+	for _, event := range c.Events {
+		lines = append(lines, fmt.Sprintf("%s  %s", event.Timestamp.UTC().Format(time.RFC3339), event.Message))
+		lines = append(lines, "    transaction "+event.TxID)
+	}
+	if c.Signature != nil {
+		lines = append(lines, "", "Stamp ("+c.Signature.Algorithm+" of the JSON certificate, verified by the issuing API):", c.Signature.Value)
+	}
+
+	return renderPDF(wrap(lines))
+}
+
+func wrap(lines []string) []string {
+	var wrapped []string
+	for _, line := range lines {
+		for utf8.RuneCountInString(line) > maxLineChars {
+			runes := []rune(line)
+			wrapped = append(wrapped, string(runes[:maxLineChars]))
+			line = "    " + string(runes[maxLineChars:])
+		}
+		wrapped = append(wrapped, line)
+	}
+	return wrapped
+}
+
+// renderPDF writes lines of Helvetica text on as many pages as needed
+func renderPDF(lines []string) []byte {
+	var pages [][]string
+	for len(lines) > linesPerPage {
+		pages = append(pages, lines[:linesPerPage])
+		lines = lines[linesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// Objects 1 and 2 are the catalog and the page tree, 3 is the font, and
+	// each page is followed by its content stream
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	)
+
+	for i, page := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", fontSize, lineHeight, margin, pageHeight-margin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", escapePDFString(line))
+		}
+		content.WriteString("ET")
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return out.Bytes()
+}
+
+// escapePDFString escapes a literal string in the WinAnsi encoding of the
+// font. Characters outside Latin-1 are replaced with '?'.
+func escapePDFString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
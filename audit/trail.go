@@ -0,0 +1,187 @@
+// Package audit turns the ledger history of documents into audit events and
+// certificates of completion
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+// Event types
+const (
+	EventUploaded               = "uploaded"
+	EventSigned                 = "signed"
+	EventRejected               = "rejected"
+	EventRenamed                = "renamed"
+	EventTimeoutChanged         = "timeoutChanged"
+	EventExpired                = "expired"
+	EventCancelled              = "cancelled"
+	EventCompleted              = "completed"
+	EventFinalizedWithRejection = "finalizedWithRejections"
+	EventDeleted                = "deleted"
+)
+
+// Document status values stored on the ledger
+const (
+	statusPending   = 0
+	statusCancelled = 1
+	statusExpired   = 2
+	statusSigned    = 3
+	statusRejected  = 4
+)
+
+// Event is a change of a document between two ledger versions
+type Event struct {
+	Type      string            `json:"type"`
+	TxID      string            `json:"txId"`
+	Timestamp time.Time         `json:"timestamp"`
+	Actor     string            `json:"actor,omitempty"`
+	ActorName string            `json:"actorName,omitempty"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// NameResolver returns the display name of a user key, or "" when unknown
+type NameResolver func(key string) string
+
+// Trail diffs consecutive versions of a document into events, oldest first
+func Trail(history []chaincode.DocumentHistoryRecord, names NameResolver) ([]Event, error) {
+	type version struct {
+		record chaincode.DocumentHistoryRecord
+		at     time.Time
+		doc    chaincode.FileAsset
+	}
+
+	versions := make([]version, 0, len(history))
+	for _, record := range history {
+		at, err := record.Time()
+		if err != nil {
+			return nil, err
+		}
+
+		v := version{record: record, at: at}
+		if !record.IsDeleted && len(record.Value) > 0 {
+			if err := json.Unmarshal(record.Value, &v.doc); err != nil {
+				return nil, fmt.Errorf("invalid document version %s: %w", record.TxID, err)
+			}
+		}
+		versions = append(versions, v)
+	}
+	// The ledger may list the history newest first
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].at.Before(versions[j].at) })
+
+	if names == nil {
+		names = func(string) string { return "" }
+	}
+	b := &builder{names: names}
+
+	var prev *chaincode.FileAsset
+	for i := range versions {
+		v := &versions[i]
+		b.txID, b.at = v.record.TxID, v.at
+
+		switch {
+		case v.record.IsDeleted:
+			b.add(EventDeleted, "", "Document deleted", nil)
+			prev = nil
+			continue
+		case prev == nil:
+			b.add(EventUploaded, v.doc.Owner.Key, fmt.Sprintf("Uploaded %q", v.doc.Name), map[string]string{
+				"name":         v.doc.Name,
+				"originalHash": v.doc.OriginalHash,
+			})
+		default:
+			b.diff(*prev, v.doc)
+		}
+		prev = &v.doc
+	}
+
+	return b.events, nil
+}
+
+type builder struct {
+	names  NameResolver
+	events []Event
+	txID   string
+	at     time.Time
+}
+
+func (b *builder) add(eventType, actor, message string, details map[string]string) {
+	event := Event{
+		Type:      eventType,
+		TxID:      b.txID,
+		Timestamp: b.at,
+		Actor:     actor,
+		Message:   message,
+		Details:   details,
+	}
+	if actor != "" {
+		event.ActorName = b.names(actor)
+	}
+	b.events = append(b.events, event)
+}
+
+// who returns the display name of a user, falling back to its key
+func (b *builder) who(key string) string {
+	if name := b.names(key); name != "" {
+		return name
+	}
+	return key
+}
+
+func (b *builder) diff(prev, next chaincode.FileAsset) {
+	for _, key := range added(prev.SuccessfulSignatures, next.SuccessfulSignatures) {
+		b.add(EventSigned, key, "Signed by "+b.who(key), map[string]string{"finalHash": next.FinalHash})
+	}
+	for _, key := range added(prev.RejectedSignatures, next.RejectedSignatures) {
+		b.add(EventRejected, key, "Rejected by "+b.who(key), nil)
+	}
+
+	if prev.Name != next.Name {
+		b.add(EventRenamed, next.Owner.Key, fmt.Sprintf("Renamed from %q to %q", prev.Name, next.Name), map[string]string{
+			"from": prev.Name,
+			"to":   next.Name,
+		})
+	}
+	if prev.Timeout != next.Timeout {
+		b.add(EventTimeoutChanged, next.Owner.Key, fmt.Sprintf("Signing deadline changed from %s to %s", prev.Timeout, next.Timeout), map[string]string{
+			"from": prev.Timeout,
+			"to":   next.Timeout,
+		})
+	}
+
+	if prev.Status == next.Status {
+		return
+	}
+	switch next.Status {
+	case statusCancelled:
+		b.add(EventCancelled, next.Owner.Key, "Cancelled by "+b.who(next.Owner.Key), nil)
+	case statusExpired:
+		b.add(EventExpired, "", "Expired before every signer signed", map[string]string{"timeout": next.Timeout})
+	case statusSigned:
+		b.add(EventCompleted, "", "Signed by every required signer", map[string]string{"finalHash": next.FinalHash})
+	case statusRejected:
+		b.add(EventFinalizedWithRejection, "", "Finalized with rejections", nil)
+	}
+}
+
+// added returns the keys of next missing from prev
+func added(prev, next []chaincode.Signer) []string {
+	seen := make(map[string]bool, len(prev))
+	for _, s := range prev {
+		seen[s.Key] = true
+	}
+
+	var keys []string
+	for _, s := range next {
+		if !seen[s.Key] {
+			keys = append(keys, s.Key)
+			seen[s.Key] = true
+		}
+	}
+	return keys
+}
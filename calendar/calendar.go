@@ -0,0 +1,226 @@
+// Package calendar collects the dates of the contracts and documents of a
+// user into calendar events, and writes them as an iCalendar (RFC 5545) feed
+// that calendar apps subscribe to
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+// EventType is the kind of date of a calendar event
+type EventType string
+
+// Kinds of calendar events
+const (
+	// EventSignature is the signature date of a contract
+	EventSignature EventType = "signature"
+	// EventContractDate is a date of the dates map of a contract
+	EventContractDate EventType = "contractDate"
+	// EventReferenceDate is the reference date given to a check date
+	// interval clause
+	EventReferenceDate EventType = "referenceDate"
+	// EventEvaluationDate is the evaluation date given to a check date
+	// interval clause
+	EventEvaluationDate EventType = "evaluationDate"
+	// EventPaymentDue is a due date of a make payment clause, set by its
+	// dueDate or dueDates parameters
+	EventPaymentDue EventType = "paymentDue"
+	// EventDocumentTimeout is the signing deadline of a pending document
+	EventDocumentTimeout EventType = "documentTimeout"
+)
+
+// pendingDocument is the status of the documents awaiting signatures
+const pendingDocument = 0
+
+// Event is a date of a contract or a document
+type Event struct {
+	// UID identifies the event across feeds, so that calendar apps update it
+	// instead of adding it again
+	UID   string    `json:"uid"`
+	Type  EventType `json:"type"`
+	Title string    `json:"title"`
+	Start time.Time `json:"start"`
+	// AllDay tells whether the date had no time of day
+	AllDay      bool   `json:"allDay"`
+	ContractKey string `json:"contractKey,omitempty"`
+	ClauseKey   string `json:"clauseKey,omitempty"`
+	DocumentKey string `json:"documentKey,omitempty"`
+}
+
+// ContractEvents returns the dates of a contract and of its clauses. Dates
+// that cannot be parsed are skipped.
+func ContractEvents(contract chaincode.AutoExecutableContract, clauses []chaincode.Clause) []Event {
+	var events []Event
+	add := func(eventType EventType, clauseKey, name, value, title string) {
+		start, allDay, ok := ParseDate(value)
+		if !ok {
+			return
+		}
+		source := contract.Key
+		if clauseKey != "" {
+			source = clauseKey
+		}
+		events = append(events, Event{
+			UID:         eventUID(eventType, source, name),
+			Type:        eventType,
+			Title:       title,
+			Start:       start,
+			AllDay:      allDay,
+			ContractKey: contract.Key,
+			ClauseKey:   clauseKey,
+		})
+	}
+
+	add(EventSignature, "", "", contract.SignatureDate, "Signature of "+contract.Name)
+	for _, date := range flattenDates("", contract.Dates) {
+		add(EventContractDate, "", date.name, date.value, fmt.Sprintf("%s of %s", date.name, contract.Name))
+	}
+
+	for _, clause := range clauses {
+		label := clauseLabel(clause)
+		if date, ok := clause.Input["referenceDate"].(string); ok {
+			add(EventReferenceDate, clause.Key, "", date, fmt.Sprintf("Reference date of %s in %s", label, contract.Name))
+		}
+		if date, ok := clause.Input["evaluatedDate"].(string); ok {
+			add(EventEvaluationDate, clause.Key, "", date, fmt.Sprintf("Evaluation of %s in %s", label, contract.Name))
+		}
+		if clause.ActionType == chaincode.ActionMakePayment {
+			for i, date := range dueDates(clause) {
+				add(EventPaymentDue, clause.Key, fmt.Sprint(i), date, fmt.Sprintf("Payment of %s due in %s", label, contract.Name))
+			}
+		}
+	}
+	return events
+}
+
+// DocumentEvents returns the signing deadline of a document, while it awaits
+// signatures
+func DocumentEvents(document map[string]interface{}) []Event {
+	if status, _ := document["status"].(float64); status != pendingDocument {
+		return nil
+	}
+	key, _ := document["@key"].(string)
+	timeout, _ := document["timeout"].(string)
+	start, allDay, ok := ParseDate(timeout)
+	if key == "" || !ok {
+		return nil
+	}
+
+	name, _ := document["name"].(string)
+	if name == "" {
+		name = key
+	}
+	return []Event{{
+		UID:         eventUID(EventDocumentTimeout, key, ""),
+		Type:        EventDocumentTimeout,
+		Title:       "Signing deadline of " + name,
+		Start:       start,
+		AllDay:      allDay,
+		DocumentKey: key,
+	}}
+}
+
+// Between returns the events from from until to, sorted by date, without
+// the events found more than once. Zero bounds are open.
+func Between(events []Event, from, to time.Time) []Event {
+	seen := make(map[string]bool, len(events))
+	list := []Event{}
+	for _, event := range events {
+		if seen[event.UID] || (!from.IsZero() && event.Start.Before(from)) || (!to.IsZero() && event.Start.After(to)) {
+			continue
+		}
+		seen[event.UID] = true
+		list = append(list, event)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Start.Before(list[j].Start)
+	})
+	return list
+}
+
+// dateLayouts are the layouts of the dates of the ledger, the date only one
+// last
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// ParseDate parses a date of the ledger, which is either a time such as
+// "2024-01-02T15:04:05Z" or a date such as "2024-01-02". Times without a
+// zone are in UTC.
+func ParseDate(value string) (t time.Time, allDay bool, ok bool) {
+	value = strings.TrimSpace(value)
+	for i, layout := range dateLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.UTC(), i == len(dateLayouts)-1, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+type namedDate struct {
+	name, value string
+}
+
+// flattenDates returns the dates of a dates map, which may group them by
+// clause, named after their path in the map
+func flattenDates(prefix string, dates map[string]interface{}) []namedDate {
+	names := make([]string, 0, len(dates))
+	for name := range dates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var list []namedDate
+	for _, name := range names {
+		path := name
+		if prefix != "" {
+			path = prefix + " " + name
+		}
+		switch v := dates[name].(type) {
+		case string:
+			list = append(list, namedDate{path, v})
+		case map[string]interface{}:
+			list = append(list, flattenDates(path, v)...)
+		}
+	}
+	return list
+}
+
+// dueDates returns the due dates set by the parameters of a make payment
+// clause
+func dueDates(clause chaincode.Clause) []string {
+	var dates []string
+	if date, ok := clause.Parameters["dueDate"].(string); ok {
+		dates = append(dates, date)
+	}
+	if list, ok := clause.Parameters["dueDates"].([]interface{}); ok {
+		for _, v := range list {
+			if date, ok := v.(string); ok {
+				dates = append(dates, date)
+			}
+		}
+	}
+	return dates
+}
+
+func clauseLabel(clause chaincode.Clause) string {
+	switch {
+	case clause.Description != "":
+		return clause.Description
+	case clause.Id != "":
+		return "clause " + clause.Id
+	default:
+		return "clause " + clause.Key
+	}
+}
+
+func eventUID(eventType EventType, source, name string) string {
+	uid := string(eventType) + "-" + source
+	if name != "" {
+		uid += "-" + name
+	}
+	return strings.ReplaceAll(uid, " ", "_") + "@clausia"
+}
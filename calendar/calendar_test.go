@@ -0,0 +1,186 @@
+package calendar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+func TestContractEvents(t *testing.T) {
+	contract := chaincode.AutoExecutableContract{
+		Key:           "autoExecutableContract:lease",
+		Name:          "Lease",
+		SignatureDate: "2024-01-01T10:00:00Z",
+		Dates: map[string]interface{}{
+			"endDate": "2024-12-31",
+			"clause:interval": map[string]interface{}{
+				"startDate": "2024-02-01T09:30:00",
+				"note":      "not a date",
+			},
+			"count": 3.0,
+		},
+	}
+	clauses := []chaincode.Clause{
+		{
+			Key:         "clause:interval",
+			Id:          "interval",
+			Description: "Delivery window",
+			ActionType:  chaincode.ActionCheckDateInterval,
+			Input:       map[string]interface{}{"referenceDate": "2024-03-01", "evaluatedDate": "2024-03-10T12:00:00Z"},
+		},
+		{
+			Key:        "clause:rent",
+			Id:         "rent",
+			ActionType: chaincode.ActionMakePayment,
+			Parameters: map[string]interface{}{"dueDate": "2024-02-05", "dueDates": []interface{}{"2024-03-05", 5.0, "someday"}},
+		},
+		{
+			// Only make payment clauses have due dates
+			Key:        "clause:fine",
+			ActionType: chaincode.ActionCheckFine,
+			Parameters: map[string]interface{}{"dueDate": "2024-02-05"},
+		},
+	}
+
+	events := ContractEvents(contract, clauses)
+	expected := []struct {
+		eventType EventType
+		uid       string
+		start     time.Time
+		allDay    bool
+		title     string
+	}{
+		{EventSignature, "signature-autoExecutableContract:lease@clausia", time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), false, "Signature of Lease"},
+		{EventContractDate, "contractDate-autoExecutableContract:lease-clause:interval_startDate@clausia", time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC), false, "clause:interval startDate of Lease"},
+		{EventContractDate, "contractDate-autoExecutableContract:lease-endDate@clausia", time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), true, "endDate of Lease"},
+		{EventReferenceDate, "referenceDate-clause:interval@clausia", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), true, "Reference date of Delivery window in Lease"},
+		{EventEvaluationDate, "evaluationDate-clause:interval@clausia", time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC), false, "Evaluation of Delivery window in Lease"},
+		{EventPaymentDue, "paymentDue-clause:rent-0@clausia", time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC), true, "Payment of clause rent due in Lease"},
+		{EventPaymentDue, "paymentDue-clause:rent-1@clausia", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), true, "Payment of clause rent due in Lease"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+	for i, e := range expected {
+		event := events[i]
+		if event.Type != e.eventType || event.UID != e.uid || !event.Start.Equal(e.start) || event.AllDay != e.allDay || event.Title != e.title || event.ContractKey != contract.Key {
+			t.Errorf("event %d: expected %+v, got %+v", i, e, event)
+		}
+	}
+}
+
+func TestDocumentEvents(t *testing.T) {
+	document := map[string]interface{}{
+		"@key":    "document:lease",
+		"name":    "lease.pdf",
+		"status":  0.0,
+		"timeout": "2024-05-01T18:00:00Z",
+	}
+	events := DocumentEvents(document)
+	if len(events) != 1 || events[0].Type != EventDocumentTimeout || events[0].DocumentKey != "document:lease" || events[0].Title != "Signing deadline of lease.pdf" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	// Signed and expired documents have no deadline
+	document["status"] = 1.0
+	if events := DocumentEvents(document); len(events) != 0 {
+		t.Fatalf("expected no events, got %+v", events)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	events := []Event{
+		{UID: "c", Start: day(20)},
+		{UID: "a", Start: day(1)},
+		{UID: "b", Start: day(10)},
+		{UID: "b", Start: day(10)},
+	}
+
+	got := Between(events, day(5), day(20))
+	if len(got) != 2 || got[0].UID != "b" || got[1].UID != "c" {
+		t.Fatalf("unexpected events %+v", got)
+	}
+	if got := Between(events, time.Time{}, time.Time{}); len(got) != 3 || got[0].UID != "a" {
+		t.Fatalf("unexpected events %+v", got)
+	}
+	if got := Between(nil, time.Time{}, time.Time{}); got == nil {
+		t.Fatal("expected an empty list")
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	events := []Event{
+		{
+			UID:         "referenceDate-clause:interval@clausia",
+			Type:        EventReferenceDate,
+			Title:       "Reference date of Delivery, pickup; returns in Lease",
+			Start:       time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			AllDay:      true,
+			ContractKey: "autoExecutableContract:lease",
+			ClauseKey:   "clause:interval",
+		},
+		{
+			UID:         "documentTimeout-document:lease@clausia",
+			Type:        EventDocumentTimeout,
+			Title:       "Signing deadline of " + strings.Repeat("contrato de locação ", 5),
+			Start:       time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC),
+			DocumentKey: "document:lease",
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteICS(&buf, "Clausia", events, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	ics := buf.String()
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line longer than %d octets: %q", maxLineOctets, line)
+		}
+		if strings.Contains(line, "\n") {
+			t.Errorf("line not ended with CRLF: %q", line)
+		}
+	}
+
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"DTSTAMP:20240101T000000Z\r\n",
+		"DTSTART;VALUE=DATE:20240301\r\nDTEND;VALUE=DATE:20240302\r\n",
+		`SUMMARY:Reference date of Delivery\, pickup\; returns in Lease` + "\r\n",
+		`DESCRIPTION:Contract: autoExecutableContract:lease\nClause: clause:interval` + "\r\n",
+		"DTSTART:20240501T180000Z\r\n",
+		"SUMMARY:Signing deadline of " + strings.Repeat("contrato de locação ", 5) + "\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Errorf("expected %q in\n%s", want, unfolded)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		want   time.Time
+		allDay bool
+	}{
+		{"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), true},
+		{"2024-01-02T15:04:05Z", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), false},
+		{"2024-01-02T15:04:05-03:00", time.Date(2024, 1, 2, 18, 4, 5, 0, time.UTC), false},
+		{"2024-01-02T15:04", time.Date(2024, 1, 2, 15, 4, 0, 0, time.UTC), false},
+	} {
+		got, allDay, ok := ParseDate(tc.in)
+		if !ok || !got.Equal(tc.want) || allDay != tc.allDay {
+			t.Errorf("%s: got %s, %v, %v", tc.in, got, allDay, ok)
+		}
+	}
+	if _, _, ok := ParseDate("02/01/2024"); ok {
+		t.Error("expected an unknown layout to fail")
+	}
+}
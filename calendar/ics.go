@@ -0,0 +1,112 @@
+package calendar
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the length of the content lines of iCalendar, beyond
+// which they are folded
+const maxLineOctets = 75
+
+const (
+	icsDate     = "20060102"
+	icsDateTime = "20060102T150405Z"
+)
+
+// WriteICS writes events as an iCalendar feed named name. Calendar apps are
+// asked to refresh it hourly. now stamps the events.
+func WriteICS(w io.Writer, name string, events []Event, now time.Time) error {
+	out := &icsWriter{w: bufio.NewWriter(w)}
+	out.line("BEGIN:VCALENDAR")
+	out.line("VERSION:2.0")
+	out.line("PRODID:-//Clausia//Contract calendar//EN")
+	out.line("CALSCALE:GREGORIAN")
+	out.line("METHOD:PUBLISH")
+	out.line("X-WR-CALNAME:" + escapeText(name))
+	out.line("REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	out.line("X-PUBLISHED-TTL:PT1H")
+
+	stamp := now.UTC().Format(icsDateTime)
+	for _, event := range events {
+		out.line("BEGIN:VEVENT")
+		out.line("UID:" + escapeText(event.UID))
+		out.line("DTSTAMP:" + stamp)
+		if event.AllDay {
+			out.line("DTSTART;VALUE=DATE:" + event.Start.Format(icsDate))
+			out.line("DTEND;VALUE=DATE:" + event.Start.AddDate(0, 0, 1).Format(icsDate))
+		} else {
+			out.line("DTSTART:" + event.Start.UTC().Format(icsDateTime))
+			out.line("DTEND:" + event.Start.UTC().Format(icsDateTime))
+		}
+		out.line("SUMMARY:" + escapeText(event.Title))
+		out.line("CATEGORIES:" + escapeText(string(event.Type)))
+		if description := eventDescription(event); description != "" {
+			out.line("DESCRIPTION:" + escapeText(description))
+		}
+		out.line("TRANSP:TRANSPARENT")
+		out.line("END:VEVENT")
+	}
+
+	out.line("END:VCALENDAR")
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+func eventDescription(event Event) string {
+	var lines []string
+	if event.ContractKey != "" {
+		lines = append(lines, "Contract: "+event.ContractKey)
+	}
+	if event.ClauseKey != "" {
+		lines = append(lines, "Clause: "+event.ClauseKey)
+	}
+	if event.DocumentKey != "" {
+		lines = append(lines, "Document: "+event.DocumentKey)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// icsWriter writes content lines, ended with CRLF and folded at 75 octets,
+// keeping the first error
+type icsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (o *icsWriter) line(s string) {
+	if o.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(s) > limit {
+		// UTF-8 sequences are not split
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// Folded lines start with a space, which counts in their length
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+
+	_, o.err = o.w.WriteString(b.String())
+}
+
+// textEscaper escapes the TEXT values of iCalendar
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
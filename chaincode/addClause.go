@@ -1,47 +1,21 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func AddClause(reqMap map[string]interface{}) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/addClause"
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
+func AddClause(ctx context.Context, contract AssetRef, clause Clause) (*AutoExecutableContract, error) {
+	reqMap, err := toArgs(clause)
 	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
+		return nil, fmt.Errorf("failed to build clause request: %w", err)
 	}
+	reqMap["autoExecutableContract"] = contract
 
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to add clause to the contract")
-	}
-
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+	var resp AutoExecutableContract
+	if err := DefaultClient().Invoke(ctx, "addClause", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to add clause to the contract: %w", err)
 	}
 
-	return resp, nil
+	return &resp, nil
 }
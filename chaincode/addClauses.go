@@ -1,47 +1,29 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func AddClauses(reqMap map[string]interface{}) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/addClauses"
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
-	}
-
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to add clauses to the contract")
+func AddClauses(ctx context.Context, contract AssetRef, clauses []Clause) (*AutoExecutableContract, error) {
+	clauseArgs := make([]map[string]interface{}, 0, len(clauses))
+	for _, clause := range clauses {
+		args, err := toArgs(clause)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build clause request: %w", err)
+		}
+		clauseArgs = append(clauseArgs, args)
 	}
 
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	reqMap := map[string]interface{}{
+		"autoExecutableContract": contract,
+		"clauses":                clauseArgs,
 	}
 
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+	var resp AutoExecutableContract
+	if err := DefaultClient().Invoke(ctx, "addClauses", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to add clauses to the contract: %w", err)
 	}
 
-	return resp, nil
+	return &resp, nil
 }
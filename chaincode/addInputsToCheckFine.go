@@ -1,47 +1,32 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
 
-	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/money"
 )
 
-func AddInputsToCheckFine(reqMap map[string]interface{}) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/addInputToCheckFineClause"
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
-	}
-
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to add inputs to the clause")
-	}
-
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
+// FineInputs holds the inputs of a check fine clause. Nil values are left
+// unchanged on the ledger. The reference value is in the currency of the
+// clause, converted from the original amount with the rate kept beside it.
+type FineInputs struct {
+	Clause              AssetRef       `json:"clause"`
+	ReferenceValue      *money.Decimal `json:"referenceValue,omitempty"`
+	Currency            string         `json:"currency,omitempty"`
+	Original            *money.Money   `json:"original,omitempty"`
+	Rate                *money.Rate    `json:"rate,omitempty"`
+	DailyPercentage     *float64       `json:"dailyPercentage,omitempty"`
+	Days                *float64       `json:"days,omitempty"`
+	ReferenceClauseDays bool           `json:"referenceClauseDays,omitempty"`
+	ReferenceClauseName string         `json:"referenceClauseName,omitempty"`
+}
 
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+func AddInputsToCheckFine(ctx context.Context, inputs FineInputs) (*Clause, error) {
+	var resp Clause
+	if err := DefaultClient().Invoke(ctx, "addInputToCheckFineClause", inputs, &resp); err != nil {
+		return nil, fmt.Errorf("failed to add inputs to the clause: %w", err)
 	}
 
-	return resp, nil
+	return &resp, nil
 }
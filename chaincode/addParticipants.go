@@ -1,47 +1,20 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func AddParticipants(reqMap map[string]interface{}) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/addParticipants"
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
-	}
-
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to add participants to the contract")
-	}
-
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+func AddParticipants(ctx context.Context, contract AssetRef, participants []AssetRef) (*AutoExecutableContract, error) {
+	reqMap := map[string]interface{}{
+		"autoExecutableContract": contract,
+		"participants":           participants,
 	}
 
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+	var resp AutoExecutableContract
+	if err := DefaultClient().Invoke(ctx, "addParticipants", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to add participants to the contract: %w", err)
 	}
 
-	return resp, nil
+	return &resp, nil
 }
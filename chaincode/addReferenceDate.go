@@ -1,47 +1,20 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func AddReferenceDate(reqMap map[string]interface{}) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/addReferenceDateCDI"
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
-	}
-
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to add reference date to the clause")
-	}
-
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+func AddReferenceDate(ctx context.Context, clause AssetRef, referenceDate string) (*Clause, error) {
+	reqMap := map[string]interface{}{
+		"clause":        clause,
+		"referenceDate": referenceDate,
 	}
 
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+	var resp Clause
+	if err := DefaultClient().Invoke(ctx, "addReferenceDateCDI", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to add reference date to the clause: %w", err)
 	}
 
-	return resp, nil
+	return &resp, nil
 }
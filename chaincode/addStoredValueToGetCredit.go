@@ -1,47 +1,28 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
 
-	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/money"
 )
 
-func AddStoredValueToGetCredit(reqMap map[string]interface{}) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/addStoredValueToGetCredit"
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
-	}
-
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to add stored value to the clause")
-	}
-
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
+// CreditInputs holds the stored value of a get credit clause, in the
+// currency of the clause, converted from the original amount with the rate
+// kept beside it
+type CreditInputs struct {
+	Clause      AssetRef      `json:"clause"`
+	StoredValue money.Decimal `json:"storedValue"`
+	Currency    string        `json:"currency"`
+	Original    *money.Money  `json:"original,omitempty"`
+	Rate        *money.Rate   `json:"rate,omitempty"`
+}
 
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+func AddStoredValueToGetCredit(ctx context.Context, inputs CreditInputs) (*Clause, error) {
+	var resp Clause
+	if err := DefaultClient().Invoke(ctx, "addStoredValueToGetCredit", inputs, &resp); err != nil {
+		return nil, fmt.Errorf("failed to add stored value to the clause: %w", err)
 	}
 
-	return resp, nil
+	return &resp, nil
 }
@@ -0,0 +1,355 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/money"
+)
+
+const (
+	AssetTypeDocument       = "document"
+	AssetTypeUser           = "user"
+	AssetTypeContract       = "autoExecutableContract"
+	AssetTypeClause         = "clause"
+	AssetTypeTemplate       = "template"
+	AssetTypeTemplateClause = "templateClause"
+)
+
+// AssetRef references an asset stored on the ledger
+type AssetRef struct {
+	AssetType string `json:"@assetType,omitempty"`
+	Key       string `json:"@key" binding:"required"`
+}
+
+// ActionType identifies what a clause does when the contract is executed
+type ActionType int
+
+// Action types of the clauses executed by the chaincode
+const (
+	ActionCheckDateInterval ActionType = iota
+	ActionMakePayment
+	ActionCheckFine
+	ActionGetCredit
+	ActionCancelContract
+)
+
+// User is the ledger asset for a registered signer
+type User struct {
+	Key      string `json:"@key,omitempty"`
+	CPF      string `json:"cpf,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	UserName string `json:"userName,omitempty"`
+
+	// Extra holds the fields returned by the ledger that are not mapped above
+	Extra map[string]interface{} `json:"-"`
+}
+
+// Review is a rating left by a user on a contract
+type Review struct {
+	User     AssetRef  `json:"user"`
+	Rating   int       `json:"rating"`
+	Comments string    `json:"comments,omitempty"`
+	Date     time.Time `json:"date"`
+}
+
+// AutoExecutableContract is the ledger asset for a contract whose clauses are
+// executed by the chaincode
+type AutoExecutableContract struct {
+	Key           string                 `json:"@key,omitempty"`
+	Name          string                 `json:"name,omitempty"`
+	SignatureDate string                 `json:"signatureDate,omitempty"`
+	Owner         *AssetRef              `json:"owner,omitempty"`
+	Participants  []AssetRef             `json:"participants,omitempty"`
+	Clauses       []Clause               `json:"clauses,omitempty"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+	Dates         map[string]interface{} `json:"dates,omitempty"`
+	Reviews       []Review               `json:"reviews,omitempty"`
+
+	Extra map[string]interface{} `json:"-"`
+}
+
+// Clause is the ledger asset for a single clause of a contract. Clauses
+// referenced from a contract only carry their key.
+type Clause struct {
+	Key          string                 `json:"@key,omitempty"`
+	Id           string                 `json:"id,omitempty"`
+	Description  string                 `json:"description,omitempty"`
+	Category     string                 `json:"category,omitempty"`
+	ActionType   ActionType             `json:"actionType"`
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+	Input        map[string]interface{} `json:"input,omitempty"`
+	Result       map[string]interface{} `json:"result,omitempty"`
+	Dependencies []AssetRef             `json:"dependencies,omitempty"`
+	Executable   bool                   `json:"executable,omitempty"`
+	Finalized    bool                   `json:"finalized,omitempty"`
+
+	Extra map[string]interface{} `json:"-"`
+}
+
+// Template is the ledger asset for a reusable contract template
+type Template struct {
+	Key         string           `json:"@key,omitempty"`
+	Id          string           `json:"id,omitempty"`
+	Name        string           `json:"name,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Public      bool             `json:"public"`
+	Creator     *AssetRef        `json:"creator,omitempty"`
+	Clauses     []TemplateClause `json:"clauses,omitempty"`
+
+	Extra map[string]interface{} `json:"-"`
+}
+
+// TemplateClause is the ledger asset for a clause of a template
+type TemplateClause struct {
+	Key               string                 `json:"@key,omitempty"`
+	Id                string                 `json:"id,omitempty"`
+	Template          *AssetRef              `json:"template,omitempty"`
+	Number            float64                `json:"number"`
+	Name              string                 `json:"name,omitempty"`
+	Description       string                 `json:"description,omitempty"`
+	Category          string                 `json:"category,omitempty"`
+	ActionType        ActionType             `json:"actionType"`
+	Dependencies      []AssetRef             `json:"dependencies,omitempty"`
+	DefaultInputs     map[string]interface{} `json:"defaultInputs,omitempty"`
+	DefaultParameters map[string]interface{} `json:"defaultParameters,omitempty"`
+	Optional          *bool                  `json:"optional,omitempty"`
+
+	Extra map[string]interface{} `json:"-"`
+}
+
+// Payment holds the inputs of a make payment clause. The payment is in the
+// currency of the clause, converted from the amount paid with the rate kept
+// beside it.
+type Payment struct {
+	Clause   AssetRef      `json:"clause"`
+	Payment  money.Decimal `json:"payment"`
+	Currency string        `json:"currency"`
+	// Original is the amount paid, when it was in another currency
+	Original            *money.Money `json:"original,omitempty"`
+	Rate                *money.Rate  `json:"rate,omitempty"`
+	FinalPayment        bool         `json:"finalPayment"`
+	Date                string       `json:"date"`
+	ReceiptURL          string       `json:"receiptUrl,omitempty"`
+	ReceiptHash         string       `json:"receiptHash,omitempty"`
+	StripeToken         string       `json:"stripeToken,omitempty"`
+	PayPalTransactionID string       `json:"payPalTransactionID,omitempty"`
+}
+
+// UserRef returns a reference to the user with the given key
+func UserRef(key string) AssetRef {
+	return AssetRef{AssetType: AssetTypeUser, Key: key}
+}
+
+func (u User) Ref() AssetRef {
+	return AssetRef{AssetType: AssetTypeUser, Key: u.Key}
+}
+
+func (c AutoExecutableContract) Ref() AssetRef {
+	return AssetRef{AssetType: AssetTypeContract, Key: c.Key}
+}
+
+func (c Clause) Ref() AssetRef {
+	return AssetRef{AssetType: AssetTypeClause, Key: c.Key}
+}
+
+// Currency returns the currency of the amounts of the clause, set by its
+// currency parameter, or the default currency
+func (c Clause) Currency() string {
+	if code, ok := c.Parameters["currency"].(string); ok {
+		if currency, err := money.Currency(code); err == nil {
+			return currency
+		}
+	}
+	return money.DefaultCurrency()
+}
+
+func (t Template) Ref() AssetRef {
+	return AssetRef{AssetType: AssetTypeTemplate, Key: t.Key}
+}
+
+func (t TemplateClause) Ref() AssetRef {
+	return AssetRef{AssetType: AssetTypeTemplateClause, Key: t.Key}
+}
+
+// OwnerKey returns the key of the contract owner, or an empty string
+func (c AutoExecutableContract) OwnerKey() string {
+	if c.Owner == nil {
+		return ""
+	}
+	return c.Owner.Key
+}
+
+// HasParticipant reports whether userKey is a participant of the contract
+func (c AutoExecutableContract) HasParticipant(userKey string) bool {
+	for _, p := range c.Participants {
+		if p.Key == userKey {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatorKey returns the key of the template creator, or an empty string
+func (t Template) CreatorKey() string {
+	if t.Creator == nil {
+		return ""
+	}
+	return t.Creator.Key
+}
+
+func (u User) MarshalJSON() ([]byte, error) {
+	type alias User
+	return marshalAsset(AssetTypeUser, alias(u), u.Extra)
+}
+
+func (u *User) UnmarshalJSON(data []byte) error {
+	type alias User
+	return unmarshalAsset(data, (*alias)(u), &u.Extra)
+}
+
+func (c AutoExecutableContract) MarshalJSON() ([]byte, error) {
+	type alias AutoExecutableContract
+	return marshalAsset(AssetTypeContract, alias(c), c.Extra)
+}
+
+func (c *AutoExecutableContract) UnmarshalJSON(data []byte) error {
+	type alias AutoExecutableContract
+	return unmarshalAsset(data, (*alias)(c), &c.Extra)
+}
+
+func (c Clause) MarshalJSON() ([]byte, error) {
+	type alias Clause
+	// The zero action type and number are valid, so only references leave
+	// them out
+	if reflect.DeepEqual(c, Clause{Key: c.Key}) {
+		return json.Marshal(AssetRef{AssetType: AssetTypeClause, Key: c.Key})
+	}
+	return marshalAsset(AssetTypeClause, alias(c), c.Extra)
+}
+
+func (c *Clause) UnmarshalJSON(data []byte) error {
+	type alias Clause
+	return unmarshalAsset(data, (*alias)(c), &c.Extra)
+}
+
+func (t Template) MarshalJSON() ([]byte, error) {
+	type alias Template
+	return marshalAsset(AssetTypeTemplate, alias(t), t.Extra)
+}
+
+func (t *Template) UnmarshalJSON(data []byte) error {
+	type alias Template
+	return unmarshalAsset(data, (*alias)(t), &t.Extra)
+}
+
+func (t TemplateClause) MarshalJSON() ([]byte, error) {
+	type alias TemplateClause
+	if reflect.DeepEqual(t, TemplateClause{Key: t.Key}) {
+		return json.Marshal(AssetRef{AssetType: AssetTypeTemplateClause, Key: t.Key})
+	}
+	return marshalAsset(AssetTypeTemplateClause, alias(t), t.Extra)
+}
+
+func (t *TemplateClause) UnmarshalJSON(data []byte) error {
+	type alias TemplateClause
+	return unmarshalAsset(data, (*alias)(t), &t.Extra)
+}
+
+// marshalAsset encodes v, which must be a struct without its own MarshalJSON,
+// merges the unmapped ledger fields back in and stamps the @assetType
+func marshalAsset(assetType string, v interface{}, extra map[string]interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]interface{}, len(fields)+len(extra)+1)
+	for k, val := range extra {
+		out[k] = val
+	}
+	for k, val := range fields {
+		out[k] = val
+	}
+	out["@assetType"] = assetType
+
+	return json.Marshal(out)
+}
+
+// unmarshalAsset decodes data into v and keeps every field v does not map in extra
+func unmarshalAsset(data []byte, v interface{}, extra *map[string]interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v).Elem())
+	for k := range all {
+		if known[k] || k == "@assetType" {
+			delete(all, k)
+		}
+	}
+
+	if len(all) == 0 {
+		*extra = nil
+	} else {
+		*extra = all
+	}
+	return nil
+}
+
+var fieldNamesCache sync.Map
+
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	if cached, ok := fieldNamesCache.Load(t); ok {
+		return cached.(map[string]bool)
+	}
+
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		names[name] = true
+	}
+
+	fieldNamesCache.Store(t, names)
+	return names
+}
+
+// toArgs converts v into the argument map of a transaction, dropping the
+// asset identifiers that the chaincode does not accept as arguments
+func toArgs(v interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var args map[string]interface{}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	delete(args, "@assetType")
+	delete(args, "@key")
+
+	return args, nil
+}
@@ -0,0 +1,111 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestContractRoundTripKeepsLedgerFields(t *testing.T) {
+	raw := `{
+		"@assetType": "autoExecutableContract",
+		"@key": "autoExecutableContract:1",
+		"@lastTx": "createContract",
+		"name": "Lease",
+		"owner": {"@assetType": "user", "@key": "user:1"},
+		"participants": [{"@assetType": "user", "@key": "user:2"}],
+		"clauses": [{"@assetType": "clause", "@key": "clause:1"}],
+		"extraField": {"nested": true}
+	}`
+
+	var contract AutoExecutableContract
+	if err := json.Unmarshal([]byte(raw), &contract); err != nil {
+		t.Fatal(err)
+	}
+
+	if contract.Key != "autoExecutableContract:1" || contract.OwnerKey() != "user:1" {
+		t.Fatalf("unexpected contract %+v", contract)
+	}
+	if !contract.HasParticipant("user:2") || contract.HasParticipant("user:1") {
+		t.Fatalf("unexpected participants %+v", contract.Participants)
+	}
+	if len(contract.Clauses) != 1 || contract.Clauses[0].Key != "clause:1" {
+		t.Fatalf("unexpected clauses %+v", contract.Clauses)
+	}
+	if _, ok := contract.Extra["extraField"]; !ok {
+		t.Fatalf("unmapped field was dropped: %+v", contract.Extra)
+	}
+	if _, ok := contract.Extra["@assetType"]; ok {
+		t.Fatal("@assetType should not be kept as an extra field")
+	}
+
+	encoded, err := json.Marshal(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"@assetType", "@key", "@lastTx", "name", "owner", "participants", "clauses", "extraField"} {
+		if _, ok := decoded[field]; !ok {
+			t.Errorf("field %s missing after round trip: %s", field, encoded)
+		}
+	}
+	if decoded["@assetType"] != AssetTypeContract {
+		t.Errorf("unexpected @assetType %v", decoded["@assetType"])
+	}
+}
+
+func TestAssetSchemaDriftIsAnError(t *testing.T) {
+	var contract AutoExecutableContract
+	if err := json.Unmarshal([]byte(`{"owner": "user:1"}`), &contract); err == nil {
+		t.Fatal("expected an error when owner is not an asset reference")
+	}
+}
+
+func TestToArgsDropsIdentifiers(t *testing.T) {
+	args, err := toArgs(Clause{Key: "clause:1", Id: "c1", ActionType: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := args["@key"]; ok {
+		t.Error("@key should be dropped")
+	}
+	if _, ok := args["@assetType"]; ok {
+		t.Error("@assetType should be dropped")
+	}
+	if args["id"] != "c1" || args["actionType"] != float64(2) {
+		t.Errorf("unexpected args %v", args)
+	}
+}
+
+func TestToArgsKeepsZeroActionType(t *testing.T) {
+	args, err := toArgs(Clause{Id: "interval", ActionType: ActionCheckDateInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actionType, ok := args["actionType"]; !ok || actionType != float64(0) {
+		t.Errorf("expected the date interval action type to be sent, got %v", args)
+	}
+
+	args, err = toArgs(TemplateClause{Id: "interval", Number: 0, ActionType: ActionCheckDateInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args["actionType"] != float64(0) || args["number"] != float64(0) {
+		t.Errorf("expected the zero action type and number to be sent, got %v", args)
+	}
+}
+
+func TestClauseReferencesMarshalAsReferences(t *testing.T) {
+	raw, err := json.Marshal(AutoExecutableContract{Key: "autoExecutableContract:1", Clauses: []Clause{{Key: "clause:1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `"clauses":[{"@assetType":"clause","@key":"clause:1"}]`) {
+		t.Errorf("expected the clause to be a bare reference, got %s", raw)
+	}
+}
@@ -1,50 +1,19 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func CancelDocument(document map[string]interface{}, status float64) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/cancelDocument"
+func CancelDocument(ctx context.Context, document map[string]interface{}, status float64) (map[string]interface{}, error) {
 	reqMap := map[string]interface{}{
 		"document": document,
 		"status":   status,
 	}
 
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
-	}
-
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to change the status of the document to cancel")
-	}
-
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
 	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+	if err := DefaultClient().Invoke(ctx, "cancelDocument", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to change the status of the document to cancel: %w", err)
 	}
 
 	return resp, nil
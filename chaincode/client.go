@@ -0,0 +1,256 @@
+package chaincode
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/env"
+)
+
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultMaxRetries   = 2
+	defaultRetryBackoff = 500 * time.Millisecond
+)
+
+// RetryPolicy controls how failed calls to the gateway are retried.
+// Only transport failures (unreachable gateway, 502, 503 and 504) are
+// retried. Invokes are not retried unless RetryInvokes is set, since a
+// transaction may have been committed even if its response was lost.
+type RetryPolicy struct {
+	MaxRetries   int
+	Backoff      time.Duration
+	RetryInvokes bool
+}
+
+// Client performs invoke, query and search calls against the chaincode
+// REST gateway.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retry      RetryPolicy
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithTimeout sets the timeout applied to each request to the gateway.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithRetryPolicy replaces the default retry policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithHTTPClient replaces the underlying http client.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient returns a client for the gateway listening at baseURL
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		retry: RetryPolicy{
+			MaxRetries: defaultMaxRetries,
+			Backoff:    defaultRetryBackoff,
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+var (
+	defaultClient *Client
+	defaultMu     sync.Mutex
+)
+
+// DefaultClient returns the client shared by the package level functions.
+// It is built on first use from the ORG_URL, CHAINCODE_TIMEOUT,
+// CHAINCODE_MAX_RETRIES and CHAINCODE_RETRY_BACKOFF env vars.
+func DefaultClient() *Client {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultClient == nil {
+		defaultClient = newClientFromEnv()
+	}
+	return defaultClient
+}
+
+// SetDefaultClient replaces the client shared by the package level functions
+func SetDefaultClient(c *Client) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultClient = c
+}
+
+func newClientFromEnv() *Client {
+	var opts []Option
+
+	if timeout := os.Getenv(env.CHAINCODE_TIMEOUT); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			logger.Errorf("invalid %s %q: %v", env.CHAINCODE_TIMEOUT, timeout, err)
+		} else {
+			opts = append(opts, WithTimeout(d))
+		}
+	}
+
+	policy := RetryPolicy{
+		MaxRetries: defaultMaxRetries,
+		Backoff:    defaultRetryBackoff,
+	}
+	if retries := os.Getenv(env.CHAINCODE_MAX_RETRIES); retries != "" {
+		n, err := strconv.Atoi(retries)
+		if err != nil {
+			logger.Errorf("invalid %s %q: %v", env.CHAINCODE_MAX_RETRIES, retries, err)
+		} else {
+			policy.MaxRetries = n
+		}
+	}
+	if backoff := os.Getenv(env.CHAINCODE_RETRY_BACKOFF); backoff != "" {
+		d, err := time.ParseDuration(backoff)
+		if err != nil {
+			logger.Errorf("invalid %s %q: %v", env.CHAINCODE_RETRY_BACKOFF, backoff, err)
+		} else {
+			policy.Backoff = d
+		}
+	}
+	opts = append(opts, WithRetryPolicy(policy))
+
+	return NewClient(os.Getenv(env.ORG_URL), opts...)
+}
+
+// Invoke submits the transaction txName with req as its arguments and
+// decodes the gateway response into resp. resp may be nil.
+func (c *Client) Invoke(ctx context.Context, txName string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	return c.do(ctx, http.MethodPost, "/invoke/"+txName, body, c.retry.RetryInvokes, resp)
+}
+
+// Query evaluates the transaction txName without committing it. req is sent
+// base64 encoded in the @request query parameter, and is omitted when nil.
+func (c *Client) Query(ctx context.Context, txName string, req, resp interface{}) error {
+	path := "/query/" + txName
+	if req != nil {
+		request, err := json.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		path += "?@request=" + url.QueryEscape(base64.StdEncoding.EncodeToString(request))
+	}
+
+	return c.do(ctx, http.MethodGet, path, nil, true, resp)
+}
+
+// Search runs a CouchDB selector against the world state and decodes the
+// gateway response, of the form {"result": [...]}, into resp.
+func (c *Client) Search(ctx context.Context, selector map[string]interface{}, resp interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"selector": selector,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	return c.do(ctx, http.MethodPost, "/query/search", body, true, resp)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body []byte, retryable bool, resp interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	attempts := 1
+	if retryable && c.retry.MaxRetries > 0 {
+		attempts += c.retry.MaxRetries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			logger.Errorf("retrying %s %s after error: %v", method, path, err)
+			select {
+			case <-ctx.Done():
+				return &Error{Method: method, Path: path, Kind: ErrTransport, Err: ctx.Err()}
+			case <-time.After(c.retry.Backoff * time.Duration(attempt)):
+			}
+		}
+
+		err = c.roundTrip(ctx, method, path, body, resp)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *Client) roundTrip(ctx context.Context, method, path string, body []byte, resp interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return &Error{Method: method, Path: path, Err: err}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return &Error{Method: method, Path: path, Kind: ErrTransport, Err: err}
+	}
+	defer res.Body.Close()
+
+	responseBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return &Error{Method: method, Path: path, StatusCode: res.StatusCode, Kind: ErrTransport, Err: err}
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return newStatusError(method, path, res.StatusCode, responseBody)
+	}
+
+	if resp == nil || len(responseBody) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(responseBody, resp); err != nil {
+		return &Error{Method: method, Path: path, StatusCode: res.StatusCode, Body: string(responseBody), Err: fmt.Errorf("failed to unmarshal response body: %w", err)}
+	}
+	return nil
+}
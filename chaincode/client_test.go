@@ -0,0 +1,131 @@
+package chaincode
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientErrorKinds(t *testing.T) {
+	cases := []struct {
+		status int
+		kind   error
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusBadRequest, ErrBadRequest},
+		{http.StatusInternalServerError, ErrEndorsement},
+		{http.StatusServiceUnavailable, ErrTransport},
+	}
+
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+			w.Write([]byte(`{"error":"boom"}`))
+		}))
+
+		client := NewClient(srv.URL, WithRetryPolicy(RetryPolicy{}))
+		err := client.Invoke(context.Background(), "anything", map[string]interface{}{}, nil)
+		srv.Close()
+
+		if !errors.Is(err, tc.kind) {
+			t.Errorf("status %d: expected %v, got %v", tc.status, tc.kind, err)
+		}
+
+		var ccErr *Error
+		if !errors.As(err, &ccErr) || ccErr.StatusCode != tc.status || ccErr.Body != `{"error":"boom"}` {
+			t.Errorf("status %d: error does not carry status and body: %#v", tc.status, err)
+		}
+	}
+}
+
+func TestClientUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	client := NewClient(url, WithRetryPolicy(RetryPolicy{}))
+	err := client.Query(context.Background(), "getDoc", nil, nil)
+	if !errors.Is(err, ErrTransport) {
+		t.Fatalf("expected transport error, got %v", err)
+	}
+}
+
+func TestClientRetriesQueriesOnly(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"result":[]}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithRetryPolicy(RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}))
+
+	var resp map[string]interface{}
+	if err := client.Search(context.Background(), map[string]interface{}{"@assetType": "document"}, &resp); err != nil {
+		t.Fatalf("expected search to succeed after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	err := client.Invoke(context.Background(), "uploadDocument", map[string]interface{}{}, nil)
+	if !errors.Is(err, ErrTransport) {
+		t.Fatalf("expected transport error, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("invoke should not be retried, got %d calls", calls)
+	}
+}
+
+func TestClientQueryEncodesRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/query/getDoc" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(r.URL.Query().Get("@request"))
+		if err != nil {
+			t.Errorf("request is not base64: %v", err)
+		}
+		w.Write(raw)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+
+	var resp map[string]interface{}
+	req := map[string]interface{}{"key": map[string]interface{}{"@key": "document:1"}}
+	if err := client.Query(context.Background(), "getDoc", req, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _ := json.Marshal(req)
+	got, _ := json.Marshal(resp)
+	if string(expected) != string(got) {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithTimeout(10*time.Millisecond), WithRetryPolicy(RetryPolicy{}))
+	err := client.Query(context.Background(), "getExpiredDocuments", nil, nil)
+	if !errors.Is(err, ErrTransport) {
+		t.Fatalf("expected timeout to be reported as transport error, got %v", err)
+	}
+}
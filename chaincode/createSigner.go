@@ -1,54 +1,20 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func CreateSignerTransaction(cpf, email, name, phone, userName string) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/createSigner"
-	reqMap := map[string]interface{}{
-		"cpf":      cpf,
-		"email":    email,
-		"name":     name,
-		"phone":    phone,
-		"userName": userName,
-	}
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
+func CreateSignerTransaction(ctx context.Context, user User) (*User, error) {
+	reqMap, err := toArgs(user)
 	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
+		return nil, fmt.Errorf("failed to build signer request: %w", err)
 	}
 
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to create signer asset")
-	}
-
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+	var resp User
+	if err := DefaultClient().Invoke(ctx, "createSigner", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to create signer asset: %w", err)
 	}
 
-	return resp, nil
+	return &resp, nil
 }
@@ -1,47 +1,29 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func EditTemplate(reqMap map[string]interface{}) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/editTemplate"
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
-	}
-
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to edit template")
-	}
+// TemplateUpdate holds the template fields to change. Empty values are left
+// unchanged on the ledger.
+type TemplateUpdate struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Public      *bool  `json:"public,omitempty"`
+}
 
-	responseBody, err := io.ReadAll(res.Body)
+func EditTemplate(ctx context.Context, template AssetRef, update TemplateUpdate) (*Template, error) {
+	reqMap, err := toArgs(update)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to build template request: %w", err)
 	}
+	reqMap["template"] = template
 
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+	var resp Template
+	if err := DefaultClient().Invoke(ctx, "editTemplate", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to edit template: %w", err)
 	}
 
-	return resp, nil
+	return &resp, nil
 }
@@ -1,47 +1,35 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func EditTemplateClause(reqMap map[string]interface{}) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/editTemplateClause"
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
-	}
-
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to edit clause template")
-	}
+// TemplateClauseUpdate holds the template clause fields to change. Empty
+// values are left unchanged on the ledger.
+type TemplateClauseUpdate struct {
+	Name              string                 `json:"name,omitempty"`
+	Number            *float64               `json:"number,omitempty"`
+	Description       string                 `json:"description,omitempty"`
+	Category          string                 `json:"category,omitempty"`
+	ActionType        *ActionType            `json:"actionType,omitempty"`
+	Dependencies      []AssetRef             `json:"dependencies,omitempty"`
+	DefaultInputs     map[string]interface{} `json:"defaultInputs,omitempty"`
+	DefaultParameters map[string]interface{} `json:"defaultParameters,omitempty"`
+	Optional          *bool                  `json:"optional,omitempty"`
+}
 
-	responseBody, err := io.ReadAll(res.Body)
+func EditTemplateClause(ctx context.Context, templateClause AssetRef, update TemplateClauseUpdate) (*TemplateClause, error) {
+	reqMap, err := toArgs(update)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to build template clause request: %w", err)
 	}
+	reqMap["templateClause"] = templateClause
 
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+	var resp TemplateClause
+	if err := DefaultClient().Invoke(ctx, "editTemplateClause", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to edit clause template: %w", err)
 	}
 
-	return resp, nil
+	return &resp, nil
 }
@@ -0,0 +1,85 @@
+package chaincode
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when the requested asset does not exist on the ledger
+	ErrNotFound = errors.New("asset not found")
+	// ErrConflict is returned when the transaction collides with the current ledger state
+	ErrConflict = errors.New("asset conflict")
+	// ErrBadRequest is returned when the chaincode rejects the transaction arguments
+	ErrBadRequest = errors.New("invalid chaincode request")
+	// ErrEndorsement is returned when the peers refuse to endorse the transaction
+	ErrEndorsement = errors.New("endorsement failure")
+	// ErrTransport is returned when the gateway or its peers can not be reached
+	ErrTransport = errors.New("chaincode gateway unreachable")
+)
+
+// Error describes a failed call to the chaincode gateway. Kind is one of the
+// sentinel errors above and can be checked with errors.Is.
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+	Kind       error
+	Err        error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", e.Method, e.Path)
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, ": status %d", e.StatusCode)
+	}
+	if e.Kind != nil {
+		fmt.Fprintf(&b, ": %s", e.Kind.Error())
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %s", e.Err.Error())
+	}
+	if e.Body != "" {
+		fmt.Fprintf(&b, ": %s", e.Body)
+	}
+	return b.String()
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newStatusError(method, path string, status int, body []byte) *Error {
+	e := &Error{
+		Method:     method,
+		Path:       path,
+		StatusCode: status,
+		Body:       strings.TrimSpace(string(body)),
+	}
+
+	switch {
+	case status == http.StatusNotFound:
+		e.Kind = ErrNotFound
+	case status == http.StatusConflict:
+		e.Kind = ErrConflict
+	case status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		e.Kind = ErrTransport
+	case status >= 500:
+		e.Kind = ErrEndorsement
+	case status >= 400:
+		e.Kind = ErrBadRequest
+	}
+	return e
+}
+
+func isRetryable(err error) bool {
+	return errors.Is(err, ErrTransport)
+}
@@ -1,47 +1,34 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func ExecuteContract(reqMap map[string]interface{}) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/invoke/executeAutoExecutableContract"
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+func ExecuteContract(ctx context.Context, contract AutoExecutableContract) (*AutoExecutableContract, error) {
+	reqMap := map[string]interface{}{
+		"contract": contract,
 	}
-	requestBody := bytes.NewBuffer(body)
 
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
+	var resp AutoExecutableContract
+	if err := DefaultClient().Invoke(ctx, "executeAutoExecutableContract", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to execute a contract: %w", err)
 	}
 
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to execute a contract")
-	}
+	return &resp, nil
+}
 
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+// SimulateContractExecution evaluates the execution of a contract without
+// committing it, and returns the contract as it would be after executing
+func SimulateContractExecution(ctx context.Context, contract AutoExecutableContract) (*AutoExecutableContract, error) {
+	reqMap := map[string]interface{}{
+		"contract": contract.Ref(),
 	}
 
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+	var resp AutoExecutableContract
+	if err := DefaultClient().Query(ctx, "executeAutoExecutableContract", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to simulate the execution of a contract: %w", err)
 	}
 
-	return resp, nil
+	return &resp, nil
 }
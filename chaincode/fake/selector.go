@@ -0,0 +1,186 @@
+package fake
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Match reports whether asset satisfies a CouchDB Mango selector. Fields are
+// matched by equality, nested objects as implicit sub-selectors, and the
+// $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $regex, $elemMatch,
+// $and, $or and $not operators are supported.
+func Match(asset map[string]interface{}, selector map[string]interface{}) bool {
+	return matchValue(asset, normalize(selector))
+}
+
+func matchValue(value interface{}, selector interface{}) bool {
+	cond, ok := selector.(map[string]interface{})
+	if !ok {
+		return equal(value, selector)
+	}
+
+	for k, v := range cond {
+		if strings.HasPrefix(k, "$") {
+			if !matchOperator(value, k, v) {
+				return false
+			}
+			continue
+		}
+
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		field, exists := lookup(obj, k)
+		if !exists {
+			if sub, ok := v.(map[string]interface{}); ok {
+				if e, ok := sub["$exists"]; ok && e == false {
+					continue
+				}
+			}
+			return false
+		}
+		if !matchValue(field, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchOperator(value interface{}, op string, arg interface{}) bool {
+	switch op {
+	case "$eq":
+		return equal(value, arg)
+	case "$ne":
+		return !equal(value, arg)
+	case "$gt", "$gte", "$lt", "$lte":
+		c, ok := compare(value, arg)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "$gt":
+			return c > 0
+		case "$gte":
+			return c >= 0
+		case "$lt":
+			return c < 0
+		default:
+			return c <= 0
+		}
+	case "$in", "$nin":
+		list, _ := arg.([]interface{})
+		found := false
+		for _, candidate := range list {
+			if equal(value, candidate) {
+				found = true
+				break
+			}
+		}
+		return found == (op == "$in")
+	case "$exists":
+		return arg == true
+	case "$regex":
+		pattern, _ := arg.(string)
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		re, err := regexp.Compile(pattern)
+		return err == nil && re.MatchString(s)
+	case "$elemMatch":
+		list, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, elem := range list {
+			if matchValue(elem, arg) {
+				return true
+			}
+		}
+		return false
+	case "$and":
+		list, _ := arg.([]interface{})
+		for _, sub := range list {
+			if !matchValue(value, sub) {
+				return false
+			}
+		}
+		return true
+	case "$or":
+		list, _ := arg.([]interface{})
+		for _, sub := range list {
+			if matchValue(value, sub) {
+				return true
+			}
+		}
+		return false
+	case "$not":
+		return !matchValue(value, arg)
+	}
+	return false
+}
+
+// lookup resolves a possibly dotted field path
+func lookup(obj map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := obj[path]; ok {
+		return v, true
+	}
+
+	var current interface{} = obj
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	}
+	return 0, false
+}
+
+// normalize round trips v through JSON so numbers and nested values have the
+// same types as stored assets
+func normalize(v interface{}) interface{} {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,42 @@
+package fake
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	asset := map[string]interface{}{
+		"@assetType": "autoExecutableContract",
+		"status":     float64(2),
+		"owner":      map[string]interface{}{"@assetType": "user", "@key": "user:1"},
+		"participants": []interface{}{
+			map[string]interface{}{"@assetType": "user", "@key": "user:2"},
+			map[string]interface{}{"@assetType": "user", "@key": "user:3"},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		selector map[string]interface{}
+		want     bool
+	}{
+		{"equality", map[string]interface{}{"@assetType": "autoExecutableContract"}, true},
+		{"int matches stored float", map[string]interface{}{"status": 2}, true},
+		{"nested object", map[string]interface{}{"owner": map[string]interface{}{"@key": "user:1"}}, true},
+		{"dotted path", map[string]interface{}{"owner.@key": "user:2"}, false},
+		{"elemMatch hit", map[string]interface{}{"participants": map[string]interface{}{"$elemMatch": map[string]interface{}{"@key": "user:3"}}}, true},
+		{"elemMatch miss", map[string]interface{}{"participants": map[string]interface{}{"$elemMatch": map[string]interface{}{"@key": "user:1"}}}, false},
+		{"comparison", map[string]interface{}{"status": map[string]interface{}{"$gte": 1, "$lt": 3}}, true},
+		{"in", map[string]interface{}{"status": map[string]interface{}{"$in": []interface{}{0, 1}}}, false},
+		{"or", map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"status": 0},
+			map[string]interface{}{"owner.@key": "user:1"},
+		}}, true},
+		{"exists false", map[string]interface{}{"deleted": map[string]interface{}{"$exists": false}}, true},
+		{"missing field", map[string]interface{}{"deleted": true}, false},
+	}
+
+	for _, tc := range cases {
+		if got := Match(asset, tc.selector); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
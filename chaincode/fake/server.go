@@ -0,0 +1,401 @@
+// Package fake provides an in-process stand-in for the chaincode REST gateway
+// at ORG_URL, backed by an in-memory asset store. It is meant to be used in
+// tests together with chaincode.SetDefaultClient.
+package fake
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+// TxFunc implements a transaction on top of the store. The returned value is
+// encoded as the JSON response body.
+type TxFunc func(s *Store, args map[string]interface{}) (interface{}, error)
+
+// TxError is returned by a TxFunc to answer with a specific status code
+type TxError struct {
+	Status  int
+	Message string
+}
+
+func (e *TxError) Error() string {
+	return e.Message
+}
+
+// NotFound returns a 404 error for the given key
+func NotFound(key string) error {
+	return &TxError{Status: http.StatusNotFound, Message: fmt.Sprintf("asset %s not found", key)}
+}
+
+// BadRequest returns a 400 error
+func BadRequest(format string, args ...interface{}) error {
+	return &TxError{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// Conflict returns a 409 error
+func Conflict(format string, args ...interface{}) error {
+	return &TxError{Status: http.StatusConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+// HistoryRecord is a past version of an asset, as returned by getDocHistory
+type HistoryRecord struct {
+	TxID      string                 `json:"txId"`
+	Timestamp string                 `json:"timestamp"`
+	Value     map[string]interface{} `json:"value"`
+	IsDeleted bool                   `json:"isDeleted"`
+}
+
+// Store is an in-memory world state. Assets are stored as decoded JSON
+// objects keyed by their @key.
+type Store struct {
+	// Now returns the transaction timestamp. It defaults to time.Now.
+	Now func() time.Time
+
+	assets  map[string]map[string]interface{}
+	history map[string][]HistoryRecord
+	seq     int
+	txID    string
+}
+
+func newStore() *Store {
+	return &Store{
+		Now:     time.Now,
+		assets:  make(map[string]map[string]interface{}),
+		history: make(map[string][]HistoryRecord),
+	}
+}
+
+// NewKey returns a fresh key for an asset of the given type. When natural is
+// not empty the key is derived from it, so the same natural key always maps
+// to the same asset.
+func (s *Store) NewKey(assetType string, natural ...string) string {
+	seed := strings.Join(natural, "|")
+	if seed == "" {
+		s.seq++
+		seed = fmt.Sprintf("seq-%d", s.seq)
+	}
+	sum := sha1.Sum([]byte(assetType + "|" + seed))
+	return fmt.Sprintf("%s:%x-%x-%x-%x-%x", assetType, sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// Get returns a copy of the asset with the given key
+func (s *Store) Get(key string) (map[string]interface{}, bool) {
+	asset, ok := s.assets[key]
+	if !ok {
+		return nil, false
+	}
+	return clone(asset), true
+}
+
+// Put writes asset to the store, assigning a key when it has none, and
+// returns the stored copy
+func (s *Store) Put(asset map[string]interface{}) map[string]interface{} {
+	asset = clone(asset)
+
+	key, _ := asset["@key"].(string)
+	if key == "" {
+		assetType, _ := asset["@assetType"].(string)
+		key = s.NewKey(assetType)
+		asset["@key"] = key
+	}
+	asset["@lastUpdated"] = s.Now().UTC().Format(time.RFC3339Nano)
+
+	s.assets[key] = asset
+	s.record(key, asset, false)
+	return clone(asset)
+}
+
+// snapshot returns a copy of the store whose writes do not affect it
+func (s *Store) snapshot() *Store {
+	cp := &Store{
+		Now:     s.Now,
+		assets:  make(map[string]map[string]interface{}, len(s.assets)),
+		history: make(map[string][]HistoryRecord, len(s.history)),
+		seq:     s.seq,
+		txID:    s.txID,
+	}
+	// Stored assets are never modified in place, so they can be shared
+	for key, asset := range s.assets {
+		cp.assets[key] = asset
+	}
+	for key, records := range s.history {
+		cp.history[key] = records[:len(records):len(records)]
+	}
+	return cp
+}
+
+// Delete removes the asset with the given key and returns it
+func (s *Store) Delete(key string) (map[string]interface{}, bool) {
+	asset, ok := s.assets[key]
+	if !ok {
+		return nil, false
+	}
+	delete(s.assets, key)
+	s.record(key, asset, true)
+	return asset, true
+}
+
+// Search returns the assets matching a CouchDB style selector, ordered by key
+func (s *Store) Search(selector map[string]interface{}) []map[string]interface{} {
+	keys := make([]string, 0, len(s.assets))
+	for key := range s.assets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := []map[string]interface{}{}
+	for _, key := range keys {
+		if Match(s.assets[key], selector) {
+			result = append(result, clone(s.assets[key]))
+		}
+	}
+	return result
+}
+
+// History returns every recorded version of the asset with the given key
+func (s *Store) History(key string) []HistoryRecord {
+	return append([]HistoryRecord(nil), s.history[key]...)
+}
+
+// Resolve returns the asset referenced by args[name], which must be an
+// object carrying a @key
+func (s *Store) Resolve(args map[string]interface{}, name string) (map[string]interface{}, error) {
+	key, err := RefKey(args, name)
+	if err != nil {
+		return nil, err
+	}
+	asset, ok := s.Get(key)
+	if !ok {
+		return nil, NotFound(key)
+	}
+	return asset, nil
+}
+
+func (s *Store) record(key string, asset map[string]interface{}, deleted bool) {
+	now := s.Now()
+	s.history[key] = append(s.history[key], HistoryRecord{
+		TxID:      s.txID,
+		Timestamp: fmt.Sprintf("seconds:%d nanos:%d", now.Unix(), now.Nanosecond()),
+		Value:     clone(asset),
+		IsDeleted: deleted,
+	})
+}
+
+// RefKey extracts the @key of the asset reference args[name]
+func RefKey(args map[string]interface{}, name string) (string, error) {
+	ref, ok := args[name].(map[string]interface{})
+	if !ok {
+		return "", BadRequest("missing argument %s", name)
+	}
+	key, _ := ref["@key"].(string)
+	if key == "" {
+		return "", BadRequest("argument %s has no @key", name)
+	}
+	return key, nil
+}
+
+// Server is an httptest server implementing the gateway routes used by the
+// chaincode package: /invoke/<tx>, /query/<tx> and /query/search.
+type Server struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	store *Store
+	txs   map[string]TxFunc
+	fails map[string]int
+	calls []string
+	seq   int
+}
+
+// NewServer starts a fake gateway with the default transactions registered
+func NewServer() *Server {
+	s := &Server{
+		store: newStore(),
+		txs:   make(map[string]TxFunc),
+		fails: make(map[string]int),
+	}
+	for name, fn := range defaultTransactions {
+		s.txs[name] = fn
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns a chaincode client talking to the fake, without retries
+func (s *Server) Client(opts ...chaincode.Option) *chaincode.Client {
+	opts = append([]chaincode.Option{chaincode.WithRetryPolicy(chaincode.RetryPolicy{})}, opts...)
+	return chaincode.NewClient(s.URL, opts...)
+}
+
+// Handle registers or replaces the implementation of txName
+func (s *Server) Handle(txName string, fn TxFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.txs[txName] = fn
+}
+
+// FailNext makes the next call to txName answer with status
+func (s *Server) FailNext(txName string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fails[txName] = status
+}
+
+// Do runs fn with exclusive access to the store, to seed or inspect it
+func (s *Server) Do(fn func(st *Store)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextTx()
+	fn(s.store)
+}
+
+// nextTx starts a transaction, whose id is recorded in the history of the
+// assets it writes
+func (s *Server) nextTx() {
+	s.seq++
+	s.store.txID = fmt.Sprintf("tx%06d", s.seq)
+}
+
+// Put seeds the store with asset and returns the stored copy
+func (s *Server) Put(asset map[string]interface{}) map[string]interface{} {
+	var stored map[string]interface{}
+	s.Do(func(st *Store) { stored = st.Put(asset) })
+	return stored
+}
+
+// Get returns a copy of the asset with the given key
+func (s *Server) Get(key string) (map[string]interface{}, bool) {
+	var (
+		asset map[string]interface{}
+		ok    bool
+	)
+	s.Do(func(st *Store) { asset, ok = st.Get(key) })
+	return asset, ok
+}
+
+// Calls returns the names of the transactions called so far, in order
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		txName string
+		args   map[string]interface{}
+		commit bool
+		err    error
+	)
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/invoke/"):
+		txName = strings.TrimPrefix(r.URL.Path, "/invoke/")
+		args, err = decodeBody(r.Body)
+		commit = true
+	case r.Method == http.MethodPost && r.URL.Path == "/query/search":
+		txName = "search"
+		args, err = decodeBody(r.Body)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/query/"):
+		txName = strings.TrimPrefix(r.URL.Path, "/query/")
+		args, err = decodeRequestParam(r.URL.Query().Get("@request"))
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": "unknown route " + r.URL.Path})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	status, resp := s.run(txName, args, commit)
+	writeJSON(w, status, resp)
+}
+
+// run executes a transaction. Like a peer evaluating a query, it discards
+// the writes of transactions that are not committed.
+func (s *Server) run(txName string, args map[string]interface{}, commit bool) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, txName)
+
+	if status, ok := s.fails[txName]; ok {
+		delete(s.fails, txName)
+		return status, map[string]interface{}{"error": "injected failure"}
+	}
+
+	fn, ok := s.txs[txName]
+	if !ok {
+		return http.StatusNotFound, map[string]interface{}{"error": "unknown transaction " + txName}
+	}
+
+	st := s.store
+	if commit {
+		s.nextTx()
+	} else {
+		st = s.store.snapshot()
+	}
+
+	resp, err := fn(st, args)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if txErr, ok := err.(*TxError); ok {
+			status = txErr.Status
+		}
+		return status, map[string]interface{}{"error": err.Error()}
+	}
+	return http.StatusOK, resp
+}
+
+func decodeBody(body io.Reader) (map[string]interface{}, error) {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	args := map[string]interface{}{}
+	if len(raw) == 0 {
+		return args, nil
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	return args, nil
+}
+
+func decodeRequestParam(param string) (map[string]interface{}, error) {
+	if param == "" {
+		return map[string]interface{}{}, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(param)
+	if err != nil {
+		return nil, fmt.Errorf("invalid @request: %w", err)
+	}
+	return decodeBody(strings.NewReader(string(raw)))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// clone deep copies a decoded JSON value
+func clone(asset map[string]interface{}) map[string]interface{} {
+	raw, _ := json.Marshal(asset)
+	var out map[string]interface{}
+	json.Unmarshal(raw, &out)
+	return out
+}
@@ -0,0 +1,482 @@
+package fake
+
+import (
+	"time"
+)
+
+var defaultTransactions = map[string]TxFunc{
+	"search":           search,
+	"searchAssetQuery": search,
+
+	"createSigner": createSigner,
+	"updateSigner": updateSigner,
+	"getSigner":    getResult,
+	"getUserKey":   getUserKey,
+
+	"readAssetHistory": readAssetHistory,
+
+	"uploadDocument":      uploadDocument,
+	"getDoc":              getResult,
+	"getDocHistory":       getHistory,
+	"cancelDocument":      cancelDocument,
+	"updateDocument":      updateDocument,
+	"expectedUserDoc":     expectedUserDoc,
+	"getExpiredDocuments": getExpiredDocuments,
+
+	"createContract":                 createContract,
+	"addClause":                      addClause,
+	"addClauses":                     addClauses,
+	"removeClause":                   removeClause,
+	"addParticipants":                addParticipants,
+	"addReviewToContract":            addReview,
+	"addReferenceDateCDI":            addClauseInputs,
+	"addEvaluatedDateCDI":            addClauseInputs,
+	"addInputToCheckFineClause":      addClauseInputs,
+	"addStoredValueToGetCredit":      addClauseInputs,
+	"addInputsToMakePaymentClause":   addClauseInputs,
+	"cancelContract":                 addClauseInputs,
+	"contractsWithExecutableClauses": contractsWithExecutableClauses,
+	"executeAutoExecutableContract":  executeContract,
+
+	"createTemplate":       createTemplate,
+	"createTemplateClause": createTemplateClause,
+	"editTemplate":         editTemplate,
+	"editTemplateClause":   editTemplateClause,
+	"duplicateTemplate":    duplicateTemplate,
+	"removeTemplate":       removeTemplate,
+	"removeTemplateClause": removeTemplateClause,
+}
+
+func search(s *Store, args map[string]interface{}) (interface{}, error) {
+	query, _ := args["query"].(map[string]interface{})
+	selector, _ := query["selector"].(map[string]interface{})
+	if selector == nil {
+		return nil, BadRequest("missing query selector")
+	}
+	return map[string]interface{}{"result": s.Search(selector)}, nil
+}
+
+func getResult(s *Store, args map[string]interface{}) (interface{}, error) {
+	asset, err := s.Resolve(args, "key")
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"result": []interface{}{asset}}, nil
+}
+
+func getHistory(s *Store, args map[string]interface{}) (interface{}, error) {
+	key, err := RefKey(args, "key")
+	if err != nil {
+		return nil, err
+	}
+	history := s.History(key)
+	if len(history) == 0 {
+		return nil, NotFound(key)
+	}
+	return history, nil
+}
+
+// readAssetHistory returns the versions of an asset in the format of the
+// cc-tools transaction: each version carries _txId, _timestamp and _isDelete
+// beside the asset fields
+func readAssetHistory(s *Store, args map[string]interface{}) (interface{}, error) {
+	key, err := RefKey(args, "key")
+	if err != nil {
+		return nil, err
+	}
+	history := s.History(key)
+	if len(history) == 0 {
+		return nil, NotFound(key)
+	}
+
+	versions := make([]map[string]interface{}, 0, len(history))
+	for _, record := range history {
+		version := clone(record.Value)
+		version["_txId"] = record.TxID
+		version["_timestamp"] = record.Timestamp
+		version["_isDelete"] = record.IsDeleted
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+func createSigner(s *Store, args map[string]interface{}) (interface{}, error) {
+	cpf, _ := args["cpf"].(string)
+	if cpf == "" {
+		return nil, BadRequest("missing argument cpf")
+	}
+
+	key := s.NewKey("user", cpf)
+	if _, exists := s.Get(key); exists {
+		return nil, Conflict("user %s already exists", key)
+	}
+
+	user := withType("user", args)
+	user["@key"] = key
+	return s.Put(user), nil
+}
+
+func updateSigner(s *Store, args map[string]interface{}) (interface{}, error) {
+	return update(s, args, "signer")
+}
+
+func getUserKey(s *Store, args map[string]interface{}) (interface{}, error) {
+	users := s.Search(map[string]interface{}{"@assetType": "user", "cpf": args["cpf"]})
+	if len(users) == 0 {
+		return nil, NotFound("user")
+	}
+	return map[string]interface{}{"@assetType": "user", "@key": users[0]["@key"]}, nil
+}
+
+func uploadDocument(s *Store, args map[string]interface{}) (interface{}, error) {
+	hash, _ := args["originalHash"].(string)
+	if hash == "" {
+		return nil, BadRequest("missing argument originalHash")
+	}
+
+	doc := withType("document", args)
+	doc["@key"] = s.NewKey("document", hash)
+	return s.Put(doc), nil
+}
+
+func cancelDocument(s *Store, args map[string]interface{}) (interface{}, error) {
+	doc, err := s.Resolve(args, "document")
+	if err != nil {
+		return nil, err
+	}
+	doc["status"] = args["status"]
+	return s.Put(doc), nil
+}
+
+func updateDocument(s *Store, args map[string]interface{}) (interface{}, error) {
+	return update(s, args, "document")
+}
+
+func expectedUserDoc(s *Store, args map[string]interface{}) (interface{}, error) {
+	signerKey, err := RefKey(args, "signer")
+	if err != nil {
+		return nil, err
+	}
+
+	selector := map[string]interface{}{
+		"@assetType": "document",
+		"requiredSignatures": map[string]interface{}{
+			"$elemMatch": map[string]interface{}{"@key": signerKey},
+		},
+	}
+	if status, ok := args["status"]; ok {
+		selector["status"] = status
+	}
+	return map[string]interface{}{"result": s.Search(selector)}, nil
+}
+
+func getExpiredDocuments(s *Store, args map[string]interface{}) (interface{}, error) {
+	expired := []map[string]interface{}{}
+	for _, doc := range s.Search(map[string]interface{}{"@assetType": "document", "status": 0}) {
+		timeout, _ := doc["timeout"].(string)
+		deadline, err := time.Parse(time.RFC3339, timeout)
+		if err == nil && deadline.Before(s.Now()) {
+			expired = append(expired, doc)
+		}
+	}
+	return expired, nil
+}
+
+// createContract stores the contract, and the clauses given in full as
+// clause assets referenced from it
+func createContract(s *Store, args map[string]interface{}) (interface{}, error) {
+	if _, err := RefKey(args, "owner"); err != nil {
+		return nil, err
+	}
+
+	contract := withType("autoExecutableContract", args)
+	if clauses := list(args["clauses"]); len(clauses) > 0 {
+		refs := make([]interface{}, 0, len(clauses))
+		for _, c := range clauses {
+			clause, ok := c.(map[string]interface{})
+			if !ok {
+				return nil, BadRequest("invalid clause")
+			}
+			if refKeyOf(clause) == "" {
+				clause = s.Put(withType("clause", clause))
+			}
+			refs = append(refs, ref(clause))
+		}
+		contract["clauses"] = refs
+	}
+	return s.Put(contract), nil
+}
+
+func addClause(s *Store, args map[string]interface{}) (interface{}, error) {
+	contract, err := s.Resolve(args, "autoExecutableContract")
+	if err != nil {
+		return nil, err
+	}
+
+	clauseArgs := withType("clause", args)
+	delete(clauseArgs, "autoExecutableContract")
+	contract["clauses"] = append(list(contract["clauses"]), ref(s.Put(clauseArgs)))
+	return s.Put(contract), nil
+}
+
+func addClauses(s *Store, args map[string]interface{}) (interface{}, error) {
+	contract, err := s.Resolve(args, "autoExecutableContract")
+	if err != nil {
+		return nil, err
+	}
+
+	clauses := list(contract["clauses"])
+	for _, c := range list(args["clauses"]) {
+		clauseArgs, ok := c.(map[string]interface{})
+		if !ok {
+			return nil, BadRequest("invalid clause")
+		}
+		clauses = append(clauses, ref(s.Put(withType("clause", clauseArgs))))
+	}
+	contract["clauses"] = clauses
+	return s.Put(contract), nil
+}
+
+func removeClause(s *Store, args map[string]interface{}) (interface{}, error) {
+	contract, err := s.Resolve(args, "autoExecutableContract")
+	if err != nil {
+		return nil, err
+	}
+	clauseKey, err := RefKey(args, "clause")
+	if err != nil {
+		return nil, err
+	}
+
+	contract["clauses"] = without(list(contract["clauses"]), clauseKey)
+	s.Delete(clauseKey)
+	return s.Put(contract), nil
+}
+
+func addParticipants(s *Store, args map[string]interface{}) (interface{}, error) {
+	contract, err := s.Resolve(args, "autoExecutableContract")
+	if err != nil {
+		return nil, err
+	}
+
+	participants := list(contract["participants"])
+	for _, p := range list(args["participants"]) {
+		participant, _ := p.(map[string]interface{})
+		key, _ := participant["@key"].(string)
+		if key == "" {
+			return nil, BadRequest("invalid participant")
+		}
+		participants = append(without(participants, key), participant)
+	}
+	contract["participants"] = participants
+	return s.Put(contract), nil
+}
+
+func addReview(s *Store, args map[string]interface{}) (interface{}, error) {
+	contract, err := s.Resolve(args, "autoExecutableContract")
+	if err != nil {
+		return nil, err
+	}
+	review, ok := args["review"].(map[string]interface{})
+	if !ok {
+		return nil, BadRequest("missing argument review")
+	}
+
+	contract["reviews"] = append(list(contract["reviews"]), review)
+	return s.Put(contract), nil
+}
+
+// addClauseInputs stores every argument but the clause reference in the
+// clause input and marks it as executable
+func addClauseInputs(s *Store, args map[string]interface{}) (interface{}, error) {
+	clause, err := s.Resolve(args, "clause")
+	if err != nil {
+		return nil, err
+	}
+
+	input, _ := clause["input"].(map[string]interface{})
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	for k, v := range args {
+		if k != "clause" {
+			input[k] = v
+		}
+	}
+	clause["input"] = input
+	clause["executable"] = true
+	return s.Put(clause), nil
+}
+
+func contractsWithExecutableClauses(s *Store, args map[string]interface{}) (interface{}, error) {
+	result := []map[string]interface{}{}
+	for _, contract := range s.Search(map[string]interface{}{"@assetType": "autoExecutableContract"}) {
+		for _, c := range list(contract["clauses"]) {
+			clause, ok := s.Get(refKeyOf(c))
+			if ok && clause["executable"] == true && clause["finalized"] != true {
+				result = append(result, contract)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// executeContract finalizes the executable clauses of a contract, and
+// returns the contract with its clauses as executed
+func executeContract(s *Store, args map[string]interface{}) (interface{}, error) {
+	contract, err := s.Resolve(args, "contract")
+	if err != nil {
+		return nil, err
+	}
+
+	var clauses []interface{}
+	for _, c := range list(contract["clauses"]) {
+		clause, ok := s.Get(refKeyOf(c))
+		if !ok {
+			continue
+		}
+		if clause["executable"] == true && clause["finalized"] != true {
+			clause["executable"] = false
+			clause["finalized"] = true
+			clause["result"] = map[string]interface{}{"executed": true, "input": clause["input"]}
+			clause = s.Put(clause)
+		}
+		clauses = append(clauses, clause)
+	}
+
+	resp := s.Put(contract)
+	resp["clauses"] = clauses
+	return resp, nil
+}
+
+func createTemplate(s *Store, args map[string]interface{}) (interface{}, error) {
+	if _, err := RefKey(args, "creator"); err != nil {
+		return nil, err
+	}
+	return s.Put(withType("template", args)), nil
+}
+
+func createTemplateClause(s *Store, args map[string]interface{}) (interface{}, error) {
+	template, err := s.Resolve(args, "template")
+	if err != nil {
+		return nil, err
+	}
+
+	templateClause := s.Put(withType("templateClause", args))
+	template["clauses"] = append(list(template["clauses"]), ref(templateClause))
+	s.Put(template)
+	return templateClause, nil
+}
+
+func editTemplate(s *Store, args map[string]interface{}) (interface{}, error) {
+	return edit(s, args, "template")
+}
+
+func editTemplateClause(s *Store, args map[string]interface{}) (interface{}, error) {
+	return edit(s, args, "templateClause")
+}
+
+func duplicateTemplate(s *Store, args map[string]interface{}) (interface{}, error) {
+	template, err := s.Resolve(args, "template")
+	if err != nil {
+		return nil, err
+	}
+
+	delete(template, "@key")
+	for _, field := range []string{"id", "name", "creator"} {
+		if v, ok := args[field]; ok {
+			template[field] = v
+		}
+	}
+	return s.Put(template), nil
+}
+
+func removeTemplate(s *Store, args map[string]interface{}) (interface{}, error) {
+	key, err := RefKey(args, "template")
+	if err != nil {
+		return nil, err
+	}
+	template, ok := s.Delete(key)
+	if !ok {
+		return nil, NotFound(key)
+	}
+	return template, nil
+}
+
+func removeTemplateClause(s *Store, args map[string]interface{}) (interface{}, error) {
+	template, err := s.Resolve(args, "template")
+	if err != nil {
+		return nil, err
+	}
+	clauseKey, err := RefKey(args, "templateClause")
+	if err != nil {
+		return nil, err
+	}
+
+	template["clauses"] = without(list(template["clauses"]), clauseKey)
+	s.Delete(clauseKey)
+	return s.Put(template), nil
+}
+
+// update merges args["updates"] into the asset referenced by args[name]
+func update(s *Store, args map[string]interface{}, name string) (interface{}, error) {
+	asset, err := s.Resolve(args, name)
+	if err != nil {
+		return nil, err
+	}
+	updates, _ := args["updates"].(map[string]interface{})
+	for k, v := range updates {
+		asset[k] = v
+	}
+	return s.Put(asset), nil
+}
+
+// edit merges every argument but the reference into the asset referenced by
+// args[name]
+func edit(s *Store, args map[string]interface{}, name string) (interface{}, error) {
+	asset, err := s.Resolve(args, name)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range args {
+		if k != name {
+			asset[k] = v
+		}
+	}
+	return s.Put(asset), nil
+}
+
+func withType(assetType string, args map[string]interface{}) map[string]interface{} {
+	asset := make(map[string]interface{}, len(args)+1)
+	for k, v := range args {
+		asset[k] = v
+	}
+	delete(asset, "@key")
+	asset["@assetType"] = assetType
+	return asset
+}
+
+func ref(asset map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"@assetType": asset["@assetType"], "@key": asset["@key"]}
+}
+
+func refKeyOf(v interface{}) string {
+	m, _ := v.(map[string]interface{})
+	key, _ := m["@key"].(string)
+	return key
+}
+
+func list(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+func without(l []interface{}, key string) []interface{} {
+	out := make([]interface{}, 0, len(l))
+	for _, v := range l {
+		if refKeyOf(v) != key {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,14 @@
+package chaincode
+
+import (
+	"context"
+)
+
+func GetClause(ctx context.Context, key string) (*Clause, error) {
+	var clause Clause
+	if err := getAsset(ctx, AssetTypeClause, key, &clause); err != nil {
+		return nil, err
+	}
+
+	return &clause, nil
+}
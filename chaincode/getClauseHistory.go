@@ -0,0 +1,68 @@
+package chaincode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ClauseVersion is a version of a clause recorded on the ledger by a
+// transaction
+type ClauseVersion struct {
+	TxID      string
+	Timestamp string
+	IsDeleted bool
+	Clause    Clause
+}
+
+// Time returns the time of the transaction that recorded the version
+func (v ClauseVersion) Time() (time.Time, error) {
+	return parseTimestamp(v.Timestamp)
+}
+
+// GetClauseHistory returns the versions of a clause recorded on the ledger
+func GetClauseHistory(ctx context.Context, key string) ([]ClauseVersion, error) {
+	request := map[string]interface{}{
+		"key": map[string]interface{}{
+			"@assetType": AssetTypeClause,
+			"@key":       key,
+		},
+	}
+
+	var records []json.RawMessage
+	if err := DefaultClient().Query(ctx, "readAssetHistory", request, &records); err != nil {
+		return nil, fmt.Errorf("failed to get clause history: %w", err)
+	}
+
+	versions := make([]ClauseVersion, 0, len(records))
+	for _, record := range records {
+		// The asset is returned with the transaction fields beside its own
+		var tx struct {
+			TxID      string `json:"_txId"`
+			Timestamp string `json:"_timestamp"`
+			IsDeleted bool   `json:"_isDelete"`
+		}
+		if err := json.Unmarshal(record, &tx); err != nil {
+			return nil, fmt.Errorf("invalid clause history record: %w", err)
+		}
+		var clause Clause
+		if err := json.Unmarshal(record, &clause); err != nil {
+			return nil, fmt.Errorf("invalid clause history record: %w", err)
+		}
+		for _, field := range []string{"_txId", "_timestamp", "_isDelete"} {
+			delete(clause.Extra, field)
+		}
+		if len(clause.Extra) == 0 {
+			clause.Extra = nil
+		}
+
+		versions = append(versions, ClauseVersion{
+			TxID:      tx.TxID,
+			Timestamp: tx.Timestamp,
+			IsDeleted: tx.IsDeleted,
+			Clause:    clause,
+		})
+	}
+	return versions, nil
+}
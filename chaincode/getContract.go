@@ -0,0 +1,49 @@
+package chaincode
+
+import (
+	"context"
+	"fmt"
+)
+
+func GetContract(ctx context.Context, key string) (*AutoExecutableContract, error) {
+	var contract AutoExecutableContract
+	if err := getAsset(ctx, AssetTypeContract, key, &contract); err != nil {
+		return nil, err
+	}
+
+	return &contract, nil
+}
+
+// SearchContracts returns the contracts matching selector. The asset type is
+// added to the selector.
+func SearchContracts(ctx context.Context, selector map[string]interface{}) ([]AutoExecutableContract, error) {
+	query := map[string]interface{}{"@assetType": AssetTypeContract}
+	for k, v := range selector {
+		query[k] = v
+	}
+
+	var contracts []AutoExecutableContract
+	if err := searchAssets(ctx, query, &contracts); err != nil {
+		return nil, err
+	}
+
+	return contracts, nil
+}
+
+// GetClauseContract returns the contract holding the clause with the given
+// key
+func GetClauseContract(ctx context.Context, clauseKey string) (*AutoExecutableContract, error) {
+	contracts, err := SearchContracts(ctx, map[string]interface{}{
+		"clauses": map[string]interface{}{
+			"$elemMatch": map[string]interface{}{"@key": clauseKey},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(contracts) == 0 {
+		return nil, fmt.Errorf("no contract holds clause %s: %w", clauseKey, ErrNotFound)
+	}
+
+	return &contracts[0], nil
+}
@@ -1,62 +1,28 @@
 package chaincode
 
 import (
-	"encoding/base64"
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"os"
-
-	"github.com/cloudflare/cfssl/log"
 )
 
-func GetDoc(key string) (map[string]interface{}, error) {
-	request, err := json.Marshal(map[string]interface{}{
+func GetDoc(ctx context.Context, key string) (map[string]interface{}, error) {
+	request := map[string]interface{}{
 		"key": map[string]interface{}{
 			"@assetType": "document",
 			"@key":       key,
 		},
-	})
-	if err != nil {
-		log.Error("Could not marshal request body", err)
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-
-	reqB64 := base64.StdEncoding.EncodeToString(request)
-
-	getDoc := os.Getenv("ORG_URL") + "/query/getDoc?@request=" + reqB64
-
-	res, err := http.Get(getDoc)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send GET request: %w", err)
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return nil, errors.New("asset not found")
+	var response struct {
+		Result []map[string]interface{} `json:"result"`
 	}
-
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get file")
+	if err := DefaultClient().Query(ctx, "getDoc", request, &response); err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
 	}
 
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	if len(response.Result) == 0 {
+		return nil, fmt.Errorf("no result found in response: %w", ErrNotFound)
 	}
 
-	var response map[string]interface{}
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response body: %w", err)
-	}
-
-	result, ok := response["result"].([]interface{})
-	if !ok || len(result) == 0 {
-		return nil, errors.New("no result found in response")
-	}
-
-	return result[0].(map[string]interface{}), nil
-
+	return response.Result[0], nil
 }
@@ -0,0 +1,28 @@
+package chaincode
+
+import (
+	"context"
+	"fmt"
+)
+
+// GetDocByHash returns the document whose original or signed file has the
+// given SHA-256 hash
+func GetDocByHash(ctx context.Context, hash string) (map[string]interface{}, error) {
+	selector := map[string]interface{}{
+		"@assetType": "document",
+		"$or": []interface{}{
+			map[string]interface{}{"originalHash": hash},
+			map[string]interface{}{"finalHash": hash},
+		},
+	}
+
+	var docs []map[string]interface{}
+	if err := searchAssets(ctx, selector, &docs); err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no document with hash %s: %w", hash, ErrNotFound)
+	}
+
+	return docs[0], nil
+}
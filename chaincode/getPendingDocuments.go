@@ -0,0 +1,19 @@
+package chaincode
+
+import (
+	"context"
+)
+
+// GetPendingDocuments returns the documents still waiting for signatures
+func GetPendingDocuments(ctx context.Context) ([]map[string]interface{}, error) {
+	selector := map[string]interface{}{
+		"@assetType": "document",
+		"status":     0,
+	}
+
+	var docs []map[string]interface{}
+	if err := searchAssets(ctx, selector, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
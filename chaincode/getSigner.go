@@ -1,62 +1,25 @@
 package chaincode
 
 import (
-	"encoding/base64"
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"os"
-
-	"github.com/cloudflare/cfssl/log"
 )
 
-func GetSigner(key string) (map[string]interface{}, error) {
-	request, err := json.Marshal(map[string]interface{}{
-		"key": map[string]interface{}{
-			"@assetType": "user",
-			"@key":       key,
-		},
-	})
-	if err != nil {
-		log.Error("Could not marshal request body", err)
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-
-	reqB64 := base64.StdEncoding.EncodeToString(request)
-
-	getDoc := os.Getenv("ORG_URL") + "/query/getSigner?@request=" + reqB64
-
-	res, err := http.Get(getDoc)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send GET request: %w", err)
+func GetSigner(ctx context.Context, key string) (*User, error) {
+	request := map[string]interface{}{
+		"key": UserRef(key),
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return nil, errors.New("asset not found")
+	var response struct {
+		Result []User `json:"result"`
 	}
-
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get signer")
+	if err := DefaultClient().Query(ctx, "getSigner", request, &response); err != nil {
+		return nil, fmt.Errorf("failed to get signer: %w", err)
 	}
 
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	if len(response.Result) == 0 {
+		return nil, fmt.Errorf("no result found in response: %w", ErrNotFound)
 	}
 
-	var response map[string]interface{}
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response body: %w", err)
-	}
-
-	result, ok := response["result"].([]interface{})
-	if !ok || len(result) == 0 {
-		return nil, errors.New("no result found in response")
-	}
-
-	return result[0].(map[string]interface{}), nil
-
+	return &response.Result[0], nil
 }
@@ -0,0 +1,55 @@
+package chaincode
+
+import (
+	"context"
+)
+
+func GetTemplate(ctx context.Context, key string) (*Template, error) {
+	var template Template
+	if err := getAsset(ctx, AssetTypeTemplate, key, &template); err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+func GetTemplateClause(ctx context.Context, key string) (*TemplateClause, error) {
+	var templateClause TemplateClause
+	if err := getAsset(ctx, AssetTypeTemplateClause, key, &templateClause); err != nil {
+		return nil, err
+	}
+
+	return &templateClause, nil
+}
+
+// SearchTemplates returns the templates matching selector. The asset type is
+// added to the selector.
+func SearchTemplates(ctx context.Context, selector map[string]interface{}) ([]Template, error) {
+	query := map[string]interface{}{"@assetType": AssetTypeTemplate}
+	for k, v := range selector {
+		query[k] = v
+	}
+
+	var templates []Template
+	if err := searchAssets(ctx, query, &templates); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// SearchTemplateClauses returns the template clauses matching selector. The
+// asset type is added to the selector.
+func SearchTemplateClauses(ctx context.Context, selector map[string]interface{}) ([]TemplateClause, error) {
+	query := map[string]interface{}{"@assetType": AssetTypeTemplateClause}
+	for k, v := range selector {
+		query[k] = v
+	}
+
+	var clauses []TemplateClause
+	if err := searchAssets(ctx, query, &clauses); err != nil {
+		return nil, err
+	}
+
+	return clauses, nil
+}
@@ -0,0 +1,43 @@
+package chaincode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time returns the time of the transaction. The gateway formats timestamps as
+// "seconds:1700000000 nanos:0"; RFC 3339 timestamps are accepted too.
+func (r DocumentHistoryRecord) Time() (time.Time, error) {
+	return parseTimestamp(r.Timestamp)
+}
+
+func parseTimestamp(timestamp string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+		return t, nil
+	}
+
+	var seconds, nanos int64
+	for _, field := range strings.Fields(timestamp) {
+		name, value, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", timestamp, err)
+		}
+		switch name {
+		case "seconds":
+			seconds = n
+		case "nanos":
+			nanos = n
+		}
+	}
+	if seconds == 0 && nanos == 0 {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+
+	return time.Unix(seconds, nanos).UTC(), nil
+}
@@ -1,53 +1,57 @@
 package chaincode
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func SearchAsset(req map[string]interface{}) (map[string]interface{}, error) {
-	path := os.Getenv("ORG_URL") + "/query/search"
-	selectorMap := map[string]interface{}{
-		"selector": req,
-	}
-	reqMap := map[string]interface{}{
-		"query": selectorMap,
+func SearchAsset(ctx context.Context, req map[string]interface{}) (map[string]interface{}, error) {
+	var resp map[string]interface{}
+	if err := DefaultClient().Search(ctx, req, &resp); err != nil {
+		return nil, fmt.Errorf("failed to search for the query: %w", err)
 	}
 
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-	requestBody := bytes.NewBuffer(body)
+	return resp, nil
+}
 
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
+// searchAssets decodes every asset matching selector into out, which must be
+// a pointer to a slice
+func searchAssets(ctx context.Context, selector map[string]interface{}, out interface{}) error {
+	var response struct {
+		Result json.RawMessage `json:"result"`
 	}
-
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to search for the query")
+	if err := DefaultClient().Search(ctx, selector, &response); err != nil {
+		return fmt.Errorf("failed to search for the query: %w", err)
 	}
 
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	if len(response.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(response.Result, out); err != nil {
+		return fmt.Errorf("failed to decode search result: %w", err)
 	}
+	return nil
+}
 
-	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+// getAsset decodes the asset with the given type and key into out
+func getAsset(ctx context.Context, assetType, key string, out interface{}) error {
+	var response struct {
+		Result []json.RawMessage `json:"result"`
+	}
+	selector := map[string]interface{}{
+		"@assetType": assetType,
+		"@key":       key,
+	}
+	if err := DefaultClient().Search(ctx, selector, &response); err != nil {
+		return fmt.Errorf("failed to search for %s: %w", assetType, err)
 	}
 
-	return resp, nil
+	if len(response.Result) == 0 {
+		return fmt.Errorf("%s %s: %w", assetType, key, ErrNotFound)
+	}
+	if err := json.Unmarshal(response.Result[0], out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", assetType, err)
+	}
+	return nil
 }
@@ -0,0 +1,22 @@
+package chaincode
+
+// SignatureField is where the visible signature of a signer is stamped. X
+// and Y are in PDF points from the bottom left corner of the page, and pages
+// are numbered from 1.
+type SignatureField struct {
+	Signer Signer  `json:"signer"`
+	Page   int     `json:"page"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+}
+
+// SignatureFieldOf returns the signature field of the signer, if the document
+// defines one
+func (f FileAsset) SignatureFieldOf(key string) (SignatureField, bool) {
+	for _, field := range f.SignatureFields {
+		if field.Signer.Key == key {
+			return field, true
+		}
+	}
+	return SignatureField{}, false
+}
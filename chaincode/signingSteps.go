@@ -0,0 +1,82 @@
+package chaincode
+
+import "encoding/json"
+
+// SigningStep is a group of signers who may sign a document in any order.
+// The steps of a document are signed one after the other.
+type SigningStep struct {
+	Role    string   `json:"role,omitempty"`
+	Signers []Signer `json:"signers"`
+}
+
+// FileAssetFromMap decodes a document returned by the ledger
+func FileAssetFromMap(asset map[string]interface{}) (FileAsset, error) {
+	var f FileAsset
+
+	raw, err := json.Marshal(asset)
+	if err != nil {
+		return f, err
+	}
+	err = json.Unmarshal(raw, &f)
+	return f, err
+}
+
+// Steps returns the signing steps of the document. Documents without steps
+// are signed by all the required signers in parallel.
+func (f FileAsset) Steps() []SigningStep {
+	if len(f.SigningSteps) > 0 {
+		return f.SigningSteps
+	}
+	return []SigningStep{{Signers: f.RequiredSignatures}}
+}
+
+// HasActed reports whether the signer already signed or rejected the document
+func (f FileAsset) HasActed(key string) bool {
+	for _, signers := range [][]Signer{f.SuccessfulSignatures, f.RejectedSignatures} {
+		for _, s := range signers {
+			if s.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CurrentStep returns the index of the first step with signers that have not
+// acted yet, or -1 once every signer has acted
+func (f FileAsset) CurrentStep() int {
+	for i, step := range f.Steps() {
+		for _, s := range step.Signers {
+			if !f.HasActed(s.Key) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// PendingSigners returns the signers of the current step that have not acted yet
+func (f FileAsset) PendingSigners() []Signer {
+	current := f.CurrentStep()
+	if current < 0 {
+		return nil
+	}
+
+	var pending []Signer
+	for _, s := range f.Steps()[current].Signers {
+		if !f.HasActed(s.Key) {
+			pending = append(pending, s)
+		}
+	}
+	return pending
+}
+
+// IsTurnOf reports whether the signer may sign the document now
+func (f FileAsset) IsTurnOf(key string) bool {
+	for _, s := range f.PendingSigners() {
+		if s.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -1,19 +1,21 @@
 package chaincode
 
 type FileAsset struct {
-	AssetType            string    `json:"@assetType"`
-	OriginalHash         string    `json:"originalHash"`
-	FinalHash            string    `json:"finalHash"`
-	Status               int       `json:"status"`
-	RequiredSignatures   []Signer  `json:"requiredSignatures"`
-	SuccessfulSignatures []Signer  `json:"successfulSignatures"`
-	RejectedSignatures   []Signer  `json:"rejectedSignatures"`
-	OriginalDocURL       string    `json:"originalDocURL"`
-	FinalDocURL          string    `json:"finalDocURL"`
-	Name                 string    `json:"name"`
-	Signature            Signature `json:"signature"`
-	Owner                Signer    `json:"owner"`
-	Timeout              string    `json:"timeout"`
+	AssetType            string           `json:"@assetType"`
+	OriginalHash         string           `json:"originalHash"`
+	FinalHash            string           `json:"finalHash"`
+	Status               int              `json:"status"`
+	RequiredSignatures   []Signer         `json:"requiredSignatures"`
+	SuccessfulSignatures []Signer         `json:"successfulSignatures"`
+	RejectedSignatures   []Signer         `json:"rejectedSignatures"`
+	OriginalDocURL       string           `json:"originalDocURL"`
+	FinalDocURL          string           `json:"finalDocURL"`
+	Name                 string           `json:"name"`
+	Signature            Signature        `json:"signature"`
+	Owner                Signer           `json:"owner"`
+	Timeout              string           `json:"timeout"`
+	SigningSteps         []SigningStep    `json:"signingSteps,omitempty"`
+	SignatureFields      []SignatureField `json:"signatureFields,omitempty"`
 }
 
 type Signer struct {
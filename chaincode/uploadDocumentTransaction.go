@@ -1,17 +1,11 @@
 package chaincode
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-
-	"github.com/google/logger"
 )
 
-func UploadDocumentTransaction(f FileAsset) (map[string]interface{}, error) {
+func UploadDocumentTransaction(ctx context.Context, f FileAsset) (map[string]interface{}, error) {
 	f.AssetType = "document"
 
 	successfulSignatureSlice := []Signer{}
@@ -20,7 +14,6 @@ func UploadDocumentTransaction(f FileAsset) (map[string]interface{}, error) {
 	rejectedSignatureSlice := []Signer{}
 	rejectedSignatureSlice = append(rejectedSignatureSlice, f.RejectedSignatures...)
 
-	path := os.Getenv("ORG_URL") + "/invoke/uploadDocument"
 	reqMap := map[string]interface{}{
 		"originalHash":         f.OriginalHash,
 		"status":               f.Status,
@@ -38,37 +31,19 @@ func UploadDocumentTransaction(f FileAsset) (map[string]interface{}, error) {
 	if f.FinalDocURL != "" {
 		reqMap["finalDocURL"] = f.FinalDocURL
 	}
-	if f.Signature.Key != "" {
-		reqMap["signature"] = f.Signature
-	}
-
-	body, err := json.Marshal(reqMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	if len(f.SigningSteps) > 0 {
+		reqMap["signingSteps"] = f.SigningSteps
 	}
-	requestBody := bytes.NewBuffer(body)
-
-	res, err := http.Post(path, "application/json", requestBody)
-	if err != nil {
-		fmt.Println("error: " + err.Error())
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to send request to chaincode: %w", err)
+	if len(f.SignatureFields) > 0 {
+		reqMap["signatureFields"] = f.SignatureFields
 	}
-
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("res: ", res)
-		return nil, fmt.Errorf("failed to create asset")
-	}
-
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	if f.Signature.Key != "" {
+		reqMap["signature"] = f.Signature
 	}
 
 	var resp map[string]interface{}
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		logger.Errorf("failed to unmarshal response from blockchain")
+	if err := DefaultClient().Invoke(ctx, "uploadDocument", reqMap, &resp); err != nil {
+		return nil, fmt.Errorf("failed to create asset: %w", err)
 	}
 
 	return resp, nil
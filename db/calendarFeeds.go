@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrCalendarFeedNotFound is returned for a user without a calendar feed, or
+// an unknown feed token
+var ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+
+// CalendarFeed is the subscription of a user to the iCalendar feed of the
+// dates of their contracts and documents. Calendar apps cannot send the
+// Cognito token, so the feed is read with a secret token in its URL, of
+// which only the SHA-256 is stored. Each user has one feed at most.
+type CalendarFeed struct {
+	UserKey string `bson:"_id" json:"userKey"`
+	// TokenHash is the hex SHA-256 of the token
+	TokenHash string    `bson:"tokenHash" json:"-"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// CalendarFeedStore stores calendar feeds. CalendarFeedService is the Mongo
+// backed implementation.
+type CalendarFeedStore interface {
+	GetCalendarFeed(ctx context.Context, userKey string) (*CalendarFeed, error)
+	// FindCalendarFeedByToken returns the feed whose token has the hash
+	FindCalendarFeedByToken(ctx context.Context, tokenHash string) (*CalendarFeed, error)
+	// SaveCalendarFeed creates the feed of a user, or replaces it, which
+	// revokes its previous token
+	SaveCalendarFeed(ctx context.Context, feed *CalendarFeed) error
+	DeleteCalendarFeed(ctx context.Context, userKey string) error
+}
+
+var (
+	calendarFeeds   CalendarFeedStore
+	calendarFeedsMu sync.Mutex
+)
+
+// CalendarFeeds returns the calendar feed store used by the handlers. It is
+// backed by Mongo unless replaced with SetCalendarFeeds.
+func CalendarFeeds() CalendarFeedStore {
+	calendarFeedsMu.Lock()
+	defer calendarFeedsMu.Unlock()
+
+	if calendarFeeds != nil {
+		return calendarFeeds
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableCalendarFeeds{}
+	}
+	return NewCalendarFeedService(mongodb.Database())
+}
+
+// SetCalendarFeeds replaces the store returned by CalendarFeeds. Passing nil
+// restores the Mongo backed one.
+func SetCalendarFeeds(s CalendarFeedStore) {
+	calendarFeedsMu.Lock()
+	defer calendarFeedsMu.Unlock()
+
+	calendarFeeds = s
+}
+
+// CalendarFeedService stores calendar feeds in Mongo
+type CalendarFeedService struct {
+	collection *mongo.Collection
+}
+
+// NewCalendarFeedService returns a new CalendarFeedService
+func NewCalendarFeedService(db *mongo.Database) *CalendarFeedService {
+	return &CalendarFeedService{
+		collection: db.Collection(calendarFeedsCollection),
+	}
+}
+
+func (s *CalendarFeedService) GetCalendarFeed(ctx context.Context, userKey string) (*CalendarFeed, error) {
+	return s.findOne(ctx, bson.M{"_id": userKey})
+}
+
+func (s *CalendarFeedService) FindCalendarFeedByToken(ctx context.Context, tokenHash string) (*CalendarFeed, error) {
+	return s.findOne(ctx, bson.M{"tokenHash": tokenHash})
+}
+
+func (s *CalendarFeedService) findOne(ctx context.Context, filter bson.M) (*CalendarFeed, error) {
+	var feed CalendarFeed
+	err := s.collection.FindOne(ctx, filter).Decode(&feed)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCalendarFeedNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (s *CalendarFeedService) SaveCalendarFeed(ctx context.Context, feed *CalendarFeed) error {
+	feed.CreatedAt = time.Now().UTC()
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": feed.UserKey}, feed, opts)
+	return err
+}
+
+func (s *CalendarFeedService) DeleteCalendarFeed(ctx context.Context, userKey string) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": userKey})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrCalendarFeedNotFound
+	}
+	return nil
+}
+
+// MemoryCalendarFeedStore keeps calendar feeds in memory, for tests
+type MemoryCalendarFeedStore struct {
+	mu    sync.Mutex
+	feeds map[string]CalendarFeed
+}
+
+// NewMemoryCalendarFeedStore returns an empty MemoryCalendarFeedStore
+func NewMemoryCalendarFeedStore() *MemoryCalendarFeedStore {
+	return &MemoryCalendarFeedStore{feeds: make(map[string]CalendarFeed)}
+}
+
+func (s *MemoryCalendarFeedStore) GetCalendarFeed(ctx context.Context, userKey string) (*CalendarFeed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	feed, ok := s.feeds[userKey]
+	if !ok {
+		return nil, ErrCalendarFeedNotFound
+	}
+	return &feed, nil
+}
+
+func (s *MemoryCalendarFeedStore) FindCalendarFeedByToken(ctx context.Context, tokenHash string) (*CalendarFeed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, feed := range s.feeds {
+		if feed.TokenHash == tokenHash {
+			return &feed, nil
+		}
+	}
+	return nil, ErrCalendarFeedNotFound
+}
+
+func (s *MemoryCalendarFeedStore) SaveCalendarFeed(ctx context.Context, feed *CalendarFeed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	feed.CreatedAt = time.Now().UTC()
+	s.feeds[feed.UserKey] = *feed
+	return nil
+}
+
+func (s *MemoryCalendarFeedStore) DeleteCalendarFeed(ctx context.Context, userKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.feeds[userKey]; !ok {
+		return ErrCalendarFeedNotFound
+	}
+	delete(s.feeds, userKey)
+	return nil
+}
+
+type unavailableCalendarFeeds struct{}
+
+func (unavailableCalendarFeeds) GetCalendarFeed(ctx context.Context, userKey string) (*CalendarFeed, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableCalendarFeeds) FindCalendarFeedByToken(ctx context.Context, tokenHash string) (*CalendarFeed, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableCalendarFeeds) SaveCalendarFeed(ctx context.Context, feed *CalendarFeed) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableCalendarFeeds) DeleteCalendarFeed(ctx context.Context, userKey string) error {
+	return errors.New("database is not available")
+}
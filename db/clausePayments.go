@@ -0,0 +1,285 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/payments"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrClausePaymentNotFound is returned for an unknown clause payment
+	ErrClausePaymentNotFound = errors.New("clause payment not found")
+	// ErrClausePaymentConflict is returned when a payment was changed since
+	// it was read
+	ErrClausePaymentConflict = errors.New("clause payment was changed concurrently")
+)
+
+// ClausePayment is a payment of a make payment clause charged through a
+// payment provider. It is recorded on the clause once the provider confirms
+// the charge.
+type ClausePayment struct {
+	ID          string `bson:"_id" json:"id"`
+	Provider    string `bson:"provider" json:"provider"`
+	IntentID    string `bson:"intentId" json:"intentId"`
+	ClauseKey   string `bson:"clauseKey" json:"clauseKey"`
+	ContractKey string `bson:"contractKey" json:"contractKey"`
+	PayerKey    string `bson:"payerKey" json:"payerKey"`
+	// Amount is in the minor unit of the currency
+	Amount       int64           `bson:"amount" json:"amount"`
+	Currency     string          `bson:"currency" json:"currency"`
+	FinalPayment bool            `bson:"finalPayment" json:"finalPayment"`
+	Date         string          `bson:"date" json:"date"`
+	Status       payments.Status `bson:"status" json:"status"`
+	Refunded     int64           `bson:"refunded,omitempty" json:"refunded,omitempty"`
+	// RecordedAt is set once the payment was recorded on the clause
+	RecordedAt *time.Time `bson:"recordedAt,omitempty" json:"recordedAt,omitempty"`
+	// Error is the last failure to capture or record the payment
+	Error string `bson:"error,omitempty" json:"error,omitempty"`
+	// Version is incremented by every save, to detect concurrent changes
+	Version   int       `bson:"version" json:"-"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ClausePaymentStore stores clause payments. ClausePaymentService is the
+// Mongo backed implementation.
+type ClausePaymentStore interface {
+	CreateClausePayment(ctx context.Context, payment *ClausePayment) error
+	GetClausePayment(ctx context.Context, id string) (*ClausePayment, error)
+	// FindClausePaymentByIntent returns the payment charged by the intent of
+	// a provider
+	FindClausePaymentByIntent(ctx context.Context, provider, intentID string) (*ClausePayment, error)
+	// ListClausePayments returns the payments of a clause, newest first
+	ListClausePayments(ctx context.Context, clauseKey string) ([]ClausePayment, error)
+	// SaveClausePayment stores a payment and increments its version. It
+	// returns ErrClausePaymentConflict when the stored version is not the one
+	// that was read.
+	SaveClausePayment(ctx context.Context, payment *ClausePayment) error
+}
+
+var (
+	clausePayments   ClausePaymentStore
+	clausePaymentsMu sync.Mutex
+)
+
+// ClausePayments returns the clause payment store used by the handlers. It is
+// backed by Mongo unless replaced with SetClausePayments.
+func ClausePayments() ClausePaymentStore {
+	clausePaymentsMu.Lock()
+	defer clausePaymentsMu.Unlock()
+
+	if clausePayments != nil {
+		return clausePayments
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableClausePayments{}
+	}
+	return NewClausePaymentService(mongodb.Database())
+}
+
+// SetClausePayments replaces the store returned by ClausePayments. Passing
+// nil restores the Mongo backed one.
+func SetClausePayments(s ClausePaymentStore) {
+	clausePaymentsMu.Lock()
+	defer clausePaymentsMu.Unlock()
+
+	clausePayments = s
+}
+
+// ClausePaymentService stores clause payments in Mongo
+type ClausePaymentService struct {
+	collection *mongo.Collection
+}
+
+// NewClausePaymentService returns a new ClausePaymentService
+func NewClausePaymentService(db *mongo.Database) *ClausePaymentService {
+	return &ClausePaymentService{
+		collection: db.Collection(clausePaymentsCollection),
+	}
+}
+
+func (s *ClausePaymentService) CreateClausePayment(ctx context.Context, payment *ClausePayment) error {
+	stampNewClausePayment(payment)
+
+	_, err := s.collection.InsertOne(ctx, payment)
+	return err
+}
+
+func (s *ClausePaymentService) GetClausePayment(ctx context.Context, id string) (*ClausePayment, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+func (s *ClausePaymentService) FindClausePaymentByIntent(ctx context.Context, provider, intentID string) (*ClausePayment, error) {
+	return s.findOne(ctx, bson.M{"provider": provider, "intentId": intentID})
+}
+
+func (s *ClausePaymentService) findOne(ctx context.Context, filter bson.M) (*ClausePayment, error) {
+	var payment ClausePayment
+	err := s.collection.FindOne(ctx, filter).Decode(&payment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrClausePaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (s *ClausePaymentService) ListClausePayments(ctx context.Context, clauseKey string) ([]ClausePayment, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := s.collection.Find(ctx, bson.M{"clauseKey": clauseKey}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []ClausePayment{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *ClausePaymentService) SaveClausePayment(ctx context.Context, payment *ClausePayment) error {
+	saved := *payment
+	saved.Version++
+	saved.UpdatedAt = time.Now().UTC()
+
+	filter := bson.M{"_id": payment.ID, "version": payment.Version}
+	result, err := s.collection.ReplaceOne(ctx, filter, saved)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrClausePaymentConflict
+	}
+
+	*payment = saved
+	return nil
+}
+
+// MemoryClausePaymentStore keeps clause payments in memory, for tests
+type MemoryClausePaymentStore struct {
+	mu       sync.Mutex
+	payments map[string]ClausePayment
+}
+
+// NewMemoryClausePaymentStore returns an empty MemoryClausePaymentStore
+func NewMemoryClausePaymentStore() *MemoryClausePaymentStore {
+	return &MemoryClausePaymentStore{payments: make(map[string]ClausePayment)}
+}
+
+func (s *MemoryClausePaymentStore) CreateClausePayment(ctx context.Context, payment *ClausePayment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stampNewClausePayment(payment)
+	s.payments[payment.ID] = copyClausePayment(*payment)
+	return nil
+}
+
+func (s *MemoryClausePaymentStore) GetClausePayment(ctx context.Context, id string) (*ClausePayment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[id]
+	if !ok {
+		return nil, ErrClausePaymentNotFound
+	}
+	payment = copyClausePayment(payment)
+	return &payment, nil
+}
+
+func (s *MemoryClausePaymentStore) FindClausePaymentByIntent(ctx context.Context, provider, intentID string) (*ClausePayment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, payment := range s.payments {
+		if payment.Provider == provider && payment.IntentID == intentID {
+			payment = copyClausePayment(payment)
+			return &payment, nil
+		}
+	}
+	return nil, ErrClausePaymentNotFound
+}
+
+func (s *MemoryClausePaymentStore) ListClausePayments(ctx context.Context, clauseKey string) ([]ClausePayment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []ClausePayment{}
+	for _, payment := range s.payments {
+		if payment.ClauseKey == clauseKey {
+			list = append(list, copyClausePayment(payment))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+func (s *MemoryClausePaymentStore) SaveClausePayment(ctx context.Context, payment *ClausePayment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.payments[payment.ID]
+	if !ok || stored.Version != payment.Version {
+		return ErrClausePaymentConflict
+	}
+
+	payment.Version++
+	payment.UpdatedAt = time.Now().UTC()
+	s.payments[payment.ID] = copyClausePayment(*payment)
+	return nil
+}
+
+// stampNewClausePayment sets the id and creation time of a payment being
+// created
+func stampNewClausePayment(payment *ClausePayment) {
+	if payment.ID == "" {
+		payment.ID = primitive.NewObjectID().Hex()
+	}
+	payment.CreatedAt = time.Now().UTC()
+	payment.UpdatedAt = payment.CreatedAt
+}
+
+func copyClausePayment(payment ClausePayment) ClausePayment {
+	if payment.RecordedAt != nil {
+		recordedAt := *payment.RecordedAt
+		payment.RecordedAt = &recordedAt
+	}
+	return payment
+}
+
+type unavailableClausePayments struct{}
+
+func (unavailableClausePayments) CreateClausePayment(ctx context.Context, payment *ClausePayment) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableClausePayments) GetClausePayment(ctx context.Context, id string) (*ClausePayment, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableClausePayments) FindClausePaymentByIntent(ctx context.Context, provider, intentID string) (*ClausePayment, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableClausePayments) ListClausePayments(ctx context.Context, clauseKey string) ([]ClausePayment, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableClausePayments) SaveClausePayment(ctx context.Context, payment *ClausePayment) error {
+	return errors.New("database is not available")
+}
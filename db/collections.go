@@ -1,3 +1,18 @@
 package db
 
-const notificationsCollection = "notifications"
+const (
+	notificationsCollection    = "notifications"
+	envelopesCollection        = "envelopes"
+	remindersCollection        = "reminders"
+	jobsCollection             = "jobs"
+	jobRunsCollection          = "jobRuns"
+	executionsCollection       = "contractExecutions"
+	lifecyclesCollection       = "contractLifecycles"
+	templateVersionsCollection = "templateVersions"
+	upgradesCollection         = "upgradeProposals"
+	templateListingsCollection = "templateListings"
+	templateGrantsCollection   = "templateGrants"
+	clausePaymentsCollection   = "clausePayments"
+	paymentReceiptsCollection  = "paymentReceipts"
+	calendarFeedsCollection    = "calendarFeeds"
+)
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ContractExecution is an attempt to execute the clauses of a contract
+type ContractExecution struct {
+	ID          string            `bson:"_id" json:"id"`
+	ContractKey string            `bson:"contractKey" json:"contractKey"`
+	DryRun      bool              `bson:"dryRun,omitempty" json:"dryRun,omitempty"`
+	StartedAt   time.Time         `bson:"startedAt" json:"startedAt"`
+	DurationMs  int64             `bson:"durationMs" json:"durationMs"`
+	Success     bool              `bson:"success" json:"success"`
+	Error       string            `bson:"error,omitempty" json:"error,omitempty"`
+	Clauses     []ClauseExecution `bson:"clauses" json:"clauses"`
+}
+
+// ClauseExecution is a clause evaluated by a contract execution, with the
+// input it was given and the result it produced
+type ClauseExecution struct {
+	Key         string                 `bson:"key" json:"key"`
+	Id          string                 `bson:"id,omitempty" json:"id,omitempty"`
+	Description string                 `bson:"description,omitempty" json:"description,omitempty"`
+	ActionType  int                    `bson:"actionType" json:"actionType"`
+	Input       map[string]interface{} `bson:"input,omitempty" json:"input,omitempty"`
+	Result      map[string]interface{} `bson:"result,omitempty" json:"result,omitempty"`
+	// Finalized tells whether the clause was finalized by the execution
+	Finalized bool `bson:"finalized" json:"finalized"`
+	// Changed tells whether the execution changed the result of the clause
+	Changed bool `bson:"changed" json:"changed"`
+}
+
+// ContractExecutionStore stores contract executions.
+// ContractExecutionService is the Mongo backed implementation.
+type ContractExecutionStore interface {
+	RecordContractExecution(ctx context.Context, execution *ContractExecution) error
+	// ListContractExecutions returns the last executions of a contract,
+	// newest first
+	ListContractExecutions(ctx context.Context, contractKey string, limit int) ([]ContractExecution, error)
+}
+
+var (
+	executionStore ContractExecutionStore
+	executionMu    sync.Mutex
+)
+
+// ContractExecutions returns the execution store used by the handlers. It is
+// backed by Mongo unless replaced with SetContractExecutions.
+func ContractExecutions() ContractExecutionStore {
+	executionMu.Lock()
+	defer executionMu.Unlock()
+
+	if executionStore != nil {
+		return executionStore
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableExecutions{}
+	}
+	return NewContractExecutionService(mongodb.Database())
+}
+
+// SetContractExecutions replaces the store returned by ContractExecutions.
+// Passing nil restores the Mongo backed one.
+func SetContractExecutions(s ContractExecutionStore) {
+	executionMu.Lock()
+	defer executionMu.Unlock()
+
+	executionStore = s
+}
+
+// ContractExecutionService stores contract executions in Mongo
+type ContractExecutionService struct {
+	collection *mongo.Collection
+}
+
+// NewContractExecutionService returns a new ContractExecutionService
+func NewContractExecutionService(db *mongo.Database) *ContractExecutionService {
+	return &ContractExecutionService{
+		collection: db.Collection(executionsCollection),
+	}
+}
+
+func (s *ContractExecutionService) RecordContractExecution(ctx context.Context, execution *ContractExecution) error {
+	if execution.ID == "" {
+		execution.ID = primitive.NewObjectID().Hex()
+	}
+	_, err := s.collection.InsertOne(ctx, execution)
+	return err
+}
+
+func (s *ContractExecutionService) ListContractExecutions(ctx context.Context, contractKey string, limit int) ([]ContractExecution, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}}).SetLimit(int64(limit))
+
+	cursor, err := s.collection.Find(ctx, bson.M{"contractKey": contractKey}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	executions := []ContractExecution{}
+	if err := cursor.All(ctx, &executions); err != nil {
+		return nil, err
+	}
+	return executions, nil
+}
+
+// MemoryContractExecutionStore keeps contract executions in memory, for tests
+type MemoryContractExecutionStore struct {
+	mu         sync.Mutex
+	executions []ContractExecution
+}
+
+// NewMemoryContractExecutionStore returns an empty
+// MemoryContractExecutionStore
+func NewMemoryContractExecutionStore() *MemoryContractExecutionStore {
+	return &MemoryContractExecutionStore{}
+}
+
+func (s *MemoryContractExecutionStore) RecordContractExecution(ctx context.Context, execution *ContractExecution) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if execution.ID == "" {
+		execution.ID = primitive.NewObjectID().Hex()
+	}
+	s.executions = append(s.executions, *execution)
+	return nil
+}
+
+func (s *MemoryContractExecutionStore) ListContractExecutions(ctx context.Context, contractKey string, limit int) ([]ContractExecution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	executions := []ContractExecution{}
+	for _, execution := range s.executions {
+		if execution.ContractKey == contractKey {
+			executions = append(executions, execution)
+		}
+	}
+	sort.SliceStable(executions, func(i, j int) bool {
+		return executions[i].StartedAt.After(executions[j].StartedAt)
+	})
+	if limit > 0 && len(executions) > limit {
+		executions = executions[:limit]
+	}
+	return executions, nil
+}
+
+type unavailableExecutions struct{}
+
+func (unavailableExecutions) RecordContractExecution(ctx context.Context, execution *ContractExecution) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableExecutions) ListContractExecutions(ctx context.Context, contractKey string, limit int) ([]ContractExecution, error) {
+	return nil, errors.New("database is not available")
+}
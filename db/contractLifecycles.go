@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrLifecycleNotFound is returned for a contract without a stored
+	// lifecycle
+	ErrLifecycleNotFound = errors.New("contract lifecycle not found")
+	// ErrLifecycleConflict is returned when a lifecycle was changed since it
+	// was read
+	ErrLifecycleConflict = errors.New("contract lifecycle was changed concurrently")
+)
+
+// ContractState is a stage of the lifecycle of a contract
+type ContractState string
+
+// States of a contract. A draft contract waits for participants to be
+// invited, and becomes active once every invited participant has accepted.
+const (
+	ContractDraft             ContractState = "draft"
+	ContractPendingAcceptance ContractState = "pendingAcceptance"
+	ContractActive            ContractState = "active"
+	ContractCompleted         ContractState = "completed"
+	ContractCancelled         ContractState = "cancelled"
+)
+
+// ContractLifecycle is the state of a contract, with the answers of the
+// participants invited to it
+type ContractLifecycle struct {
+	ContractKey string        `bson:"_id" json:"contractKey"`
+	State       ContractState `bson:"state" json:"state"`
+	Invited     []string      `bson:"invited" json:"invited"`
+	Accepted    []string      `bson:"accepted" json:"accepted"`
+	Declined    []string      `bson:"declined" json:"declined"`
+	// Version is incremented by every save, to detect concurrent changes
+	Version   int       `bson:"version" json:"-"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// LifecycleStore stores contract lifecycles. LifecycleService is the Mongo
+// backed implementation.
+type LifecycleStore interface {
+	GetContractLifecycle(ctx context.Context, contractKey string) (*ContractLifecycle, error)
+	// SaveContractLifecycle stores a lifecycle and increments its version. It
+	// returns ErrLifecycleConflict when the stored version is not the one
+	// that was read, or when a new lifecycle already exists.
+	SaveContractLifecycle(ctx context.Context, lifecycle *ContractLifecycle) error
+}
+
+var (
+	lifecycles   LifecycleStore
+	lifecyclesMu sync.Mutex
+)
+
+// Lifecycles returns the lifecycle store used by the handlers. It is backed
+// by Mongo unless replaced with SetLifecycles.
+func Lifecycles() LifecycleStore {
+	lifecyclesMu.Lock()
+	defer lifecyclesMu.Unlock()
+
+	if lifecycles != nil {
+		return lifecycles
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableLifecycles{}
+	}
+	return NewLifecycleService(mongodb.Database())
+}
+
+// SetLifecycles replaces the store returned by Lifecycles. Passing nil
+// restores the Mongo backed one.
+func SetLifecycles(s LifecycleStore) {
+	lifecyclesMu.Lock()
+	defer lifecyclesMu.Unlock()
+
+	lifecycles = s
+}
+
+// LifecycleService stores contract lifecycles in Mongo
+type LifecycleService struct {
+	collection *mongo.Collection
+}
+
+// NewLifecycleService returns a new LifecycleService
+func NewLifecycleService(db *mongo.Database) *LifecycleService {
+	return &LifecycleService{
+		collection: db.Collection(lifecyclesCollection),
+	}
+}
+
+func (s *LifecycleService) GetContractLifecycle(ctx context.Context, contractKey string) (*ContractLifecycle, error) {
+	var lifecycle ContractLifecycle
+	err := s.collection.FindOne(ctx, bson.M{"_id": contractKey}).Decode(&lifecycle)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrLifecycleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lifecycle, nil
+}
+
+func (s *LifecycleService) SaveContractLifecycle(ctx context.Context, lifecycle *ContractLifecycle) error {
+	saved := *lifecycle
+	saved.Version++
+	saved.UpdatedAt = time.Now().UTC()
+
+	if lifecycle.Version == 0 {
+		_, err := s.collection.InsertOne(ctx, saved)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrLifecycleConflict
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		filter := bson.M{"_id": lifecycle.ContractKey, "version": lifecycle.Version}
+		result, err := s.collection.ReplaceOne(ctx, filter, saved)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrLifecycleConflict
+		}
+	}
+
+	*lifecycle = saved
+	return nil
+}
+
+// MemoryLifecycleStore keeps contract lifecycles in memory, for tests
+type MemoryLifecycleStore struct {
+	mu         sync.Mutex
+	lifecycles map[string]ContractLifecycle
+}
+
+// NewMemoryLifecycleStore returns an empty MemoryLifecycleStore
+func NewMemoryLifecycleStore() *MemoryLifecycleStore {
+	return &MemoryLifecycleStore{lifecycles: make(map[string]ContractLifecycle)}
+}
+
+func (s *MemoryLifecycleStore) GetContractLifecycle(ctx context.Context, contractKey string) (*ContractLifecycle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lifecycle, ok := s.lifecycles[contractKey]
+	if !ok {
+		return nil, ErrLifecycleNotFound
+	}
+	lifecycle.Invited = append([]string(nil), lifecycle.Invited...)
+	lifecycle.Accepted = append([]string(nil), lifecycle.Accepted...)
+	lifecycle.Declined = append([]string(nil), lifecycle.Declined...)
+	return &lifecycle, nil
+}
+
+func (s *MemoryLifecycleStore) SaveContractLifecycle(ctx context.Context, lifecycle *ContractLifecycle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, exists := s.lifecycles[lifecycle.ContractKey]
+	if exists != (lifecycle.Version != 0) || stored.Version != lifecycle.Version {
+		return ErrLifecycleConflict
+	}
+
+	lifecycle.Version++
+	lifecycle.UpdatedAt = time.Now().UTC()
+	saved := *lifecycle
+	saved.Invited = append([]string(nil), lifecycle.Invited...)
+	saved.Accepted = append([]string(nil), lifecycle.Accepted...)
+	saved.Declined = append([]string(nil), lifecycle.Declined...)
+	s.lifecycles[lifecycle.ContractKey] = saved
+	return nil
+}
+
+type unavailableLifecycles struct{}
+
+func (unavailableLifecycles) GetContractLifecycle(ctx context.Context, contractKey string) (*ContractLifecycle, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableLifecycles) SaveContractLifecycle(ctx context.Context, lifecycle *ContractLifecycle) error {
+	return errors.New("database is not available")
+}
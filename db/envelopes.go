@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrEnvelopeNotFound is returned when no envelope has the requested id
+var ErrEnvelopeNotFound = errors.New("envelope not found")
+
+// Envelope groups documents uploaded together. They share signers, timeout
+// and status, and are signed in one action.
+type Envelope struct {
+	ID        string    `bson:"_id" json:"id"`
+	Name      string    `bson:"name" json:"name"`
+	Owner     string    `bson:"owner" json:"owner"`
+	Signers   []string  `bson:"signers" json:"signers"`
+	Documents []string  `bson:"documents" json:"documents"`
+	Timeout   string    `bson:"timeout" json:"timeout"`
+	Status    int       `bson:"status" json:"status"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// EnvelopeStore stores envelopes. EnvelopeService is the Mongo backed
+// implementation.
+type EnvelopeStore interface {
+	CreateEnvelope(ctx context.Context, envelope *Envelope) error
+	GetEnvelope(ctx context.Context, id string) (*Envelope, error)
+	// ListEnvelopes returns the envelopes owned or signed by userID, newest
+	// first
+	ListEnvelopes(ctx context.Context, userID string) ([]Envelope, error)
+	UpdateEnvelopeStatus(ctx context.Context, id string, status int) error
+}
+
+var (
+	envelopes   EnvelopeStore
+	envelopesMu sync.Mutex
+)
+
+// Envelopes returns the envelope store used by the handlers. It is backed by
+// Mongo unless replaced with SetEnvelopes.
+func Envelopes() EnvelopeStore {
+	envelopesMu.Lock()
+	defer envelopesMu.Unlock()
+
+	if envelopes != nil {
+		return envelopes
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableEnvelopes{}
+	}
+	return NewEnvelopeService(mongodb.Database())
+}
+
+// SetEnvelopes replaces the store returned by Envelopes. Passing nil restores
+// the Mongo backed one.
+func SetEnvelopes(s EnvelopeStore) {
+	envelopesMu.Lock()
+	defer envelopesMu.Unlock()
+
+	envelopes = s
+}
+
+// EnvelopeService stores envelopes in Mongo
+type EnvelopeService struct {
+	collection *mongo.Collection
+}
+
+// NewEnvelopeService returns a new EnvelopeService
+func NewEnvelopeService(db *mongo.Database) *EnvelopeService {
+	return &EnvelopeService{
+		collection: db.Collection(envelopesCollection),
+	}
+}
+
+func (s *EnvelopeService) CreateEnvelope(ctx context.Context, envelope *Envelope) error {
+	stampNewEnvelope(envelope)
+
+	_, err := s.collection.InsertOne(ctx, envelope)
+	return err
+}
+
+func (s *EnvelopeService) GetEnvelope(ctx context.Context, id string) (*Envelope, error) {
+	var envelope Envelope
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&envelope)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrEnvelopeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
+
+func (s *EnvelopeService) ListEnvelopes(ctx context.Context, userID string) ([]Envelope, error) {
+	filter := bson.M{"$or": []bson.M{{"owner": userID}, {"signers": userID}}}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	envelopes := []Envelope{}
+	if err := cursor.All(ctx, &envelopes); err != nil {
+		return nil, err
+	}
+	return envelopes, nil
+}
+
+func (s *EnvelopeService) UpdateEnvelopeStatus(ctx context.Context, id string, status int) error {
+	update := bson.M{"$set": bson.M{"status": status, "updatedAt": time.Now().UTC()}}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrEnvelopeNotFound
+	}
+	return nil
+}
+
+// MemoryEnvelopeStore keeps envelopes in memory, for tests
+type MemoryEnvelopeStore struct {
+	mu        sync.Mutex
+	envelopes map[string]Envelope
+}
+
+// NewMemoryEnvelopeStore returns an empty MemoryEnvelopeStore
+func NewMemoryEnvelopeStore() *MemoryEnvelopeStore {
+	return &MemoryEnvelopeStore{envelopes: make(map[string]Envelope)}
+}
+
+func (s *MemoryEnvelopeStore) CreateEnvelope(ctx context.Context, envelope *Envelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stampNewEnvelope(envelope)
+	s.envelopes[envelope.ID] = copyEnvelope(*envelope)
+	return nil
+}
+
+func (s *MemoryEnvelopeStore) GetEnvelope(ctx context.Context, id string) (*Envelope, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	envelope, ok := s.envelopes[id]
+	if !ok {
+		return nil, ErrEnvelopeNotFound
+	}
+	envelope = copyEnvelope(envelope)
+	return &envelope, nil
+}
+
+func (s *MemoryEnvelopeStore) ListEnvelopes(ctx context.Context, userID string) ([]Envelope, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	envelopes := []Envelope{}
+	for _, envelope := range s.envelopes {
+		if envelope.Owner == userID || containsString(envelope.Signers, userID) {
+			envelopes = append(envelopes, copyEnvelope(envelope))
+		}
+	}
+	sort.Slice(envelopes, func(i, j int) bool {
+		return envelopes[i].CreatedAt.After(envelopes[j].CreatedAt)
+	})
+	return envelopes, nil
+}
+
+func (s *MemoryEnvelopeStore) UpdateEnvelopeStatus(ctx context.Context, id string, status int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	envelope, ok := s.envelopes[id]
+	if !ok {
+		return ErrEnvelopeNotFound
+	}
+	envelope.Status = status
+	envelope.UpdatedAt = time.Now().UTC()
+	s.envelopes[id] = envelope
+	return nil
+}
+
+// stampNewEnvelope sets the id and creation time of an envelope being created
+func stampNewEnvelope(envelope *Envelope) {
+	if envelope.ID == "" {
+		envelope.ID = primitive.NewObjectID().Hex()
+	}
+	envelope.CreatedAt = time.Now().UTC()
+	envelope.UpdatedAt = envelope.CreatedAt
+}
+
+func copyEnvelope(envelope Envelope) Envelope {
+	envelope.Signers = append([]string(nil), envelope.Signers...)
+	envelope.Documents = append([]string(nil), envelope.Documents...)
+	return envelope
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type unavailableEnvelopes struct{}
+
+func (unavailableEnvelopes) CreateEnvelope(ctx context.Context, envelope *Envelope) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableEnvelopes) GetEnvelope(ctx context.Context, id string) (*Envelope, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableEnvelopes) ListEnvelopes(ctx context.Context, userID string) ([]Envelope, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableEnvelopes) UpdateEnvelopeStatus(ctx context.Context, id string, status int) error {
+	return errors.New("database is not available")
+}
@@ -0,0 +1,326 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JobRun is one run of a scheduled job
+type JobRun struct {
+	ID         string    `bson:"_id" json:"id"`
+	Job        string    `bson:"job" json:"job"`
+	Holder     string    `bson:"holder" json:"holder"`
+	Trigger    string    `bson:"trigger" json:"trigger"`
+	StartedAt  time.Time `bson:"startedAt" json:"startedAt"`
+	DurationMs int64     `bson:"durationMs" json:"durationMs"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// JobStore keeps the state scheduled jobs share between API replicas: who
+// holds the lease to run each job, the last scheduled run taken, which jobs
+// are paused and their runs.
+// JobService is the Mongo backed implementation.
+type JobStore interface {
+	// AcquireJobLease gives holder the lease of job until the given time,
+	// returning false while another holder has an unexpired lease
+	AcquireJobLease(ctx context.Context, job, holder string, until time.Time) (bool, error)
+	ReleaseJobLease(ctx context.Context, job, holder string) error
+	// ClaimJobSlot takes the scheduled run of job at slot, returning false
+	// when a replica already took it or a later one
+	ClaimJobSlot(ctx context.Context, job string, slot time.Time) (bool, error)
+	SetJobPaused(ctx context.Context, job string, paused bool) error
+	PausedJobs(ctx context.Context) (map[string]bool, error)
+	RecordJobRun(ctx context.Context, run *JobRun) error
+	// ListJobRuns returns the last runs of job, newest first
+	ListJobRuns(ctx context.Context, job string, limit int) ([]JobRun, error)
+}
+
+var (
+	jobStore JobStore
+	jobMu    sync.Mutex
+)
+
+// Jobs returns the job store used by the scheduler. It is backed by Mongo
+// unless replaced with SetJobs.
+func Jobs() JobStore {
+	jobMu.Lock()
+	defer jobMu.Unlock()
+
+	if jobStore != nil {
+		return jobStore
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableJobs{}
+	}
+	return NewJobService(mongodb.Database())
+}
+
+// SetJobs replaces the store returned by Jobs. Passing nil restores the
+// Mongo backed one.
+func SetJobs(s JobStore) {
+	jobMu.Lock()
+	defer jobMu.Unlock()
+
+	jobStore = s
+}
+
+// JobService stores job state in Mongo
+type JobService struct {
+	jobs *mongo.Collection
+	runs *mongo.Collection
+}
+
+// NewJobService returns a new JobService
+func NewJobService(db *mongo.Database) *JobService {
+	return &JobService{
+		jobs: db.Collection(jobsCollection),
+		runs: db.Collection(jobRunsCollection),
+	}
+}
+
+func (s *JobService) AcquireJobLease(ctx context.Context, job, holder string, until time.Time) (bool, error) {
+	// The filter matches no document while another holder has the lease, and
+	// the upsert then fails on the duplicate id
+	filter := bson.M{
+		"_id": job,
+		"$or": []bson.M{
+			{"holder": holder},
+			{"leaseExpiresAt": bson.M{"$lte": time.Now().UTC()}},
+			{"leaseExpiresAt": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"holder": holder, "leaseExpiresAt": until.UTC()}}
+
+	_, err := s.jobs.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *JobService) ReleaseJobLease(ctx context.Context, job, holder string) error {
+	filter := bson.M{"_id": job, "holder": holder}
+	update := bson.M{"$unset": bson.M{"holder": "", "leaseExpiresAt": ""}}
+
+	_, err := s.jobs.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (s *JobService) ClaimJobSlot(ctx context.Context, job string, slot time.Time) (bool, error) {
+	// As for leases, the upsert fails on the duplicate id once the slot was
+	// taken
+	filter := bson.M{
+		"_id": job,
+		"$or": []bson.M{
+			{"lastSlot": bson.M{"$lt": slot.UTC()}},
+			{"lastSlot": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"lastSlot": slot.UTC()}}
+
+	_, err := s.jobs.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *JobService) SetJobPaused(ctx context.Context, job string, paused bool) error {
+	update := bson.M{"$set": bson.M{"paused": paused}}
+	_, err := s.jobs.UpdateOne(ctx, bson.M{"_id": job}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *JobService) PausedJobs(ctx context.Context) (map[string]bool, error) {
+	cursor, err := s.jobs.Find(ctx, bson.M{"paused": true})
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+
+	paused := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		paused[job.ID] = true
+	}
+	return paused, nil
+}
+
+func (s *JobService) RecordJobRun(ctx context.Context, run *JobRun) error {
+	if run.ID == "" {
+		run.ID = primitive.NewObjectID().Hex()
+	}
+	_, err := s.runs.InsertOne(ctx, run)
+	return err
+}
+
+func (s *JobService) ListJobRuns(ctx context.Context, job string, limit int) ([]JobRun, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}}).SetLimit(int64(limit))
+
+	cursor, err := s.runs.Find(ctx, bson.M{"job": job}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []JobRun{}
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// MemoryJobStore keeps job state in memory, for tests
+type MemoryJobStore struct {
+	mu     sync.Mutex
+	leases map[string]jobLease
+	slots  map[string]time.Time
+	paused map[string]bool
+	runs   []JobRun
+}
+
+type jobLease struct {
+	holder string
+	until  time.Time
+}
+
+// NewMemoryJobStore returns an empty MemoryJobStore
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		leases: make(map[string]jobLease),
+		slots:  make(map[string]time.Time),
+		paused: make(map[string]bool),
+	}
+}
+
+func (s *MemoryJobStore) AcquireJobLease(ctx context.Context, job, holder string, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.leases[job]
+	if ok && lease.holder != holder && time.Now().Before(lease.until) {
+		return false, nil
+	}
+	s.leases[job] = jobLease{holder: holder, until: until}
+	return true, nil
+}
+
+func (s *MemoryJobStore) ReleaseJobLease(ctx context.Context, job, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.leases[job].holder == holder {
+		delete(s.leases, job)
+	}
+	return nil
+}
+
+func (s *MemoryJobStore) ClaimJobSlot(ctx context.Context, job string, slot time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last, ok := s.slots[job]; ok && !last.Before(slot) {
+		return false, nil
+	}
+	s.slots[job] = slot
+	return true, nil
+}
+
+func (s *MemoryJobStore) SetJobPaused(ctx context.Context, job string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused[job] = paused
+	return nil
+}
+
+func (s *MemoryJobStore) PausedJobs(ctx context.Context) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	paused := make(map[string]bool)
+	for job, p := range s.paused {
+		if p {
+			paused[job] = true
+		}
+	}
+	return paused, nil
+}
+
+func (s *MemoryJobStore) RecordJobRun(ctx context.Context, run *JobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if run.ID == "" {
+		run.ID = primitive.NewObjectID().Hex()
+	}
+	s.runs = append(s.runs, *run)
+	return nil
+}
+
+func (s *MemoryJobStore) ListJobRuns(ctx context.Context, job string, limit int) ([]JobRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := []JobRun{}
+	for _, run := range s.runs {
+		if run.Job == job {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+type unavailableJobs struct{}
+
+func (unavailableJobs) AcquireJobLease(ctx context.Context, job, holder string, until time.Time) (bool, error) {
+	return false, errors.New("database is not available")
+}
+
+func (unavailableJobs) ReleaseJobLease(ctx context.Context, job, holder string) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableJobs) ClaimJobSlot(ctx context.Context, job string, slot time.Time) (bool, error) {
+	return false, errors.New("database is not available")
+}
+
+func (unavailableJobs) SetJobPaused(ctx context.Context, job string, paused bool) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableJobs) PausedJobs(ctx context.Context) (map[string]bool, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableJobs) RecordJobRun(ctx context.Context, run *JobRun) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableJobs) ListJobRuns(ctx context.Context, job string, limit int) ([]JobRun, error) {
+	return nil, errors.New("database is not available")
+}
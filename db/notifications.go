@@ -56,7 +56,7 @@ func (s *NotificationService) CreateNotification(ctx context.Context, notif *[]N
 
 func (s *NotificationService) GetNotificationsByUser(ctx context.Context, userID string, limit int) ([]Notification, error) {
 	var notifications []Notification
-	opts := options.Find().SetSort(bson.D{{"timestamp", -1}}).SetLimit(int64(limit))
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(int64(limit))
 
 	cursor, err := s.collection.Find(ctx, bson.M{"userId": userID}, opts)
 	if err != nil {
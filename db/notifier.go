@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Notifier stores notifications for users. NotificationService is the Mongo
+// backed implementation.
+type Notifier interface {
+	CreateNotification(ctx context.Context, notif *[]Notification) (*mongo.InsertManyResult, error)
+}
+
+var (
+	notifier   Notifier
+	notifierMu sync.Mutex
+)
+
+// Notifications returns the notifier used by the handlers. It is backed by
+// Mongo unless replaced with SetNotifier.
+func Notifications() Notifier {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+
+	if notifier != nil {
+		return notifier
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableNotifier{}
+	}
+	return NewNotificationService(mongodb.Database())
+}
+
+// SetNotifier replaces the notifier returned by Notifications. Passing nil
+// restores the Mongo backed one.
+func SetNotifier(n Notifier) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+
+	notifier = n
+}
+
+type unavailableNotifier struct{}
+
+func (unavailableNotifier) CreateNotification(ctx context.Context, notif *[]Notification) (*mongo.InsertManyResult, error) {
+	return nil, errors.New("database is not available")
+}
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrPaymentReceiptNotFound is returned for an unknown payment receipt
+	ErrPaymentReceiptNotFound = errors.New("payment receipt not found")
+	// ErrPaymentReceiptConflict is returned when a receipt was changed since
+	// it was read
+	ErrPaymentReceiptConflict = errors.New("payment receipt was changed concurrently")
+)
+
+// ReceiptStatus is the review of a payment receipt by the payee
+type ReceiptStatus string
+
+// Statuses of a payment receipt. A disputed receipt can still be accepted
+// once the payer and the payee settle it.
+const (
+	ReceiptPending  ReceiptStatus = "pending"
+	ReceiptAccepted ReceiptStatus = "accepted"
+	ReceiptDisputed ReceiptStatus = "disputed"
+)
+
+// PaymentReceipt is the receipt of a manual payment of a make payment clause,
+// reviewed by the owner of the contract, who receives the payment
+type PaymentReceipt struct {
+	ID          string `bson:"_id" json:"id"`
+	ClauseKey   string `bson:"clauseKey" json:"clauseKey"`
+	ContractKey string `bson:"contractKey" json:"contractKey"`
+	PayerKey    string `bson:"payerKey" json:"payerKey"`
+	PayeeKey    string `bson:"payeeKey" json:"payeeKey"`
+	// Payment is the amount recorded on the clause, in its currency
+	Payment  money.Decimal `bson:"payment" json:"payment"`
+	Currency string        `bson:"currency" json:"currency"`
+	// Original and Rate keep the conversion of a payment made in another
+	// currency, to record a held payment as it was made
+	Original *money.Money `bson:"original,omitempty" json:"original,omitempty"`
+	Rate     *money.Rate  `bson:"rate,omitempty" json:"rate,omitempty"`
+	Date     string       `bson:"date" json:"date"`
+	// FinalPayment tells whether the payment was recorded as the last one
+	FinalPayment bool   `bson:"finalPayment" json:"finalPayment"`
+	ReceiptURL   string `bson:"receiptUrl" json:"receiptUrl"`
+	// ReceiptHash is the hex SHA-256 of the receipt, as recorded on the clause
+	ReceiptHash string        `bson:"receiptHash" json:"receiptHash"`
+	Status      ReceiptStatus `bson:"status" json:"status"`
+	// Comment explains a dispute
+	Comment    string     `bson:"comment,omitempty" json:"comment,omitempty"`
+	ReviewedAt *time.Time `bson:"reviewedAt,omitempty" json:"reviewedAt,omitempty"`
+	// RecordedAt is set once the payment is recorded on the clause. Final
+	// payments are held until the payee accepts their receipt.
+	RecordedAt *time.Time `bson:"recordedAt,omitempty" json:"recordedAt,omitempty"`
+	// Version is incremented by every save, to detect concurrent changes
+	Version   int       `bson:"version" json:"-"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Amount returns the payment of the receipt in its currency
+func (r PaymentReceipt) Amount() money.Money {
+	return money.Money{Amount: r.Payment, Currency: r.Currency}
+}
+
+// Held tells whether the receipt holds a final payment that awaits the
+// acceptance of the payee to be recorded on the clause
+func (r PaymentReceipt) Held() bool {
+	return r.FinalPayment && r.RecordedAt == nil && r.PayeeKey != "" && r.PayeeKey != r.PayerKey
+}
+
+// PaymentReceiptStore stores payment receipts. PaymentReceiptService is the
+// Mongo backed implementation.
+type PaymentReceiptStore interface {
+	CreatePaymentReceipt(ctx context.Context, receipt *PaymentReceipt) error
+	GetPaymentReceipt(ctx context.Context, id string) (*PaymentReceipt, error)
+	// ListPaymentReceipts returns the receipts of a clause, newest first
+	ListPaymentReceipts(ctx context.Context, clauseKey string) ([]PaymentReceipt, error)
+	// SavePaymentReceipt stores a receipt and increments its version. It
+	// returns ErrPaymentReceiptConflict when the stored version is not the
+	// one that was read.
+	SavePaymentReceipt(ctx context.Context, receipt *PaymentReceipt) error
+}
+
+var (
+	paymentReceipts   PaymentReceiptStore
+	paymentReceiptsMu sync.Mutex
+)
+
+// PaymentReceipts returns the payment receipt store used by the handlers. It
+// is backed by Mongo unless replaced with SetPaymentReceipts.
+func PaymentReceipts() PaymentReceiptStore {
+	paymentReceiptsMu.Lock()
+	defer paymentReceiptsMu.Unlock()
+
+	if paymentReceipts != nil {
+		return paymentReceipts
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailablePaymentReceipts{}
+	}
+	return NewPaymentReceiptService(mongodb.Database())
+}
+
+// SetPaymentReceipts replaces the store returned by PaymentReceipts. Passing
+// nil restores the Mongo backed one.
+func SetPaymentReceipts(s PaymentReceiptStore) {
+	paymentReceiptsMu.Lock()
+	defer paymentReceiptsMu.Unlock()
+
+	paymentReceipts = s
+}
+
+// PaymentReceiptService stores payment receipts in Mongo
+type PaymentReceiptService struct {
+	collection *mongo.Collection
+}
+
+// NewPaymentReceiptService returns a new PaymentReceiptService
+func NewPaymentReceiptService(db *mongo.Database) *PaymentReceiptService {
+	return &PaymentReceiptService{
+		collection: db.Collection(paymentReceiptsCollection),
+	}
+}
+
+func (s *PaymentReceiptService) CreatePaymentReceipt(ctx context.Context, receipt *PaymentReceipt) error {
+	stampNewPaymentReceipt(receipt)
+
+	_, err := s.collection.InsertOne(ctx, receipt)
+	return err
+}
+
+func (s *PaymentReceiptService) GetPaymentReceipt(ctx context.Context, id string) (*PaymentReceipt, error) {
+	var receipt PaymentReceipt
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&receipt)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrPaymentReceiptNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+func (s *PaymentReceiptService) ListPaymentReceipts(ctx context.Context, clauseKey string) ([]PaymentReceipt, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := s.collection.Find(ctx, bson.M{"clauseKey": clauseKey}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []PaymentReceipt{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *PaymentReceiptService) SavePaymentReceipt(ctx context.Context, receipt *PaymentReceipt) error {
+	saved := *receipt
+	saved.Version++
+	saved.UpdatedAt = time.Now().UTC()
+
+	filter := bson.M{"_id": receipt.ID, "version": receipt.Version}
+	result, err := s.collection.ReplaceOne(ctx, filter, saved)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrPaymentReceiptConflict
+	}
+
+	*receipt = saved
+	return nil
+}
+
+// MemoryPaymentReceiptStore keeps payment receipts in memory, for tests
+type MemoryPaymentReceiptStore struct {
+	mu       sync.Mutex
+	receipts map[string]PaymentReceipt
+}
+
+// NewMemoryPaymentReceiptStore returns an empty MemoryPaymentReceiptStore
+func NewMemoryPaymentReceiptStore() *MemoryPaymentReceiptStore {
+	return &MemoryPaymentReceiptStore{receipts: make(map[string]PaymentReceipt)}
+}
+
+func (s *MemoryPaymentReceiptStore) CreatePaymentReceipt(ctx context.Context, receipt *PaymentReceipt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stampNewPaymentReceipt(receipt)
+	s.receipts[receipt.ID] = copyPaymentReceipt(*receipt)
+	return nil
+}
+
+func (s *MemoryPaymentReceiptStore) GetPaymentReceipt(ctx context.Context, id string) (*PaymentReceipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receipt, ok := s.receipts[id]
+	if !ok {
+		return nil, ErrPaymentReceiptNotFound
+	}
+	receipt = copyPaymentReceipt(receipt)
+	return &receipt, nil
+}
+
+func (s *MemoryPaymentReceiptStore) ListPaymentReceipts(ctx context.Context, clauseKey string) ([]PaymentReceipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []PaymentReceipt{}
+	for _, receipt := range s.receipts {
+		if receipt.ClauseKey == clauseKey {
+			list = append(list, copyPaymentReceipt(receipt))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+func (s *MemoryPaymentReceiptStore) SavePaymentReceipt(ctx context.Context, receipt *PaymentReceipt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.receipts[receipt.ID]
+	if !ok || stored.Version != receipt.Version {
+		return ErrPaymentReceiptConflict
+	}
+
+	receipt.Version++
+	receipt.UpdatedAt = time.Now().UTC()
+	s.receipts[receipt.ID] = copyPaymentReceipt(*receipt)
+	return nil
+}
+
+// stampNewPaymentReceipt sets the id and creation time of a receipt being
+// created
+func stampNewPaymentReceipt(receipt *PaymentReceipt) {
+	if receipt.ID == "" {
+		receipt.ID = primitive.NewObjectID().Hex()
+	}
+	receipt.CreatedAt = time.Now().UTC()
+	receipt.UpdatedAt = receipt.CreatedAt
+}
+
+func copyPaymentReceipt(receipt PaymentReceipt) PaymentReceipt {
+	if receipt.ReviewedAt != nil {
+		reviewedAt := *receipt.ReviewedAt
+		receipt.ReviewedAt = &reviewedAt
+	}
+	if receipt.RecordedAt != nil {
+		recordedAt := *receipt.RecordedAt
+		receipt.RecordedAt = &recordedAt
+	}
+	return receipt
+}
+
+type unavailablePaymentReceipts struct{}
+
+func (unavailablePaymentReceipts) CreatePaymentReceipt(ctx context.Context, receipt *PaymentReceipt) error {
+	return errors.New("database is not available")
+}
+
+func (unavailablePaymentReceipts) GetPaymentReceipt(ctx context.Context, id string) (*PaymentReceipt, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailablePaymentReceipts) ListPaymentReceipts(ctx context.Context, clauseKey string) ([]PaymentReceipt, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailablePaymentReceipts) SavePaymentReceipt(ctx context.Context, receipt *PaymentReceipt) error {
+	return errors.New("database is not available")
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReminderState is the reminder state of a document: when its signers are
+// reminded to sign it and which reminders were already sent
+type ReminderState struct {
+	DocumentKey string `bson:"_id" json:"documentKey"`
+	// Before holds how long before the document timeout each reminder is
+	// sent. Documents without reminders use the default schedule.
+	Before []time.Duration `bson:"before,omitempty" json:"before,omitempty"`
+	Sent   []string        `bson:"sent,omitempty" json:"sent,omitempty"`
+}
+
+// ReminderStore stores the reminder state of documents. ReminderService is
+// the Mongo backed implementation.
+type ReminderStore interface {
+	// SetReminderSchedule sets when the signers of a document are reminded
+	SetReminderSchedule(ctx context.Context, documentKey string, before []time.Duration) error
+	// GetReminderState returns the reminder state of a document, empty when it
+	// has none
+	GetReminderState(ctx context.Context, documentKey string) (*ReminderState, error)
+	// MarkReminderSent records that a reminder was sent, returning false when
+	// it already was, so that concurrent schedulers send it once
+	MarkReminderSent(ctx context.Context, documentKey, reminder string) (bool, error)
+}
+
+var (
+	reminderStore ReminderStore
+	reminderMu    sync.Mutex
+)
+
+// Reminders returns the reminder store used by the handlers. It is backed by
+// Mongo unless replaced with SetReminders.
+func Reminders() ReminderStore {
+	reminderMu.Lock()
+	defer reminderMu.Unlock()
+
+	if reminderStore != nil {
+		return reminderStore
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableReminders{}
+	}
+	return NewReminderService(mongodb.Database())
+}
+
+// SetReminders replaces the store returned by Reminders. Passing nil
+// restores the Mongo backed one.
+func SetReminders(s ReminderStore) {
+	reminderMu.Lock()
+	defer reminderMu.Unlock()
+
+	reminderStore = s
+}
+
+// ReminderService stores reminder state in Mongo
+type ReminderService struct {
+	collection *mongo.Collection
+}
+
+// NewReminderService returns a new ReminderService
+func NewReminderService(db *mongo.Database) *ReminderService {
+	return &ReminderService{
+		collection: db.Collection(remindersCollection),
+	}
+}
+
+func (s *ReminderService) SetReminderSchedule(ctx context.Context, documentKey string, before []time.Duration) error {
+	update := bson.M{"$set": bson.M{"before": before}}
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": documentKey}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *ReminderService) GetReminderState(ctx context.Context, documentKey string) (*ReminderState, error) {
+	var state ReminderState
+	err := s.collection.FindOne(ctx, bson.M{"_id": documentKey}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &ReminderState{DocumentKey: documentKey}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *ReminderService) MarkReminderSent(ctx context.Context, documentKey, reminder string) (bool, error) {
+	// The filter matches no document once the reminder is recorded, and the
+	// upsert then fails on the duplicate id
+	filter := bson.M{"_id": documentKey, "sent": bson.M{"$ne": reminder}}
+	update := bson.M{"$addToSet": bson.M{"sent": reminder}}
+
+	_, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MemoryReminderStore keeps reminder state in memory, for tests
+type MemoryReminderStore struct {
+	mu     sync.Mutex
+	states map[string]ReminderState
+}
+
+// NewMemoryReminderStore returns an empty MemoryReminderStore
+func NewMemoryReminderStore() *MemoryReminderStore {
+	return &MemoryReminderStore{states: make(map[string]ReminderState)}
+}
+
+func (s *MemoryReminderStore) SetReminderSchedule(ctx context.Context, documentKey string, before []time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.states[documentKey]
+	state.DocumentKey = documentKey
+	state.Before = append([]time.Duration(nil), before...)
+	s.states[documentKey] = state
+	return nil
+}
+
+func (s *MemoryReminderStore) GetReminderState(ctx context.Context, documentKey string) (*ReminderState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.states[documentKey]
+	state.DocumentKey = documentKey
+	state.Before = append([]time.Duration(nil), state.Before...)
+	state.Sent = append([]string(nil), state.Sent...)
+	return &state, nil
+}
+
+func (s *MemoryReminderStore) MarkReminderSent(ctx context.Context, documentKey, reminder string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.states[documentKey]
+	if containsString(state.Sent, reminder) {
+		return false, nil
+	}
+	state.DocumentKey = documentKey
+	state.Sent = append(state.Sent, reminder)
+	s.states[documentKey] = state
+	return true, nil
+}
+
+type unavailableReminders struct{}
+
+func (unavailableReminders) SetReminderSchedule(ctx context.Context, documentKey string, before []time.Duration) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableReminders) GetReminderState(ctx context.Context, documentKey string) (*ReminderState, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableReminders) MarkReminderSent(ctx context.Context, documentKey, reminder string) (bool, error) {
+	return false, errors.New("database is not available")
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrTemplateGrantNotFound is returned for a user without access granted to
+// a template
+var ErrTemplateGrantNotFound = errors.New("template access not found")
+
+// TemplateRole is the access a user has to a template. Each role includes
+// the ones before it.
+type TemplateRole string
+
+// Roles of a template. Viewers see, duplicate and instantiate a template,
+// editors also change it and its clauses, and owners also remove it and
+// manage who has access to it.
+const (
+	TemplateViewer TemplateRole = "viewer"
+	TemplateEditor TemplateRole = "editor"
+	TemplateOwner  TemplateRole = "owner"
+)
+
+var templateRoleRanks = map[TemplateRole]int{
+	TemplateViewer: 1,
+	TemplateEditor: 2,
+	TemplateOwner:  3,
+}
+
+// Valid reports whether r is a known role
+func (r TemplateRole) Valid() bool {
+	return templateRoleRanks[r] > 0
+}
+
+// Includes reports whether r grants at least the access of role
+func (r TemplateRole) Includes(role TemplateRole) bool {
+	return r.Valid() && templateRoleRanks[r] >= templateRoleRanks[role]
+}
+
+// TemplateGrant gives a user a role on a template
+type TemplateGrant struct {
+	ID          string       `bson:"_id" json:"-"`
+	TemplateKey string       `bson:"templateKey" json:"templateKey"`
+	UserKey     string       `bson:"userKey" json:"userKey"`
+	Role        TemplateRole `bson:"role" json:"role"`
+	GrantedBy   string       `bson:"grantedBy" json:"grantedBy"`
+	GrantedAt   time.Time    `bson:"grantedAt" json:"grantedAt"`
+}
+
+// TemplateGrantStore stores the access granted to templates.
+// TemplateGrantService is the Mongo backed implementation.
+type TemplateGrantStore interface {
+	GetTemplateGrant(ctx context.Context, templateKey, userKey string) (*TemplateGrant, error)
+	// ListTemplateGrants returns the grants of a template, oldest first
+	ListTemplateGrants(ctx context.Context, templateKey string) ([]TemplateGrant, error)
+	// SaveTemplateGrant grants a role, replacing the previous role of the user
+	SaveTemplateGrant(ctx context.Context, grant *TemplateGrant) error
+	// RevokeTemplateGrant removes the access of a user, failing with
+	// ErrTemplateGrantNotFound when the user had none
+	RevokeTemplateGrant(ctx context.Context, templateKey, userKey string) error
+}
+
+var (
+	templateGrants   TemplateGrantStore
+	templateGrantsMu sync.Mutex
+)
+
+// TemplateGrants returns the template grant store used by the handlers. It
+// is backed by Mongo unless replaced with SetTemplateGrants.
+func TemplateGrants() TemplateGrantStore {
+	templateGrantsMu.Lock()
+	defer templateGrantsMu.Unlock()
+
+	if templateGrants != nil {
+		return templateGrants
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableTemplateGrants{}
+	}
+	return NewTemplateGrantService(mongodb.Database())
+}
+
+// SetTemplateGrants replaces the store returned by TemplateGrants. Passing
+// nil restores the Mongo backed one.
+func SetTemplateGrants(s TemplateGrantStore) {
+	templateGrantsMu.Lock()
+	defer templateGrantsMu.Unlock()
+
+	templateGrants = s
+}
+
+// TemplateGrantService stores template grants in Mongo
+type TemplateGrantService struct {
+	collection *mongo.Collection
+}
+
+// NewTemplateGrantService returns a new TemplateGrantService
+func NewTemplateGrantService(db *mongo.Database) *TemplateGrantService {
+	return &TemplateGrantService{
+		collection: db.Collection(templateGrantsCollection),
+	}
+}
+
+func (s *TemplateGrantService) GetTemplateGrant(ctx context.Context, templateKey, userKey string) (*TemplateGrant, error) {
+	var grant TemplateGrant
+	err := s.collection.FindOne(ctx, bson.M{"_id": templateGrantID(templateKey, userKey)}).Decode(&grant)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrTemplateGrantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (s *TemplateGrantService) ListTemplateGrants(ctx context.Context, templateKey string) ([]TemplateGrant, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "grantedAt", Value: 1}})
+
+	cursor, err := s.collection.Find(ctx, bson.M{"templateKey": templateKey}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := []TemplateGrant{}
+	if err := cursor.All(ctx, &grants); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (s *TemplateGrantService) SaveTemplateGrant(ctx context.Context, grant *TemplateGrant) error {
+	stampTemplateGrant(grant)
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": grant.ID}, grant, opts)
+	return err
+}
+
+func (s *TemplateGrantService) RevokeTemplateGrant(ctx context.Context, templateKey, userKey string) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": templateGrantID(templateKey, userKey)})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrTemplateGrantNotFound
+	}
+	return nil
+}
+
+// MemoryTemplateGrantStore keeps template grants in memory, for tests
+type MemoryTemplateGrantStore struct {
+	mu     sync.Mutex
+	grants map[string]TemplateGrant
+}
+
+// NewMemoryTemplateGrantStore returns an empty MemoryTemplateGrantStore
+func NewMemoryTemplateGrantStore() *MemoryTemplateGrantStore {
+	return &MemoryTemplateGrantStore{grants: make(map[string]TemplateGrant)}
+}
+
+func (s *MemoryTemplateGrantStore) GetTemplateGrant(ctx context.Context, templateKey, userKey string) (*TemplateGrant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grant, ok := s.grants[templateGrantID(templateKey, userKey)]
+	if !ok {
+		return nil, ErrTemplateGrantNotFound
+	}
+	return &grant, nil
+}
+
+func (s *MemoryTemplateGrantStore) ListTemplateGrants(ctx context.Context, templateKey string) ([]TemplateGrant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grants := []TemplateGrant{}
+	for _, grant := range s.grants {
+		if grant.TemplateKey == templateKey {
+			grants = append(grants, grant)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		return grants[i].GrantedAt.Before(grants[j].GrantedAt)
+	})
+	return grants, nil
+}
+
+func (s *MemoryTemplateGrantStore) SaveTemplateGrant(ctx context.Context, grant *TemplateGrant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stampTemplateGrant(grant)
+	s.grants[grant.ID] = *grant
+	return nil
+}
+
+func (s *MemoryTemplateGrantStore) RevokeTemplateGrant(ctx context.Context, templateKey, userKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := templateGrantID(templateKey, userKey)
+	if _, ok := s.grants[id]; !ok {
+		return ErrTemplateGrantNotFound
+	}
+	delete(s.grants, id)
+	return nil
+}
+
+// stampTemplateGrant sets the id and time of a grant being saved. A user has
+// a single grant per template.
+func stampTemplateGrant(grant *TemplateGrant) {
+	grant.ID = templateGrantID(grant.TemplateKey, grant.UserKey)
+	grant.GrantedAt = time.Now().UTC()
+}
+
+func templateGrantID(templateKey, userKey string) string {
+	return templateKey + "/" + userKey
+}
+
+type unavailableTemplateGrants struct{}
+
+func (unavailableTemplateGrants) GetTemplateGrant(ctx context.Context, templateKey, userKey string) (*TemplateGrant, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableTemplateGrants) ListTemplateGrants(ctx context.Context, templateKey string) ([]TemplateGrant, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableTemplateGrants) SaveTemplateGrant(ctx context.Context, grant *TemplateGrant) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableTemplateGrants) RevokeTemplateGrant(ctx context.Context, templateKey, userKey string) error {
+	return errors.New("database is not available")
+}
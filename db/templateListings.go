@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TemplateUse is a way a template is used, counted for its popularity
+type TemplateUse string
+
+// Uses of a template
+const (
+	TemplateDuplicated   TemplateUse = "duplicated"
+	TemplateInstantiated TemplateUse = "instantiated"
+)
+
+// TemplateListing holds what the template catalog knows about a template
+// besides its ledger asset: its tags, how often it was used and the reviews
+// left by users. Reviews use the same model as contract reviews, one per
+// user.
+type TemplateListing struct {
+	TemplateKey  string             `bson:"_id" json:"templateKey"`
+	Tags         []string           `bson:"tags" json:"tags"`
+	Duplicated   int                `bson:"duplicated" json:"duplicated"`
+	Instantiated int                `bson:"instantiated" json:"instantiated"`
+	Reviews      []chaincode.Review `bson:"reviews" json:"reviews"`
+	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Popularity is the number of times a template was used
+func (l TemplateListing) Popularity() int {
+	return l.Duplicated + l.Instantiated
+}
+
+// Rating returns the average rating of a template, 0 without reviews
+func (l TemplateListing) Rating() float64 {
+	if len(l.Reviews) == 0 {
+		return 0
+	}
+	total := 0
+	for _, review := range l.Reviews {
+		total += review.Rating
+	}
+	return float64(total) / float64(len(l.Reviews))
+}
+
+// TemplateListingStore stores template listings. TemplateListingService is
+// the Mongo backed implementation. Templates without a stored listing have
+// an empty one.
+type TemplateListingStore interface {
+	// GetTemplateListings returns the listings of the given templates, by
+	// template key
+	GetTemplateListings(ctx context.Context, templateKeys []string) (map[string]TemplateListing, error)
+	SetTemplateTags(ctx context.Context, templateKey string, tags []string) error
+	CountTemplateUse(ctx context.Context, templateKey string, use TemplateUse) error
+	// SaveTemplateReview adds a review, replacing the previous review of the
+	// same user
+	SaveTemplateReview(ctx context.Context, templateKey string, review chaincode.Review) error
+}
+
+var (
+	templateListings   TemplateListingStore
+	templateListingsMu sync.Mutex
+)
+
+// TemplateListings returns the template listing store used by the handlers.
+// It is backed by Mongo unless replaced with SetTemplateListings.
+func TemplateListings() TemplateListingStore {
+	templateListingsMu.Lock()
+	defer templateListingsMu.Unlock()
+
+	if templateListings != nil {
+		return templateListings
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableTemplateListings{}
+	}
+	return NewTemplateListingService(mongodb.Database())
+}
+
+// SetTemplateListings replaces the store returned by TemplateListings.
+// Passing nil restores the Mongo backed one.
+func SetTemplateListings(s TemplateListingStore) {
+	templateListingsMu.Lock()
+	defer templateListingsMu.Unlock()
+
+	templateListings = s
+}
+
+// TemplateListingService stores template listings in Mongo
+type TemplateListingService struct {
+	collection *mongo.Collection
+}
+
+// NewTemplateListingService returns a new TemplateListingService
+func NewTemplateListingService(db *mongo.Database) *TemplateListingService {
+	return &TemplateListingService{
+		collection: db.Collection(templateListingsCollection),
+	}
+}
+
+func (s *TemplateListingService) GetTemplateListings(ctx context.Context, templateKeys []string) (map[string]TemplateListing, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": templateKeys}})
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []TemplateListing
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, err
+	}
+
+	listings := emptyListings(templateKeys)
+	for _, listing := range stored {
+		if listing.Tags == nil {
+			listing.Tags = []string{}
+		}
+		if listing.Reviews == nil {
+			listing.Reviews = []chaincode.Review{}
+		}
+		listings[listing.TemplateKey] = listing
+	}
+	return listings, nil
+}
+
+func (s *TemplateListingService) SetTemplateTags(ctx context.Context, templateKey string, tags []string) error {
+	return s.upsert(ctx, templateKey, bson.M{"$set": bson.M{"tags": tags}})
+}
+
+func (s *TemplateListingService) CountTemplateUse(ctx context.Context, templateKey string, use TemplateUse) error {
+	return s.upsert(ctx, templateKey, bson.M{"$inc": bson.M{string(use): 1}})
+}
+
+func (s *TemplateListingService) SaveTemplateReview(ctx context.Context, templateKey string, review chaincode.Review) error {
+	pull := bson.M{"$pull": bson.M{"reviews": bson.M{"user.key": review.User.Key}}}
+	if err := s.upsert(ctx, templateKey, pull); err != nil {
+		return err
+	}
+	return s.upsert(ctx, templateKey, bson.M{"$push": bson.M{"reviews": review}})
+}
+
+func (s *TemplateListingService) upsert(ctx context.Context, templateKey string, update bson.M) error {
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+		update["$set"] = set
+	}
+	set["updatedAt"] = time.Now().UTC()
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": templateKey}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// MemoryTemplateListingStore keeps template listings in memory, for tests
+type MemoryTemplateListingStore struct {
+	mu       sync.Mutex
+	listings map[string]TemplateListing
+}
+
+// NewMemoryTemplateListingStore returns an empty MemoryTemplateListingStore
+func NewMemoryTemplateListingStore() *MemoryTemplateListingStore {
+	return &MemoryTemplateListingStore{listings: make(map[string]TemplateListing)}
+}
+
+func (s *MemoryTemplateListingStore) GetTemplateListings(ctx context.Context, templateKeys []string) (map[string]TemplateListing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listings := emptyListings(templateKeys)
+	for _, key := range templateKeys {
+		if listing, ok := s.listings[key]; ok {
+			listing.Tags = append([]string(nil), listing.Tags...)
+			listing.Reviews = append([]chaincode.Review(nil), listing.Reviews...)
+			listings[key] = listing
+		}
+	}
+	return listings, nil
+}
+
+func (s *MemoryTemplateListingStore) SetTemplateTags(ctx context.Context, templateKey string, tags []string) error {
+	s.update(templateKey, func(l *TemplateListing) {
+		l.Tags = append([]string(nil), tags...)
+	})
+	return nil
+}
+
+func (s *MemoryTemplateListingStore) CountTemplateUse(ctx context.Context, templateKey string, use TemplateUse) error {
+	s.update(templateKey, func(l *TemplateListing) {
+		switch use {
+		case TemplateDuplicated:
+			l.Duplicated++
+		case TemplateInstantiated:
+			l.Instantiated++
+		}
+	})
+	return nil
+}
+
+func (s *MemoryTemplateListingStore) SaveTemplateReview(ctx context.Context, templateKey string, review chaincode.Review) error {
+	s.update(templateKey, func(l *TemplateListing) {
+		reviews := []chaincode.Review{}
+		for _, r := range l.Reviews {
+			if r.User.Key != review.User.Key {
+				reviews = append(reviews, r)
+			}
+		}
+		l.Reviews = append(reviews, review)
+	})
+	return nil
+}
+
+func (s *MemoryTemplateListingStore) update(templateKey string, change func(*TemplateListing)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listing, ok := s.listings[templateKey]
+	if !ok {
+		listing = emptyListing(templateKey)
+	}
+	change(&listing)
+	listing.UpdatedAt = time.Now().UTC()
+	s.listings[templateKey] = listing
+}
+
+func emptyListings(templateKeys []string) map[string]TemplateListing {
+	listings := make(map[string]TemplateListing, len(templateKeys))
+	for _, key := range templateKeys {
+		listings[key] = emptyListing(key)
+	}
+	return listings
+}
+
+func emptyListing(templateKey string) TemplateListing {
+	return TemplateListing{
+		TemplateKey: templateKey,
+		Tags:        []string{},
+		Reviews:     []chaincode.Review{},
+	}
+}
+
+type unavailableTemplateListings struct{}
+
+func (unavailableTemplateListings) GetTemplateListings(ctx context.Context, templateKeys []string) (map[string]TemplateListing, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableTemplateListings) SetTemplateTags(ctx context.Context, templateKey string, tags []string) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableTemplateListings) CountTemplateUse(ctx context.Context, templateKey string, use TemplateUse) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableTemplateListings) SaveTemplateReview(ctx context.Context, templateKey string, review chaincode.Review) error {
+	return errors.New("database is not available")
+}
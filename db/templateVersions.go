@@ -0,0 +1,306 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrTemplateVersionNotFound is returned when a template has no version
+	// with the requested number
+	ErrTemplateVersionNotFound = errors.New("template version not found")
+	// ErrTemplateVersionExists is returned when a version with the same
+	// number was recorded concurrently
+	ErrTemplateVersionExists = errors.New("template version already exists")
+)
+
+// TemplateVersion is an immutable snapshot of a template and its clauses.
+// Every change of a template records a new version.
+type TemplateVersion struct {
+	ID          string                  `bson:"_id" json:"-"`
+	TemplateKey string                  `bson:"templateKey" json:"templateKey"`
+	Version     int                     `bson:"version" json:"version"`
+	Name        string                  `bson:"name" json:"name"`
+	Description string                  `bson:"description,omitempty" json:"description,omitempty"`
+	Public      bool                    `bson:"public" json:"public"`
+	Clauses     []TemplateVersionClause `bson:"clauses" json:"clauses"`
+	// Digest identifies the content of the version, to tell whether a
+	// template changed since it was recorded
+	Digest    string    `bson:"digest" json:"-"`
+	CreatedBy string    `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// TemplateVersionClause is a template clause as it was in a version
+type TemplateVersionClause struct {
+	Key               string                 `bson:"key" json:"key"`
+	Id                string                 `bson:"id" json:"id"`
+	Number            float64                `bson:"number" json:"number"`
+	Name              string                 `bson:"name" json:"name"`
+	Description       string                 `bson:"description,omitempty" json:"description,omitempty"`
+	Category          string                 `bson:"category,omitempty" json:"category,omitempty"`
+	ActionType        int                    `bson:"actionType" json:"actionType"`
+	Dependencies      []string               `bson:"dependencies,omitempty" json:"dependencies,omitempty"`
+	DefaultInputs     map[string]interface{} `bson:"defaultInputs,omitempty" json:"defaultInputs,omitempty"`
+	DefaultParameters map[string]interface{} `bson:"defaultParameters,omitempty" json:"defaultParameters,omitempty"`
+	Optional          bool                   `bson:"optional" json:"optional"`
+}
+
+// TemplateVersionStore stores template versions. TemplateVersionService is
+// the Mongo backed implementation.
+type TemplateVersionStore interface {
+	// CreateTemplateVersion records a version, failing with
+	// ErrTemplateVersionExists when its number is taken
+	CreateTemplateVersion(ctx context.Context, version *TemplateVersion) error
+	GetTemplateVersion(ctx context.Context, templateKey string, version int) (*TemplateVersion, error)
+	// LatestTemplateVersion returns the version with the highest number
+	LatestTemplateVersion(ctx context.Context, templateKey string) (*TemplateVersion, error)
+	// ListTemplateVersions returns the versions of a template, oldest first
+	ListTemplateVersions(ctx context.Context, templateKey string) ([]TemplateVersion, error)
+}
+
+var (
+	templateVersions   TemplateVersionStore
+	templateVersionsMu sync.Mutex
+)
+
+// TemplateVersions returns the template version store used by the handlers.
+// It is backed by Mongo unless replaced with SetTemplateVersions.
+func TemplateVersions() TemplateVersionStore {
+	templateVersionsMu.Lock()
+	defer templateVersionsMu.Unlock()
+
+	if templateVersions != nil {
+		return templateVersions
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableTemplateVersions{}
+	}
+	return NewTemplateVersionService(mongodb.Database())
+}
+
+// SetTemplateVersions replaces the store returned by TemplateVersions.
+// Passing nil restores the Mongo backed one.
+func SetTemplateVersions(s TemplateVersionStore) {
+	templateVersionsMu.Lock()
+	defer templateVersionsMu.Unlock()
+
+	templateVersions = s
+}
+
+// TemplateVersionService stores template versions in Mongo
+type TemplateVersionService struct {
+	collection *mongo.Collection
+}
+
+// NewTemplateVersionService returns a new TemplateVersionService
+func NewTemplateVersionService(db *mongo.Database) *TemplateVersionService {
+	return &TemplateVersionService{
+		collection: db.Collection(templateVersionsCollection),
+	}
+}
+
+func (s *TemplateVersionService) CreateTemplateVersion(ctx context.Context, version *TemplateVersion) error {
+	stampTemplateVersion(version)
+
+	_, err := s.collection.InsertOne(ctx, version)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrTemplateVersionExists
+	}
+	return err
+}
+
+func (s *TemplateVersionService) GetTemplateVersion(ctx context.Context, templateKey string, version int) (*TemplateVersion, error) {
+	return s.findOne(ctx, bson.M{"templateKey": templateKey, "version": version}, nil)
+}
+
+func (s *TemplateVersionService) LatestTemplateVersion(ctx context.Context, templateKey string) (*TemplateVersion, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	return s.findOne(ctx, bson.M{"templateKey": templateKey}, opts)
+}
+
+func (s *TemplateVersionService) ListTemplateVersions(ctx context.Context, templateKey string) ([]TemplateVersion, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: 1}})
+
+	cursor, err := s.collection.Find(ctx, bson.M{"templateKey": templateKey}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []TemplateVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		plainTemplateVersion(&versions[i])
+	}
+	return versions, nil
+}
+
+func (s *TemplateVersionService) findOne(ctx context.Context, filter bson.M, opts *options.FindOneOptions) (*TemplateVersion, error) {
+	if opts == nil {
+		opts = options.FindOne()
+	}
+
+	var version TemplateVersion
+	err := s.collection.FindOne(ctx, filter, opts).Decode(&version)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrTemplateVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	plainTemplateVersion(&version)
+	return &version, nil
+}
+
+// plainTemplateVersion turns the documents and arrays decoded from Mongo in
+// the clause defaults back into maps and slices, as they were recorded
+func plainTemplateVersion(version *TemplateVersion) {
+	for i := range version.Clauses {
+		clause := &version.Clauses[i]
+		clause.DefaultInputs = plainMap(clause.DefaultInputs)
+		clause.DefaultParameters = plainMap(clause.DefaultParameters)
+	}
+}
+
+func plainMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = plainValue(v)
+	}
+	return out
+}
+
+func plainValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case primitive.D:
+		out := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			out[e.Key] = plainValue(e.Value)
+		}
+		return out
+	case primitive.M:
+		return plainMap(v)
+	case map[string]interface{}:
+		return plainMap(v)
+	case primitive.A:
+		return plainValue([]interface{}(v))
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = plainValue(item)
+		}
+		return out
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+// MemoryTemplateVersionStore keeps template versions in memory, for tests
+type MemoryTemplateVersionStore struct {
+	mu       sync.Mutex
+	versions map[string]TemplateVersion
+}
+
+// NewMemoryTemplateVersionStore returns an empty MemoryTemplateVersionStore
+func NewMemoryTemplateVersionStore() *MemoryTemplateVersionStore {
+	return &MemoryTemplateVersionStore{versions: make(map[string]TemplateVersion)}
+}
+
+func (s *MemoryTemplateVersionStore) CreateTemplateVersion(ctx context.Context, version *TemplateVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stampTemplateVersion(version)
+	if _, exists := s.versions[version.ID]; exists {
+		return ErrTemplateVersionExists
+	}
+	s.versions[version.ID] = *version
+	return nil
+}
+
+func (s *MemoryTemplateVersionStore) GetTemplateVersion(ctx context.Context, templateKey string, version int) (*TemplateVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.versions[templateVersionID(templateKey, version)]
+	if !ok {
+		return nil, ErrTemplateVersionNotFound
+	}
+	return &v, nil
+}
+
+func (s *MemoryTemplateVersionStore) LatestTemplateVersion(ctx context.Context, templateKey string) (*TemplateVersion, error) {
+	versions, _ := s.ListTemplateVersions(ctx, templateKey)
+	if len(versions) == 0 {
+		return nil, ErrTemplateVersionNotFound
+	}
+	return &versions[len(versions)-1], nil
+}
+
+func (s *MemoryTemplateVersionStore) ListTemplateVersions(ctx context.Context, templateKey string) ([]TemplateVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := []TemplateVersion{}
+	for _, v := range s.versions {
+		if v.TemplateKey == templateKey {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
+}
+
+// stampTemplateVersion sets the id and creation time of a version being
+// recorded. The id is derived from the version number, so that a number is
+// only recorded once.
+func stampTemplateVersion(version *TemplateVersion) {
+	version.ID = templateVersionID(version.TemplateKey, version.Version)
+	if version.CreatedAt.IsZero() {
+		version.CreatedAt = time.Now().UTC()
+	}
+}
+
+func templateVersionID(templateKey string, version int) string {
+	return fmt.Sprintf("%s@%d", templateKey, version)
+}
+
+type unavailableTemplateVersions struct{}
+
+func (unavailableTemplateVersions) CreateTemplateVersion(ctx context.Context, version *TemplateVersion) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableTemplateVersions) GetTemplateVersion(ctx context.Context, templateKey string, version int) (*TemplateVersion, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableTemplateVersions) LatestTemplateVersion(ctx context.Context, templateKey string) (*TemplateVersion, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableTemplateVersions) ListTemplateVersions(ctx context.Context, templateKey string) ([]TemplateVersion, error) {
+	return nil, errors.New("database is not available")
+}
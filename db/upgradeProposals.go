@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrUpgradeProposalNotFound is returned for an unknown upgrade proposal
+	ErrUpgradeProposalNotFound = errors.New("upgrade proposal not found")
+	// ErrUpgradeProposalConflict is returned when a proposal was changed
+	// since it was read
+	ErrUpgradeProposalConflict = errors.New("upgrade proposal was changed concurrently")
+)
+
+// UpgradeStatus is the stage of an upgrade proposal
+type UpgradeStatus string
+
+// Statuses of an upgrade proposal. A pending proposal is applied once every
+// participant of the contract accepted it, and rejected when one declines.
+// It is applying while its changes are made to the contract, until an
+// interrupted upgrade is resumed by accepting it again.
+const (
+	UpgradePending  UpgradeStatus = "pending"
+	UpgradeApplying UpgradeStatus = "applying"
+	UpgradeApplied  UpgradeStatus = "applied"
+	UpgradeRejected UpgradeStatus = "rejected"
+)
+
+// UpgradeProposal proposes to move a contract created from a template to
+// another version of the template
+type UpgradeProposal struct {
+	ID          string        `bson:"_id" json:"id"`
+	ContractKey string        `bson:"contractKey" json:"contractKey"`
+	TemplateKey string        `bson:"templateKey" json:"templateKey"`
+	FromVersion int           `bson:"fromVersion" json:"fromVersion"`
+	ToVersion   int           `bson:"toVersion" json:"toVersion"`
+	ProposedBy  string        `bson:"proposedBy" json:"proposedBy"`
+	Status      UpgradeStatus `bson:"status" json:"status"`
+	// Awaiting lists the participants who have not answered yet
+	Awaiting []string `bson:"awaiting" json:"awaiting"`
+	Accepted []string `bson:"accepted" json:"accepted"`
+	// DeclinedBy is the participant who rejected the proposal
+	DeclinedBy string `bson:"declinedBy,omitempty" json:"declinedBy,omitempty"`
+	// Progress records the changes made to the contract by the upgrade
+	Progress *UpgradeProgress `bson:"progress,omitempty" json:"progress,omitempty"`
+	// Version is incremented by every save, to detect concurrent changes
+	Version   int       `bson:"version" json:"-"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// UpgradeProgress records how far an upgrade got on the ledger, so that an
+// interrupted upgrade resumes where it stopped
+type UpgradeProgress struct {
+	// Previous are the clause keys of the contract before the upgrade
+	Previous []string `bson:"previous" json:"previous"`
+	// Replaced are the keys of the clauses removed once the new clauses are
+	// added
+	Replaced []string `bson:"replaced" json:"replaced"`
+	// Added tells whether the new clauses were added to the contract
+	Added bool `bson:"added" json:"added"`
+}
+
+// UpgradeProposalStore stores upgrade proposals. UpgradeProposalService is
+// the Mongo backed implementation.
+type UpgradeProposalStore interface {
+	CreateUpgradeProposal(ctx context.Context, proposal *UpgradeProposal) error
+	GetUpgradeProposal(ctx context.Context, id string) (*UpgradeProposal, error)
+	// ListUpgradeProposals returns the proposals of a contract, newest first
+	ListUpgradeProposals(ctx context.Context, contractKey string) ([]UpgradeProposal, error)
+	// SaveUpgradeProposal stores a proposal and increments its version. It
+	// returns ErrUpgradeProposalConflict when the stored version is not the
+	// one that was read.
+	SaveUpgradeProposal(ctx context.Context, proposal *UpgradeProposal) error
+}
+
+var (
+	upgradeProposals   UpgradeProposalStore
+	upgradeProposalsMu sync.Mutex
+)
+
+// UpgradeProposals returns the upgrade proposal store used by the handlers.
+// It is backed by Mongo unless replaced with SetUpgradeProposals.
+func UpgradeProposals() UpgradeProposalStore {
+	upgradeProposalsMu.Lock()
+	defer upgradeProposalsMu.Unlock()
+
+	if upgradeProposals != nil {
+		return upgradeProposals
+	}
+
+	mongodb := GetDB()
+	if mongodb == nil {
+		return unavailableUpgradeProposals{}
+	}
+	return NewUpgradeProposalService(mongodb.Database())
+}
+
+// SetUpgradeProposals replaces the store returned by UpgradeProposals.
+// Passing nil restores the Mongo backed one.
+func SetUpgradeProposals(s UpgradeProposalStore) {
+	upgradeProposalsMu.Lock()
+	defer upgradeProposalsMu.Unlock()
+
+	upgradeProposals = s
+}
+
+// UpgradeProposalService stores upgrade proposals in Mongo
+type UpgradeProposalService struct {
+	collection *mongo.Collection
+}
+
+// NewUpgradeProposalService returns a new UpgradeProposalService
+func NewUpgradeProposalService(db *mongo.Database) *UpgradeProposalService {
+	return &UpgradeProposalService{
+		collection: db.Collection(upgradesCollection),
+	}
+}
+
+func (s *UpgradeProposalService) CreateUpgradeProposal(ctx context.Context, proposal *UpgradeProposal) error {
+	stampNewUpgradeProposal(proposal)
+
+	_, err := s.collection.InsertOne(ctx, proposal)
+	return err
+}
+
+func (s *UpgradeProposalService) GetUpgradeProposal(ctx context.Context, id string) (*UpgradeProposal, error) {
+	var proposal UpgradeProposal
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&proposal)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUpgradeProposalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &proposal, nil
+}
+
+func (s *UpgradeProposalService) ListUpgradeProposals(ctx context.Context, contractKey string) ([]UpgradeProposal, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := s.collection.Find(ctx, bson.M{"contractKey": contractKey}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	proposals := []UpgradeProposal{}
+	if err := cursor.All(ctx, &proposals); err != nil {
+		return nil, err
+	}
+	return proposals, nil
+}
+
+func (s *UpgradeProposalService) SaveUpgradeProposal(ctx context.Context, proposal *UpgradeProposal) error {
+	saved := *proposal
+	saved.Version++
+	saved.UpdatedAt = time.Now().UTC()
+
+	filter := bson.M{"_id": proposal.ID, "version": proposal.Version}
+	result, err := s.collection.ReplaceOne(ctx, filter, saved)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUpgradeProposalConflict
+	}
+
+	*proposal = saved
+	return nil
+}
+
+// MemoryUpgradeProposalStore keeps upgrade proposals in memory, for tests
+type MemoryUpgradeProposalStore struct {
+	mu        sync.Mutex
+	proposals map[string]UpgradeProposal
+}
+
+// NewMemoryUpgradeProposalStore returns an empty MemoryUpgradeProposalStore
+func NewMemoryUpgradeProposalStore() *MemoryUpgradeProposalStore {
+	return &MemoryUpgradeProposalStore{proposals: make(map[string]UpgradeProposal)}
+}
+
+func (s *MemoryUpgradeProposalStore) CreateUpgradeProposal(ctx context.Context, proposal *UpgradeProposal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stampNewUpgradeProposal(proposal)
+	s.proposals[proposal.ID] = copyUpgradeProposal(*proposal)
+	return nil
+}
+
+func (s *MemoryUpgradeProposalStore) GetUpgradeProposal(ctx context.Context, id string) (*UpgradeProposal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	proposal, ok := s.proposals[id]
+	if !ok {
+		return nil, ErrUpgradeProposalNotFound
+	}
+	proposal = copyUpgradeProposal(proposal)
+	return &proposal, nil
+}
+
+func (s *MemoryUpgradeProposalStore) ListUpgradeProposals(ctx context.Context, contractKey string) ([]UpgradeProposal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	proposals := []UpgradeProposal{}
+	for _, proposal := range s.proposals {
+		if proposal.ContractKey == contractKey {
+			proposals = append(proposals, copyUpgradeProposal(proposal))
+		}
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		return proposals[i].CreatedAt.After(proposals[j].CreatedAt)
+	})
+	return proposals, nil
+}
+
+func (s *MemoryUpgradeProposalStore) SaveUpgradeProposal(ctx context.Context, proposal *UpgradeProposal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.proposals[proposal.ID]
+	if !ok || stored.Version != proposal.Version {
+		return ErrUpgradeProposalConflict
+	}
+
+	proposal.Version++
+	proposal.UpdatedAt = time.Now().UTC()
+	s.proposals[proposal.ID] = copyUpgradeProposal(*proposal)
+	return nil
+}
+
+// stampNewUpgradeProposal sets the id and creation time of a proposal being
+// created
+func stampNewUpgradeProposal(proposal *UpgradeProposal) {
+	if proposal.ID == "" {
+		proposal.ID = primitive.NewObjectID().Hex()
+	}
+	proposal.CreatedAt = time.Now().UTC()
+	proposal.UpdatedAt = proposal.CreatedAt
+}
+
+func copyUpgradeProposal(proposal UpgradeProposal) UpgradeProposal {
+	proposal.Awaiting = append([]string(nil), proposal.Awaiting...)
+	proposal.Accepted = append([]string(nil), proposal.Accepted...)
+	if proposal.Progress != nil {
+		progress := *proposal.Progress
+		progress.Previous = append([]string(nil), progress.Previous...)
+		progress.Replaced = append([]string(nil), progress.Replaced...)
+		proposal.Progress = &progress
+	}
+	return proposal
+}
+
+type unavailableUpgradeProposals struct{}
+
+func (unavailableUpgradeProposals) CreateUpgradeProposal(ctx context.Context, proposal *UpgradeProposal) error {
+	return errors.New("database is not available")
+}
+
+func (unavailableUpgradeProposals) GetUpgradeProposal(ctx context.Context, id string) (*UpgradeProposal, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableUpgradeProposals) ListUpgradeProposals(ctx context.Context, contractKey string) ([]UpgradeProposal, error) {
+	return nil, errors.New("database is not available")
+}
+
+func (unavailableUpgradeProposals) SaveUpgradeProposal(ctx context.Context, proposal *UpgradeProposal) error {
+	return errors.New("database is not available")
+}
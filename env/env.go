@@ -1,10 +1,29 @@
 package env
 
 const (
-	SERVER_PORT     = "PORT"
-	FRONTEND_ORIGIN = "FRONTEND_ORIGIN"
-	MONGO_USER      = "MONGO_USER"
-	MONGO_PWD       = "MONGO_PWD"
-	MONGO_URL       = "MONGO_URL"
-	DATABASE_NAME   = "DATABASE_NAME"
+	SERVER_PORT             = "PORT"
+	FRONTEND_ORIGIN         = "FRONTEND_ORIGIN"
+	MONGO_USER              = "MONGO_USER"
+	MONGO_PWD               = "MONGO_PWD"
+	MONGO_URL               = "MONGO_URL"
+	DATABASE_NAME           = "DATABASE_NAME"
+	ORG_URL                 = "ORG_URL"
+	CHAINCODE_TIMEOUT       = "CHAINCODE_TIMEOUT"
+	CHAINCODE_MAX_RETRIES   = "CHAINCODE_MAX_RETRIES"
+	CHAINCODE_RETRY_BACKOFF = "CHAINCODE_RETRY_BACKOFF"
+	STORAGE_BACKEND         = "STORAGE_BACKEND"
+	STORAGE_LOCAL_DIR       = "STORAGE_LOCAL_DIR"
+	S3_BUCKET_NAME          = "S3_BUCKET_NAME"
+	PDF_TRUSTED_ROOTS       = "PDF_TRUSTED_ROOTS"
+	PUBLIC_VERIFY_RATE      = "PUBLIC_VERIFY_RATE"
+	CERTIFICATE_SIGNING_KEY = "CERTIFICATE_SIGNING_KEY"
+	ADMIN_EMAILS            = "ADMIN_EMAILS"
+	JOB_SCHEDULE_PREFIX     = "JOB_SCHEDULE_"
+	PAYMENT_PROVIDER        = "PAYMENT_PROVIDER"
+	PAYMENT_CURRENCY        = "PAYMENT_CURRENCY"
+	PAYMENT_WEBHOOK_SECRET  = "PAYMENT_WEBHOOK_SECRET"
+	STRIPE_SECRET_KEY       = "STRIPE_SECRET_KEY"
+	STRIPE_API_URL          = "STRIPE_API_URL"
+	EXCHANGE_RATES_FILE     = "EXCHANGE_RATES_FILE"
+	PUBLIC_API_URL          = "PUBLIC_API_URL"
 )
@@ -0,0 +1,318 @@
+// Package financials builds the financial ledger of a contract: the payments,
+// fines and credits recorded on its clauses, in a dated timeline with the
+// running balance, converted into a reporting currency
+package financials
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/money"
+)
+
+// EntryType is the kind of a financial entry
+type EntryType string
+
+// Kinds of financial entries. Payments and credits lower the balance, fines
+// and refunds raise it.
+const (
+	EntryPayment EntryType = "payment"
+	EntryFine    EntryType = "fine"
+	EntryCredit  EntryType = "credit"
+	EntryRefund  EntryType = "refund"
+)
+
+// Entry is a change of the balance of a contract
+type Entry struct {
+	// Time is when the change was recorded
+	Time time.Time `json:"time"`
+	// Date is the date of a payment, as given by the payer
+	Date      string    `json:"date,omitempty"`
+	Type      EntryType `json:"type"`
+	ClauseKey string    `json:"clauseKey"`
+	ClauseID  string    `json:"clauseId,omitempty"`
+	// Amount is in the currency of the report
+	Amount money.Decimal `json:"amount"`
+	// Original is the amount as recorded, in the currency of the clause or
+	// of the refunded payment
+	Original money.Money `json:"original"`
+	// Rate converted the original amount into the currency of the report
+	Rate money.Rate `json:"rate"`
+	// Final tells whether a payment was the last one of its clause
+	Final bool `json:"final,omitempty"`
+	// Reference identifies the payment: the card token, the PayPal
+	// transaction or the hash of the receipt
+	Reference string `json:"reference,omitempty"`
+	TxID      string `json:"txId,omitempty"`
+	// Balance is the outstanding balance after the entry
+	Balance money.Decimal `json:"balance"`
+}
+
+// Report is the financial ledger of a contract. Its amounts are in its
+// currency, each converted with the rate as of when it was recorded.
+type Report struct {
+	ContractKey string `json:"contractKey"`
+	Currency    string `json:"currency"`
+	// Scheduled is the sum of the amounts of the make payment clauses,
+	// converted with the rates as of when the report was built
+	Scheduled money.Decimal `json:"scheduled"`
+	// ScheduledRates are the rates that converted the scheduled amounts
+	ScheduledRates []money.Rate `json:"scheduledRates"`
+	// TotalPaid is net of the refunds
+	TotalPaid     money.Decimal `json:"totalPaid"`
+	TotalRefunded money.Decimal `json:"totalRefunded"`
+	TotalFines    money.Decimal `json:"totalFines"`
+	TotalCredits  money.Decimal `json:"totalCredits"`
+	// Outstanding is what is left to pay: the scheduled amount and the
+	// fines, less the credits and what was paid. It is negative when the
+	// contract was overpaid.
+	Outstanding money.Decimal `json:"outstanding"`
+	Timeline    []Entry       `json:"timeline"`
+}
+
+// ClauseHistory is a clause of a contract with the versions of it recorded on
+// the ledger
+type ClauseHistory struct {
+	Clause   chaincode.Clause
+	Versions []chaincode.ClauseVersion
+}
+
+// Refund is a refund of a card payment. Refunds are made with the payment
+// provider and are not recorded on the ledger.
+type Refund struct {
+	Time      time.Time
+	ClauseKey string
+	Amount    money.Money
+	Reference string
+}
+
+// Build computes the report of a contract in a currency. A payment is read
+// from every version of a make payment clause that changed its input, and a
+// fine or a credit from every version of a check fine or get credit clause
+// that changed its result. The versions of a clause may be in any order.
+// Amounts in other currencies are converted with the rates of the source as
+// of when they were recorded, and the scheduled amounts as of now.
+func Build(ctx context.Context, contractKey, currency string, rates money.RateSource, clauses []ClauseHistory, refunds []Refund) (*Report, error) {
+	report := &Report{ContractKey: contractKey, Currency: currency, ScheduledRates: []money.Rate{}, Timeline: []Entry{}}
+	now := time.Now().UTC()
+
+	for _, history := range clauses {
+		clause := history.Clause
+		if clause.ActionType == chaincode.ActionMakePayment {
+			if amount, ok := number(clause.Parameters["amount"]); ok {
+				scheduled, rate, err := money.Convert(ctx, rates, money.Money{Amount: amount, Currency: clause.Currency()}, currency, now)
+				if err != nil {
+					return nil, fmt.Errorf("clause %s: %w", clause.Key, err)
+				}
+				report.Scheduled = report.Scheduled.Add(scheduled.Amount)
+				report.ScheduledRates = append(report.ScheduledRates, rate)
+			}
+		}
+
+		entries, err := clauseEntries(clause, history.Versions)
+		if err != nil {
+			return nil, err
+		}
+		report.Timeline = append(report.Timeline, entries...)
+	}
+
+	for _, refund := range refunds {
+		report.Timeline = append(report.Timeline, Entry{
+			Time:      refund.Time,
+			Type:      EntryRefund,
+			ClauseKey: refund.ClauseKey,
+			Original:  refund.Amount,
+			Reference: refund.Reference,
+		})
+	}
+
+	sort.SliceStable(report.Timeline, func(i, j int) bool {
+		return report.Timeline[i].Time.Before(report.Timeline[j].Time)
+	})
+
+	balance := report.Scheduled
+	for i := range report.Timeline {
+		entry := &report.Timeline[i]
+
+		converted, rate, err := money.Convert(ctx, rates, entry.Original, currency, entry.Time)
+		if err != nil {
+			return nil, fmt.Errorf("clause %s: %w", entry.ClauseKey, err)
+		}
+		entry.Amount = converted.Amount
+		entry.Rate = rate
+
+		switch entry.Type {
+		case EntryPayment:
+			report.TotalPaid = report.TotalPaid.Add(entry.Amount)
+			balance = balance.Sub(entry.Amount)
+		case EntryRefund:
+			report.TotalPaid = report.TotalPaid.Sub(entry.Amount)
+			report.TotalRefunded = report.TotalRefunded.Add(entry.Amount)
+			balance = balance.Add(entry.Amount)
+		case EntryFine:
+			report.TotalFines = report.TotalFines.Add(entry.Amount)
+			balance = balance.Add(entry.Amount)
+		case EntryCredit:
+			report.TotalCredits = report.TotalCredits.Add(entry.Amount)
+			balance = balance.Sub(entry.Amount)
+		}
+		entry.Balance = balance
+	}
+	report.Outstanding = balance
+
+	return report, nil
+}
+
+// clauseEntries returns the entries recorded by the versions of a clause,
+// with their original amounts
+func clauseEntries(clause chaincode.Clause, versions []chaincode.ClauseVersion) ([]Entry, error) {
+	type dated struct {
+		time    time.Time
+		version chaincode.ClauseVersion
+	}
+	sorted := make([]dated, 0, len(versions))
+	for _, version := range versions {
+		t, err := version.Time()
+		if err != nil {
+			return nil, fmt.Errorf("clause %s: %w", clause.Key, err)
+		}
+		sorted = append(sorted, dated{t, version})
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].time.Before(sorted[j].time)
+	})
+
+	var entries []Entry
+	var input, result map[string]interface{}
+	for _, v := range sorted {
+		if v.version.IsDeleted {
+			continue
+		}
+		version := v.version.Clause
+
+		entry := Entry{
+			Time:      v.time,
+			ClauseKey: clause.Key,
+			ClauseID:  clause.Id,
+			TxID:      v.version.TxID,
+		}
+		switch clause.ActionType {
+		case chaincode.ActionMakePayment:
+			if reflect.DeepEqual(version.Input, input) {
+				continue
+			}
+			input = version.Input
+
+			amount, ok := number(input["payment"])
+			if !ok || amount.Sign() <= 0 {
+				continue
+			}
+			entry.Type = EntryPayment
+			entry.Original = money.Money{Amount: amount, Currency: inputCurrency(clause, input)}
+			entry.Date, _ = input["date"].(string)
+			entry.Final, _ = input["finalPayment"].(bool)
+			entry.Reference = paymentReference(input)
+		case chaincode.ActionCheckFine, chaincode.ActionGetCredit:
+			if reflect.DeepEqual(version.Result, result) {
+				continue
+			}
+			result = version.Result
+
+			field, entryType := "fine", EntryFine
+			if clause.ActionType == chaincode.ActionGetCredit {
+				field, entryType = "credit", EntryCredit
+			}
+			amount, ok := number(result[field])
+			if !ok || amount.Sign() <= 0 {
+				continue
+			}
+			entry.Type = entryType
+			entry.Original = money.Money{Amount: amount, Currency: clause.Currency()}
+		default:
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// inputCurrency returns the currency of a payment recorded on a make payment
+// clause. Payments recorded before amounts had a currency are in the currency
+// of the clause.
+func inputCurrency(clause chaincode.Clause, input map[string]interface{}) string {
+	if code, ok := input["currency"].(string); ok {
+		if currency, err := money.Currency(code); err == nil {
+			return currency
+		}
+	}
+	return clause.Currency()
+}
+
+// paymentReference returns what identifies a payment among the inputs of a
+// make payment clause
+func paymentReference(input map[string]interface{}) string {
+	for _, field := range []string{"stripeToken", "payPalTransactionID", "receiptHash"} {
+		if reference, _ := input[field].(string); reference != "" {
+			return reference
+		}
+	}
+	return ""
+}
+
+// WriteCSV writes the timeline of the report as CSV, with a header row. The
+// amounts and balances are in the currency of the report, followed by the
+// original amounts and the rates that converted them.
+func (r *Report) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	header := []string{"time", "date", "type", "clauseKey", "clauseId", "amount", "balance", "currency",
+		"originalAmount", "originalCurrency", "rate", "rateSource", "final", "reference", "txId"}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	places := money.MinorUnits(r.Currency)
+	for _, entry := range r.Timeline {
+		row := []string{
+			entry.Time.UTC().Format(time.RFC3339),
+			entry.Date,
+			string(entry.Type),
+			entry.ClauseKey,
+			entry.ClauseID,
+			entry.Amount.StringFixed(places),
+			entry.Balance.StringFixed(places),
+			r.Currency,
+			entry.Original.Amount.StringFixed(money.MinorUnits(entry.Original.Currency)),
+			entry.Original.Currency,
+			entry.Rate.Value.String(),
+			entry.Rate.Source,
+			strconv.FormatBool(entry.Final),
+			entry.Reference,
+			entry.TxID,
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// number returns a numeric value of a clause, which the forms may have
+// stored as a string
+func number(value interface{}) (money.Decimal, bool) {
+	switch v := value.(type) {
+	case float64:
+		return money.DecimalFromFloat(v), true
+	case string:
+		n, err := money.ParseDecimal(v)
+		return n, err == nil
+	default:
+		return money.Decimal{}, false
+	}
+}
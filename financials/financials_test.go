@@ -0,0 +1,187 @@
+package financials
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/money"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// rates are the amounts of each currency worth one BRL: 1 USD is 5 BRL and 1
+// EUR is 5.5555555556 BRL
+var rates = &money.StaticRates{
+	Source: "test",
+	Base:   "BRL",
+	AsOf:   start,
+	Rates: map[string]money.Decimal{
+		"BRL": money.MustParseDecimal("1"),
+		"USD": money.MustParseDecimal("0.2"),
+		"EUR": money.MustParseDecimal("0.18"),
+	},
+}
+
+func equal(d money.Decimal, s string) bool {
+	return d.Equal(money.MustParseDecimal(s))
+}
+
+func version(day int, input, result map[string]interface{}) chaincode.ClauseVersion {
+	t := start.AddDate(0, 0, day)
+	return chaincode.ClauseVersion{
+		TxID:      fmt.Sprintf("tx%d", day),
+		Timestamp: fmt.Sprintf("seconds:%d nanos:0", t.Unix()),
+		Clause:    chaincode.Clause{Input: input, Result: result},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	rent := chaincode.Clause{
+		Key:        "clause:rent",
+		Id:         "rent",
+		ActionType: chaincode.ActionMakePayment,
+		Parameters: map[string]interface{}{"amount": 1000.0, "currency": "BRL"},
+	}
+	first := map[string]interface{}{"payment": 400.0, "date": "2024-01-05", "payPalTransactionID": "PAYID-1"}
+	last := map[string]interface{}{"payment": "600", "date": "2024-01-20", "finalPayment": true, "receiptHash": "abc"}
+	deleted := version(30, map[string]interface{}{"payment": 999.0}, nil)
+	deleted.IsDeleted = true
+
+	brl := map[string]interface{}{"currency": "BRL"}
+	fine := chaincode.Clause{Key: "clause:fine", Id: "fine", ActionType: chaincode.ActionCheckFine, Parameters: brl}
+	credit := chaincode.Clause{Key: "clause:credit", Id: "credit", ActionType: chaincode.ActionGetCredit, Parameters: brl}
+
+	report, err := Build(context.Background(), "autoExecutableContract:lease", "BRL", rates, []ClauseHistory{
+		{Clause: rent, Versions: []chaincode.ClauseVersion{
+			// Versions are ordered by time, and an execution that leaves the
+			// input unchanged is no payment
+			version(19, last, nil),
+			version(0, nil, nil),
+			version(4, first, nil),
+			version(10, first, map[string]interface{}{"executed": true}),
+			deleted,
+		}},
+		{Clause: fine, Versions: []chaincode.ClauseVersion{
+			version(1, map[string]interface{}{"days": 5.0}, nil),
+			version(15, map[string]interface{}{"days": 5.0}, map[string]interface{}{"fine": 50.0}),
+			version(16, map[string]interface{}{"days": 6.0}, map[string]interface{}{"fine": 50.0}),
+		}},
+		{Clause: credit, Versions: []chaincode.ClauseVersion{
+			version(12, nil, map[string]interface{}{"credit": 20.0}),
+		}},
+	}, []Refund{
+		{Time: start.AddDate(0, 0, 25), ClauseKey: "clause:rent", Amount: money.FromMinor(10000, "brl"), Reference: "pi_1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !equal(report.Scheduled, "1000") || !equal(report.TotalPaid, "900") || !equal(report.TotalRefunded, "100") || !equal(report.TotalFines, "50") || !equal(report.TotalCredits, "20") || !equal(report.Outstanding, "130") {
+		t.Fatalf("unexpected totals %+v", report)
+	}
+
+	expected := []struct {
+		day       int
+		entryType EntryType
+		amount    string
+		balance   string
+		reference string
+	}{
+		{4, EntryPayment, "400", "600", "PAYID-1"},
+		{12, EntryCredit, "20", "580", ""},
+		{15, EntryFine, "50", "630", ""},
+		{19, EntryPayment, "600", "30", "abc"},
+		{25, EntryRefund, "100", "130", "pi_1"},
+	}
+	if len(report.Timeline) != len(expected) {
+		t.Fatalf("expected %d entries, got %+v", len(expected), report.Timeline)
+	}
+	for i, e := range expected {
+		entry := report.Timeline[i]
+		if !entry.Time.Equal(start.AddDate(0, 0, e.day)) || entry.Type != e.entryType || !equal(entry.Amount, e.amount) || !equal(entry.Balance, e.balance) || entry.Reference != e.reference || entry.Rate.Source != "identity" {
+			t.Errorf("entry %d: expected %+v, got %+v", i, e, entry)
+		}
+	}
+	if last := report.Timeline[3]; !last.Final || last.Date != "2024-01-20" || last.ClauseID != "rent" || last.TxID != "tx19" {
+		t.Errorf("unexpected final payment %+v", last)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(expected)+1 || rows[0][0] != "time" {
+		t.Fatalf("unexpected CSV %v", rows)
+	}
+	if got := rows[4]; got[0] != "2024-01-20T12:00:00Z" || got[1] != "2024-01-20" || got[2] != "payment" || got[5] != "600.00" || got[6] != "30.00" || got[7] != "BRL" || got[12] != "true" {
+		t.Fatalf("unexpected CSV row %v", got)
+	}
+}
+
+func TestBuildInvalidTimestamp(t *testing.T) {
+	rent := chaincode.Clause{Key: "clause:rent", ActionType: chaincode.ActionMakePayment}
+	_, err := Build(context.Background(), "autoExecutableContract:lease", "BRL", rates, []ClauseHistory{
+		{Clause: rent, Versions: []chaincode.ClauseVersion{{Timestamp: "yesterday"}}},
+	}, nil)
+	if err == nil {
+		t.Fatal("expected an invalid timestamp to fail")
+	}
+}
+
+func TestBuildConverts(t *testing.T) {
+	rent := chaincode.Clause{
+		Key:        "clause:rent",
+		ActionType: chaincode.ActionMakePayment,
+		Parameters: map[string]interface{}{"amount": "200", "currency": "USD"},
+	}
+	fine := chaincode.Clause{Key: "clause:fine", ActionType: chaincode.ActionCheckFine, Parameters: map[string]interface{}{"currency": "eur"}}
+	clauses := []ClauseHistory{
+		{Clause: rent, Versions: []chaincode.ClauseVersion{
+			version(2, map[string]interface{}{"payment": 100.0, "currency": "USD"}, nil),
+		}},
+		{Clause: fine, Versions: []chaincode.ClauseVersion{
+			version(3, nil, map[string]interface{}{"fine": 10.0}),
+		}},
+	}
+
+	report, err := Build(context.Background(), "autoExecutableContract:lease", "BRL", rates, clauses, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Currency != "BRL" || !equal(report.Scheduled, "1000") || !equal(report.TotalPaid, "500") || !equal(report.TotalFines, "55.56") || !equal(report.Outstanding, "555.56") {
+		t.Fatalf("unexpected totals %+v", report)
+	}
+	if len(report.ScheduledRates) != 1 || report.ScheduledRates[0].From != "USD" || !equal(report.ScheduledRates[0].Value, "5") {
+		t.Fatalf("unexpected scheduled rates %+v", report.ScheduledRates)
+	}
+	payment := report.Timeline[0]
+	if payment.Original.Currency != "USD" || !equal(payment.Original.Amount, "100") || payment.Rate.Source != "test" || !payment.Rate.AsOf.Equal(start) {
+		t.Fatalf("unexpected payment %+v", payment)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rows[2]; got[2] != "fine" || got[5] != "55.56" || got[8] != "10.00" || got[9] != "EUR" || got[10] != "5.5555555556" {
+		t.Fatalf("unexpected CSV row %v", got)
+	}
+
+	if _, err := Build(context.Background(), "autoExecutableContract:lease", "GBP", rates, clauses, nil); !errors.Is(err, money.ErrNoRate) {
+		t.Fatalf("expected a missing rate to fail, got %v", err)
+	}
+}
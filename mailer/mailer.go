@@ -0,0 +1,73 @@
+// Package mailer sends emails to users, through the SMTP account of the
+// invitations unless replaced with SetDefault
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/umairmaseed/clausia-api/utils"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// String returns the message as sent over SMTP, with its subject header
+func (m Message) String() string {
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(m.Subject)
+	return fmt.Sprintf("Subject: %s\n\n%s", subject, m.Body)
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	defaultMailer Mailer
+	mu            sync.Mutex
+)
+
+// Default returns the mailer used by the API. It sends through the SMTP
+// server configured for the clausia_EMAIL account.
+func Default() Mailer {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if defaultMailer != nil {
+		return defaultMailer
+	}
+	return smtpMailer{}
+}
+
+// SetDefault replaces the mailer returned by Default. Passing nil restores
+// the SMTP one.
+func SetDefault(m Mailer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	defaultMailer = m
+}
+
+// smtpMailer sends emails with utils.SendInviteEmail, one per recipient
+type smtpMailer struct{}
+
+func (smtpMailer) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("email has no recipient")
+	}
+
+	for _, to := range msg.To {
+		if err := utils.SendInviteEmail(to, msg.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -13,6 +14,8 @@ import (
 	"github.com/umairmaseed/clausia-api/api/handlers/documents"
 	"github.com/umairmaseed/clausia-api/api/server"
 	"github.com/umairmaseed/clausia-api/db"
+	"github.com/umairmaseed/clausia-api/env"
+	"github.com/umairmaseed/clausia-api/scheduler"
 	"github.com/umairmaseed/clausia-api/websocket"
 )
 
@@ -55,20 +58,34 @@ func main() {
 		duration = 1 * time.Minute
 	}
 
-	// Start the routine to check for expired documents and contracts to be executed
-	go func() {
-		ticker := time.NewTicker(duration)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				documents.CheckExpiredDocs()
-				contract.ExecuteContract()
-			case <-ctx.Done():
-				return
+	// Schedule the background jobs, each one every CHECK_INTERVAL_UNIT unless
+	// it has its own JOB_SCHEDULE_<NAME> interval or cron expression
+	jobs := scheduler.Default()
+	for _, job := range []scheduler.Job{
+		{Name: "expire-documents", Run: documents.CheckExpiredDocs},
+		{Name: "send-reminders", Run: documents.SendReminders},
+		{Name: "execute-contracts", Run: contract.ExecuteContract},
+	} {
+		job.Schedule = scheduler.Every(duration)
+		envName := env.JOB_SCHEDULE_PREFIX + strings.ToUpper(strings.ReplaceAll(job.Name, "-", "_"))
+		if spec := os.Getenv(envName); spec != "" {
+			schedule, err := scheduler.ParseSchedule(spec)
+			if err != nil {
+				log.Fatalf("invalid %s: %v", envName, err)
 			}
+			job.Schedule = schedule
 		}
-	}()
+
+		if err := jobs.Register(job); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Templates created before their versions were recorded get their first
+	// version when an admin runs the backfill
+	if err := jobs.Register(scheduler.Job{Name: "backfill-template-versions", Schedule: scheduler.Manual(), Run: contract.BackfillTemplateVersions}); err != nil {
+		log.Fatal(err)
+	}
+	jobs.Start(ctx)
 
 	// Initialize and start WebSocket server
 	wsServer := websocket.NewWebSocketServer()
@@ -0,0 +1,272 @@
+// Package money handles monetary amounts: exact decimals, ISO 4217
+// currencies and exchange rates
+package money
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// decimalPattern matches the decimal numbers accepted by ParseDecimal, with
+// the integer digits, the fraction digits and the exponent as groups
+var decimalPattern = regexp.MustCompile(`^[+-]?(?:(\d+)\.?(\d*)|\.(\d+))(?:[eE]([+-]?\d+))?$`)
+
+// Limits of the decimals accepted by ParseDecimal, which parses amounts
+// straight from requests. Decimal128, which stores them, keeps 34 digits.
+const (
+	maxDigits   = 34
+	maxExponent = 64
+)
+
+// Decimal is an exact decimal number, for amounts that floats would round.
+// The zero value is 0. Decimals are encoded as JSON numbers, keeping every
+// digit, and stored in Mongo as Decimal128.
+type Decimal struct {
+	// r is never changed once set, so copies of a Decimal can share it
+	r *big.Rat
+}
+
+// ParseDecimal parses a decimal number such as "-1234.50". Numbers written
+// with more than 34 digits, or with an exponent beyond ±64, are rejected.
+func ParseDecimal(s string) (Decimal, error) {
+	m := decimalPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if digits := len(strings.TrimLeft(m[1], "0")) + len(m[2]) + len(m[3]); digits > maxDigits {
+		return Decimal{}, fmt.Errorf("decimal %q has more than %d digits", s, maxDigits)
+	}
+	if m[4] != "" {
+		if exp, err := strconv.Atoi(m[4]); err != nil || exp > maxExponent || exp < -maxExponent {
+			return Decimal{}, fmt.Errorf("decimal %q has an exponent beyond %d", s, maxExponent)
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	return Decimal{r}, nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics on invalid numbers. It is
+// meant for constants.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// NewDecimal returns unscaled / 10^scale
+func NewDecimal(unscaled int64, scale int) Decimal {
+	r := new(big.Rat).SetInt64(unscaled)
+	return Decimal{r.Quo(r, new(big.Rat).SetInt(pow10(scale)))}
+}
+
+// DecimalFromFloat returns the shortest decimal that rounds to f, which is
+// what a float decoded from a JSON number was written as
+func DecimalFromFloat(f float64) Decimal {
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'e', -1, 64))
+	if err != nil {
+		return Decimal{}
+	}
+	return d
+}
+
+func (d Decimal) rat() *big.Rat {
+	if d.r == nil {
+		return new(big.Rat)
+	}
+	return d.r
+}
+
+func (d Decimal) Add(e Decimal) Decimal {
+	return Decimal{new(big.Rat).Add(d.rat(), e.rat())}
+}
+
+func (d Decimal) Sub(e Decimal) Decimal {
+	return Decimal{new(big.Rat).Sub(d.rat(), e.rat())}
+}
+
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{new(big.Rat).Mul(d.rat(), e.rat())}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{new(big.Rat).Neg(d.rat())}
+}
+
+// Quo returns d / e rounded to places decimal places. e must not be zero.
+func (d Decimal) Quo(e Decimal, places int) Decimal {
+	return Decimal{new(big.Rat).Quo(d.rat(), e.rat())}.Round(places)
+}
+
+// Round rounds d to places decimal places, halves away from zero
+func (d Decimal) Round(places int) Decimal {
+	scale := pow10(places)
+	scaled := new(big.Rat).Mul(d.rat(), new(big.Rat).SetInt(scale))
+
+	q, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(scaled.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(scaled.Sign())))
+	}
+	return Decimal{new(big.Rat).SetFrac(q, scale)}
+}
+
+// Cmp returns -1, 0 or +1 as d is less than, equal to or greater than e
+func (d Decimal) Cmp(e Decimal) int {
+	return d.rat().Cmp(e.rat())
+}
+
+// Equal tells whether d and e are the same number
+func (d Decimal) Equal(e Decimal) bool {
+	return d.Cmp(e) == 0
+}
+
+// Sign returns -1, 0 or +1 as d is negative, zero or positive
+func (d Decimal) Sign() int {
+	return d.rat().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Scaled returns d * 10^places, which must be an integer that fits in an
+// int64, such as an amount in minor units
+func (d Decimal) Scaled(places int) (int64, error) {
+	scaled := new(big.Rat).Mul(d.rat(), new(big.Rat).SetInt(pow10(places)))
+	if !scaled.IsInt() || !scaled.Num().IsInt64() {
+		return 0, fmt.Errorf("%s does not have %d decimal places", d, places)
+	}
+	return scaled.Num().Int64(), nil
+}
+
+// Float64 returns the float nearest to d, for the APIs that only take floats
+func (d Decimal) Float64() float64 {
+	f, _ := d.rat().Float64()
+	return f
+}
+
+// String returns every digit of d, without trailing zeros
+func (d Decimal) String() string {
+	return d.rat().FloatString(d.Places())
+}
+
+// StringFixed returns d rounded to places decimal places, with trailing
+// zeros
+func (d Decimal) StringFixed(places int) string {
+	return d.Round(places).rat().FloatString(places)
+}
+
+// Places returns the number of decimal places of d. Decimals only come from
+// decimal strings, products and rounding, so their denominator is made of
+// twos and fives, and it takes as many places as the most of either.
+func (d Decimal) Places() int {
+	denom := new(big.Int).Set(d.rat().Denom())
+	twos := int(denom.TrailingZeroBits())
+	denom.Rsh(denom, uint(twos))
+
+	fives := 0
+	five, rem := big.NewInt(5), new(big.Int)
+	for denom.Cmp(big.NewInt(1)) != 0 {
+		if _, rem = denom.QuoRem(denom, five, rem); rem.Sign() != 0 {
+			// Not a finite decimal, which only a bug could produce
+			return 18
+		}
+		fives++
+	}
+
+	if twos > fives {
+		return twos
+	}
+	return fives
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts numbers and strings holding a number
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*d = Decimal{}
+		return nil
+	}
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// UnmarshalParam binds a Decimal from a form or query param
+func (d *Decimal) UnmarshalParam(param string) error {
+	parsed, err := ParseDecimal(param)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Decimal) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	value, err := primitive.ParseDecimal128(d.String())
+	if err != nil {
+		return 0, nil, fmt.Errorf("%s cannot be stored as a Decimal128: %w", d, err)
+	}
+	return bson.MarshalValue(value)
+}
+
+// UnmarshalBSONValue accepts Decimal128, the doubles of documents stored
+// before amounts were decimals, and strings
+func (d *Decimal) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+
+	var s string
+	switch t {
+	case bsontype.Null, bsontype.Undefined:
+		*d = Decimal{}
+		return nil
+	case bsontype.Decimal128:
+		s = raw.Decimal128().String()
+	case bsontype.Double:
+		*d = DecimalFromFloat(raw.Double())
+		return nil
+	case bsontype.Int32:
+		*d = NewDecimal(int64(raw.Int32()), 0)
+		return nil
+	case bsontype.Int64:
+		*d = NewDecimal(raw.Int64(), 0)
+		return nil
+	case bsontype.String:
+		s = raw.StringValue()
+	default:
+		return fmt.Errorf("cannot decode %s into a decimal", t)
+	}
+
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,205 @@
+package money
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDecimal(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"1234.50", "1234.5"},
+		{"-0.10", "-0.1"},
+		{".5", "0.5"},
+		{"1e3", "1000"},
+		{"1.5E-2", "0.015"},
+	} {
+		d, err := ParseDecimal(tc.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.in, err)
+		}
+		if d.String() != tc.out {
+			t.Errorf("%s: expected %s, got %s", tc.in, tc.out, d)
+		}
+	}
+	for _, in := range []string{"", "1/3", "abc", "1.2.3", "NaN", "1e-999999", "1e65", "0." + strings.Repeat("0", 40) + "1", strings.Repeat("9", 35)} {
+		if _, err := ParseDecimal(in); err == nil {
+			t.Errorf("expected %q to be invalid", in)
+		}
+	}
+
+	if d, err := ParseDecimal("1.5e-64"); err != nil || d.Places() != 65 {
+		t.Errorf("expected 1.5e-64 to have 65 places, got %v, %v", d, err)
+	}
+	if got := DecimalFromFloat(1.25e-20).String(); got != "0.0000000000000000000125" {
+		t.Errorf("expected a small float to keep its digits, got %s", got)
+	}
+
+	// Floats would add up to 0.30000000000000004
+	sum := MustParseDecimal("0.1").Add(MustParseDecimal("0.2"))
+	if !sum.Equal(MustParseDecimal("0.3")) {
+		t.Fatalf("expected 0.3, got %s", sum)
+	}
+
+	for _, tc := range []struct {
+		in     string
+		places int
+		out    string
+	}{
+		{"2.345", 2, "2.35"},
+		{"-2.345", 2, "-2.35"},
+		{"2.344", 2, "2.34"},
+		{"1234.5", 0, "1235"},
+	} {
+		if got := MustParseDecimal(tc.in).Round(tc.places).String(); got != tc.out {
+			t.Errorf("%s rounded to %d places: expected %s, got %s", tc.in, tc.places, tc.out, got)
+		}
+	}
+	if got := MustParseDecimal("1").Quo(MustParseDecimal("3"), 4).String(); got != "0.3333" {
+		t.Errorf("expected 0.3333, got %s", got)
+	}
+	if got := NewDecimal(105, 2).StringFixed(3); got != "1.050" {
+		t.Errorf("expected 1.050, got %s", got)
+	}
+	if got := DecimalFromFloat(1000.5).String(); got != "1000.5" {
+		t.Errorf("expected 1000.5, got %s", got)
+	}
+
+	if cents, err := MustParseDecimal("10.5").Scaled(2); err != nil || cents != 1050 {
+		t.Errorf("expected 1050 cents, got %d, %v", cents, err)
+	}
+	if _, err := MustParseDecimal("10.555").Scaled(2); err == nil {
+		t.Error("expected a third decimal place not to fit in cents")
+	}
+}
+
+func TestDecimalEncoding(t *testing.T) {
+	var v struct {
+		Amount  Decimal  `json:"amount" bson:"amount"`
+		Missing *Decimal `json:"missing" bson:"missing"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 12345678901234567890.12, "missing": null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Amount.String() != "12345678901234567890.12" || v.Missing != nil {
+		t.Fatalf("unexpected decimals %+v", v)
+	}
+	if err := json.Unmarshal([]byte(`{"amount": "0.07"}`), &v); err != nil || v.Amount.String() != "0.07" {
+		t.Fatalf("expected a quoted decimal, got %s, %v", v.Amount, err)
+	}
+	if err := json.Unmarshal([]byte(`{"amount": "seven"}`), &v); err == nil {
+		t.Fatal("expected an invalid decimal to fail")
+	}
+
+	data, err := json.Marshal(map[string]Decimal{"amount": MustParseDecimal("1000.50")})
+	if err != nil || string(data) != `{"amount":1000.5}` {
+		t.Fatalf("unexpected JSON %s, %v", data, err)
+	}
+
+	raw, err := bson.Marshal(bson.M{"amount": MustParseDecimal("0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind := bson.Raw(raw).Lookup("amount").Type; kind != bson.TypeDecimal128 {
+		t.Fatalf("expected a Decimal128, got %s", kind)
+	}
+	if err := bson.Unmarshal(raw, &v); err != nil || v.Amount.String() != "0.1" {
+		t.Fatalf("unexpected decimal %s, %v", v.Amount, err)
+	}
+
+	// Documents stored before amounts were decimals hold doubles
+	raw, err = bson.Marshal(bson.M{"amount": 99.9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bson.Unmarshal(raw, &v); err != nil || v.Amount.String() != "99.9" {
+		t.Fatalf("unexpected decimal %s, %v", v.Amount, err)
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	if currency, err := Currency(" usd "); err != nil || currency != "USD" {
+		t.Fatalf("expected USD, got %q, %v", currency, err)
+	}
+	if _, err := Currency("XYZ"); err == nil {
+		t.Fatal("expected an unknown currency to fail")
+	}
+
+	if got := FromMinor(1050, "brl"); got.Currency != "BRL" || got.String() != "10.50 BRL" {
+		t.Fatalf("unexpected amount %s", got)
+	}
+	if got := FromMinor(1050, "JPY").String(); got != "1050 JPY" {
+		t.Fatalf("unexpected amount %s", got)
+	}
+	if minor, err := (Money{Amount: MustParseDecimal("1.234"), Currency: "KWD"}).Minor(); err != nil || minor != 1234 {
+		t.Fatalf("expected 1234 fils, got %d, %v", minor, err)
+	}
+
+	t.Setenv("PAYMENT_CURRENCY", "eur")
+	if got := DefaultCurrency(); got != "EUR" {
+		t.Fatalf("expected EUR, got %s", got)
+	}
+	t.Setenv("PAYMENT_CURRENCY", "")
+	if got := DefaultCurrency(); got != "BRL" {
+		t.Fatalf("expected BRL, got %s", got)
+	}
+}
+
+func TestStaticRates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	data := `{"source": "ecb", "base": "eur", "asOf": "2024-01-02T00:00:00Z", "rates": {"usd": "1.1", "BRL": 5.5, "JPY": 160}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rates, err := LoadStaticRates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	at := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	converted, rate, err := Convert(ctx, rates, Money{Amount: MustParseDecimal("100"), Currency: "EUR"}, "USD", at)
+	if err != nil || converted.String() != "110.00 USD" {
+		t.Fatalf("unexpected conversion %s, %v", converted, err)
+	}
+	if rate.From != "EUR" || rate.To != "USD" || rate.Source != "ecb" || !rate.AsOf.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected rate %+v", rate)
+	}
+
+	// Cross rates go through the base currency
+	converted, rate, err = Convert(ctx, rates, Money{Amount: MustParseDecimal("100"), Currency: "BRL"}, "JPY", at)
+	if err != nil || converted.String() != "2909 JPY" || rate.Value.String() != "29.0909090909" {
+		t.Fatalf("unexpected conversion %s with %s, %v", converted, rate.Value, err)
+	}
+
+	converted, rate, err = Convert(ctx, rates, Money{Amount: MustParseDecimal("1.005"), Currency: "GBP"}, "GBP", at)
+	if err != nil || converted.Amount.String() != "1.005" || rate.Source != "identity" {
+		t.Fatalf("expected an identity conversion, got %s with %+v, %v", converted, rate, err)
+	}
+
+	if _, _, err := Convert(ctx, rates, Money{Amount: MustParseDecimal("1"), Currency: "GBP"}, "EUR", at); !errors.Is(err, ErrNoRate) {
+		t.Fatalf("expected no rate, got %v", err)
+	}
+
+	for _, invalid := range []string{
+		`{"base": "EUR", "rates": {"XYZ": 1}}`,
+		`{"base": "EUR", "rates": {"USD": 0}}`,
+		`{"base": "EUR", "rates": {"USD": "one"}}`,
+	} {
+		if err := os.WriteFile(path, []byte(invalid), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadStaticRates(path); err == nil {
+			t.Errorf("expected %s to be invalid", invalid)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package money
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/env"
+)
+
+// ErrNoRate is returned when a rate source has no rate between two
+// currencies
+var ErrNoRate = errors.New("no exchange rate")
+
+// ratePlaces is the precision of the cross rates computed from a base
+// currency
+const ratePlaces = 10
+
+// Rate is a snapshot of an exchange rate, kept with the amounts converted
+// with it
+type Rate struct {
+	From string `bson:"from" json:"from"`
+	To   string `bson:"to" json:"to"`
+	// Value is the amount of To worth one unit of From
+	Value  Decimal   `bson:"value" json:"value"`
+	Source string    `bson:"source" json:"source"`
+	AsOf   time.Time `bson:"asOf" json:"asOf"`
+}
+
+// RateSource provides exchange rates
+type RateSource interface {
+	// Rate returns the rate from one currency to another as of a time, or
+	// the latest one the source has before it
+	Rate(ctx context.Context, from, to string, at time.Time) (Rate, error)
+}
+
+// Convert converts an amount into a currency with a rate of the source as of
+// at, rounded to the minor unit of the currency. Amounts already in the
+// currency are returned unchanged with an identity rate.
+func Convert(ctx context.Context, source RateSource, amount Money, to string, at time.Time) (Money, Rate, error) {
+	if amount.Currency == to {
+		return amount, Rate{From: to, To: to, Value: NewDecimal(1, 0), Source: "identity", AsOf: at}, nil
+	}
+
+	rate, err := source.Rate(ctx, amount.Currency, to, at)
+	if err != nil {
+		return Money{}, Rate{}, err
+	}
+	converted := Money{Amount: amount.Amount.Mul(rate.Value), Currency: to}
+	return converted.Round(), rate, nil
+}
+
+var (
+	defaultSource RateSource
+	defaultMu     sync.Mutex
+)
+
+// DefaultRates returns the rate source used by the handlers: the static rates
+// of the file set by the EXCHANGE_RATES_FILE env var
+func DefaultRates() RateSource {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultSource != nil {
+		return defaultSource
+	}
+
+	path, err := env.Get(env.EXCHANGE_RATES_FILE)
+	if err != nil {
+		return unavailableRates{err}
+	}
+	source, err := LoadStaticRates(path)
+	if err != nil {
+		return unavailableRates{err}
+	}
+	defaultSource = source
+	return defaultSource
+}
+
+// SetDefaultRates replaces the source returned by DefaultRates. Passing nil
+// restores the one configured by env vars.
+func SetDefaultRates(s RateSource) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultSource = s
+}
+
+// StaticRates are fixed rates against a base currency, as published by
+// central banks
+type StaticRates struct {
+	Source string    `json:"source"`
+	Base   string    `json:"base"`
+	AsOf   time.Time `json:"asOf"`
+	// Rates are the amounts of each currency worth one unit of Base
+	Rates map[string]Decimal `json:"rates"`
+}
+
+// LoadStaticRates reads static rates from a JSON file such as
+//
+//	{"source": "ecb", "base": "EUR", "asOf": "2024-01-02T00:00:00Z",
+//	 "rates": {"USD": "1.0956", "BRL": 5.3507}}
+func LoadStaticRates(path string) (*StaticRates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rates StaticRates
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("invalid exchange rates file %s: %w", path, err)
+	}
+	if err := rates.validate(); err != nil {
+		return nil, fmt.Errorf("invalid exchange rates file %s: %w", path, err)
+	}
+	return &rates, nil
+}
+
+func (s *StaticRates) validate() error {
+	base, err := Currency(s.Base)
+	if err != nil {
+		return err
+	}
+	s.Base = base
+
+	rates := make(map[string]Decimal, len(s.Rates))
+	for code, rate := range s.Rates {
+		currency, err := Currency(code)
+		if err != nil {
+			return err
+		}
+		if rate.Sign() <= 0 {
+			return fmt.Errorf("rate of %s must be positive", currency)
+		}
+		rates[currency] = rate
+	}
+	rates[base] = NewDecimal(1, 0)
+	s.Rates = rates
+
+	if s.Source == "" {
+		s.Source = "static"
+	}
+	return nil
+}
+
+// Rate returns the cross rate of two currencies through the base currency.
+// The rates are the same at any time.
+func (s *StaticRates) Rate(ctx context.Context, from, to string, at time.Time) (Rate, error) {
+	fromRate, ok := s.Rates[from]
+	if !ok {
+		return Rate{}, fmt.Errorf("%s to %s: %w", from, to, ErrNoRate)
+	}
+	toRate, ok := s.Rates[to]
+	if !ok {
+		return Rate{}, fmt.Errorf("%s to %s: %w", from, to, ErrNoRate)
+	}
+
+	value := toRate
+	if from != s.Base {
+		value = toRate.Quo(fromRate, ratePlaces)
+	}
+	return Rate{From: from, To: to, Value: value, Source: s.Source, AsOf: s.AsOf}, nil
+}
+
+type unavailableRates struct {
+	err error
+}
+
+func (r unavailableRates) Rate(ctx context.Context, from, to string, at time.Time) (Rate, error) {
+	return Rate{}, fmt.Errorf("%s to %s: %v: %w", from, to, r.err, ErrNoRate)
+}
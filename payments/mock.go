@@ -0,0 +1,198 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MockProvider keeps payment intents in memory, to run the payment flow
+// offline. Its webhooks have the format and signature of Stripe ones, and the
+// payer is simulated with Pay and Decline.
+type MockProvider struct {
+	mu          sync.Mutex
+	secret      string
+	intents     map[string]Intent
+	idempotency map[string]string
+	events      int
+	now         func() time.Time
+}
+
+// NewMockProvider returns an empty MockProvider signing its webhooks with
+// secret
+func NewMockProvider(secret string) *MockProvider {
+	return &MockProvider{
+		secret:      secret,
+		intents:     make(map[string]Intent),
+		idempotency: make(map[string]string),
+		now:         time.Now,
+	}
+}
+
+func (p *MockProvider) Name() string {
+	return "mock"
+}
+
+func (p *MockProvider) CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id, ok := p.idempotency[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		intent := copyIntent(p.intents[id])
+		return &intent, nil
+	}
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive, got %d", req.Amount)
+	}
+
+	id := fmt.Sprintf("pi_mock_%d", len(p.intents)+1)
+	intent := Intent{
+		ID:           id,
+		ClientSecret: id + "_secret",
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		Status:       StatusPending,
+		Metadata:     req.Metadata,
+	}
+	p.intents[id] = copyIntent(intent)
+	if req.IdempotencyKey != "" {
+		p.idempotency[req.IdempotencyKey] = id
+	}
+	return &intent, nil
+}
+
+func (p *MockProvider) Capture(ctx context.Context, id string) (*Intent, error) {
+	return p.move(id, StatusAuthorized, func(i *Intent) {
+		i.Status = StatusSucceeded
+	})
+}
+
+func (p *MockProvider) Refund(ctx context.Context, id string, amount int64) (*Intent, error) {
+	return p.move(id, StatusSucceeded, func(i *Intent) {
+		if amount <= 0 || amount > i.Amount {
+			amount = i.Amount
+		}
+		i.Refunded = amount
+		i.Status = StatusRefunded
+	})
+}
+
+func (p *MockProvider) Intent(ctx context.Context, id string) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	intent = copyIntent(intent)
+	return &intent, nil
+}
+
+func (p *MockProvider) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := VerifySignature(payload, header.Get(SignatureHeader), p.secret, p.now()); err != nil {
+		return nil, err
+	}
+	return parseStripeEvent(payload)
+}
+
+// Pay simulates the payer confirming a pending intent, which becomes
+// authorized
+func (p *MockProvider) Pay(id string) (*Intent, error) {
+	return p.move(id, StatusPending, func(i *Intent) {
+		i.Status = StatusAuthorized
+	})
+}
+
+// Decline simulates the payment method of the payer being declined
+func (p *MockProvider) Decline(id string) (*Intent, error) {
+	return p.move(id, StatusPending, func(i *Intent) {
+		i.Status = StatusFailed
+	})
+}
+
+// Webhook returns the signed delivery notifying the current status of an
+// intent, in the format of the Stripe API
+func (p *MockProvider) Webhook(id string) ([]byte, http.Header, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+
+	var eventType string
+	for t, status := range stripeEvents {
+		if status == intent.Status {
+			eventType = t
+		}
+	}
+	if eventType == "" {
+		return nil, nil, fmt.Errorf("no event for status %s: %w", intent.Status, ErrInvalidState)
+	}
+
+	object := map[string]interface{}{
+		"id":       intent.ID,
+		"object":   "payment_intent",
+		"amount":   intent.Amount,
+		"currency": intent.Currency,
+		"metadata": intent.Metadata,
+	}
+	if intent.Status == StatusRefunded {
+		object = map[string]interface{}{
+			"id":              "ch_" + intent.ID,
+			"object":          "charge",
+			"amount":          intent.Amount,
+			"amount_refunded": intent.Refunded,
+			"currency":        intent.Currency,
+			"payment_intent":  intent.ID,
+		}
+	}
+
+	p.events++
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":   fmt.Sprintf("evt_mock_%d", p.events),
+		"type": eventType,
+		"data": map[string]interface{}{"object": object},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := http.Header{}
+	header.Set(SignatureHeader, Sign(payload, p.secret, p.now()))
+	return payload, header, nil
+}
+
+// move applies change to an intent in the from status
+func (p *MockProvider) move(id string, from Status, change func(*Intent)) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	if intent.Status != from {
+		return nil, fmt.Errorf("%s is %s: %w", id, intent.Status, ErrInvalidState)
+	}
+
+	change(&intent)
+	p.intents[id] = copyIntent(intent)
+	return &intent, nil
+}
+
+func copyIntent(intent Intent) Intent {
+	if intent.Metadata != nil {
+		metadata := make(map[string]string, len(intent.Metadata))
+		for k, v := range intent.Metadata {
+			metadata[k] = v
+		}
+		intent.Metadata = metadata
+	}
+	return intent
+}
@@ -0,0 +1,167 @@
+// Package payments charges the payments of make payment clauses through a
+// payment provider: Stripe, or an in-memory mock to run the flow offline
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/umairmaseed/clausia-api/env"
+)
+
+var (
+	// ErrNotFound is returned for an unknown payment intent
+	ErrNotFound = errors.New("payment intent not found")
+	// ErrInvalidState is returned when an intent cannot be captured or
+	// refunded in its current status
+	ErrInvalidState = errors.New("payment intent is not in a valid state for the operation")
+	// ErrInvalidSignature is returned for webhooks whose signature does not
+	// match their payload
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Status is the stage of a payment intent
+type Status string
+
+// Statuses of a payment intent. Intents are created with a manual capture, so
+// an authorized payment is only charged once it is captured.
+const (
+	StatusPending    Status = "pending"
+	StatusAuthorized Status = "authorized"
+	StatusSucceeded  Status = "succeeded"
+	StatusFailed     Status = "failed"
+	StatusCanceled   Status = "canceled"
+	StatusRefunded   Status = "refunded"
+)
+
+// Intent is a payment the payer is asked to make
+type Intent struct {
+	ID string `json:"id"`
+	// ClientSecret lets the frontend confirm the intent with the provider
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// Amount is in the minor unit of the currency, such as cents
+	Amount   int64             `json:"amount"`
+	Currency string            `json:"currency"`
+	Status   Status            `json:"status"`
+	Refunded int64             `json:"refunded,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// IntentRequest describes the intent to create
+type IntentRequest struct {
+	Amount   int64
+	Currency string
+	Metadata map[string]string
+	// IdempotencyKey makes retries of the same request create one intent
+	IdempotencyKey string
+}
+
+// Event is a change of a payment intent notified by a webhook
+type Event struct {
+	ID   string
+	Type string
+	// Intent is the intent as of the event. Its status is empty for events
+	// that are not handled.
+	Intent Intent
+}
+
+// Provider creates and follows payment intents with a payment gateway
+type Provider interface {
+	// Name identifies the provider in stored payments
+	Name() string
+	CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error)
+	// Capture charges an authorized intent
+	Capture(ctx context.Context, id string) (*Intent, error)
+	// Refund returns amount of a succeeded intent to the payer, or all of it
+	// when amount is 0
+	Refund(ctx context.Context, id string, amount int64) (*Intent, error)
+	// Intent fetches the current state of an intent
+	Intent(ctx context.Context, id string) (*Intent, error)
+	// ParseWebhook verifies the signature of a webhook delivery and returns
+	// its event. It returns ErrInvalidSignature for forged deliveries.
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+var (
+	defaultProvider Provider
+	defaultMu       sync.Mutex
+)
+
+// Default returns the provider used by the handlers. It is chosen by the
+// PAYMENT_PROVIDER env var: stripe (the default) or mock.
+func Default() Provider {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultProvider != nil {
+		return defaultProvider
+	}
+
+	provider, err := newProviderFromEnv()
+	if err != nil {
+		return unavailableProvider{err}
+	}
+	defaultProvider = provider
+	return defaultProvider
+}
+
+// SetDefault replaces the provider returned by Default. Passing nil restores
+// the one configured by env vars.
+func SetDefault(p Provider) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultProvider = p
+}
+
+func newProviderFromEnv() (Provider, error) {
+	secret, err := env.Get(env.PAYMENT_WEBHOOK_SECRET)
+	if err != nil {
+		return nil, err
+	}
+
+	switch provider := os.Getenv(env.PAYMENT_PROVIDER); provider {
+	case "", "stripe":
+		key, err := env.Get(env.STRIPE_SECRET_KEY)
+		if err != nil {
+			return nil, err
+		}
+		return NewStripeProvider(key, secret, os.Getenv(env.STRIPE_API_URL)), nil
+	case "mock":
+		return NewMockProvider(secret), nil
+	default:
+		return nil, fmt.Errorf("unknown %s %q", env.PAYMENT_PROVIDER, provider)
+	}
+}
+
+type unavailableProvider struct {
+	err error
+}
+
+func (p unavailableProvider) Name() string {
+	return "unavailable"
+}
+
+func (p unavailableProvider) CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	return nil, p.err
+}
+
+func (p unavailableProvider) Capture(ctx context.Context, id string) (*Intent, error) {
+	return nil, p.err
+}
+
+func (p unavailableProvider) Refund(ctx context.Context, id string, amount int64) (*Intent, error) {
+	return nil, p.err
+}
+
+func (p unavailableProvider) Intent(ctx context.Context, id string) (*Intent, error) {
+	return nil, p.err
+}
+
+func (p unavailableProvider) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	return nil, p.err
+}
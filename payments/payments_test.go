@@ -0,0 +1,197 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStripeProvider(t *testing.T) {
+	ctx := context.Background()
+
+	var requests []*http.Request
+	var forms []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		requests = append(requests, r)
+		forms = append(forms, form)
+
+		switch r.URL.Path {
+		case "/v1/payment_intents":
+			io.WriteString(w, `{"id":"pi_1","client_secret":"pi_1_secret","amount":1500,"currency":"brl","status":"requires_payment_method","metadata":{"clauseKey":"clause:rent"}}`)
+		case "/v1/payment_intents/pi_1/capture":
+			io.WriteString(w, `{"id":"pi_1","amount":1500,"currency":"brl","status":"succeeded","latest_charge":"ch_1"}`)
+		case "/v1/payment_intents/pi_2/capture":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":{"code":"payment_intent_unexpected_state","message":"already captured"}}`)
+		case "/v1/refunds":
+			io.WriteString(w, `{"id":"re_1","status":"succeeded"}`)
+		case "/v1/payment_intents/pi_1":
+			io.WriteString(w, `{"id":"pi_1","amount":1500,"currency":"brl","status":"succeeded","latest_charge":{"id":"ch_1","amount_refunded":500}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":{"code":"resource_missing","message":"no such payment_intent"}}`)
+		}
+	}))
+	defer server.Close()
+
+	p := NewStripeProvider("sk_test", "whsec_test", server.URL+"/")
+
+	intent, err := p.CreateIntent(ctx, IntentRequest{
+		Amount:         1500,
+		Currency:       "brl",
+		Metadata:       map[string]string{"clauseKey": "clause:rent"},
+		IdempotencyKey: "payment-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.ID != "pi_1" || intent.ClientSecret != "pi_1_secret" || intent.Status != StatusPending || intent.Metadata["clauseKey"] != "clause:rent" {
+		t.Fatalf("unexpected intent %+v", intent)
+	}
+	req, form := requests[0], forms[0]
+	if req.Header.Get("Authorization") != "Bearer sk_test" || req.Header.Get("Idempotency-Key") != "payment-1" {
+		t.Fatalf("unexpected headers %v", req.Header)
+	}
+	if form.Get("amount") != "1500" || form.Get("currency") != "brl" || form.Get("capture_method") != "manual" || form.Get("metadata[clauseKey]") != "clause:rent" {
+		t.Fatalf("unexpected form %v", form)
+	}
+
+	if intent, err = p.Capture(ctx, "pi_1"); err != nil || intent.Status != StatusSucceeded || intent.Refunded != 0 {
+		t.Fatalf("expected a captured intent, got %+v, %v", intent, err)
+	}
+	if _, err := p.Capture(ctx, "pi_2"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected ErrInvalidState, got %v", err)
+	}
+	if _, err := p.Intent(ctx, "pi_missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	requests, forms = nil, nil
+	intent, err = p.Refund(ctx, "pi_1", 500)
+	if err != nil || intent.Status != StatusRefunded || intent.Refunded != 500 {
+		t.Fatalf("expected a refunded intent, got %+v, %v", intent, err)
+	}
+	if forms[0].Get("payment_intent") != "pi_1" || forms[0].Get("amount") != "500" {
+		t.Fatalf("unexpected refund form %v", forms[0])
+	}
+	if requests[1].URL.Query().Get("expand[]") != "latest_charge" {
+		t.Fatalf("expected the charge to be expanded, got %s", requests[1].URL)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1"}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign(payload, "whsec_test", now)
+
+	if err := VerifySignature(payload, header, "whsec_test", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	// A rotated secret is signed along with the previous one
+	rotated := header + ",v1=" + signature(payload, "whsec_old", "1700000000")
+	if err := VerifySignature(payload, rotated, "whsec_test", now); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		payload []byte
+		header  string
+		secret  string
+		now     time.Time
+	}{
+		"tampered payload": {[]byte(`{"id":"evt_2"}`), header, "whsec_test", now},
+		"other secret":     {payload, header, "whsec_other", now},
+		"no secret":        {payload, header, "", now},
+		"replayed":         {payload, header, "whsec_test", now.Add(10 * time.Minute)},
+		"no timestamp":     {payload, "v1=" + signature(payload, "whsec_test", ""), "whsec_test", now},
+		"empty":            {payload, "", "whsec_test", now},
+	} {
+		if err := VerifySignature(tc.payload, tc.header, tc.secret, tc.now); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+}
+
+func TestParseStripeEvent(t *testing.T) {
+	event, err := parseStripeEvent([]byte(`{"id":"evt_1","type":"charge.refunded","data":{"object":{"id":"ch_1","object":"charge","amount":1500,"amount_refunded":1500,"currency":"brl","payment_intent":"pi_1"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != "evt_1" || event.Intent.ID != "pi_1" || event.Intent.Status != StatusRefunded || event.Intent.Refunded != 1500 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	event, err = parseStripeEvent([]byte(`{"id":"evt_2","type":"payment_intent.created","data":{"object":{"id":"pi_1","object":"payment_intent"}}}`))
+	if err != nil || event.Intent.Status != "" {
+		t.Fatalf("expected an event that is not handled, got %+v, %v", event, err)
+	}
+
+	if _, err := parseStripeEvent([]byte(`not json`)); err == nil {
+		t.Fatal("expected an invalid payload to fail")
+	}
+}
+
+func TestMockProvider(t *testing.T) {
+	ctx := context.Background()
+	p := NewMockProvider("whsec_test")
+
+	req := IntentRequest{Amount: 1500, Currency: "brl", IdempotencyKey: "payment-1"}
+	intent, err := p.CreateIntent(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := p.CreateIntent(ctx, req); err != nil || again.ID != intent.ID {
+		t.Fatalf("expected the same intent for the same idempotency key, got %+v, %v", again, err)
+	}
+	if _, err := p.CreateIntent(ctx, IntentRequest{Amount: 0, Currency: "brl"}); err == nil {
+		t.Fatal("expected a zero amount to be rejected")
+	}
+
+	if _, err := p.Capture(ctx, intent.ID); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected a pending intent not to be captured, got %v", err)
+	}
+	if _, err := p.Pay("pi_missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := p.Pay(intent.ID); err != nil {
+		t.Fatal(err)
+	}
+	payload, header, err := p.Webhook(intent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := p.ParseWebhook(payload, header)
+	if err != nil || event.Intent.ID != intent.ID || event.Intent.Status != StatusAuthorized || event.Intent.Amount != 1500 {
+		t.Fatalf("unexpected event %+v, %v", event, err)
+	}
+	if _, err := p.ParseWebhook([]byte(strings.Replace(string(payload), "1500", "1", 1)), header); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected a tampered webhook to be rejected, got %v", err)
+	}
+
+	if intent, err = p.Capture(ctx, intent.ID); err != nil || intent.Status != StatusSucceeded {
+		t.Fatalf("expected a captured intent, got %+v, %v", intent, err)
+	}
+	if intent, err = p.Refund(ctx, intent.ID, 0); err != nil || intent.Status != StatusRefunded || intent.Refunded != 1500 {
+		t.Fatalf("expected a refunded intent, got %+v, %v", intent, err)
+	}
+	if _, err := p.Refund(ctx, intent.ID, 0); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected a refunded intent not to be refunded again, got %v", err)
+	}
+
+	payload, header, err = p.Webhook(intent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event, err = p.ParseWebhook(payload, header); err != nil || event.Type != "charge.refunded" || event.Intent.ID != intent.ID || event.Intent.Refunded != 1500 {
+		t.Fatalf("unexpected event %+v, %v", event, err)
+	}
+}
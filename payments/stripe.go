@@ -0,0 +1,313 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stripeAPIURL = "https://api.stripe.com"
+	// SignatureHeader carries the signature of webhook deliveries
+	SignatureHeader = "Stripe-Signature"
+	// signatureTolerance is how old a webhook delivery may be, against
+	// replays of captured deliveries
+	signatureTolerance = 5 * time.Minute
+)
+
+// StripeProvider charges payments with the Stripe API, or any API
+// compatible with it
+type StripeProvider struct {
+	apiURL        string
+	secretKey     string
+	webhookSecret string
+	httpClient    *http.Client
+	now           func() time.Time
+}
+
+// NewStripeProvider returns a provider calling the Stripe API at apiURL,
+// https://api.stripe.com when empty, with the given secret key. Webhooks are
+// verified with webhookSecret.
+func NewStripeProvider(secretKey, webhookSecret, apiURL string) *StripeProvider {
+	if apiURL == "" {
+		apiURL = stripeAPIURL
+	}
+	return &StripeProvider{
+		apiURL:        strings.TrimRight(apiURL, "/"),
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+		now:           time.Now,
+	}
+}
+
+func (p *StripeProvider) Name() string {
+	return "stripe"
+}
+
+func (p *StripeProvider) CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	form := url.Values{
+		"amount":         {strconv.FormatInt(req.Amount, 10)},
+		"currency":       {req.Currency},
+		"capture_method": {"manual"},
+	}
+	for k, v := range req.Metadata {
+		form.Set("metadata["+k+"]", v)
+	}
+
+	var intent stripeIntent
+	if err := p.call(ctx, http.MethodPost, "/v1/payment_intents", form, req.IdempotencyKey, &intent); err != nil {
+		return nil, err
+	}
+	return intent.toIntent(), nil
+}
+
+func (p *StripeProvider) Capture(ctx context.Context, id string) (*Intent, error) {
+	var intent stripeIntent
+	if err := p.call(ctx, http.MethodPost, "/v1/payment_intents/"+url.PathEscape(id)+"/capture", url.Values{}, "", &intent); err != nil {
+		return nil, err
+	}
+	return intent.toIntent(), nil
+}
+
+func (p *StripeProvider) Refund(ctx context.Context, id string, amount int64) (*Intent, error) {
+	form := url.Values{"payment_intent": {id}}
+	if amount > 0 {
+		form.Set("amount", strconv.FormatInt(amount, 10))
+	}
+	if err := p.call(ctx, http.MethodPost, "/v1/refunds", form, "", nil); err != nil {
+		return nil, err
+	}
+	return p.Intent(ctx, id)
+}
+
+func (p *StripeProvider) Intent(ctx context.Context, id string) (*Intent, error) {
+	var intent stripeIntent
+	path := "/v1/payment_intents/" + url.PathEscape(id) + "?expand[]=latest_charge"
+	if err := p.call(ctx, http.MethodGet, path, nil, "", &intent); err != nil {
+		return nil, err
+	}
+	return intent.toIntent(), nil
+}
+
+func (p *StripeProvider) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := VerifySignature(payload, header.Get(SignatureHeader), p.webhookSecret, p.now()); err != nil {
+		return nil, err
+	}
+	return parseStripeEvent(payload)
+}
+
+// call sends a form encoded request to the API and decodes the response into
+// out, when not nil
+func (p *StripeProvider) call(ctx context.Context, method, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secretKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call payment provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read payment provider response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+				Code    string `json:"code"`
+			} `json:"error"`
+		}
+		json.Unmarshal(raw, &apiErr)
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound || apiErr.Error.Code == "resource_missing":
+			return fmt.Errorf("%s: %w", apiErr.Error.Message, ErrNotFound)
+		case apiErr.Error.Code == "payment_intent_unexpected_state" || apiErr.Error.Code == "charge_already_refunded":
+			return fmt.Errorf("%s: %w", apiErr.Error.Message, ErrInvalidState)
+		default:
+			return fmt.Errorf("payment provider returned %d: %s", resp.StatusCode, apiErr.Error.Message)
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("failed to decode payment provider response: %w", err)
+	}
+	return nil
+}
+
+// stripeIntent is a payment intent of the Stripe API
+type stripeIntent struct {
+	ID           string            `json:"id"`
+	ClientSecret string            `json:"client_secret"`
+	Amount       int64             `json:"amount"`
+	Currency     string            `json:"currency"`
+	Status       string            `json:"status"`
+	Metadata     map[string]string `json:"metadata"`
+	// LatestCharge is the id of the charge, or the charge itself when
+	// expanded
+	LatestCharge json.RawMessage `json:"latest_charge,omitempty"`
+}
+
+func (i stripeIntent) toIntent() *Intent {
+	intent := &Intent{
+		ID:           i.ID,
+		ClientSecret: i.ClientSecret,
+		Amount:       i.Amount,
+		Currency:     i.Currency,
+		Status:       stripeStatus(i.Status),
+		Metadata:     i.Metadata,
+	}
+	var charge struct {
+		AmountRefunded int64 `json:"amount_refunded"`
+	}
+	if json.Unmarshal(i.LatestCharge, &charge) == nil && charge.AmountRefunded > 0 {
+		intent.Refunded = charge.AmountRefunded
+		intent.Status = StatusRefunded
+	}
+	return intent
+}
+
+// stripeStatus maps the status of a Stripe payment intent to a Status
+func stripeStatus(status string) Status {
+	switch status {
+	case "requires_capture":
+		return StatusAuthorized
+	case "succeeded":
+		return StatusSucceeded
+	case "canceled":
+		return StatusCanceled
+	default:
+		return StatusPending
+	}
+}
+
+// stripeEvents maps the webhook events handled to the status they move the
+// intent to
+var stripeEvents = map[string]Status{
+	"payment_intent.amount_capturable_updated": StatusAuthorized,
+	"payment_intent.succeeded":                 StatusSucceeded,
+	"payment_intent.payment_failed":            StatusFailed,
+	"payment_intent.canceled":                  StatusCanceled,
+	"charge.refunded":                          StatusRefunded,
+}
+
+// parseStripeEvent decodes a webhook delivery in the format of the Stripe
+// API. Events about charges refer to their intent by its id.
+func parseStripeEvent(payload []byte) (*Event, error) {
+	var delivery struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID             string            `json:"id"`
+				Object         string            `json:"object"`
+				Amount         int64             `json:"amount"`
+				AmountRefunded int64             `json:"amount_refunded"`
+				Currency       string            `json:"currency"`
+				Metadata       map[string]string `json:"metadata"`
+				PaymentIntent  string            `json:"payment_intent"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &delivery); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	object := delivery.Data.Object
+	event := &Event{
+		ID:   delivery.ID,
+		Type: delivery.Type,
+		Intent: Intent{
+			ID:       object.ID,
+			Amount:   object.Amount,
+			Currency: object.Currency,
+			Status:   stripeEvents[delivery.Type],
+			Metadata: object.Metadata,
+		},
+	}
+	if object.Object == "charge" {
+		event.Intent.ID = object.PaymentIntent
+		event.Intent.Refunded = object.AmountRefunded
+	}
+	return event, nil
+}
+
+// Sign returns the signature header of a webhook payload sent at t, in the
+// t=<unix time>,v1=<hex HMAC-SHA256> format of Stripe
+func Sign(payload []byte, secret string, t time.Time) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + signature(payload, secret, timestamp)
+}
+
+// VerifySignature checks the signature header of a webhook payload, which
+// must have been signed with secret less than five minutes before now
+func VerifySignature(payload []byte, header, secret string, now time.Time) error {
+	if secret == "" {
+		return fmt.Errorf("no webhook secret configured: %w", ErrInvalidSignature)
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			signatures = append(signatures, v)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing signature timestamp: %w", ErrInvalidSignature)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return fmt.Errorf("signature timestamp is outside the tolerance: %w", ErrInvalidSignature)
+	}
+
+	expected := signature(payload, secret, timestamp)
+	for _, s := range signatures {
+		if hmac.Equal([]byte(s), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func signature(payload []byte, secret, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
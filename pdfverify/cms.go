@@ -0,0 +1,256 @@
+package pdfverify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	// Registers the hash functions used by signatures
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidRSAPSS        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+
+	digestAlgorithms = map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+		"2.16.840.1.101.3.4.2.4": crypto.SHA224,
+	}
+)
+
+// The PKCS#7 / CMS structures of RFC 5652 needed to check PDF signatures
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// signature is a parsed CMS signature
+type signature struct {
+	certificates []*x509.Certificate
+	signer       *x509.Certificate
+	info         signerInfo
+	hash         crypto.Hash
+	content      []byte
+	attrs        map[string]asn1.RawValue
+}
+
+func parseSignature(der []byte) (*signature, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("invalid signature container: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("unsupported signature content type %s", ci.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("invalid signed data: %w", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("expected one signer, found %d", len(sd.SignerInfos))
+	}
+
+	sig := &signature{info: sd.SignerInfos[0], attrs: map[string]asn1.RawValue{}}
+
+	if len(sd.Certificates.Bytes) > 0 {
+		certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificates: %w", err)
+		}
+		sig.certificates = certs
+	}
+
+	if len(sd.EncapContentInfo.Content.Bytes) > 0 {
+		// adbe.pkcs7.sha1 signatures embed the digest of the signed bytes
+		var content []byte
+		if _, err := asn1.Unmarshal(sd.EncapContentInfo.Content.Bytes, &content); err != nil {
+			return nil, fmt.Errorf("invalid signed content: %w", err)
+		}
+		sig.content = content
+	}
+
+	hash, ok := digestAlgorithms[sig.info.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", sig.info.DigestAlgorithm.Algorithm)
+	}
+	sig.hash = hash
+
+	signer, err := findSigner(sig.info.SID, sig.certificates)
+	if err != nil {
+		return nil, err
+	}
+	sig.signer = signer
+
+	rest := sig.info.SignedAttrs.Bytes
+	for len(rest) > 0 {
+		var attr attribute
+		rest, err = asn1.Unmarshal(rest, &attr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signed attributes: %w", err)
+		}
+		sig.attrs[attr.Type.String()] = attr.Values
+	}
+
+	return sig, nil
+}
+
+// findSigner returns the certificate matching the signer identifier, either
+// an issuer and serial number or a [0] subject key identifier
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, cert := range certs {
+			if bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+		return nil, errors.New("signer certificate not found")
+	}
+
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil, fmt.Errorf("invalid signer identifier: %w", err)
+	}
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.Serial) == 0 {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("signer certificate not found")
+}
+
+// signingTime returns the signing time attribute, if the signer added one
+func (s *signature) signingTime() *time.Time {
+	values, ok := s.attrs[oidSigningTime.String()]
+	if !ok {
+		return nil
+	}
+
+	var t time.Time
+	if _, err := asn1.Unmarshal(values.Bytes, &t); err != nil {
+		return nil
+	}
+	return &t
+}
+
+// checkDigest reports whether the signature covers signed, the bytes of the
+// PDF within its byte range
+func (s *signature) checkDigest(signed []byte) (bool, error) {
+	h := s.hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	if s.content != nil {
+		sha1 := crypto.SHA1.New()
+		sha1.Write(signed)
+		if !bytes.Equal(s.content, sha1.Sum(nil)) {
+			return false, nil
+		}
+		digest = s.digestOf(s.content)
+	}
+
+	if len(s.info.SignedAttrs.Bytes) == 0 {
+		// Without signed attributes the signature is computed over the
+		// content directly, which checkSignature verifies
+		return true, nil
+	}
+
+	values, ok := s.attrs[oidMessageDigest.String()]
+	if !ok {
+		return false, errors.New("missing message digest attribute")
+	}
+	var messageDigest []byte
+	if _, err := asn1.Unmarshal(values.Bytes, &messageDigest); err != nil {
+		return false, fmt.Errorf("invalid message digest attribute: %w", err)
+	}
+	return bytes.Equal(messageDigest, digest), nil
+}
+
+// checkSignature verifies the signer's signature over the signed attributes,
+// or over the signed bytes when there are none
+func (s *signature) checkSignature(signed []byte) error {
+	data := signed
+	if s.content != nil {
+		data = s.content
+	}
+	if len(s.info.SignedAttrs.Bytes) > 0 {
+		// The signature covers the DER encoding of the attributes as a SET,
+		// not with the implicit [0] tag they are stored with
+		data = append([]byte{}, s.info.SignedAttrs.FullBytes...)
+		data[0] = 0x31
+	}
+
+	switch pub := s.signer.PublicKey.(type) {
+	case *rsa.PublicKey:
+		digest := s.digestOf(data)
+		if s.info.SignatureAlgorithm.Algorithm.Equal(oidRSAPSS) {
+			return rsa.VerifyPSS(pub, s.hash, digest, s.info.Signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(pub, s.hash, digest, s.info.Signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, s.digestOf(data), s.info.Signature) {
+			return errors.New("ecdsa signature verification failed")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, data, s.info.Signature) {
+			return errors.New("ed25519 signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+func (s *signature) digestOf(data []byte) []byte {
+	h := s.hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
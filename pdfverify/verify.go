@@ -0,0 +1,253 @@
+// Package pdfverify checks the digital signatures embedded in PDF files
+package pdfverify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// byteRangePattern matches the /ByteRange of the signature dictionaries.
+// The bytes left out of the range are the hex encoded /Contents holding the
+// CMS signature.
+var byteRangePattern = regexp.MustCompile(`/ByteRange\s*\[\s*(\d+)\s+(\d+)\s+(\d+)\s+(\d+)\s*\]`)
+
+// errRangeOutside is the error of the signatures whose byte range does not
+// fit in the file
+const errRangeOutside = "byte range is outside the file"
+
+// ErrNoSignatures is returned by Verify for PDFs without signatures
+var ErrNoSignatures = errors.New("no signatures found")
+
+// Options configure how certificate chains are validated
+type Options struct {
+	// Roots are the trusted root certificates. The system pool is used
+	// when nil.
+	Roots *x509.CertPool
+	// CurrentTime is the time chains are validated at. Each signature's
+	// signing time is used when zero, falling back to the current time.
+	CurrentTime time.Time
+}
+
+// Report is the result of verifying the signatures of a PDF
+type Report struct {
+	Size       int64             `json:"size"`
+	SHA256     string            `json:"sha256"`
+	Signatures []SignatureReport `json:"signatures"`
+	// Valid is true when every signature is intact and verified
+	Valid bool `json:"valid"`
+	// UnsignedChanges is true when the end of the file is not covered by
+	// any signature, i.e. the PDF was updated after it was last signed
+	UnsignedChanges bool `json:"unsignedChanges"`
+}
+
+// SignatureReport describes one embedded signature
+type SignatureReport struct {
+	Signer          *Certificate  `json:"signer,omitempty"`
+	Chain           []Certificate `json:"chain,omitempty"`
+	ChainTrusted    bool          `json:"chainTrusted"`
+	TrustError      string        `json:"trustError,omitempty"`
+	SigningTime     *time.Time    `json:"signingTime,omitempty"`
+	DigestAlgorithm string        `json:"digestAlgorithm,omitempty"`
+	ByteRange       [4]int64      `json:"byteRange"`
+	CoveredBytes    int64         `json:"coveredBytes"`
+	// ModifiedAfter is true when the file has bytes past the end of the
+	// signed range, such as later signatures or edits
+	ModifiedAfter bool `json:"modifiedAfter"`
+	// DigestValid is true when the signed bytes match the signed digest
+	DigestValid bool `json:"digestValid"`
+	// SignatureValid is true when the signer's signature verifies
+	SignatureValid bool   `json:"signatureValid"`
+	Error          string `json:"error,omitempty"`
+}
+
+// Certificate summarizes an X.509 certificate
+type Certificate struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serialNumber"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+}
+
+// Verify checks every signature of the PDF. Signature dictionaries stored in
+// compressed object streams are not found.
+func Verify(pdf []byte, opts Options) (*Report, error) {
+	sum := sha256.Sum256(pdf)
+	report := &Report{
+		Size:   int64(len(pdf)),
+		SHA256: hex.EncodeToString(sum[:]),
+		Valid:  true,
+	}
+
+	// Incremental updates may repeat a signature dictionary
+	seen := map[[4]int64]bool{}
+	var end int64
+	for _, match := range byteRangePattern.FindAllSubmatch(pdf, -1) {
+		var byteRange [4]int64
+		for i := range byteRange {
+			n, err := strconv.ParseInt(string(match[i+1]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid byte range %q: %w", match[0], err)
+			}
+			byteRange[i] = n
+		}
+		if seen[byteRange] {
+			continue
+		}
+		seen[byteRange] = true
+
+		sig := verifySignature(pdf, byteRange, opts)
+		report.Valid = report.Valid && sig.DigestValid && sig.SignatureValid
+		report.Signatures = append(report.Signatures, sig)
+
+		if sig.Error != errRangeOutside {
+			if rangeEnd := byteRange[2] + byteRange[3]; rangeEnd > end {
+				end = rangeEnd
+			}
+		}
+	}
+
+	if len(report.Signatures) == 0 {
+		report.Valid = false
+		return report, ErrNoSignatures
+	}
+	report.UnsignedChanges = end < report.Size
+	return report, nil
+}
+
+func verifySignature(pdf []byte, byteRange [4]int64, opts Options) SignatureReport {
+	report := SignatureReport{ByteRange: byteRange}
+
+	start, length, gapEnd, tail := byteRange[0], byteRange[1], byteRange[2], byteRange[3]
+	size := int64(len(pdf))
+	// Compared without sums, which crafted ranges would overflow
+	if start < 0 || length < 0 || tail < 0 || gapEnd < start || gapEnd > size || length > gapEnd-start || tail > size-gapEnd {
+		report.Error = errRangeOutside
+		return report
+	}
+	report.CoveredBytes = length + tail
+	report.ModifiedAfter = gapEnd+tail < size
+
+	der, err := decodeContents(pdf[start+length : gapEnd])
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	sig, err := parseSignature(der)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	report.Signer = summarize(sig.signer)
+	report.SigningTime = sig.signingTime()
+	report.DigestAlgorithm = sig.hash.String()
+	report.Chain, report.ChainTrusted, report.TrustError = checkChain(sig, opts)
+
+	signed := make([]byte, 0, report.CoveredBytes)
+	signed = append(signed, pdf[start:start+length]...)
+	signed = append(signed, pdf[gapEnd:gapEnd+tail]...)
+
+	report.DigestValid, err = sig.checkDigest(signed)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	if err := sig.checkSignature(signed); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.SignatureValid = true
+
+	return report
+}
+
+// decodeContents decodes the hex string <...> holding the signature. It is
+// padded with zeros, which asn1.Unmarshal ignores.
+func decodeContents(contents []byte) ([]byte, error) {
+	contents = bytes.TrimSpace(contents)
+	if len(contents) < 2 || contents[0] != '<' || contents[len(contents)-1] != '>' {
+		return nil, errors.New("signature contents are not a hex string")
+	}
+
+	hexDigits := bytes.Map(func(r rune) rune {
+		if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+			return -1
+		}
+		return r
+	}, contents[1:len(contents)-1])
+	if len(hexDigits)%2 == 1 {
+		hexDigits = append(hexDigits, '0')
+	}
+
+	der := make([]byte, hex.DecodedLen(len(hexDigits)))
+	if _, err := hex.Decode(der, hexDigits); err != nil {
+		return nil, fmt.Errorf("invalid signature contents: %w", err)
+	}
+	return der, nil
+}
+
+// checkChain returns the issuer chain of the signer built from the embedded
+// certificates, and whether it leads to a trusted root
+func checkChain(sig *signature, opts Options) ([]Certificate, bool, string) {
+	var chain []Certificate
+	intermediates := x509.NewCertPool()
+	for _, cert := range sig.certificates {
+		intermediates.AddCert(cert)
+	}
+
+	cert := sig.signer
+	for i := 0; cert != nil && i < len(sig.certificates)+1; i++ {
+		chain = append(chain, *summarize(cert))
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			break
+		}
+		cert = issuerOf(cert, sig.certificates)
+	}
+
+	at := opts.CurrentTime
+	if at.IsZero() {
+		if t := sig.signingTime(); t != nil {
+			at = *t
+		}
+	}
+
+	_, err := sig.signer.Verify(x509.VerifyOptions{
+		Roots:         opts.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return chain, false, err.Error()
+	}
+	return chain, true, ""
+}
+
+func issuerOf(cert *x509.Certificate, certs []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range certs {
+		if candidate != cert && bytes.Equal(candidate.RawSubject, cert.RawIssuer) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+func summarize(cert *x509.Certificate) *Certificate {
+	return &Certificate{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	}
+}
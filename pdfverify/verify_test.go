@@ -0,0 +1,146 @@
+package pdfverify
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func readFixture(t *testing.T) []byte {
+	t.Helper()
+
+	pdf, err := os.ReadFile("testdata/signed.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pdf
+}
+
+func TestVerifySignedPDF(t *testing.T) {
+	report, err := Verify(readFixture(t), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.Valid || report.UnsignedChanges || len(report.Signatures) != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	sig := report.Signatures[0]
+	if !sig.DigestValid || !sig.SignatureValid || sig.ModifiedAfter {
+		t.Fatalf("expected an intact signature, got %+v", sig)
+	}
+	if sig.Signer == nil || sig.Signer.Subject != "CN=Nome Posto nao encontrado-47773901104,OU=client" {
+		t.Fatalf("unexpected signer %+v", sig.Signer)
+	}
+	if len(sig.Chain) != 1 || sig.Chain[0].Issuer != sig.Signer.Issuer {
+		t.Fatalf("unexpected chain %+v", sig.Chain)
+	}
+	if sig.ChainTrusted {
+		t.Fatal("expected the chain not to be trusted without the issuing CA")
+	}
+	if sig.SigningTime == nil || sig.SigningTime.Format("2006-01-02") != "2021-08-11" {
+		t.Fatalf("unexpected signing time %v", sig.SigningTime)
+	}
+	if sig.ByteRange != [4]int64{0, 100757, 103481, 14103} || sig.CoveredBytes != 100757+14103 {
+		t.Fatalf("unexpected byte range %v covering %d bytes", sig.ByteRange, sig.CoveredBytes)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	pdf := readFixture(t)
+
+	// Change one byte in the signed range, before the signature
+	tampered := append([]byte{}, pdf...)
+	i := bytes.Index(tampered, []byte("/Producer"))
+	if i < 0 || i > 100757 {
+		i = 100
+	}
+	tampered[i+1] ^= 0x20
+
+	report, err := Verify(tampered, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid || report.Signatures[0].DigestValid {
+		t.Fatalf("expected the digest check to fail, got %+v", report.Signatures[0])
+	}
+}
+
+func TestVerifyReportsChangesAfterSigning(t *testing.T) {
+	pdf := append(readFixture(t), []byte("\n1 0 obj\n<< /Annot /Injected >>\nendobj\n%%EOF\n")...)
+
+	report, err := Verify(pdf, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.UnsignedChanges || !report.Signatures[0].ModifiedAfter {
+		t.Fatalf("expected the appended update to be reported, got %+v", report)
+	}
+	if !report.Signatures[0].SignatureValid {
+		t.Fatal("expected the signature over the original bytes to remain valid")
+	}
+}
+
+func TestVerifyUnsignedPDF(t *testing.T) {
+	report, err := Verify([]byte("%PDF-1.7\n%%EOF\n"), Options{})
+	if !errors.Is(err, ErrNoSignatures) {
+		t.Fatalf("expected ErrNoSignatures, got %v", err)
+	}
+	if report.Valid || report.SHA256 == "" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestVerifyRejectsInvalidByteRange(t *testing.T) {
+	report, err := Verify([]byte("%PDF-1.7\n/ByteRange [0 10 20 99999]\n%%EOF\n"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid || report.Signatures[0].Error == "" {
+		t.Fatalf("expected an invalid signature, got %+v", report.Signatures[0])
+	}
+}
+
+func TestVerifyRejectsOverflowingByteRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		byteRange string
+		parsed    bool
+	}{
+		{"length past the gap", "0 9223372036854775807 20 0", true},
+		{"tail past the file", "0 10 20 9223372036854775807", true},
+		{"gap past the file", "0 10 9223372036854775807 9223372036854775807", true},
+		{"gap before start", "30 10 20 0", true},
+		{"too large", "0 10 20 99999999999999999999", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Verify([]byte("%PDF-1.7\n/ByteRange ["+tt.byteRange+"]\n%%EOF\n"), Options{})
+			if !tt.parsed {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", report)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Valid || report.Signatures[0].Error == "" {
+				t.Fatalf("expected an invalid signature, got %+v", report)
+			}
+		})
+	}
+}
+
+func FuzzVerify(f *testing.F) {
+	f.Add([]byte("%PDF-1.7\n/ByteRange [0 10 20 99999]\n%%EOF\n"))
+	f.Add([]byte("/ByteRange [0 9223372036854775807 9223372036854775807 9223372036854775807]"))
+	f.Add([]byte("/ByteRange [0 1 2 3]<00>"))
+	f.Fuzz(func(t *testing.T, pdf []byte) {
+		// Verify must not panic on any input
+		Verify(pdf, Options{})
+	})
+}
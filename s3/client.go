@@ -3,18 +3,31 @@ package s3
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go/aws"
 )
 
+// ErrNoSuchKey is returned when the requested object does not exist
+var ErrNoSuchKey = errors.New("no such key")
+
 type S3Client struct {
 	*s3.Client
 }
 
+// ObjectInfo describes an object stored in a bucket
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
 func NewS3Client() (*S3Client, error) {
 	conf, err := config.LoadDefaultConfig(
 		context.TODO(),
@@ -32,26 +45,118 @@ func NewS3Client() (*S3Client, error) {
 }
 
 func (c *S3Client) UploadDocument(file []byte, filename, bucketName string) error {
-	_, err := c.PutObject(context.TODO(), &s3.PutObjectInput{
+	return c.PutStream(context.TODO(), bytes.NewReader(file), filename, bucketName)
+}
+
+// PutStream uploads body to filename. Bodies that cannot seek are buffered,
+// since the request payload has to be hashed before it is sent.
+func (c *S3Client) PutStream(ctx context.Context, body io.Reader, filename, bucketName string) error {
+	if _, ok := body.(io.ReadSeeker); !ok {
+		buf, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	_, err := c.PutObject(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(filename),
-		Body:   bytes.NewReader(file),
+		Body:   body,
 	})
 
 	return err
 }
 
 func (c *S3Client) DownloadDocument(ctx context.Context, filename, bucketName string) ([]byte, error) {
+	body, err := c.GetStream(ctx, filename, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	buf := &bytes.Buffer{}
+	_, err = io.Copy(buf, body)
+
+	return buf.Bytes(), err
+}
+
+// GetStream returns the contents of filename. The caller must close it.
+func (c *S3Client) GetStream(ctx context.Context, filename, bucketName string) (io.ReadCloser, error) {
 	output, err := c.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(filename),
 	})
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 
-	buf := &bytes.Buffer{}
-	_, err = io.Copy(buf, output.Body)
+	return output.Body, nil
+}
 
-	return buf.Bytes(), err
+// HeadDocument returns the size and modification time of filename
+func (c *S3Client) HeadDocument(ctx context.Context, filename, bucketName string) (*ObjectInfo, error) {
+	output, err := c.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(filename),
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	info := &ObjectInfo{Key: filename}
+	if output.ContentLength != nil {
+		info.Size = *output.ContentLength
+	}
+	if output.LastModified != nil {
+		info.LastModified = *output.LastModified
+	}
+	return info, nil
+}
+
+func (c *S3Client) DeleteDocument(ctx context.Context, filename, bucketName string) error {
+	_, err := c.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(filename),
+	})
+
+	return err
+}
+
+// ListDocuments returns every object whose key starts with prefix
+func (c *S3Client) ListDocuments(ctx context.Context, prefix, bucketName string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	paginator := s3.NewListObjectsV2Paginator(c.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Contents {
+			info := ObjectInfo{Key: aws.StringValue(obj.Key)}
+			if obj.Size != nil {
+				info.Size = *obj.Size
+			}
+			if obj.LastModified != nil {
+				info.LastModified = *obj.LastModified
+			}
+			objects = append(objects, info)
+		}
+	}
+
+	return objects, nil
+}
+
+func notFound(err error) error {
+	var noSuchKey *types.NoSuchKey
+	var missing *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &missing) {
+		return ErrNoSuchKey
+	}
+	return err
 }
@@ -0,0 +1,220 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job runs next
+type Schedule interface {
+	// Next returns the first run time after t, or the zero time when the
+	// job never runs again
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// ParseSchedule parses a job schedule, which is either an interval such as
+// "@every 10m" or "10m", or a cron expression with five fields (minute,
+// hour, day of month, month and day of week) such as "*/15 8-18 * * 1-5".
+// The @hourly, @daily, @weekly, @monthly and @yearly shorthands are accepted.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if interval := strings.TrimPrefix(spec, "@every "); interval != spec {
+		return parseInterval(interval)
+	}
+	if _, err := time.ParseDuration(spec); err == nil {
+		return parseInterval(spec)
+	}
+	return ParseCron(spec)
+}
+
+func parseInterval(spec string) (Schedule, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(spec))
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval %q: %w", spec, err)
+	}
+	if d < time.Second {
+		return nil, fmt.Errorf("interval %s is shorter than a second", d)
+	}
+	return Every(d), nil
+}
+
+// Every returns a schedule running a job at a fixed interval. Runs fall on
+// the multiples of the interval since the zero time, so that every replica
+// schedules them at the same times.
+func Every(d time.Duration) Schedule {
+	return interval(d)
+}
+
+// Manual returns a schedule that never runs a job on its own, for jobs only
+// run from the admin API
+func Manual() Schedule {
+	return manual{}
+}
+
+type manual struct{}
+
+func (manual) Next(time.Time) time.Time {
+	return time.Time{}
+}
+
+func (manual) String() string {
+	return "manual"
+}
+
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(i)).Add(time.Duration(i))
+}
+
+func (i interval) String() string {
+	return "@every " + time.Duration(i).String()
+}
+
+var cronShorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cron is a schedule given by a cron expression, evaluated in UTC
+type cron struct {
+	spec                         string
+	minute, hour, dom, month     uint64
+	dow                          uint64
+	domRestricted, dowRestricted bool
+}
+
+// ParseCron parses a cron expression with five fields, evaluated in UTC
+func ParseCron(spec string) (Schedule, error) {
+	expr := spec
+	if full, ok := cronShorthands[spec]; ok {
+		expr = full
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	c := &cron{spec: spec}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: minute: %w", spec, err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: hour: %w", spec, err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: day of month: %w", spec, err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: month: %w", spec, err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: day of week: %w", spec, err)
+	}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domRestricted = fields[2] != "*"
+	c.dowRestricted = fields[4] != "*"
+
+	return c, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps
+// into a bit set
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			v, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", rangePart)
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both the day of month and the day of week
+// are restricted, matching either is enough
+func (c *cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func (c *cron) String() string {
+	return c.spec
+}
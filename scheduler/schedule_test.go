@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2026, 3, 14, 10, 7, 30, 0, time.UTC) // a Saturday
+
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"@every 90s", from.Add(90 * time.Second)},
+		// Intervals are aligned, for replicas to agree on the run times
+		{"10m", time.Date(2026, 3, 14, 10, 10, 0, 0, time.UTC)},
+		{"@every 1h", time.Date(2026, 3, 14, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 3, 14, 10, 15, 0, 0, time.UTC)},
+		{"0 8-18 * * 1-5", time.Date(2026, 3, 16, 8, 0, 0, 0, time.UTC)},
+		{"30 9 1,15 * *", time.Date(2026, 3, 15, 9, 30, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if next := schedule.Next(from); !next.Equal(tt.next) {
+			t.Errorf("%s: expected next run at %s, got %s", tt.spec, tt.next, next)
+		}
+	}
+
+	for _, spec := range []string{"", "100ms", "@every soon", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "0 0 30 2 x"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+
+	if next := mustParse(t, "0 0 30 2 *").Next(from); !next.IsZero() {
+		t.Errorf("expected a schedule on February 30 to never run, got %s", next)
+	}
+	if next := Manual().Next(from); !next.IsZero() || Manual().String() != "manual" {
+		t.Errorf("expected a manual schedule to never run, got %s", next)
+	}
+}
+
+func mustParse(t *testing.T, spec string) Schedule {
+	t.Helper()
+
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schedule
+}
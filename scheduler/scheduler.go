@@ -0,0 +1,343 @@
+// Package scheduler runs background jobs on interval or cron schedules.
+// Every API replica keeps the schedules, but each scheduled run is claimed in
+// the job store by a single replica. A lease taken before each run keeps the
+// runs of a job from overlapping, and every run is recorded with its
+// duration and error.
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+var (
+	// ErrUnknownJob is returned for a job that was not registered
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrJobBusy is returned when a job is already running, on this replica
+	// or on another one
+	ErrJobBusy = errors.New("job is already running")
+)
+
+// Triggers of a job run
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// defaultTimeout bounds the runs of jobs registered without a timeout
+const defaultTimeout = 10 * time.Minute
+
+// Job is a task run by the scheduler
+type Job struct {
+	Name     string
+	Schedule Schedule
+	// Timeout bounds a run and the lease taken for it, 10 minutes by default
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// JobStatus describes a registered job
+type JobStatus struct {
+	Name     string     `json:"name"`
+	Schedule string     `json:"schedule"`
+	Paused   bool       `json:"paused"`
+	Running  bool       `json:"running"`
+	NextRun  *time.Time `json:"nextRun,omitempty"`
+	LastRun  *db.JobRun `json:"lastRun,omitempty"`
+}
+
+type entry struct {
+	job Job
+
+	mu      sync.Mutex
+	running bool
+	next    time.Time
+}
+
+// Scheduler runs registered jobs once started
+type Scheduler struct {
+	holder string
+
+	mu      sync.Mutex
+	jobs    []*entry
+	started bool
+}
+
+// New returns a scheduler whose leases are taken in the name of holder,
+// which must be unique to the replica
+func New(holder string) *Scheduler {
+	return &Scheduler{holder: holder}
+}
+
+var (
+	defaultScheduler *Scheduler
+	defaultMu        sync.Mutex
+)
+
+// Default returns the scheduler of the API, holding leases in the name of
+// the host
+func Default() *Scheduler {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultScheduler == nil {
+		defaultScheduler = New(defaultHolder())
+	}
+	return defaultScheduler
+}
+
+// SetDefault replaces the scheduler returned by Default. Passing nil makes
+// Default create a new one.
+func SetDefault(s *Scheduler) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultScheduler = s
+}
+
+func defaultHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "api"
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return host + "-" + hex.EncodeToString(suffix)
+}
+
+// Register adds a job, which runs on its schedule once the scheduler is
+// started
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Schedule == nil || job.Run == nil {
+		return errors.New("job needs a name, a schedule and a run function")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return fmt.Errorf("cannot register job %s after the scheduler started", job.Name)
+	}
+	for _, e := range s.jobs {
+		if e.job.Name == job.Name {
+			return fmt.Errorf("job %s is already registered", job.Name)
+		}
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultTimeout
+	}
+
+	s.jobs = append(s.jobs, &entry{job: job})
+	return nil
+}
+
+// Start runs every job on its schedule until ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+
+	for _, e := range s.jobs {
+		go s.loop(ctx, e)
+	}
+}
+
+// Jobs returns the status of every registered job
+func (s *Scheduler) Jobs(ctx context.Context) ([]JobStatus, error) {
+	store := db.Jobs()
+	paused, err := store.PausedJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	entries := append([]*entry(nil), s.jobs...)
+	s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(entries))
+	for _, e := range entries {
+		status := JobStatus{
+			Name:     e.job.Name,
+			Schedule: e.job.Schedule.String(),
+			Paused:   paused[e.job.Name],
+		}
+
+		e.mu.Lock()
+		status.Running = e.running
+		if !e.next.IsZero() {
+			next := e.next
+			status.NextRun = &next
+		}
+		e.mu.Unlock()
+
+		runs, err := store.ListJobRuns(ctx, e.job.Name, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) > 0 {
+			status.LastRun = &runs[0]
+		}
+
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Runs returns the last runs of a job, newest first
+func (s *Scheduler) Runs(ctx context.Context, name string, limit int) ([]db.JobRun, error) {
+	if s.entry(name) == nil {
+		return nil, ErrUnknownJob
+	}
+	return db.Jobs().ListJobRuns(ctx, name, limit)
+}
+
+// SetPaused pauses or resumes the scheduled runs of a job on every replica
+func (s *Scheduler) SetPaused(ctx context.Context, name string, paused bool) error {
+	if s.entry(name) == nil {
+		return ErrUnknownJob
+	}
+	return db.Jobs().SetJobPaused(ctx, name, paused)
+}
+
+// RunNow runs a job immediately, even when it is paused, and returns the
+// recorded run. The run is cancelled with ctx.
+func (s *Scheduler) RunNow(ctx context.Context, name string) (*db.JobRun, error) {
+	e := s.entry(name)
+	if e == nil {
+		return nil, ErrUnknownJob
+	}
+	return s.run(ctx, e, TriggerManual)
+}
+
+func (s *Scheduler) entry(name string) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.jobs {
+		if e.job.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	for {
+		next := e.job.Schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		e.mu.Lock()
+		e.next = next
+		e.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		paused, err := db.Jobs().PausedJobs(ctx)
+		if err != nil {
+			logger.Errorf("failed to check whether job %s is paused: %v", e.job.Name, err)
+			continue
+		}
+		if paused[e.job.Name] {
+			continue
+		}
+
+		// Replicas agree on the run times, so the first to claim one runs it
+		claimed, err := db.Jobs().ClaimJobSlot(ctx, e.job.Name, next)
+		if err != nil {
+			logger.Errorf("failed to claim the run of job %s: %v", e.job.Name, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		if _, err := s.run(ctx, e, TriggerSchedule); err != nil && !errors.Is(err, ErrJobBusy) {
+			logger.Errorf("failed to run job %s: %v", e.job.Name, err)
+		}
+	}
+}
+
+// run runs a job under its lease and records the run
+func (s *Scheduler) run(ctx context.Context, e *entry, trigger string) (*db.JobRun, error) {
+	e.mu.Lock()
+	if e.running {
+		e.mu.Unlock()
+		return nil, ErrJobBusy
+	}
+	e.running = true
+	e.mu.Unlock()
+
+	defer func() {
+		e.mu.Lock()
+		e.running = false
+		e.mu.Unlock()
+	}()
+
+	store := db.Jobs()
+	acquired, err := store.AcquireJobLease(ctx, e.job.Name, s.holder, time.Now().Add(e.job.Timeout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire the lease of job %s: %w", e.job.Name, err)
+	}
+	if !acquired {
+		return nil, ErrJobBusy
+	}
+	defer func() {
+		if err := store.ReleaseJobLease(ctx, e.job.Name, s.holder); err != nil {
+			logger.Errorf("failed to release the lease of job %s: %v", e.job.Name, err)
+		}
+	}()
+
+	run := &db.JobRun{
+		Job:       e.job.Name,
+		Holder:    s.holder,
+		Trigger:   trigger,
+		StartedAt: time.Now().UTC(),
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, e.job.Timeout)
+	err = safeRun(runCtx, e.job.Run)
+	cancel()
+
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+	if err != nil {
+		run.Error = err.Error()
+		logger.Errorf("job %s failed: %v", e.job.Name, err)
+	}
+
+	if err := store.RecordJobRun(ctx, run); err != nil {
+		logger.Errorf("failed to record run of job %s: %v", e.job.Name, err)
+	}
+	return run, nil
+}
+
+// safeRun turns a panic of a job into an error, so that it does not stop the
+// API
+func safeRun(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
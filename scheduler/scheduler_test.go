@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+// soon runs a job every few milliseconds
+type soon time.Duration
+
+func (s soon) Next(t time.Time) time.Time { return t.Add(time.Duration(s)) }
+func (s soon) String() string             { return "soon" }
+
+func useMemoryStore(t *testing.T) *db.MemoryJobStore {
+	store := db.NewMemoryJobStore()
+	db.SetJobs(store)
+	t.Cleanup(func() { db.SetJobs(nil) })
+	return store
+}
+
+func TestRunNow(t *testing.T) {
+	store := useMemoryStore(t)
+	ctx := context.Background()
+
+	s := New("replica-a")
+	if err := s.Register(Job{Name: "fails", Schedule: Every(time.Hour), Run: func(ctx context.Context) error {
+		return errors.New("ledger unavailable")
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(Job{Name: "panics", Schedule: Every(time.Hour), Run: func(ctx context.Context) error {
+		panic("boom")
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(Job{Name: "fails", Schedule: Every(time.Hour), Run: func(ctx context.Context) error { return nil }}); err == nil {
+		t.Fatal("expected duplicate job names to be rejected")
+	}
+
+	run, err := s.RunNow(ctx, "fails")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Error != "ledger unavailable" || run.Trigger != TriggerManual || run.Holder != "replica-a" {
+		t.Fatalf("unexpected run %+v", run)
+	}
+
+	run, err = s.RunNow(ctx, "panics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Error != "job panicked: boom" {
+		t.Fatalf("expected the panic to be recorded, got %q", run.Error)
+	}
+
+	if _, err := s.RunNow(ctx, "unknown"); !errors.Is(err, ErrUnknownJob) {
+		t.Fatalf("expected ErrUnknownJob, got %v", err)
+	}
+
+	runs, _ := store.ListJobRuns(ctx, "fails", 10)
+	if len(runs) != 1 {
+		t.Fatalf("expected one recorded run, got %v", runs)
+	}
+}
+
+func TestLeaseRunsJobOnOneReplica(t *testing.T) {
+	useMemoryStore(t)
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	job := func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}
+
+	a, b := New("replica-a"), New("replica-b")
+	a.Register(Job{Name: "expire", Schedule: Every(time.Hour), Run: job})
+	b.Register(Job{Name: "expire", Schedule: Every(time.Hour), Run: func(ctx context.Context) error { return nil }})
+
+	done := make(chan error)
+	go func() {
+		_, err := a.RunNow(ctx, "expire")
+		done <- err
+	}()
+	<-started
+
+	if _, err := a.RunNow(ctx, "expire"); !errors.Is(err, ErrJobBusy) {
+		t.Fatalf("expected the job to be busy on its replica, got %v", err)
+	}
+	if _, err := b.RunNow(ctx, "expire"); !errors.Is(err, ErrJobBusy) {
+		t.Fatalf("expected the lease to keep the other replica out, got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.RunNow(ctx, "expire"); err != nil {
+		t.Fatalf("expected the lease to be released, got %v", err)
+	}
+}
+
+func TestScheduledRunsHonourPause(t *testing.T) {
+	useMemoryStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs int32
+	s := New("replica-a")
+	s.Register(Job{Name: "tick", Schedule: soon(5 * time.Millisecond), Run: func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}})
+	if err := s.SetPaused(ctx, "tick", true); err != nil {
+		t.Fatal(err)
+	}
+	s.Start(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 0 {
+		t.Fatalf("expected a paused job not to run, ran %d times", n)
+	}
+
+	s.SetPaused(ctx, "tick", false)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&runs) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the resumed job to run")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	jobs, err := s.Jobs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Paused || jobs[0].LastRun == nil || jobs[0].NextRun == nil {
+		t.Fatalf("unexpected job status %+v", jobs)
+	}
+}
+
+func TestScheduledRunsRunOnOneReplica(t *testing.T) {
+	useMemoryStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs int32
+	job := func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}
+
+	// Both replicas share the store, as they share Mongo
+	a, b := New("replica-a"), New("replica-b")
+	a.Register(Job{Name: "expire", Schedule: Every(20 * time.Millisecond), Run: job})
+	b.Register(Job{Name: "expire", Schedule: Every(20 * time.Millisecond), Run: job})
+	a.Start(ctx)
+	b.Start(ctx)
+
+	time.Sleep(210 * time.Millisecond)
+	cancel()
+
+	// At most one run per slot of the 10 elapsed, and not one per replica
+	if n := atomic.LoadInt32(&runs); n == 0 || n > 11 {
+		t.Fatalf("expected each scheduled run on a single replica, got %d runs", n)
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps blobs in memory. It is meant for tests and local runs.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string]memoryBlob
+	now   func() time.Time
+}
+
+type memoryBlob struct {
+	data         []byte
+	lastModified time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		blobs: map[string]memoryBlob{},
+		now:   time.Now,
+	}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, body io.Reader) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blobs[key] = memoryBlob{data: data, lastModified: s.now()}
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	blob, err := s.blob(key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(blob.data)), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *MemoryStore) Head(ctx context.Context, key string) (*BlobInfo, error) {
+	blob, err := s.blob(key)
+	if err != nil {
+		return nil, err
+	}
+	return &BlobInfo{Key: key, Size: int64(len(blob.data)), LastModified: blob.lastModified}, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var infos []BlobInfo
+	for key, blob := range s.blobs {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, BlobInfo{Key: key, Size: int64(len(blob.data)), LastModified: blob.lastModified})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
+
+func (s *MemoryStore) blob(key string) (memoryBlob, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return memoryBlob{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	blob, ok := s.blobs[key]
+	if !ok {
+		return memoryBlob{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return blob, nil
+}
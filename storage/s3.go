@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/umairmaseed/clausia-api/s3"
+)
+
+// S3Store keeps blobs in an S3 bucket
+type S3Store struct {
+	client *s3.S3Client
+	bucket string
+}
+
+func NewS3Store(bucket string) (*S3Store, error) {
+	client, err := s3.NewS3Client()
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{client: client, bucket: bucket}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	return s.client.PutStream(ctx, body, key, s.bucket)
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := s.client.GetStream(ctx, key, s.bucket)
+	if errors.Is(err, s3.ErrNoSuchKey) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return body, err
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	return s.client.DeleteDocument(ctx, key, s.bucket)
+}
+
+func (s *S3Store) Head(ctx context.Context, key string) (*BlobInfo, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := s.client.HeadDocument(ctx, key, s.bucket)
+	if errors.Is(err, s3.ErrNoSuchKey) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BlobInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified}, nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	objects, err := s.client.ListDocuments(ctx, prefix, s.bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]BlobInfo, len(objects))
+	for i, obj := range objects {
+		infos[i] = BlobInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/env"
+)
+
+// Scheme prefixes the URIs stored on the ledger for blobs, whatever backend
+// holds them
+const Scheme = "blob://"
+
+// legacyS3Scheme prefixes the URLs of documents uploaded before the storage
+// abstraction, in the form s3://bucket/key
+const legacyS3Scheme = "s3://"
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores files by key. Keys are slash separated paths such as
+// documents/contract.pdf.
+type BlobStore interface {
+	// Put stores the contents of body under key, replacing any existing blob
+	Put(ctx context.Context, key string, body io.Reader) error
+	// Get returns the contents of key. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// Head returns the metadata of key
+	Head(ctx context.Context, key string) (*BlobInfo, error)
+	// List returns the blobs whose key starts with prefix, sorted by key
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+}
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// URI returns the backend neutral URI of key
+func URI(key string) string {
+	return Scheme + key
+}
+
+// KeyFromURI returns the key addressed by uri. Besides blob:// URIs it
+// accepts the legacy s3://bucket/key URLs and bare keys.
+func KeyFromURI(uri string) (string, error) {
+	var key string
+	switch {
+	case strings.HasPrefix(uri, Scheme):
+		key = strings.TrimPrefix(uri, Scheme)
+	case strings.HasPrefix(uri, legacyS3Scheme):
+		_, key, _ = strings.Cut(strings.TrimPrefix(uri, legacyS3Scheme), "/")
+	case strings.Contains(uri, "://"):
+		return "", fmt.Errorf("unsupported blob uri %q", uri)
+	default:
+		key = uri
+	}
+
+	return cleanKey(key)
+}
+
+// cleanKey normalizes key and rejects keys that escape the store root
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return cleaned, nil
+}
+
+// ReadAll returns the whole contents of key
+func ReadAll(ctx context.Context, store BlobStore, key string) ([]byte, error) {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+var (
+	defaultStore BlobStore
+	defaultMu    sync.Mutex
+)
+
+// Default returns the store used by the handlers. The backend is chosen by
+// the STORAGE_BACKEND env var: s3 (the default), local or memory.
+func Default() BlobStore {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultStore != nil {
+		return defaultStore
+	}
+
+	store, err := newStoreFromEnv()
+	if err != nil {
+		// Not cached, so that the next call tries again
+		logger.Errorf("failed to create blob store: %v", err)
+		return unavailableStore{err}
+	}
+	defaultStore = store
+	return defaultStore
+}
+
+// SetDefault replaces the store returned by Default. Passing nil restores the
+// one configured by env vars.
+func SetDefault(store BlobStore) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultStore = store
+}
+
+func newStoreFromEnv() (BlobStore, error) {
+	switch backend := os.Getenv(env.STORAGE_BACKEND); backend {
+	case "", "s3":
+		bucket, err := env.Get(env.S3_BUCKET_NAME)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Store(bucket)
+	case "local":
+		dir, err := env.Get(env.STORAGE_LOCAL_DIR)
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalStore(dir)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown %s %q", env.STORAGE_BACKEND, backend)
+	}
+}
+
+type unavailableStore struct {
+	err error
+}
+
+func (s unavailableStore) Put(ctx context.Context, key string, body io.Reader) error {
+	return s.err
+}
+
+func (s unavailableStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return nil, s.err
+}
+
+func (s unavailableStore) Delete(ctx context.Context, key string) error {
+	return s.err
+}
+
+func (s unavailableStore) Head(ctx context.Context, key string) (*BlobInfo, error) {
+	return nil, s.err
+}
+
+func (s unavailableStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	return nil, s.err
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testBlobStore(t, NewMemoryStore())
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+}
+
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "documents/missing.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.Head(ctx, "documents/missing.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	for key, body := range map[string]string{
+		"documents/a.pdf":      "first",
+		"documents/b.pdf":      "second document",
+		"certificates/a_c.pfx": "cert",
+	} {
+		if err := store.Put(ctx, key, strings.NewReader(body)); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	if err := store.Put(ctx, "documents/a.pdf", strings.NewReader("replaced")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadAll(ctx, store, "documents/a.pdf")
+	if err != nil || string(data) != "replaced" {
+		t.Fatalf("expected replaced contents, got %q, %v", data, err)
+	}
+
+	info, err := store.Head(ctx, "documents/b.pdf")
+	if err != nil || info.Size != int64(len("second document")) || info.LastModified.IsZero() {
+		t.Fatalf("unexpected head %+v, %v", info, err)
+	}
+
+	infos, err := store.List(ctx, "documents/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Key != "documents/a.pdf" || infos[1].Key != "documents/b.pdf" {
+		t.Fatalf("unexpected listing %+v", infos)
+	}
+
+	if err := store.Delete(ctx, "documents/a.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "documents/a.pdf"); err != nil {
+		t.Fatalf("deleting a missing blob should not fail, got %v", err)
+	}
+	if _, err := store.Get(ctx, "documents/a.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the blob to be deleted, got %v", err)
+	}
+
+	if err := store.Put(ctx, "../escape", strings.NewReader("x")); err == nil {
+		t.Fatal("expected keys outside the store to be rejected")
+	}
+
+	body, err := store.Get(ctx, "certificates/a_c.pfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if data, _ := io.ReadAll(body); string(data) != "cert" {
+		t.Fatalf("unexpected contents %q", data)
+	}
+}
+
+func TestKeyFromURI(t *testing.T) {
+	cases := map[string]string{
+		"blob://documents/a.pdf":            "documents/a.pdf",
+		"s3://bucket/documents/a.pdf":       "documents/a.pdf",
+		"certificates/user_cert.pfx":        "certificates/user_cert.pfx",
+		URI("sign-documents/hash-file.pdf"): "sign-documents/hash-file.pdf",
+	}
+	for uri, want := range cases {
+		if got, err := KeyFromURI(uri); err != nil || got != want {
+			t.Errorf("%s: expected %q, got %q, %v", uri, want, got, err)
+		}
+	}
+
+	for _, uri := range []string{"https://example.com/a.pdf", "blob://../etc/passwd", "s3://bucket", ""} {
+		if key, err := KeyFromURI(uri); err == nil {
+			t.Errorf("%s: expected an error, got %q", uri, key)
+		}
+	}
+}
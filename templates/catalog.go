@@ -0,0 +1,165 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+// Orders of the template catalog
+const (
+	SortPopular = "popular"
+	SortRating  = "rating"
+	SortName    = "name"
+)
+
+// Limits of the tags of a template
+const (
+	MaxTags      = 10
+	MaxTagLength = 32
+)
+
+// CatalogEntry is a public template as listed in the catalog
+type CatalogEntry struct {
+	Template     chaincode.Template `json:"template"`
+	Tags         []string           `json:"tags"`
+	Categories   []string           `json:"categories"`
+	Duplicated   int                `json:"duplicated"`
+	Instantiated int                `json:"instantiated"`
+	Popularity   int                `json:"popularity"`
+	Rating       float64            `json:"rating"`
+	ReviewCount  int                `json:"reviewCount"`
+}
+
+// CatalogQuery selects and orders catalog entries. Text must match the
+// name, description or clause categories of a template, every word of it
+// somewhere. Every tag must be set on the template, and the category must be
+// the category of one of its clauses. Pages start at 1.
+type CatalogQuery struct {
+	Text     string
+	Tags     []string
+	Category string
+	Sort     string
+	Page     int
+	PageSize int
+}
+
+// NewCatalogEntry returns the catalog entry of a template with its clauses
+// and listing
+func NewCatalogEntry(template chaincode.Template, clauses []chaincode.TemplateClause, listing db.TemplateListing) CatalogEntry {
+	entry := CatalogEntry{
+		Template:     template,
+		Tags:         listing.Tags,
+		Categories:   []string{},
+		Duplicated:   listing.Duplicated,
+		Instantiated: listing.Instantiated,
+		Popularity:   listing.Popularity(),
+		Rating:       listing.Rating(),
+		ReviewCount:  len(listing.Reviews),
+	}
+	if entry.Tags == nil {
+		entry.Tags = []string{}
+	}
+
+	seen := map[string]bool{}
+	for _, clause := range clauses {
+		if clause.Category != "" && !seen[clause.Category] {
+			seen[clause.Category] = true
+			entry.Categories = append(entry.Categories, clause.Category)
+		}
+	}
+	sort.Strings(entry.Categories)
+	return entry
+}
+
+// SearchCatalog returns the page of the entries matching query, in its
+// order, with the number of matching entries. Ties are ordered by name.
+func SearchCatalog(entries []CatalogEntry, query CatalogQuery) ([]CatalogEntry, int) {
+	terms := strings.Fields(strings.ToLower(query.Text))
+	tags, _ := NormalizeTags(query.Tags)
+
+	matching := []CatalogEntry{}
+	for _, entry := range entries {
+		if entry.matches(terms, tags, query.Category) {
+			matching = append(matching, entry)
+		}
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		a, b := matching[i], matching[j]
+		switch {
+		case query.Sort == SortPopular && a.Popularity != b.Popularity:
+			return a.Popularity > b.Popularity
+		case query.Sort == SortRating && a.Rating != b.Rating:
+			return a.Rating > b.Rating
+		case query.Sort == SortRating && a.ReviewCount != b.ReviewCount:
+			return a.ReviewCount > b.ReviewCount
+		}
+		if name := strings.Compare(strings.ToLower(a.Template.Name), strings.ToLower(b.Template.Name)); name != 0 {
+			return name < 0
+		}
+		return a.Template.Key < b.Template.Key
+	})
+
+	total := len(matching)
+	start := (query.Page - 1) * query.PageSize
+	if start < 0 || start >= total {
+		return []CatalogEntry{}, total
+	}
+	end := start + query.PageSize
+	if end > total {
+		end = total
+	}
+	return matching[start:end], total
+}
+
+func (e CatalogEntry) matches(terms, tags []string, category string) bool {
+	text := strings.ToLower(strings.Join(append([]string{e.Template.Name, e.Template.Description}, e.Categories...), " "))
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+
+	for _, tag := range tags {
+		if !containsFold(e.Tags, tag) {
+			return false
+		}
+	}
+
+	return category == "" || containsFold(e.Categories, category)
+}
+
+// NormalizeTags trims and lowercases tags, dropping duplicates
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case tag == "":
+			return nil, errors.New("tags cannot be empty")
+		case len(tag) > MaxTagLength:
+			return nil, fmt.Errorf("tag %s is longer than %d characters", tag, MaxTagLength)
+		case containsFold(normalized, tag):
+			continue
+		}
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > MaxTags {
+		return nil, fmt.Errorf("a template can have at most %d tags", MaxTags)
+	}
+	return normalized, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
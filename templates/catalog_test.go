@@ -0,0 +1,90 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+func catalogEntries() []CatalogEntry {
+	review := func(rating int) chaincode.Review { return chaincode.Review{Rating: rating} }
+	return []CatalogEntry{
+		NewCatalogEntry(
+			chaincode.Template{Key: "template:lease", Name: "Lease", Description: "Residential lease"},
+			[]chaincode.TemplateClause{{Category: "payment"}, {Category: "fine"}, {Category: "payment"}},
+			db.TemplateListing{Tags: []string{"housing"}, Duplicated: 1, Reviews: []chaincode.Review{review(3)}},
+		),
+		NewCatalogEntry(
+			chaincode.Template{Key: "template:loan", Name: "Loan", Description: "Personal loan"},
+			[]chaincode.TemplateClause{{Category: "payment"}},
+			db.TemplateListing{Tags: []string{"finance"}, Instantiated: 5, Reviews: []chaincode.Review{review(4), review(5)}},
+		),
+		NewCatalogEntry(
+			chaincode.Template{Key: "template:office", Name: "Office lease", Description: "Commercial lease"},
+			nil,
+			db.TemplateListing{Tags: []string{"housing", "business"}},
+		),
+	}
+}
+
+func keys(entries []CatalogEntry) []string {
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Template.Key)
+	}
+	return keys
+}
+
+func TestSearchCatalog(t *testing.T) {
+	entries := catalogEntries()
+	if e := entries[0]; len(e.Categories) != 2 || e.Popularity != 1 || e.Rating != 3 || e.ReviewCount != 1 {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+
+	tests := []struct {
+		name  string
+		query CatalogQuery
+		want  []string
+		total int
+	}{
+		{"popular", CatalogQuery{Sort: SortPopular}, []string{"template:loan", "template:lease", "template:office"}, 3},
+		{"rating", CatalogQuery{Sort: SortRating}, []string{"template:loan", "template:lease", "template:office"}, 3},
+		{"name", CatalogQuery{Sort: SortName}, []string{"template:lease", "template:loan", "template:office"}, 3},
+		{"text", CatalogQuery{Text: "LEASE residential", Sort: SortName}, []string{"template:lease"}, 1},
+		{"category text", CatalogQuery{Text: "fine", Sort: SortName}, []string{"template:lease"}, 1},
+		{"tags", CatalogQuery{Tags: []string{"Housing", "business"}, Sort: SortName}, []string{"template:office"}, 1},
+		{"category", CatalogQuery{Category: "payment", Sort: SortPopular}, []string{"template:loan", "template:lease"}, 2},
+		{"second page", CatalogQuery{Sort: SortName, Page: 2, PageSize: 2}, []string{"template:office"}, 3},
+		{"past the end", CatalogQuery{Sort: SortName, Page: 3, PageSize: 2}, nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.query.Page == 0 {
+				tt.query.Page, tt.query.PageSize = 1, 10
+			}
+			page, total := SearchCatalog(entries, tt.query)
+			if got := keys(page); total != tt.total || len(got) != len(tt.want) {
+				t.Fatalf("got %v of %d, want %v of %d", got, total, tt.want, tt.total)
+			}
+			for i, key := range keys(page) {
+				if key != tt.want[i] {
+					t.Fatalf("got %v, want %v", keys(page), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := NormalizeTags([]string{" Housing", "housing", "RENT"})
+	if err != nil || len(tags) != 2 || tags[0] != "housing" || tags[1] != "rent" {
+		t.Fatalf("unexpected tags %v, %v", tags, err)
+	}
+	if _, err := NormalizeTags([]string{" "}); err == nil {
+		t.Fatal("expected empty tags to be rejected")
+	}
+	if _, err := NormalizeTags([]string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}); err == nil {
+		t.Fatal("expected too many tags to be rejected")
+	}
+}
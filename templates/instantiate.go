@@ -0,0 +1,230 @@
+// Package templates turns contract templates into the clauses of a contract.
+// The parameters declared by a template clause are the keys of its default
+// parameters, and the type of each default is the type expected from the
+// values given when the template is instantiated.
+package templates
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+// Values holds the parameter values of an instantiation, by template clause
+// id and parameter name
+type Values map[string]map[string]interface{}
+
+// ValidationError lists every parameter value that does not match the
+// parameters declared by the template
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid template parameters: " + strings.Join(e.Problems, "; ")
+}
+
+// Instantiate returns the contract clauses for the clauses of a template,
+// ordered by their number, with the given parameter values in place of the
+// defaults. Optional clauses whose id is excluded are left out. Parameters
+// referencing users must reference one of the parties of the contract.
+//
+// Templates whose clauses declare dependencies are rejected: the keys of the
+// contract clauses are only known once the contract is created, so the
+// dependencies cannot be carried over.
+func Instantiate(clauses []chaincode.TemplateClause, values Values, excluded []string, parties []string) ([]chaincode.Clause, error) {
+	clauses = append([]chaincode.TemplateClause(nil), clauses...)
+	sort.SliceStable(clauses, func(i, j int) bool {
+		return clauses[i].Number < clauses[j].Number
+	})
+
+	v := &validator{parties: parties}
+
+	known := map[string]bool{}
+	for _, clause := range clauses {
+		known[clause.Id] = true
+	}
+	var ids []string
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !known[id] {
+			v.addf("template has no clause %s", id)
+		}
+	}
+
+	skip := map[string]bool{}
+	for _, id := range excluded {
+		if !known[id] {
+			v.addf("template has no clause %s", id)
+		}
+		skip[id] = true
+	}
+
+	var instantiated []chaincode.Clause
+	for _, clause := range clauses {
+		if skip[clause.Id] {
+			if clause.Optional == nil || !*clause.Optional {
+				v.addf("clause %s is not optional", clause.Id)
+			}
+			continue
+		}
+		if len(clause.Dependencies) > 0 {
+			v.addf("clause %s declares dependencies, which cannot be carried over to a contract", clause.Id)
+		}
+
+		instantiated = append(instantiated, chaincode.Clause{
+			Id:          clause.Id,
+			Description: clause.Description,
+			Category:    clause.Category,
+			ActionType:  clause.ActionType,
+			Parameters:  v.parameters(clause, values[clause.Id]),
+			Input:       copyMap(clause.DefaultInputs),
+		})
+	}
+	if len(v.problems) > 0 {
+		return nil, &ValidationError{Problems: v.problems}
+	}
+	return instantiated, nil
+}
+
+type validator struct {
+	parties  []string
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// parameters returns the parameters of a clause, with the given values
+// checked against the declared defaults
+func (v *validator) parameters(clause chaincode.TemplateClause, given map[string]interface{}) map[string]interface{} {
+	params := copyMap(clause.DefaultParameters)
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	for _, name := range sortedKeys(given) {
+		declared, ok := clause.DefaultParameters[name]
+		if !ok {
+			v.addf("clause %s has no parameter %s", clause.Id, name)
+			continue
+		}
+		if problem := v.check(name, declared, given[name]); problem != "" {
+			v.addf("parameter %s of clause %s %s", name, clause.Id, problem)
+			continue
+		}
+		params[name] = given[name]
+	}
+
+	for _, name := range sortedKeys(params) {
+		if params[name] == nil {
+			v.addf("parameter %s of clause %s is required", name, clause.Id)
+		}
+	}
+	return params
+}
+
+// check returns what is wrong with value for a parameter declared with the
+// given default, or an empty string
+func (v *validator) check(name string, declared, value interface{}) string {
+	if value == nil {
+		return "cannot be null"
+	}
+
+	switch d := declared.(type) {
+	case nil:
+		// A parameter without default accepts any value
+		return ""
+	case float64:
+		n, ok := value.(float64)
+		if !ok {
+			return "must be a number"
+		}
+		if strings.Contains(strings.ToLower(name), "percent") && (n < 0 || n > 100) {
+			return "must be a percentage between 0 and 100"
+		}
+	case bool:
+		if _, ok := value.(bool); !ok {
+			return "must be a boolean"
+		}
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		if isDate(d) && !isDate(s) {
+			return "must be a date"
+		}
+	case map[string]interface{}:
+		if d["@assetType"] == chaincode.AssetTypeUser {
+			return v.checkParty(value)
+		}
+		if _, ok := value.(map[string]interface{}); !ok {
+			return "must be an object"
+		}
+	case []interface{}:
+		values, ok := value.([]interface{})
+		if !ok {
+			return "must be a list"
+		}
+		if len(d) > 0 {
+			for _, item := range values {
+				if problem := v.check(name, d[0], item); problem != "" {
+					return problem
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// checkParty checks that value references a party of the contract
+func (v *validator) checkParty(value interface{}) string {
+	ref, ok := value.(map[string]interface{})
+	if !ok {
+		return "must reference a user"
+	}
+	key, _ := ref["@key"].(string)
+	for _, party := range v.parties {
+		if key == party {
+			return ""
+		}
+	}
+	return "must reference a party of the contract"
+}
+
+// isDate reports whether s is an RFC 3339 timestamp or a date
+func isDate(s string) bool {
+	if _, err := time.Parse(time.RFC3339, s); err == nil {
+		return true
+	}
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
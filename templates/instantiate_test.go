@@ -0,0 +1,126 @@
+package templates
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+func optional() *bool {
+	b := true
+	return &b
+}
+
+func leaseClauses() []chaincode.TemplateClause {
+	return []chaincode.TemplateClause{
+		{
+			Id:                "fine",
+			Number:            2,
+			ActionType:        chaincode.ActionCheckFine,
+			DefaultParameters: map[string]interface{}{"dailyPercentage": 1.0},
+			Optional:          optional(),
+		},
+		{
+			Id:         "rent",
+			Number:     1,
+			ActionType: chaincode.ActionMakePayment,
+			DefaultParameters: map[string]interface{}{
+				"amount":  1000.0,
+				"dueDate": "2024-01-05T00:00:00Z",
+				"payer":   map[string]interface{}{"@assetType": "user", "@key": "user:owner"},
+				"tenant":  nil,
+			},
+			DefaultInputs: map[string]interface{}{"payment": 0.0},
+		},
+	}
+}
+
+func TestInstantiate(t *testing.T) {
+	values := Values{
+		"rent": {
+			"amount": 1200.0,
+			"payer":  map[string]interface{}{"@assetType": "user", "@key": "user:bob"},
+			"tenant": "Bob",
+		},
+	}
+
+	clauses, err := Instantiate(leaseClauses(), values, nil, []string{"user:owner", "user:bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clauses) != 2 || clauses[0].Id != "rent" || clauses[1].Id != "fine" {
+		t.Fatalf("expected the clauses ordered by number, got %+v", clauses)
+	}
+
+	want := map[string]interface{}{
+		"amount":  1200.0,
+		"dueDate": "2024-01-05T00:00:00Z",
+		"payer":   map[string]interface{}{"@assetType": "user", "@key": "user:bob"},
+		"tenant":  "Bob",
+	}
+	if !reflect.DeepEqual(clauses[0].Parameters, want) {
+		t.Errorf("unexpected rent parameters %v", clauses[0].Parameters)
+	}
+	if clauses[0].Input["payment"] != 0.0 || clauses[0].ActionType != chaincode.ActionMakePayment {
+		t.Errorf("unexpected rent clause %+v", clauses[0])
+	}
+	if clauses[1].Parameters["dailyPercentage"] != 1.0 {
+		t.Errorf("expected the default fine percentage, got %v", clauses[1].Parameters)
+	}
+}
+
+func TestInstantiateExcludesOptionalClauses(t *testing.T) {
+	values := Values{"rent": {"tenant": "Bob"}}
+
+	clauses, err := Instantiate(leaseClauses(), values, []string{"fine"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clauses) != 1 || clauses[0].Id != "rent" {
+		t.Fatalf("expected only the rent clause, got %+v", clauses)
+	}
+
+	_, err = Instantiate(leaseClauses(), values, []string{"rent"}, nil)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || !reflect.DeepEqual(invalid.Problems, []string{"clause rent is not optional"}) {
+		t.Fatalf("expected the rent clause to be required, got %v", err)
+	}
+}
+
+func TestInstantiateValidation(t *testing.T) {
+	values := Values{
+		"rent": {
+			"amount":  "1200",
+			"dueDate": "next month",
+			"payer":   map[string]interface{}{"@assetType": "user", "@key": "user:stranger"},
+			"deposit": 500.0,
+		},
+		"fine":    {"dailyPercentage": 150.0},
+		"parking": {"spot": 3.0},
+	}
+	clauses := leaseClauses()
+	clauses[0].Dependencies = []chaincode.AssetRef{{AssetType: chaincode.AssetTypeTemplateClause, Key: "templateClause:rent"}}
+
+	_, err := Instantiate(clauses, values, []string{"storage"}, []string{"user:owner"})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+
+	want := []string{
+		"template has no clause parking",
+		"template has no clause storage",
+		"parameter amount of clause rent must be a number",
+		"clause rent has no parameter deposit",
+		"parameter dueDate of clause rent must be a date",
+		"parameter payer of clause rent must reference a party of the contract",
+		"parameter tenant of clause rent is required",
+		"clause fine declares dependencies, which cannot be carried over to a contract",
+		"parameter dailyPercentage of clause fine must be a percentage between 0 and 100",
+	}
+	if !reflect.DeepEqual(invalid.Problems, want) {
+		t.Fatalf("unexpected problems:\n%q\nwant:\n%q", invalid.Problems, want)
+	}
+}
@@ -0,0 +1,206 @@
+package templates
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+	"github.com/umairmaseed/clausia-api/db"
+)
+
+// Changes of a clause between two versions
+const (
+	ClauseAdded   = "added"
+	ClauseRemoved = "removed"
+	ClauseChanged = "changed"
+)
+
+// Diff lists the differences between two versions of a template
+type Diff struct {
+	TemplateKey string        `json:"templateKey"`
+	From        int           `json:"from"`
+	To          int           `json:"to"`
+	Template    []FieldChange `json:"template"`
+	Clauses     []ClauseDiff  `json:"clauses"`
+}
+
+// ClauseDiff is the change of a template clause, identified by its id.
+// Fields is only set for changed clauses.
+type ClauseDiff struct {
+	Id     string        `json:"id"`
+	Change string        `json:"change"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a field whose value differs between two versions. Default
+// inputs and parameters are compared one by one, as defaultParameters.name.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// Snapshot returns the version of a template with the given clauses, without
+// its number. Clauses are ordered by their number.
+func Snapshot(template chaincode.Template, clauses []chaincode.TemplateClause) db.TemplateVersion {
+	version := db.TemplateVersion{
+		TemplateKey: template.Key,
+		Name:        template.Name,
+		Description: template.Description,
+		Public:      template.Public,
+		Clauses:     []db.TemplateVersionClause{},
+	}
+
+	for _, clause := range clauses {
+		var dependencies []string
+		for _, dep := range clause.Dependencies {
+			dependencies = append(dependencies, dep.Key)
+		}
+		version.Clauses = append(version.Clauses, db.TemplateVersionClause{
+			Key:               clause.Key,
+			Id:                clause.Id,
+			Number:            clause.Number,
+			Name:              clause.Name,
+			Description:       clause.Description,
+			Category:          clause.Category,
+			ActionType:        int(clause.ActionType),
+			Dependencies:      dependencies,
+			DefaultInputs:     copyMap(clause.DefaultInputs),
+			DefaultParameters: copyMap(clause.DefaultParameters),
+			Optional:          clause.Optional != nil && *clause.Optional,
+		})
+	}
+	sort.SliceStable(version.Clauses, func(i, j int) bool {
+		return version.Clauses[i].Number < version.Clauses[j].Number
+	})
+
+	version.Digest = digest(version)
+	return version
+}
+
+// digest hashes the content of a version, leaving out its number and
+// authorship
+func digest(version db.TemplateVersion) string {
+	content, _ := json.Marshal(struct {
+		Name        string
+		Description string
+		Public      bool
+		Clauses     []db.TemplateVersionClause
+	}{version.Name, version.Description, version.Public, version.Clauses})
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Clauses returns the template clauses of a version, to instantiate them
+func Clauses(version db.TemplateVersion) []chaincode.TemplateClause {
+	var clauses []chaincode.TemplateClause
+	for _, clause := range version.Clauses {
+		optional := clause.Optional
+		var dependencies []chaincode.AssetRef
+		for _, key := range clause.Dependencies {
+			dependencies = append(dependencies, chaincode.AssetRef{AssetType: chaincode.AssetTypeTemplateClause, Key: key})
+		}
+		clauses = append(clauses, chaincode.TemplateClause{
+			Key:               clause.Key,
+			Id:                clause.Id,
+			Number:            clause.Number,
+			Name:              clause.Name,
+			Description:       clause.Description,
+			Category:          clause.Category,
+			ActionType:        chaincode.ActionType(clause.ActionType),
+			Dependencies:      dependencies,
+			DefaultInputs:     copyMap(clause.DefaultInputs),
+			DefaultParameters: copyMap(clause.DefaultParameters),
+			Optional:          &optional,
+		})
+	}
+	return clauses
+}
+
+// DiffVersions compares two versions of a template. Clauses are matched by
+// id and listed in the order of the target version, removed ones last.
+func DiffVersions(from, to db.TemplateVersion) Diff {
+	diff := Diff{
+		TemplateKey: to.TemplateKey,
+		From:        from.Version,
+		To:          to.Version,
+		Template:    []FieldChange{},
+		Clauses:     []ClauseDiff{},
+	}
+
+	diff.Template = compareFields(diff.Template, "name", from.Name, to.Name)
+	diff.Template = compareFields(diff.Template, "description", from.Description, to.Description)
+	diff.Template = compareFields(diff.Template, "public", from.Public, to.Public)
+
+	previous := map[string]db.TemplateVersionClause{}
+	for _, clause := range from.Clauses {
+		previous[clause.Id] = clause
+	}
+	current := map[string]bool{}
+
+	for _, clause := range to.Clauses {
+		current[clause.Id] = true
+		old, ok := previous[clause.Id]
+		if !ok {
+			diff.Clauses = append(diff.Clauses, ClauseDiff{Id: clause.Id, Change: ClauseAdded})
+			continue
+		}
+		if fields := diffClause(old, clause); len(fields) > 0 {
+			diff.Clauses = append(diff.Clauses, ClauseDiff{Id: clause.Id, Change: ClauseChanged, Fields: fields})
+		}
+	}
+
+	for _, clause := range from.Clauses {
+		if !current[clause.Id] {
+			diff.Clauses = append(diff.Clauses, ClauseDiff{Id: clause.Id, Change: ClauseRemoved})
+		}
+	}
+	return diff
+}
+
+func diffClause(from, to db.TemplateVersionClause) []FieldChange {
+	var fields []FieldChange
+	fields = compareFields(fields, "number", from.Number, to.Number)
+	fields = compareFields(fields, "name", from.Name, to.Name)
+	fields = compareFields(fields, "description", from.Description, to.Description)
+	fields = compareFields(fields, "category", from.Category, to.Category)
+	fields = compareFields(fields, "actionType", from.ActionType, to.ActionType)
+	fields = compareFields(fields, "optional", from.Optional, to.Optional)
+	fields = compareFields(fields, "dependencies", from.Dependencies, to.Dependencies)
+	fields = compareMaps(fields, "defaultInputs", from.DefaultInputs, to.DefaultInputs)
+	fields = compareMaps(fields, "defaultParameters", from.DefaultParameters, to.DefaultParameters)
+	return fields
+}
+
+func compareFields(fields []FieldChange, name string, from, to interface{}) []FieldChange {
+	if reflect.DeepEqual(from, to) {
+		return fields
+	}
+	return append(fields, FieldChange{Field: name, From: from, To: to})
+}
+
+func compareMaps(fields []FieldChange, name string, from, to map[string]interface{}) []FieldChange {
+	keys := sortedKeys(from)
+	for _, key := range sortedKeys(to) {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		_, before := from[key]
+		_, after := to[key]
+		if before != after && from[key] == nil && to[key] == nil {
+			// A parameter without default was declared or dropped
+			fields = append(fields, FieldChange{Field: name + "." + key})
+			continue
+		}
+		fields = compareFields(fields, name+"."+key, from[key], to[key])
+	}
+	return fields
+}
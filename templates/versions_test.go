@@ -0,0 +1,52 @@
+package templates
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/umairmaseed/clausia-api/chaincode"
+)
+
+func TestDiffVersions(t *testing.T) {
+	template := chaincode.Template{Key: "template:lease", Name: "Lease"}
+	from := Snapshot(template, leaseClauses())
+	from.Version = 1
+
+	clauses := leaseClauses()
+	clauses[1].DefaultParameters["amount"] = 1200.0
+	delete(clauses[1].DefaultParameters, "tenant")
+	clauses[0] = chaincode.TemplateClause{Id: "deposit", Number: 3, ActionType: chaincode.ActionGetCredit}
+	template.Public = true
+	to := Snapshot(template, clauses)
+	to.Version = 2
+
+	if from.Digest == to.Digest {
+		t.Fatal("expected the digest to change with the content")
+	}
+	if again := Snapshot(chaincode.Template{Key: "template:lease", Name: "Lease"}, leaseClauses()); again.Digest != from.Digest {
+		t.Fatal("expected the digest to only depend on the content")
+	}
+
+	diff := DiffVersions(from, to)
+	want := Diff{
+		TemplateKey: "template:lease",
+		From:        1,
+		To:          2,
+		Template:    []FieldChange{{Field: "public", From: false, To: true}},
+		Clauses: []ClauseDiff{
+			{Id: "rent", Change: ClauseChanged, Fields: []FieldChange{
+				{Field: "defaultParameters.amount", From: 1000.0, To: 1200.0},
+				{Field: "defaultParameters.tenant"},
+			}},
+			{Id: "deposit", Change: ClauseAdded},
+			{Id: "fine", Change: ClauseRemoved},
+		},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Fatalf("unexpected diff\n got %+v\nwant %+v", diff, want)
+	}
+
+	if diff := DiffVersions(to, to); len(diff.Template) != 0 || len(diff.Clauses) != 0 {
+		t.Fatalf("expected no difference, got %+v", diff)
+	}
+}
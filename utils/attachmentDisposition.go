@@ -0,0 +1,9 @@
+package utils
+
+import "mime"
+
+// AttachmentDisposition returns the Content-Disposition header of a download
+// saved as filename, quoting or encoding the name as it needs
+func AttachmentDisposition(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/storage"
+)
+
+// DownloadFile returns the contents of the blob addressed by uri. Legacy
+// s3:// URLs and bare keys are accepted too.
+func DownloadFile(ctx context.Context, uri string) ([]byte, error) {
+	key, err := storage.KeyFromURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	docBytes, err := storage.ReadAll(ctx, storage.Default(), key)
+	if err != nil {
+		logger.Error("Failed to download document", err)
+		return nil, err
+	}
+
+	return docBytes, nil
+}
@@ -1,28 +1,33 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/google/logger"
 	"github.com/umairmaseed/clausia-api/chaincode"
 )
 
-func SearchAndReturnSignerKey(email string) (string, error) {
+func SearchAndReturnSignerKey(ctx context.Context, email string) (string, error) {
 	queryMap := map[string]interface{}{
 		"@assetType": "user",
 		"email":      email,
 	}
 
-	signerAsset, err := chaincode.SearchAsset(queryMap)
+	signerAsset, err := chaincode.SearchAsset(ctx, queryMap)
 	if err != nil {
 		logger.Error(err)
 		return "", fmt.Errorf("failed to search for user: %w", err)
 	}
 
 	resultArray, ok := signerAsset["result"].([]interface{})
-	if !ok || len(resultArray) == 0 {
-		logger.Error("Signer asset result is empty or not in expected format")
-		return "", fmt.Errorf("signer asset result is empty or not in expected format")
+	if !ok {
+		logger.Error("Signer asset result is not in expected format")
+		return "", fmt.Errorf("signer asset result is not in expected format")
+	}
+	if len(resultArray) == 0 {
+		logger.Error("Signer asset result is empty")
+		return "", fmt.Errorf("signer asset result is empty: %w", chaincode.ErrNotFound)
 	}
 
 	firstResult := resultArray[0].(map[string]interface{})
@@ -17,9 +17,6 @@ func SendInviteEmail(to, msg string) error {
 		return fmt.Errorf("failed to find clausia email password")
 	}
 
-	fmt.Println("Sending email from: ", from)
-	fmt.Println("Sending email password: ", password)
-
 	smtpHost := os.Getenv("SMTP_HOST")
 	if smtpHost == "" {
 		return fmt.Errorf("failed to find smtp host")
@@ -0,0 +1,8 @@
+package utils
+
+import "context"
+
+// UploadCert stores a user's signing certificate and returns its blob URI
+func UploadCert(ctx context.Context, cert []byte, certName string) (string, error) {
+	return uploadBlob(ctx, "certificates/"+certName, cert)
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/google/logger"
+	"github.com/umairmaseed/clausia-api/storage"
+)
+
+// UploadFile stores an original document and returns its blob URI
+func UploadFile(ctx context.Context, file []byte, fileName string) (string, error) {
+	return uploadBlob(ctx, "documents/"+fileName, file)
+}
+
+func uploadBlob(ctx context.Context, key string, file []byte) (string, error) {
+	err := storage.Default().Put(ctx, key, bytes.NewReader(file))
+	if err != nil {
+		logger.Error(err)
+		return "", err
+	}
+
+	return storage.URI(key), nil
+}
@@ -0,0 +1,8 @@
+package utils
+
+import "context"
+
+// UploadReceipt stores a payment receipt and returns its blob URI
+func UploadReceipt(ctx context.Context, file []byte, fileName string) (string, error) {
+	return uploadBlob(ctx, "receipts/"+fileName, file)
+}
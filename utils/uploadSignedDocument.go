@@ -0,0 +1,8 @@
+package utils
+
+import "context"
+
+// UploadSignedDocument stores a signed document and returns its blob URI
+func UploadSignedDocument(ctx context.Context, file []byte, fileName string) (string, error) {
+	return uploadBlob(ctx, "sign-documents/"+fileName, file)
+}
@@ -67,7 +67,7 @@ func (server *WebSocketServer) ServeWebSocket(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	signerKey, err := utils.SearchAndReturnSignerKey(email)
+	signerKey, err := utils.SearchAndReturnSignerKey(r.Context(), email)
 	if err != nil {
 		logger.Error(err)
 		return